@@ -1,39 +1,355 @@
 package cmd
 
 import (
+	"flag"
 	"fmt"
-	"github.com/driusan/dgit/git"
 	"os"
+	"strings"
+
+	"github.com/driusan/dgit/git"
 )
 
-func Branch(c *git.Client, args []string) {
-	switch len(args) {
-	case 0:
-		branches, err := c.GetBranches()
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "Could not get list of branches.")
-			return
+func Branch(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("branch", flag.ExitOnError)
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(os.Stderr, "\nbranch options:\n\n")
+		flags.PrintDefaults()
+	}
+
+	opts := git.BranchOptions{}
+	del := flags.Bool("delete", false, "Delete a branch")
+	d := flags.Bool("d", false, "Alias of --delete")
+	D := flags.Bool("D", false, "Shortcut for --delete --force")
+	move := flags.Bool("move", false, "Move/rename a branch and its reflog")
+	m := flags.Bool("m", false, "Alias of --move")
+	M := flags.Bool("M", false, "Shortcut for --move --force")
+	copy := flags.Bool("copy", false, "Copy a branch and its reflog")
+	cp := flags.Bool("c", false, "Alias of --copy")
+	C := flags.Bool("C", false, "Shortcut for --copy --force")
+	flags.BoolVar(&opts.Force, "force", false, "Allow overwriting existing branches and deleting unmerged branches")
+	flags.BoolVar(&opts.Force, "f", false, "Alias of --force")
+	flags.BoolVar(&opts.Remotes, "remotes", false, "List or delete remote-tracking branches")
+	flags.BoolVar(&opts.Remotes, "r", false, "Alias of --remotes")
+	flags.BoolVar(&opts.All, "all", false, "List both local and remote-tracking branches")
+	flags.BoolVar(&opts.All, "a", false, "Alias of --all")
+	list := flags.Bool("list", false, "List branches matching the given patterns")
+	l := flags.Bool("l", false, "Alias of --list")
+	verbose := flags.Bool("verbose", false, "Show the commit and subject of each branch")
+	v := flags.Bool("v", false, "Alias of --verbose")
+	vv := flags.Bool("vv", false, "Also show the name of the upstream branch")
+	// The commit is optional for the filters, and defaults to HEAD.
+	contains := &optionalStringFlag{def: "HEAD"}
+	merged := &optionalStringFlag{def: "HEAD"}
+	noMerged := &optionalStringFlag{def: "HEAD"}
+	flags.Var(contains, "contains", "Only list branches which contain the given `commit`")
+	flags.Var(merged, "merged", "Only list branches whose tips are reachable from the given `commit`")
+	flags.Var(noMerged, "no-merged", "Only list branches whose tips are not reachable from the given `commit`")
+	setUpstream := flags.String("set-upstream-to", "", "Set up the branch to track the given upstream")
+	flags.StringVar(setUpstream, "u", "", "Alias of --set-upstream-to")
+	unsetUpstream := flags.Bool("unset-upstream", false, "Remove the upstream information of the branch")
+	flags.Parse(joinFilterArgs(args))
+
+	args = flags.Args()
+	switch {
+	case *del || *d || *D:
+		if *D {
+			opts.Force = true
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("fatal: branch name required")
 		}
-		head := c.GetHeadBranch()
-		for _, b := range branches {
-			if head == b {
-				fmt.Print("* ")
+		for _, name := range args {
+			id, err := git.BranchDelete(c, opts, name)
+			if err != nil {
+				return err
+			}
+			if opts.Remotes {
+				fmt.Printf("Deleted remote-tracking branch %s (was %s).\n", name, git.Sha1(id).Abbrev(c, 0))
 			} else {
-				fmt.Print("  ")
+				fmt.Printf("Deleted branch %s (was %s).\n", name, git.Sha1(id).Abbrev(c, 0))
+			}
+		}
+		return nil
+	case *move || *m || *M, *copy || *cp || *C:
+		if *M || *C {
+			opts.Force = true
+		}
+		var oldname, newname string
+		switch len(args) {
+		case 1:
+			newname = args[0]
+		case 2:
+			oldname, newname = args[0], args[1]
+		default:
+			flags.Usage()
+			return fmt.Errorf("Invalid usage")
+		}
+		if *move || *m || *M {
+			return git.BranchRename(c, opts, oldname, newname)
+		}
+		return git.BranchCopy(c, opts, oldname, newname)
+	case *setUpstream != "":
+		var name string
+		switch len(args) {
+		case 0:
+		case 1:
+			name = args[0]
+		default:
+			flags.Usage()
+			return fmt.Errorf("Invalid usage")
+		}
+		if name == "" {
+			name = c.GetHeadBranch().BranchName()
+		}
+		upstream, err := git.BranchSetUpstream(c, name, *setUpstream)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("branch '%s' set up to track '%s'.\n", name, upstream.ShortName())
+		return nil
+	case *unsetUpstream:
+		var name string
+		switch len(args) {
+		case 0:
+		case 1:
+			name = args[0]
+		default:
+			flags.Usage()
+			return fmt.Errorf("Invalid usage")
+		}
+		return git.BranchUnsetUpstream(c, name)
+	}
+
+	// If we get here, we're either listing or creating a branch.
+	if !*list && !*l && contains.value == "" && merged.value == "" && noMerged.value == "" &&
+		!opts.Remotes && !opts.All && !*verbose && !*v && !*vv && len(args) > 0 {
+		if len(args) > 2 {
+			flags.Usage()
+			return fmt.Errorf("Invalid usage")
+		}
+		var start string
+		if len(args) == 2 {
+			start = args[1]
+		}
+		return git.BranchCreate(c, opts, args[0], start)
+	}
+
+	for _, filter := range []struct {
+		val string
+		opt *git.Commitish
+	}{
+		{contains.value, &opts.Contains},
+		{merged.value, &opts.Merged},
+		{noMerged.value, &opts.NoMerged},
+	} {
+		if filter.val == "" {
+			continue
+		}
+		cmt, err := git.RevParseCommit(c, &git.RevParseOptions{}, filter.val)
+		if err != nil {
+			return fmt.Errorf("error: malformed object name %s", filter.val)
+		}
+		*filter.opt = cmt
+	}
+	branches, err := git.BranchList(c, opts, args)
+	if err != nil {
+		return err
+	}
+	verbosity := 0
+	if *verbose || *v {
+		verbosity = 1
+	}
+	if *vv {
+		verbosity = 2
+	}
+	return printBranches(c, opts, branches, verbosity)
+}
+
+// Joins the commit given to --contains, --merged or --no-merged as a
+// separate argument to the option, since the flag package can't tell
+// that it's the option's value when the value is optional. Like git, the
+// next argument is always the value unless the option is the last
+// argument.
+func joinFilterArgs(args []string) []string {
+	var joined []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(joined, args[i:]...)
+		}
+		switch strings.TrimLeft(arg, "-") {
+		case "contains", "merged", "no-merged":
+			if strings.HasPrefix(arg, "-") && i+1 < len(args) {
+				arg += "=" + args[i+1]
+				i++
+			}
+		}
+		joined = append(joined, arg)
+	}
+	return joined
+}
+
+// Prints the list of branches in the same format as git. verbosity is 1
+// for -v and 2 for -vv.
+func printBranches(c *git.Client, opts git.BranchOptions, branches []git.Branch, verbosity int) error {
+	type entry struct {
+		name, target string
+		branch       git.Branch
+		current      bool
+	}
+	var entries []entry
+
+	head := c.GetHeadBranch()
+	if head == "" && !opts.Remotes {
+		if name, ok := detachedName(c, opts); ok {
+			entries = append(entries, entry{name: name, branch: git.Branch("HEAD"), current: true})
+		}
+	}
+	width := 0
+	for _, b := range branches {
+		e := entry{branch: b, current: b == head}
+		if git.RefSpec(b).HasPrefix("refs/remotes/") {
+			e.name = strings.TrimPrefix(b.String(), "refs/remotes/")
+			if opts.All {
+				e.name = "remotes/" + e.name
+			}
+			if target, err := git.SymbolicRefGet(c, git.SymbolicRefOptions{}, git.SymbolicRef(b.String())); err == nil {
+				e.target = git.RefSpec(target).ShortName()
 			}
-			fmt.Println(b.BranchName())
+		} else {
+			e.name = b.BranchName()
 		}
-	case 1:
-		headref, err := git.SymbolicRefGet(c, git.SymbolicRefOptions{}, "HEAD")
+		entries = append(entries, e)
+	}
+	for _, e := range entries {
+		if len(e.name) > width {
+			width = len(e.name)
+		}
+	}
+
+	for _, e := range entries {
+		prefix := "  "
+		if e.current {
+			prefix = "* "
+		}
+		if e.target != "" {
+			fmt.Printf("%s%s -> %s\n", prefix, e.name, e.target)
+			continue
+		}
+		if verbosity == 0 {
+			fmt.Printf("%s%s\n", prefix, e.name)
+			continue
+		}
+		id, err := e.branch.CommitID(c)
 		if err != nil {
-			return
+			return err
+		}
+		info, err := git.FormatRef(c, git.Ref{Name: git.RefSpec(e.branch), Value: git.Sha1(id)}, "%(objectname:short) %(contents:subject)")
+		if err != nil {
+			return err
+		}
+		if track := trackingInfo(c, e.branch, verbosity); track != "" {
+			sp := strings.IndexByte(info, ' ')
+			info = info[:sp] + " " + track + info[sp:]
+		}
+		fmt.Printf("%s%-*s %s\n", prefix, width, e.name, info)
+	}
+	return nil
+}
+
+// Returns the name to display for a detached HEAD, based on the last
+// checkout recorded in the HEAD reflog. It returns false if HEAD is
+// excluded by the filters in opts.
+func detachedName(c *git.Client, opts git.BranchOptions) (string, bool) {
+	id, err := git.RevParseCommit(c, &git.RevParseOptions{}, "HEAD")
+	if err != nil {
+		return "", false
+	}
+	reachable := func(from git.Commitish) bool {
+		cmt, err := from.CommitID(c)
+		return err == nil && (cmt == id || id.IsAncestor(c, cmt))
+	}
+	if opts.Contains != nil {
+		if cmt, err := opts.Contains.CommitID(c); err != nil || (cmt != id && !cmt.IsAncestor(c, id)) {
+			return "", false
 		}
-		b := git.Branch(headref)
-		if err := c.CreateBranch(args[0], b); err != nil {
-			fmt.Fprintf(os.Stderr, "Could not create branch (%v): %v\n", args[0], err)
+	}
+	if opts.Merged != nil && !reachable(opts.Merged) {
+		return "", false
+	}
+	if opts.NoMerged != nil && reachable(opts.NoMerged) {
+		return "", false
+	}
+	return "(" + detachedHead(c, id) + ")", true
+}
+
+// Returns the description of a detached HEAD pointing at id, such as
+// "HEAD detached at v1.0", based on the last checkout recorded in the
+// HEAD reflog.
+func detachedHead(c *git.Client, id git.CommitID) string {
+	if git.ReflogExists(c, "HEAD") {
+		log, err := c.ReadReflog("HEAD")
+		if err == nil {
+			for i := len(log) - 1; i >= 0; i-- {
+				msg := log[i].Message
+				if !strings.HasPrefix(msg, "checkout: moving from ") {
+					continue
+				}
+				// Like git, describe the checkout target by its ref
+				// name if it was one, and otherwise by the commit
+				// that was checked out.
+				to := log[i].New.Abbrev(c, 0)
+				if idx := strings.LastIndex(msg, " to "); idx >= 0 {
+					if fields := strings.Fields(msg[idx+4:]); len(fields) > 0 {
+						if ref, err := c.DwimRef(fields[0]); err == nil {
+							to = c.ShortenRef(ref)
+						}
+					}
+				}
+				if git.CommitID(log[i].New) == id {
+					return "HEAD detached at " + to
+				}
+				return "HEAD detached from " + to
+			}
 		}
-	default:
-		fmt.Fprintln(os.Stderr, "Usage: go-git branch [branchname]")
 	}
+	return "HEAD detached at " + git.Sha1(id).Abbrev(c, 0)
+}
 
+// Returns the "[upstream: ahead n, behind m]" annotation for b. With
+// verbosity 1 the upstream name is omitted, and nothing is shown if the
+// branch is up to date.
+func trackingInfo(c *git.Client, b git.Branch, verbosity int) string {
+	upstream := b.Upstream(c)
+	if upstream == "" {
+		return ""
+	}
+	var status string
+	if !upstream.Exists(c) {
+		status = "gone"
+	} else {
+		ahead, behind, err := git.AheadBehind(c, b, upstream)
+		if err != nil {
+			return ""
+		}
+		switch {
+		case ahead > 0 && behind > 0:
+			status = fmt.Sprintf("ahead %d, behind %d", ahead, behind)
+		case ahead > 0:
+			status = fmt.Sprintf("ahead %d", ahead)
+		case behind > 0:
+			status = fmt.Sprintf("behind %d", behind)
+		}
+	}
+	if verbosity < 2 {
+		if status == "" {
+			return ""
+		}
+		return "[" + status + "]"
+	}
+	if status == "" {
+		return "[" + upstream.ShortName() + "]"
+	}
+	return "[" + upstream.ShortName() + ": " + status + "]"
 }
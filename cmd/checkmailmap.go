@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/driusan/dgit/git"
+)
+
+// Implements "git check-mailmap", which shows the canonical name and email
+// for each contact according to the mailmap.
+func CheckMailmap(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("check-mailmap", flag.ExitOnError)
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(os.Stderr, "\ncheck-mailmap options:\n\n")
+		flags.PrintDefaults()
+	}
+	stdin := flags.Bool("stdin", false, "Also read contacts from stdin, one per line")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 && !*stdin {
+		return fmt.Errorf("no contacts specified")
+	}
+	mailmap, err := git.ReadMailmap(c)
+	if err != nil {
+		return err
+	}
+	check := func(contact string) error {
+		mapped, err := mailmap.MapContact(contact)
+		if err != nil {
+			return err
+		}
+		fmt.Println(mapped)
+		return nil
+	}
+	for _, contact := range flags.Args() {
+		if err := check(contact); err != nil {
+			return err
+		}
+	}
+	if !*stdin {
+		return nil
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if err := check(scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
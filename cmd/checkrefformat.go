@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/driusan/dgit/git"
+)
+
+var InvalidRefFormat error = errors.New("Invalid ref format")
+
+func CheckRefFormat(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("check-ref-format", flag.ExitOnError)
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(os.Stderr, "\ncheck-ref-format options:\n\n")
+		flags.PrintDefaults()
+	}
+
+	opts := git.CheckRefFormatOptions{}
+	branch := flags.Bool("branch", false, "Check that the name is a valid branch name, expanding @{-n} syntax")
+	flags.BoolVar(&opts.Normalize, "normalize", false, "Normalize the name and print it if it's valid")
+	flags.BoolVar(&opts.AllowOnelevel, "allow-onelevel", false, "Allow names with only one component")
+	noOnelevel := flags.Bool("no-allow-onelevel", false, "Do not allow names with only one component (default)")
+	flags.BoolVar(&opts.RefspecPattern, "refspec-pattern", false, "Allow a single '*' in the name")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("Invalid usage")
+	}
+	if *noOnelevel {
+		opts.AllowOnelevel = false
+	}
+
+	if *branch {
+		name, err := git.CheckBranchName(c, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		fmt.Println(name)
+		return nil
+	}
+
+	name, err := git.CheckRefFormat(opts, flags.Arg(0))
+	if err != nil {
+		return InvalidRefFormat
+	}
+	if opts.Normalize {
+		fmt.Println(name)
+	}
+	return nil
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
 	"strings"
 
@@ -44,37 +43,29 @@ func Clone(c *git.Client, args []string) error {
 
 	c = Init(c, []string{dirName})
 
-	Config(c, []string{"--set", "remote.origin.url", repoid})
+	if err := git.RemoteAdd(c, git.RemoteAddOptions{}, "origin", repoid); err != nil {
+		return err
+	}
 	Config(c, []string{"--set", "branch.master.remote", "origin"})
 
 	// This should be smarter and try and get the HEAD branch from Fetch.
 	// The HEAD refspec isn't necessarily named refs/heads/master.
 	Config(c, []string{"--set", "branch.master.merge", "refs/heads/master"})
 
-	Fetch(c, []string{"origin"})
-
-	// Create an empty reflog for HEAD, since this is an initial clone, and then
-	// point HEAD at refs/heads/master
-	if err := os.MkdirAll(c.GitDir.File("logs").String(), 0755); err != nil {
-		return err
-	}
-	if err := ioutil.WriteFile(c.GitDir.File("logs/HEAD").String(), []byte{}, 0644); err != nil {
+	if err := Fetch(c, []string{"origin"}); err != nil {
 		return err
 	}
+
 	// The references were unpacked into refs/remotes/origin/, there's
-	// still no master branch set up, so copy refs/remotes/origin/master
-	// into refs/heads/master before doing a reset.
-	remoteMaster, err := ioutil.ReadFile(c.GitDir.File("refs/remotes/origin/master").String())
+	// still no master branch set up, so create refs/heads/master from
+	// refs/remotes/origin/master before doing a reset. HEAD already points to
+	// refs/heads/master, so updating it through HEAD creates the reflogs
+	// for both of them.
+	remoteMaster, err := git.RefSpec("refs/remotes/origin/master").CommitID(c)
 	if err != nil {
 		return err
 	}
-	if err := ioutil.WriteFile(c.GitDir.File("refs/heads/master").String(), remoteMaster, 0644); err != nil {
-		return err
-	}
-
-	// This needs to be done after writing the above, or updateRefLog will
-	// complain that refs/heads/master doesn't exist.
-	if err := git.SymbolicRefUpdate(c, git.SymbolicRefOptions{}, "HEAD", "refs/heads/master", "clone: "+args[0]); err != nil {
+	if err := git.UpdateRef(c, git.UpdateRefOptions{}, "HEAD", remoteMaster, "clone: from "+repoid); err != nil {
 		return err
 	}
 
@@ -59,7 +59,10 @@ func Commit(c *git.Client, args []string) (string, error) {
 
 	oldHead, err := c.GetHeadCommit()
 	if err != nil {
-		return "", err
+		// There's no commit yet, so this is the initial commit and
+		// HEAD's branch must still not exist when it's updated.
+		refmsg = fmt.Sprintf("commit (initial): %s (go-git)", msg)
+		oldHead = git.CommitID{}
 	}
 	err = git.UpdateRef(c, git.UpdateRefOptions{OldValue: oldHead, CreateReflog: true}, "HEAD", commitSha1, refmsg)
 	return commitSha1.String(), err
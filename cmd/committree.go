@@ -80,7 +80,10 @@ func CommitTree(c *git.Client, args []string) (git.CommitID, error) {
 	}
 
 	now := time.Now()
-	author := c.GetAuthor(&now)
+	author, err := c.GetAuthor(&now)
+	if err != nil {
+		return git.CommitID{}, err
+	}
 	fmt.Fprintf(content, "author %s\n", author)
 	fmt.Fprintf(content, "committer %s\n", author)
 	fmt.Fprintf(content, "%s", messageString)
@@ -4,6 +4,9 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/driusan/dgit/git"
 )
@@ -69,3 +72,599 @@ func printDiffs(c *git.Client, options git.DiffCommonOptions, diffs []git.HashDi
 	}
 
 }
+
+// The formats that the changes made by a commit can be shown in by log.
+type changeFormat struct {
+	Patch, Stat, NameOnly, NameStatus bool
+}
+
+// Returns true if any of the formats are enabled.
+func (f changeFormat) any() bool {
+	return f.Patch || f.Stat || f.NameOnly || f.NameStatus
+}
+
+// Checks that at most one of the formats which list the names of the
+// files, and -s (which is given by noOutput), is used. Like git, they
+// replace the other formats.
+func (f *changeFormat) checkExclusive(noOutput bool) error {
+	exclusive := 0
+	for _, set := range []bool{f.NameOnly, f.NameStatus, noOutput} {
+		if set {
+			exclusive++
+		}
+	}
+	if exclusive > 1 {
+		return fmt.Errorf("options '--name-only', '--name-status', '--check', and '-s' cannot be used together")
+	}
+	if exclusive > 0 {
+		f.Stat, f.Patch = false, false
+	}
+	return nil
+}
+
+// Returns the changes made by cmt compared to parent, with renames
+// detected. If parent is nil, cmt is treated as a root commit. Only the
+// changes under paths are returned, if there are any.
+func commitChanges(c *git.Client, parent, cmt git.Treeish, paths []git.IndexPath) ([]git.FileChange, error) {
+	var limit []string
+	for _, p := range paths {
+		limit = append(limit, p.String())
+	}
+	var diffs []git.HashDiff
+	var err error
+	if parent == nil {
+		diffs, err = git.DiffTree(c, &git.DiffTreeOptions{Recurse: true}, nil, cmt, limit)
+	} else {
+		diffs, err = git.DiffTree(c, &git.DiffTreeOptions{Recurse: true}, parent, cmt, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return git.DetectRenames(c, diffs)
+}
+
+// The patch for a single file, in git's format.
+type filePatch struct {
+	change git.FileChange
+
+	// The extended header lines after "diff --git", and the hunks of
+	// the diff (including the "---" and "+++" lines.)
+	header, hunks []string
+
+	binary         bool
+	added, deleted int
+}
+
+// Returns the content of the object in a tree entry as it's compared by
+// diff. Submodules are compared by the commit that they refer to.
+func entryContent(c *git.Client, e git.TreeEntry) ([]byte, error) {
+	switch {
+	case e.Sha1 == (git.Sha1{}):
+		return nil, nil
+	case e.FileMode == git.ModeCommit:
+		return []byte(fmt.Sprintf("Subproject commit %s\n", e.Sha1)), nil
+	}
+	obj, err := c.GetObject(e.Sha1)
+	if err != nil {
+		return nil, err
+	}
+	return obj.GetContent(), nil
+}
+
+// Returns the function name to show in a hunk header, the same way as
+// git's default, which is the last line before the hunk which starts with
+// a letter, "_" or "$", searching back as far as the previous hunk.
+func hunkFunction(lines []string, start, limit int, prev string) string {
+	for i := start; i > limit && i >= 0; i-- {
+		if i >= len(lines) {
+			continue
+		}
+		l := lines[i]
+		if l == "" || !(l[0] == '_' || l[0] == '$' || (l[0] >= 'a' && l[0] <= 'z') || (l[0] >= 'A' && l[0] <= 'Z')) {
+			continue
+		}
+		if len(l) > 80 {
+			l = l[:80]
+		}
+		return strings.TrimRight(l, " \t\r\n\v\f")
+	}
+	return prev
+}
+
+// Generates the patch for change, and counts the lines that it adds and
+// deletes (or the sizes of the files, for binary files.)
+func diffFile(c *git.Client, change git.FileChange) (*filePatch, error) {
+	p := &filePatch{change: change}
+	src, dst := change.Src, change.Dst
+	oldName, newName := change.Name, change.Name
+	if change.OldName != "" {
+		oldName = change.OldName
+	}
+	abbrev := func(id git.Sha1) string {
+		return id.Abbrev(c, 0)
+	}
+
+	switch {
+	case src.FileMode == 0:
+		p.header = append(p.header, fmt.Sprintf("new file mode %06o", dst.FileMode))
+	case dst.FileMode == 0:
+		p.header = append(p.header, fmt.Sprintf("deleted file mode %06o", src.FileMode))
+	case src.FileMode != dst.FileMode:
+		p.header = append(p.header, fmt.Sprintf("old mode %06o", src.FileMode), fmt.Sprintf("new mode %06o", dst.FileMode))
+	}
+	if change.OldName != "" {
+		p.header = append(p.header,
+			fmt.Sprintf("similarity index %d%%", change.Similarity),
+			"rename from "+oldName.String(),
+			"rename to "+newName.String(),
+		)
+	}
+	if src.Sha1 != dst.Sha1 {
+		index := fmt.Sprintf("index %s..%s", abbrev(src.Sha1), abbrev(dst.Sha1))
+		if src.FileMode == dst.FileMode {
+			index += fmt.Sprintf(" %06o", src.FileMode)
+		}
+		p.header = append(p.header, index)
+	}
+	if src.Sha1 == dst.Sha1 {
+		return p, nil
+	}
+
+	old, err := entryContent(c, src)
+	if err != nil {
+		return nil, err
+	}
+	new, err := entryContent(c, dst)
+	if err != nil {
+		return nil, err
+	}
+	labels := []string{"/dev/null", "/dev/null"}
+	if src.FileMode != 0 {
+		labels[0] = "a/" + oldName.String()
+	}
+	if dst.FileMode != 0 {
+		labels[1] = "b/" + newName.String()
+	}
+	if git.IsBinary(old) || git.IsBinary(new) {
+		p.binary = true
+		p.added, p.deleted = len(new), len(old)
+		p.hunks = []string{fmt.Sprintf("Binary files %s and %s differ", labels[0], labels[1])}
+		return p, nil
+	}
+
+	var out string
+	if src.FileMode == git.ModeCommit || dst.FileMode == git.ModeCommit {
+		// Submodules aren't in the object database, so the diff is
+		// always the one line.
+		switch {
+		case src.FileMode == 0:
+			out = "@@ -0,0 +1 @@\n+" + string(new)
+		case dst.FileMode == 0:
+			out = "@@ -1 +0,0 @@\n-" + string(old)
+		default:
+			out = "@@ -1 +1 @@\n-" + string(old) + "+" + string(new)
+		}
+	} else {
+		patch, err := change.ExternalDiff(c, src, dst, git.File(newName), git.DiffCommonOptions{NumContextLines: 3})
+		if err != nil {
+			return nil, err
+		}
+		// Skip the "---" and "+++" lines, which have the labels
+		// of the temporary files.
+		if lines := strings.SplitN(patch, "\n", 3); len(lines) == 3 {
+			out = lines[2]
+		}
+	}
+	if out == "" {
+		return p, nil
+	}
+	for i, name := range labels {
+		// Like git, names with spaces have a tab after them.
+		if strings.Contains(name, " ") {
+			labels[i] += "\t"
+		}
+	}
+	p.hunks = append(p.hunks, "--- "+labels[0], "+++ "+labels[1])
+
+	oldLines := strings.SplitAfter(string(old), "\n")
+	function, limit := "", -1
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "@@ "):
+			// The hunk starts at line s, or after line s if it
+			// doesn't have any lines from the old file.
+			var s, n int
+			if _, err := fmt.Sscanf(line, "@@ -%d,%d", &s, &n); err != nil {
+				n = 1
+			}
+			if n > 0 {
+				s--
+			}
+			function = hunkFunction(oldLines, s-1, limit, function)
+			limit = s - 1
+			if function != "" {
+				line += " " + function
+			}
+		case strings.HasPrefix(line, "+"):
+			p.added++
+		case strings.HasPrefix(line, "-"):
+			p.deleted++
+		}
+		p.hunks = append(p.hunks, line)
+	}
+	return p, nil
+}
+
+// Returns the name of a renamed file as shown by --stat, with the parts
+// of the names which are the same only shown once, such as "a/{b => c}".
+func renameName(a, b string) string {
+	pfx := 0
+	for i := 0; i < len(a) && i < len(b) && a[i] == b[i]; i++ {
+		if a[i] == '/' {
+			pfx = i + 1
+		}
+	}
+	sfx := 0
+	adjust := 0
+	if pfx > 0 {
+		adjust = 1
+	}
+	for i, j := len(a), len(b); i >= pfx-adjust && j >= pfx-adjust; i, j = i-1, j-1 {
+		// The ends of the strings are treated as matching.
+		var ach, bch byte
+		if i < len(a) {
+			ach = a[i]
+		}
+		if j < len(b) {
+			bch = b[j]
+		}
+		if ach != bch {
+			break
+		}
+		if ach == '/' {
+			sfx = len(a) - i
+		}
+	}
+	amid, bmid := len(a)-pfx-sfx, len(b)-pfx-sfx
+	if amid < 0 {
+		amid = 0
+	}
+	if bmid < 0 {
+		bmid = 0
+	}
+	if pfx+sfx == 0 {
+		return a[pfx:pfx+amid] + " => " + b[pfx:pfx+bmid]
+	}
+	return a[:pfx] + "{" + a[pfx:pfx+amid] + " => " + b[pfx:pfx+bmid] + "}" + a[len(a)-sfx:]
+}
+
+// Returns the lines of the --stat output for the patches, for output
+// which is width columns wide.
+func diffStat(patches []*filePatch, width int) []string {
+	var maxLen, maxChange, numberWidth, binWidth int
+	names := make([]string, len(patches))
+	for i, p := range patches {
+		names[i] = p.change.Name.String()
+		if p.change.OldName != "" {
+			names[i] = renameName(p.change.OldName.String(), names[i])
+		}
+		if len(names[i]) > maxLen {
+			maxLen = len(names[i])
+		}
+		if p.binary {
+			if w := 14 + len(strconv.Itoa(p.added)) + len(strconv.Itoa(p.deleted)); w > binWidth {
+				binWidth = w
+			}
+			numberWidth = 3
+			continue
+		}
+		if change := p.added + p.deleted; change > maxChange {
+			maxChange = change
+		}
+	}
+	if w := len(strconv.Itoa(maxChange)); w > numberWidth {
+		numberWidth = w
+	}
+
+	// This is the same layout as git's, where the name takes up to
+	// 5/8 of the width if there isn't enough room.
+	if width < 16+6+numberWidth {
+		width = 16 + 6 + numberWidth
+	}
+	graphWidth := maxChange
+	if maxChange+4 <= binWidth {
+		graphWidth = binWidth - 4
+	}
+	nameWidth := maxLen
+	if nameWidth+numberWidth+6+graphWidth > width {
+		if graphWidth > width*3/8-numberWidth-6 {
+			graphWidth = width*3/8 - numberWidth - 6
+			if graphWidth < 6 {
+				graphWidth = 6
+			}
+		}
+		if nameWidth > width-numberWidth-6-graphWidth {
+			nameWidth = width - numberWidth - 6 - graphWidth
+		} else {
+			graphWidth = width - numberWidth - 6 - nameWidth
+		}
+	}
+	scale := func(n int) int {
+		if n == 0 {
+			return 0
+		}
+		return 1 + n*(graphWidth-1)/maxChange
+	}
+
+	var lines []string
+	var adds, dels int
+	for i, p := range patches {
+		name, prefix := names[i], ""
+		if len(name) > nameWidth {
+			prefix = "..."
+			n := nameWidth - 3
+			if n < 0 {
+				n = 0
+			}
+			name = name[len(name)-n:]
+			if slash := strings.IndexByte(name, '/'); slash >= 0 {
+				name = name[slash:]
+			}
+		}
+		padding := nameWidth - len(prefix) - len(name)
+		if padding < 0 {
+			padding = 0
+		}
+		line := fmt.Sprintf(" %s%s%s | ", prefix, name, strings.Repeat(" ", padding))
+		if p.binary {
+			line += fmt.Sprintf("%*s", numberWidth, "Bin")
+			if p.added != 0 || p.deleted != 0 {
+				line += fmt.Sprintf(" %d -> %d bytes", p.deleted, p.added)
+			}
+			lines = append(lines, line)
+			continue
+		}
+		adds += p.added
+		dels += p.deleted
+		add, del := p.added, p.deleted
+		if graphWidth <= maxChange {
+			total := scale(add + del)
+			if total < 2 && add > 0 && del > 0 {
+				total = 2
+			}
+			if add < del {
+				add = scale(add)
+				del = total - add
+			} else {
+				del = scale(del)
+				add = total - del
+			}
+		}
+		line += fmt.Sprintf("%*d", numberWidth, p.added+p.deleted)
+		if p.added+p.deleted > 0 {
+			line += " "
+		}
+		lines = append(lines, line+strings.Repeat("+", add)+strings.Repeat("-", del))
+	}
+
+	plural := func(n int, one, many string) string {
+		if n == 1 {
+			return fmt.Sprintf(one, n)
+		}
+		return fmt.Sprintf(many, n)
+	}
+	summary := plural(len(patches), " %d file changed", " %d files changed")
+	if adds > 0 || dels == 0 {
+		summary += plural(adds, ", %d insertion(+)", ", %d insertions(+)")
+	}
+	if dels > 0 || adds == 0 {
+		summary += plural(dels, ", %d deletion(-)", ", %d deletions(-)")
+	}
+	return append(lines, summary)
+}
+
+// Returns the width of the terminal for --stat, which is 80 columns
+// unless $COLUMNS says otherwise.
+func statWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return 80
+}
+
+// Prints the changes in the formats that are enabled in format, in the
+// same order as git. prefix is called for every line of output, to get
+// the graph to show before it.
+func printChanges(c *git.Client, format changeFormat, changes []git.FileChange, prefix func() string) error {
+	separator := false
+	if format.NameOnly || format.NameStatus {
+		for _, change := range changes {
+			switch {
+			case format.NameOnly:
+				fmt.Printf("%s%s\n", prefix(), change.Name)
+			case change.OldName != "":
+				fmt.Printf("%s%s%03d\t%s\t%s\n", prefix(), change.Status(), change.Similarity, change.OldName, change.Name)
+			default:
+				fmt.Printf("%s%s\t%s\n", prefix(), change.Status(), change.Name)
+			}
+		}
+		separator = true
+	}
+	if !format.Stat && !format.Patch {
+		return nil
+	}
+
+	var patches []*filePatch
+	for _, change := range changes {
+		if change.Status() == "T" {
+			// Like git, changes between different types of files
+			// are shown as a deletion and an addition.
+			del, add := change, change
+			del.Dst, add.Src = git.TreeEntry{}, git.TreeEntry{}
+			for _, ch := range []git.FileChange{del, add} {
+				p, err := diffFile(c, ch)
+				if err != nil {
+					return err
+				}
+				patches = append(patches, p)
+			}
+			continue
+		}
+		p, err := diffFile(c, change)
+		if err != nil {
+			return err
+		}
+		patches = append(patches, p)
+	}
+
+	if format.Stat && len(patches) > 0 {
+		for _, line := range diffStat(patches, statWidth()-len(prefix())) {
+			fmt.Printf("%s%s\n", prefix(), line)
+		}
+		separator = true
+	}
+	if !format.Patch {
+		return nil
+	}
+	if separator && len(patches) > 0 {
+		fmt.Println(prefix())
+	}
+	for _, p := range patches {
+		oldName := p.change.Name
+		if p.change.OldName != "" {
+			oldName = p.change.OldName
+		}
+		fmt.Printf("%sdiff --git a/%s b/%s\n", prefix(), oldName, p.change.Name)
+		for _, line := range p.header {
+			fmt.Printf("%s%s\n", prefix(), line)
+		}
+		for _, line := range p.hunks {
+			fmt.Printf("%s%s\n", prefix(), line)
+		}
+	}
+	return nil
+}
+
+// Returns the lines of the combined diff for a file in a merge, in the
+// same format as git's --cc, or nil if there's nothing to show because
+// the merge only took one of the parents' changes.
+func combinedPatch(c *git.Client, change git.CombinedChange) ([]string, error) {
+	result, err := entryContent(c, change.Result)
+	if err != nil {
+		return nil, err
+	}
+	binary := git.IsBinary(result)
+	var parents [][]byte
+	var ids, modes []string
+	added, modeDiffers := true, false
+	for _, p := range change.Parents {
+		content, err := entryContent(c, p)
+		if err != nil {
+			return nil, err
+		}
+		binary = binary || git.IsBinary(content)
+		parents = append(parents, content)
+		ids = append(ids, p.Sha1.Abbrev(c, 0))
+		modes = append(modes, fmt.Sprintf("%06o", p.FileMode))
+		if p.FileMode != 0 {
+			added = false
+		}
+		if p.FileMode != change.Result.FileMode {
+			modeDiffers = true
+		}
+	}
+	deleted := change.Result.FileMode == 0
+
+	var hunks []string
+	if !binary {
+		if hunks, err = git.CombinedDiff(result, parents, 3); err != nil {
+			return nil, err
+		}
+	}
+	if !binary && len(hunks) == 0 && !modeDiffers {
+		return nil, nil
+	}
+
+	lines := []string{
+		"diff --cc " + change.Name.String(),
+		fmt.Sprintf("index %s..%s", strings.Join(ids, ","), change.Result.Sha1.Abbrev(c, 0)),
+	}
+	if modeDiffers {
+		switch {
+		case deleted:
+			lines = append(lines, "deleted file mode "+strings.Join(modes, ","))
+		case added:
+			lines = append(lines, fmt.Sprintf("new file mode %06o", change.Result.FileMode))
+		default:
+			lines = append(lines, fmt.Sprintf("mode %s..%06o", strings.Join(modes, ","), change.Result.FileMode))
+		}
+	}
+	if binary {
+		return append(lines, "Binary files differ"), nil
+	}
+	oldName, newName := "a/"+change.Name.String(), "b/"+change.Name.String()
+	if modeDiffers && added {
+		oldName = "/dev/null"
+	}
+	if deleted {
+		newName = "/dev/null"
+	}
+	lines = append(lines, "--- "+oldName, "+++ "+newName)
+	return append(lines, hunks...), nil
+}
+
+// Prints the changes made by a merge compared to all of its parents at
+// once, in the formats that are enabled in format. Like git, the --stat
+// output is against the first parent, since there isn't a combined
+// version of it.
+func printCombinedChanges(c *git.Client, format changeFormat, parents []git.CommitID, merge git.CommitID, paths []git.IndexPath, prefix func() string) error {
+	if format.Stat {
+		changes, err := commitChanges(c, parents[0], merge, paths)
+		if err != nil {
+			return err
+		}
+		if err := printChanges(c, changeFormat{Stat: true}, changes, prefix); err != nil {
+			return err
+		}
+	}
+
+	var limit []string
+	for _, p := range paths {
+		limit = append(limit, p.String())
+	}
+	trees := make([]git.Treeish, len(parents))
+	for i, p := range parents {
+		trees[i] = p
+	}
+	changes, err := git.CombinedChanges(c, trees, merge, limit)
+	if err != nil || len(changes) == 0 {
+		return err
+	}
+	separator := format.Stat
+	if format.NameOnly || format.NameStatus {
+		for _, change := range changes {
+			if format.NameOnly {
+				fmt.Printf("%s%s\n", prefix(), change.Name)
+			} else {
+				fmt.Printf("%s%s\t%s\n", prefix(), change.Status(), change.Name)
+			}
+		}
+		separator = true
+	}
+	if !format.Patch {
+		return nil
+	}
+	if separator {
+		fmt.Println(prefix())
+	}
+	for _, change := range changes {
+		lines, err := combinedPatch(c, change)
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			fmt.Printf("%s%s\n", prefix(), line)
+		}
+	}
+	return nil
+}
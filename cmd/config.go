@@ -57,8 +57,12 @@ func Config(c *git.Client, args []string) {
 			return
 		}
 
+		if err := config.SetConfig(args[0], args[1]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
 		file.Seek(0, 0)
-		config.SetConfig(args[0], args[1])
+		file.Truncate(0)
 		config.WriteFile(file)
 		return
 	}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/driusan/dgit/git"
+)
+
+// An optionalStringFlag is a flag.Value for flags which may be given
+// with or without a value, such as --dirty[=<mark>]. Without a value,
+// the flag is set to its default.
+type optionalStringFlag struct {
+	value, def string
+}
+
+func (f *optionalStringFlag) String() string   { return f.value }
+func (f *optionalStringFlag) IsBoolFlag() bool { return true }
+
+func (f *optionalStringFlag) Set(s string) error {
+	// The flag package passes "true" for boolean flags given without
+	// a value.
+	if s == "true" {
+		s = f.def
+	}
+	f.value = s
+	return nil
+}
+
+func Describe(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("describe", flag.ExitOnError)
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(os.Stderr, "\ndescribe options:\n\n")
+		flags.PrintDefaults()
+	}
+
+	opts := git.DescribeOptions{}
+	flags.BoolVar(&opts.All, "all", false, "Use any ref to describe commits")
+	flags.BoolVar(&opts.Tags, "tags", false, "Use any tag, including lightweight tags")
+	flags.BoolVar(&opts.Contains, "contains", false, "Find the tag that comes after the commit")
+	flags.BoolVar(&opts.Long, "long", false, "Always use the long format")
+	flags.BoolVar(&opts.Always, "always", false, "Show the abbreviated commit id as a fallback")
+	flags.BoolVar(&opts.FirstParent, "first-parent", false, "Only follow the first parent of merge commits")
+	flags.BoolVar(&opts.ExactMatch, "exact-match", false, "Only output exact matches")
+	abbrev := flags.Int("abbrev", -1, "Use at least `n` digits for the abbreviated commit id, or 0 to omit it")
+	candidates := flags.Int("candidates", 10, "Consider up to `n` candidate tags")
+	dirty := &optionalStringFlag{def: "-dirty"}
+	flags.Var(dirty, "dirty", "Describe HEAD, and append `mark` if the work tree is modified")
+	match := &multiStringFlag{}
+	flags.Var(match, "match", "Only consider tags matching `pattern`. May be given multiple times")
+	exclude := &multiStringFlag{}
+	flags.Var(exclude, "exclude", "Do not consider tags matching `pattern`. May be given multiple times")
+	flags.Parse(args)
+
+	switch {
+	case *abbrev < 0:
+		opts.Abbrev = 0
+	case *abbrev == 0:
+		opts.Abbrev = -1
+	case *abbrev < 4:
+		opts.Abbrev = 4
+	default:
+		opts.Abbrev = *abbrev
+	}
+	if *candidates <= 0 {
+		opts.ExactMatch = true
+	}
+	opts.Candidates = *candidates
+	opts.Dirty = dirty.value
+	opts.Match = *match
+	opts.Exclude = *exclude
+
+	descriptions, err := git.Describe(c, opts, flags.Args())
+	for _, d := range descriptions {
+		fmt.Println(d)
+	}
+	return err
+}
@@ -2,66 +2,66 @@ package cmd
 
 import (
 	"fmt"
-	"io/ioutil"
-	"os"
 	"strings"
 
 	"github.com/driusan/dgit/git"
 )
 
-func Fetch(c *git.Client, args []string) {
+func Fetch(c *git.Client, args []string) error {
 	if len(args) < 1 {
-		fmt.Fprintf(os.Stderr, "Missing repository to fetch")
-		return
+		return fmt.Errorf("Missing repository to fetch")
 	}
 
 	file, err := c.GitDir.Open("config")
 	if err != nil {
-		panic("Couldn't open config\n")
+		return fmt.Errorf("Couldn't open config")
 	}
 	defer file.Close()
 	config := git.ParseConfig(file)
 	repoid := config.GetConfig("remote." + args[0] + ".url")
+	if repoid == "" {
+		return fmt.Errorf("'%s' does not appear to be a git repository", args[0])
+	}
 	var ups git.Uploadpack
-	if repoid[0:7] == "http://" || repoid[0:8] == "https://" {
+	if strings.HasPrefix(repoid, "http://") || strings.HasPrefix(repoid, "https://") {
 		ups = &git.SmartHTTPServerRetriever{Location: repoid,
 			C: c,
 		}
 	} else {
-		fmt.Fprintln(os.Stderr, "Unknown protocol.")
-		return
+		return fmt.Errorf("Unknown protocol.")
 	}
 	refs, pack, err := ups.NegotiatePack()
 	switch err {
 	case git.NoNewCommits:
-		return
+		return nil
 	case nil:
 		break
 	default:
-		panic(err)
+		return err
 	}
 	if pack != nil {
 		defer pack.Close()
 	}
 	_, err = git.IndexAndCopyPack(c, git.IndexPackOptions{Verbose: true}, pack)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	for _, ref := range refs {
 		if c.GitDir != "" {
 			refname := ref.Refname.String()
 			if strings.HasPrefix(refname, "refs/heads") {
-				os.MkdirAll(c.GitDir.File(git.File("refs/remotes/"+args[0])).String(), 0755)
 				refname = strings.Replace(refname, "refs/heads/", "refs/remotes/"+args[0]+"/", 1)
-				refloc := fmt.Sprintf("%s/%s", c.GitDir, refname)
-				fmt.Printf("Creating %s with %s", refloc, ref.Sha1)
-				ioutil.WriteFile(
-					refloc,
-					[]byte(ref.Sha1),
-					0644,
-				)
+				fmt.Printf("Creating %s with %s", refname, ref.Sha1)
+				cid, err := git.CommitIDFromString(ref.Sha1)
+				if err != nil {
+					return err
+				}
+				if err := git.UpdateRefSpec(c, git.UpdateRefOptions{}, git.RefSpec(refname), cid, "fetch: storing head"); err != nil {
+					return err
+				}
 			}
 
 		}
 	}
+	return nil
 }
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/driusan/dgit/git"
+)
+
+// A multiStringFlag is a flag.Value for flags which may be passed more
+// than once, such as --sort.
+type multiStringFlag []string
+
+func (m *multiStringFlag) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *multiStringFlag) Set(s string) error {
+	*m = append(*m, s)
+	return nil
+}
+
+func ForEachRef(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("for-each-ref", flag.ExitOnError)
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(os.Stderr, "\nfor-each-ref options:\n\n")
+		flags.PrintDefaults()
+	}
+
+	opts := git.ForEachRefOptions{}
+	format := flags.String("format", "%(objectname) %(objecttype)\t%(refname)", "Format to print each ref with")
+	sortKeys := &multiStringFlag{}
+	flags.Var(sortKeys, "sort", "Field to sort by. May be given multiple times, the last key is the primary key")
+	flags.IntVar(&opts.Count, "count", 0, "Stop after printing this many refs")
+	pointsAt := flags.String("points-at", "", "Only list refs which point at the given object")
+	merged := flags.String("merged", "", "Only list refs whose tips are reachable from the given commit")
+	contains := flags.String("contains", "", "Only list refs which contain the given commit")
+	flags.Parse(args)
+
+	opts.Sort = *sortKeys
+	if *pointsAt != "" {
+		cmt, err := git.RevParseCommit(c, &git.RevParseOptions{}, *pointsAt)
+		if err != nil {
+			return err
+		}
+		opts.PointsAt = git.Sha1(cmt)
+	}
+	if *merged != "" {
+		cmt, err := git.RevParseCommit(c, &git.RevParseOptions{}, *merged)
+		if err != nil {
+			return err
+		}
+		opts.Merged = cmt
+	}
+	if *contains != "" {
+		cmt, err := git.RevParseCommit(c, &git.RevParseOptions{}, *contains)
+		if err != nil {
+			return err
+		}
+		opts.Contains = cmt
+	}
+
+	refs, err := git.ForEachRef(c, opts, flags.Args())
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		line, err := git.FormatRef(c, ref, *format)
+		if err != nil {
+			return err
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
@@ -3,7 +3,6 @@ package cmd
 import (
 	"flag"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -28,75 +27,75 @@ func IndexPack(c *git.Client, args []string) (err error) {
 	flags.BoolVar(&options.FixThin, "fix-thin", false, "Inflate packfiles generated by git pack-objects --thin")
 	flags.StringVar(&options.Keep, "keep", "", "Generate an empty .keep file. See git documentation.")
 	flags.BoolVar(&options.Strict, "strict", false, "Die if the pack contains broken objects or links.")
+	flags.BoolVar(&options.CheckSelfContainedAndConnected, "check-self-contained-and-connected", false, "Die if the pack contains broken links or links to objects outside of the pack.")
 	flags.UintVar(&options.Threads, "threads", 0, "Specify the number of threads to use to resolve deltas.")
 	flags.Parse(args)
 	args = flags.Args()
 
-	// Determine where to read the pack file based on command line options.
-	var packfile io.ReadSeeker
-	var idx git.PackfileIndex
-
 	if *stdin {
-		packfile = os.Stdin
-	} else if len(args) < 1 {
-		flags.Usage()
-		return fmt.Errorf("Must provide pack file name or --stdin")
-	} else {
-		f, err := os.Open(args[0])
-		if err != nil {
-			return err
-		}
-		defer f.Close()
-		packfile = f
-	}
-
-	// Determine where to put the pack file based on command line options
-	if *output != "" {
-		// User specified output file
-		f, err := os.Create(*output)
-		if err != nil {
-			return err
-		}
-		defer f.Close()
-		options.Output = f
-	} else if *stdin {
-		if len(args) >= 1 {
-			// No output file, but stdin was specified.
-			f, err := os.Create(args[0])
-			if err != nil {
-				return err
-			}
-			defer f.Close()
-			options.Output = f
-		} else {
-			// No output file or packfile was specified, but
-			// --stdin was used. Save it into a file in .git/objects/pack
-			// (we'll rename it in the end based on the trailer.)
+		if len(args) < 1 {
+			// No packfile was specified, so save it into a file
+			// in .git/objects/pack. (It's renamed in the end based
+			// on the trailer.)
 			// (We use a temp file directly in the packs directory
 			//  because otherwise we'll need an extra pointless copy
 			//  on some operating systems, where mv can't move between
 			// directories.)
-			_, err := git.IndexAndCopyPack(c, options, os.Stdin)
-			return err
+			idx, err := git.IndexAndCopyPack(c, options, os.Stdin)
+			if err != nil || *output == "" {
+				return err
+			}
+			f, err := os.Create(*output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return idx.WriteIndex(f)
 		}
-	} else {
-		// Guess based on the pack name.
-		if filepath.Ext(args[0]) != ".pack" {
-			return fmt.Errorf("File name does not end in .pack")
+		// Stdin may be a pipe, so the pack is copied to the packfile
+		// while it's read and the deltas are resolved from there.
+		pack, err := os.Create(args[0])
+		if err != nil {
+			return err
 		}
-		fname := strings.TrimSuffix(args[0], "pack") + "idx"
-
-		f, err := os.Create(fname)
+		defer pack.Close()
+		idx, err := git.IndexAndCopyPackTo(c, options, os.Stdin, pack)
 		if err != nil {
 			return err
 		}
-		defer f.Close()
-		options.Output = f
+		return writeIndexFile(idx, *output, args[0])
 	}
-	idx, err = git.IndexPack(c, options, packfile)
+
+	if len(args) < 1 {
+		flags.Usage()
+		return fmt.Errorf("Must provide pack file name or --stdin")
+	}
+	f, err := os.Open(args[0])
 	if err != nil {
 		return err
 	}
+	defer f.Close()
+	idx, err := git.IndexPack(c, options, f)
+	if err != nil {
+		return err
+	}
+	return writeIndexFile(idx, *output, args[0])
+}
 
-	return idx.WriteIndex(options.Output)
+// Writes the index to the file named output, or if it's empty, to the
+// file named after packname with an .idx extension instead of .pack.
+func writeIndexFile(idx git.PackfileIndex, output, packname string) error {
+	if output == "" {
+		// Guess based on the pack name.
+		if filepath.Ext(packname) != ".pack" {
+			return fmt.Errorf("File name does not end in .pack")
+		}
+		output = strings.TrimSuffix(packname, "pack") + "idx"
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return idx.WriteIndex(f)
 }
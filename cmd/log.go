@@ -1,53 +1,401 @@
 package cmd
 
 import (
-	"errors"
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/driusan/dgit/git"
-	libgit "github.com/driusan/git"
 )
 
-// Since libgit is somewhat out of our control and we can't implement
-// a fmt.Stringer interface there, we use this helper.
-func printCommit(c *libgit.Commit) {
-	fmt.Printf("commit %v\nAuthor: %v\nDate: %v\n\n", c.Id, c.Author, c.Author.When.Format("Mon Jan 2 15:04:05 2006 -0700"))
+// Returns true if arg names a revision or range of revisions, rather than
+// a path.
+func isRevision(c *git.Client, arg string) bool {
+	arg = strings.TrimPrefix(arg, "^")
+	var sides []string
+	switch {
+	case strings.Contains(arg, "..."):
+		sides = strings.SplitN(arg, "...", 2)
+	case strings.Contains(arg, ".."):
+		sides = strings.SplitN(arg, "..", 2)
+	default:
+		sides = []string{arg}
+	}
+	for _, side := range sides {
+		if side == "" && len(sides) > 1 {
+			// An empty side of a range means HEAD.
+			continue
+		}
+		if _, err := git.RevParseObject(c, &git.RevParseOptions{}, side); err != nil {
+			return false
+		}
+	}
+	return true
+}
 
-	lines := strings.Split(c.CommitMessage, "\n")
-	for _, l := range lines {
-		fmt.Printf("    %v\n", l)
+// Adds the path p, which is relative to the current directory, to paths.
+func addPathArg(c *git.Client, paths *[]git.IndexPath, p string) error {
+	path, err := git.File(p).IndexPath(c)
+	if err != nil {
+		return err
 	}
+	*paths = append(*paths, git.IndexPath(strings.TrimSuffix(string(path), "/")))
+	return nil
 }
 
-func Log(c *git.Client, args []string) error {
+// Adds arg, which is neither an option nor after "--", to revs if it
+// names a revision and to paths otherwise. Like git, arguments which
+// aren't revisions are treated as paths if they exist, and everything
+// after the first path is a path.
+func addRevisionOrPath(c *git.Client, revs *[]string, paths *[]git.IndexPath, arg string) error {
+	if len(*paths) == 0 && isRevision(c, arg) {
+		*revs = append(*revs, arg)
+		return nil
+	}
+	if !git.File(arg).Exists() {
+		return fmt.Errorf("fatal: ambiguous argument '%s': unknown revision or path not in the working tree.\nUse '--' to separate paths from revisions, like this:\n'git <command> [<revision>...] -- [<file>...]'", arg)
+	}
+	return addPathArg(c, paths, arg)
+}
+
+// Returns true if arg is one of the pseudo-options which stand for a set
+// of refs, such as --all or --branches, or --not.
+func isRefOption(arg string) bool {
+	switch arg {
+	case "--all", "--not", "--branches", "--tags", "--remotes":
+		return true
+	}
+	for _, opt := range []string{"--branches=", "--tags=", "--remotes="} {
+		if strings.HasPrefix(arg, opt) {
+			return true
+		}
+	}
+	return false
+}
+
+// Prints the commits found by git.Log, optionally with a graph and the
+// changes that each commit made.
+type logPrinter struct {
+	c *git.Client
+
+	graph        *git.LogGraph
+	decorations  map[git.Sha1][]string
+	pretty       git.PrettyFormat
+	formatter    *git.CommitFormatter
+	abbrevCommit bool
+	format       changeFormat
+
+	// The paths that the log is limited to, which also limit the
+	// changes shown.
+	paths       []git.IndexPath
+	follow      bool
+	firstParent bool
+
+	// Whether merges are shown with a combined diff against all of
+	// their parents, like show does, instead of without any changes.
+	combined bool
+
+	// Whether a commit has already been printed, and whether the last
+	// one's message didn't end with a newline.
+	shown          bool
+	missingNewline bool
+}
+
+// Returns the graph to go before a line of output which isn't the commit
+// line, or the empty string if the graph isn't being shown.
+func (l *logPrinter) prefix() string {
+	if l.graph == nil {
+		return ""
+	}
+	return l.graph.PaddingLine()
+}
+
+// Prints the lines of the graph up to and including the commit's line,
+// except for the newline after the commit's line.
+func (l *logPrinter) showGraphCommit() {
+	if l.graph == nil {
+		return
+	}
+	for !l.graph.IsCommitFinished() {
+		line, commit := l.graph.NextLine()
+		fmt.Print(line)
+		if commit {
+			return
+		}
+		fmt.Println()
+	}
+	fmt.Print(l.graph.PaddingLine())
+}
+
+// Prints the next line of the graph, without a newline.
+func (l *logPrinter) showGraphLine() {
+	if l.graph != nil {
+		line, _ := l.graph.NextLine()
+		fmt.Print(line)
+	}
+}
 
-	if len(args) != 0 {
-		fmt.Fprintf(os.Stderr, "Usage: go-git log\nNo options are currently supported.\n")
-		return errors.New("No options are currently supported for log")
+// Prints msg with the graph before every line but the first, followed by
+// the rest of the graph for the commit.
+func (l *logPrinter) showMessage(msg string) {
+	lines := strings.SplitAfter(msg, "\n")
+	for i, line := range lines {
+		fmt.Print(line)
+		if strings.HasSuffix(line, "\n") && i+1 < len(lines) && lines[i+1] != "" {
+			l.showGraphLine()
+		}
+	}
+	if l.graph == nil || l.graph.IsCommitFinished() {
+		return
+	}
+	terminated := strings.HasSuffix(msg, "\n")
+	if !terminated {
+		fmt.Println()
+	}
+	for {
+		l.showGraphLine()
+		if l.graph.IsCommitFinished() {
+			break
+		}
+		fmt.Println()
 	}
+	if terminated {
+		fmt.Println()
+	}
+}
 
-	repo, err := libgit.OpenRepository(c.GitDir.String())
+// Returns the changes to show for the commit, if any.
+func (l *logPrinter) changes(e git.LogEntry) ([]git.FileChange, error) {
+	if !l.format.any() {
+		return nil, nil
+	}
+	// Like git, merges don't have a diff unless only the first
+	// parent is being followed.
+	var parent git.Treeish
+	switch {
+	case len(e.Parents) == 1, len(e.Parents) > 1 && l.firstParent:
+		parent = e.Parents[0]
+	case len(e.Parents) > 1:
+		return nil, nil
+	}
+	if !l.follow {
+		return commitChanges(l.c, parent, e.Id, l.paths)
+	}
+	// Like git, only the followed file is diffed, so renaming it away
+	// shows as deleting it. When it was created, the rest of the commit
+	// is diffed to find the file that it was renamed from.
+	changes, err := commitChanges(l.c, parent, e.Id, []git.IndexPath{e.Path})
+	if err != nil || parent == nil || len(changes) != 1 || changes[0].Status() != "A" {
+		return changes, err
+	}
+	all, err := commitChanges(l.c, parent, e.Id, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range all {
+		if change.Name == e.Path {
+			return []git.FileChange{change}, nil
+		}
+	}
+	return changes, nil
+}
+
+// Prints the commit, followed by its changes.
+func (l *logPrinter) print(e git.LogEntry) error {
+	if l.graph != nil {
+		l.graph.Update(e.Id, e.GraphParents)
+	}
+	changes, err := l.changes(e)
 	if err != nil {
 		return err
 	}
-	head, err := c.GetHeadID()
+	msg, err := l.formatter.Format(e.Id, e.Parents)
 	if err != nil {
 		return err
 	}
 
-	// CommitsBefore also returns the commit passed..
-	l, err := repo.CommitsBefore(head)
+	// Like git, a newline either separates commits or terminates each
+	// of them, depending on the format.
+	emptyFormat := l.pretty.IsUserFormat() && l.pretty.Template == ""
+	if l.shown && !l.pretty.Terminator {
+		if !l.missingNewline {
+			fmt.Print(l.prefix())
+		}
+		fmt.Println()
+	}
+	l.shown = true
+	l.showGraphCommit()
+	if !l.pretty.IsUserFormat() && l.pretty.Name != "email" {
+		id := e.Id.String()
+		if l.abbrevCommit {
+			id = git.Sha1(e.Id).Abbrev(l.c, 0)
+		}
+		if l.pretty.Name != "oneline" {
+			fmt.Print("commit ")
+		}
+		fmt.Print(id)
+		if names := l.decorations[git.Sha1(e.Id)]; len(names) > 0 {
+			fmt.Printf(" (%s)", strings.Join(names, ", "))
+		}
+		if l.pretty.Name == "oneline" {
+			fmt.Print(" ")
+		} else {
+			fmt.Println()
+			l.showGraphLine()
+		}
+	}
+	l.missingNewline = !strings.HasSuffix(msg, "\n")
+	l.showMessage(msg)
+	if l.pretty.Terminator && !emptyFormat {
+		if !l.missingNewline {
+			fmt.Print(l.prefix())
+		}
+		fmt.Println()
+	}
+
+	if l.combined && len(e.Parents) > 1 && !l.firstParent {
+		if !l.format.any() {
+			return nil
+		}
+		// Unlike other commits, there's always a separator after
+		// merges, even in the oneline format.
+		if !emptyFormat {
+			fmt.Println(l.prefix())
+		}
+		return printCombinedChanges(l.c, l.format, e.Parents, e.Id, l.paths, l.prefix)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	if l.pretty.Name != "oneline" && !emptyFormat {
+		if l.format.Patch && l.format.Stat {
+			fmt.Printf("%s---\n", l.prefix())
+		} else {
+			fmt.Println(l.prefix())
+		}
+	}
+	return printChanges(l.c, l.format, changes, l.prefix)
+}
+
+// Implements "git log". Like rev-list, options are parsed by hand instead
+// of with the flag package, since the revisions and paths need to stay in
+// order.
+func Log(c *git.Client, args []string) error {
+	var opts git.LogOptions
+	var revs []string
+	var format changeFormat
+	var pretty prettyArgs
+	var graph, noOutput bool
+	decorate := ""
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			for _, p := range args[i+1:] {
+				if err := addPathArg(c, &opts.Paths, p); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		switch arg {
+		case "-p", "-u", "--patch":
+			format.Patch = true
+			noOutput = false
+		case "-s", "--no-patch":
+			format.Stat, format.Patch = false, false
+			noOutput = true
+		case "--stat":
+			format.Stat = true
+		case "--name-only":
+			format.NameOnly = true
+		case "--name-status":
+			format.NameStatus = true
+		case "--graph":
+			graph = true
+		case "--decorate":
+			decorate = "short"
+		case "--no-decorate":
+			decorate = ""
+		case "--follow":
+			opts.Follow = true
+		default:
+			if strings.HasPrefix(arg, "--decorate=") {
+				switch v := arg[len("--decorate="):]; v {
+				case "short", "full":
+					decorate = v
+				case "no", "auto":
+					// There's no terminal detection, so auto
+					// is the same as the default.
+					decorate = ""
+				default:
+					return fmt.Errorf("invalid --decorate option: %s", v)
+				}
+				continue
+			}
+			if isRefOption(arg) {
+				revs = append(revs, arg)
+				continue
+			}
+			if n := parsePrettyOption(args[i:], &pretty); n > 0 {
+				i += n - 1
+				continue
+			}
+			n, err := parseWalkOption(args[i:], &opts.WalkOptions)
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				i += n - 1
+				continue
+			}
+			if strings.HasPrefix(arg, "-") && arg != "-" {
+				return fmt.Errorf("unrecognized argument: %s", arg)
+			}
+			if err := addRevisionOrPath(c, &revs, &opts.Paths, arg); err != nil {
+				return err
+			}
+		}
+	}
+	if err := format.checkExclusive(noOutput); err != nil {
+		return err
+	}
+	if graph {
+		if opts.Reverse {
+			return fmt.Errorf("options '--reverse' and '--graph' cannot be used together")
+		}
+		opts.TopoOrder = true
+		opts.RewriteParents = true
+	}
+
+	l := &logPrinter{
+		c:            c,
+		abbrevCommit: pretty.abbrevCommit,
+		format:       format,
+		paths:        opts.Paths,
+		follow:       opts.Follow,
+		firstParent:  opts.FirstParent,
+	}
+	if graph {
+		l.graph = git.NewLogGraph()
+	}
+	var err error
+	if decorate != "" {
+		if l.decorations, err = git.Decorations(c, decorate == "full"); err != nil {
+			return err
+		}
+	}
+	pretty.defaultMailmap(c)
+	if l.pretty, l.formatter, err = pretty.formatter(c, true, l.decorations); err != nil {
+		return err
+	}
+
+	entries, err := git.Log(c, opts, revs)
 	if err != nil {
 		return err
 	}
-	for e := l.Front(); e != nil; e = e.Next() {
-		c, ok := e.Value.(*libgit.Commit)
-		if ok {
-			printCommit(c)
+	for _, e := range entries {
+		if err := l.print(e); err != nil {
+			return err
 		}
 	}
 	return nil
-
 }
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/driusan/dgit/git"
+)
+
+func LsRemote(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("ls-remote", flag.ExitOnError)
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(os.Stderr, "\nls-remote options:\n\n")
+		flags.PrintDefaults()
+	}
+
+	opts := git.LsRemoteOptions{}
+	heads := flags.Bool("heads", false, "Limit to refs/heads")
+	h := flags.Bool("h", false, "Alias of --heads")
+	tags := flags.Bool("tags", false, "Limit to refs/tags")
+	t := flags.Bool("t", false, "Alias of --tags")
+	flags.BoolVar(&opts.Symref, "symref", false, "Show the ref that symbolic refs point to")
+	flags.Parse(args)
+
+	opts.Heads = *heads || *h
+	opts.Tags = *tags || *t
+
+	var remote string
+	patterns := flags.Args()
+	if len(patterns) > 0 {
+		remote, patterns = patterns[0], patterns[1:]
+	} else {
+		// Default to the upstream of the current branch, or origin.
+		remote = "origin"
+		if head := c.GetHeadBranch(); head != "" {
+			if r := c.GetConfig("branch." + head.BranchName() + ".remote"); r != "" {
+				remote = r
+			}
+		}
+	}
+
+	refs, err := git.LsRemote(c, opts, remote, patterns)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if ref.Symref != "" {
+			fmt.Printf("ref: %s\t%s\n", ref.Symref, ref.Refname)
+		}
+		fmt.Printf("%s\t%s\n", ref.Sha1, ref.Refname)
+	}
+	return nil
+}
@@ -12,44 +12,145 @@ import (
 var Ancestor error = errors.New("Commit is an ancestor")
 var NonAncestor error = errors.New("Commit not an ancestor")
 
-func MergeBase(c *git.Client, args []string) (git.CommitID, error) {
-	os.Args = append([]string{"git merge-base"}, args...)
-	octopus := flag.Bool("octopus", false, "Compute the common ancestor of all supplied commits")
-	ancestor := flag.Bool("is-ancestor", false, "Determine if two commits are ancestors")
-	flag.Parse()
-	args = flag.Args()
-
-	if len(args) < 1 {
-		flag.Usage()
-		return git.CommitID{}, fmt.Errorf("Invalid usage of merge-base")
-	}
-	if *ancestor {
-		commits, err := RevParse(c, args)
+// Returned by MergeBase when there's no merge base or fork point to print.
+var NoMergeBase error = errors.New("No merge base found")
+
+// Resolves arg to a commit, with the same errors as git merge-base.
+func mergeBaseCommit(c *git.Client, arg string) (git.Commitish, error) {
+	revs, err := revParse(c, []string{arg})
+	if err != nil || len(revs) != 1 || revs[0].Excluded {
+		return nil, fmt.Errorf("Not a valid object name %s", arg)
+	}
+	if _, err := revs[0].CommitID(c); err != nil {
+		return nil, fmt.Errorf("Not a valid commit name %s", arg)
+	}
+	return revs[0], nil
+}
+
+func MergeBase(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("merge-base", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s merge-base [-a | --all] <commit> <commit>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "   or: %s merge-base [-a | --all] --octopus <commit>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "   or: %s merge-base --is-ancestor <commit> <commit>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "   or: %s merge-base --independent <commit>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "   or: %s merge-base --fork-point <ref> [<commit>]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nmerge-base options:\n\n")
+		flags.PrintDefaults()
+	}
+
+	opts := git.MergeBaseOptions{}
+	flags.BoolVar(&opts.All, "all", false, "Output all common ancestors")
+	flags.BoolVar(&opts.All, "a", false, "Alias of --all")
+	flags.BoolVar(&opts.Octopus, "octopus", false, "Find ancestors for a single n-way merge")
+	independent := flags.Bool("independent", false, "List revs not reachable from others")
+	ancestor := flags.Bool("is-ancestor", false, "Is the first one ancestor of the other?")
+	forkPoint := flags.Bool("fork-point", false, "Find where <commit> forked from reflog of <ref>")
+	flags.Parse(args)
+	args = flags.Args()
+
+	// The modes are mutually exclusive.
+	var mode string
+	for _, m := range []struct {
+		name string
+		set  bool
+	}{
+		{"octopus", opts.Octopus},
+		{"independent", *independent},
+		{"is-ancestor", *ancestor},
+		{"fork-point", *forkPoint},
+	} {
+		if !m.set {
+			continue
+		}
+		if mode != "" {
+			return fmt.Errorf("error: option `%s' is incompatible with --%s", m.name, mode)
+		}
+		mode = m.name
+	}
+
+	switch mode {
+	case "is-ancestor":
+		if len(args) < 2 {
+			flags.Usage()
+			return fmt.Errorf("Invalid usage of merge-base")
+		}
+		if opts.All {
+			return fmt.Errorf("options '--is-ancestor' and '--all' cannot be used together")
+		}
+		if len(args) != 2 {
+			return fmt.Errorf("--is-ancestor takes exactly two commits")
+		}
+		one, err := mergeBaseCommit(c, args[0])
 		if err != nil {
-			return git.CommitID{}, err
+			return err
 		}
-		if commits[1].IsAncestor(c, commits[0]) {
-			return git.CommitID{}, Ancestor
+		two, err := mergeBaseCommit(c, args[1])
+		if err != nil {
+			return err
 		}
-		return git.CommitID{}, NonAncestor
-	} else if *octopus {
-		commits, err := RevParse(c, args)
+		cmt, err := one.CommitID(c)
 		if err != nil {
-			return git.CommitID{}, err
+			return err
 		}
-
-		// RevParse returns ParsedRevisions, which are Commitish, but slices
-		// can't be passed in terms of interfaces without converting them
-		// first.
-		var asCommitish []git.Commitish
-		for _, c := range commits {
-			asCommitish = append(asCommitish, c)
+		if cmt.IsAncestor(c, two) {
+			return Ancestor
 		}
+		return NonAncestor
+	case "fork-point":
+		if len(args) < 1 || len(args) > 2 {
+			flags.Usage()
+			return fmt.Errorf("Invalid usage of merge-base")
+		}
+		name := "HEAD"
+		if len(args) == 2 {
+			name = args[1]
+		}
+		revs, err := revParse(c, []string{name})
+		if err != nil || len(revs) != 1 {
+			return fmt.Errorf("Not a valid object name: '%s'", name)
+		}
+		fork, err := git.MergeBaseForkPoint(c, args[0], revs[0])
+		if err != nil {
+			return err
+		}
+		if fork == (git.CommitID{}) {
+			return NoMergeBase
+		}
+		fmt.Println(fork)
+		return nil
+	}
 
-		return git.MergeBaseOctopus(c, asCommitish)
+	if mode == "" && len(args) < 2 {
+		flags.Usage()
+		return fmt.Errorf("Invalid usage of merge-base")
+	}
+	if mode == "independent" && opts.All {
+		return fmt.Errorf("options '--independent' and '--all' cannot be used together")
+	}
+	var commits []git.Commitish
+	for _, arg := range args {
+		cmt, err := mergeBaseCommit(c, arg)
+		if err != nil {
+			return err
+		}
+		commits = append(commits, cmt)
+	}
+	var bases []git.CommitID
+	var err error
+	if mode == "independent" {
+		bases, err = git.MergeBaseIndependent(c, commits)
 	} else {
-		panic("Only octopus and is-ancestor are currently supported")
+		bases, err = git.MergeBase(c, opts, commits)
 	}
-
-	panic("Only octopus and is-ancestor are currently supported")
+	if err != nil {
+		return err
+	}
+	if len(bases) == 0 {
+		return NoMergeBase
+	}
+	for _, b := range bases {
+		fmt.Println(b)
+	}
+	return nil
 }
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/driusan/dgit/git"
+)
+
+func NameRev(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("name-rev", flag.ExitOnError)
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(os.Stderr, "\nname-rev options:\n\n")
+		flags.PrintDefaults()
+	}
+
+	opts := git.NameRevOptions{}
+	flags.BoolVar(&opts.NameOnly, "name-only", false, "Only print the names, not the object ids")
+	flags.BoolVar(&opts.Tags, "tags", false, "Only use tags to name the commits")
+	flags.BoolVar(&opts.All, "all", false, "List all commits reachable from all refs")
+	flags.BoolVar(&opts.Always, "always", false, "Show the abbreviated object id as a fallback")
+	flags.BoolVar(&opts.PeelTag, "peel-tag", false, "Dereference tags in the input")
+	noUndefined := flags.Bool("no-undefined", false, "Fail if a revision can't be named")
+	stdin := flags.Bool("stdin", false, "Alias of --annotate-stdin")
+	annotate := flags.Bool("annotate-stdin", false, "Annotate the object ids read from stdin with their names")
+	refs := &multiStringFlag{}
+	flags.Var(refs, "refs", "Only use refs matching `pattern`. May be given multiple times")
+	exclude := &multiStringFlag{}
+	flags.Var(exclude, "exclude", "Ignore refs matching `pattern`. May be given multiple times")
+	flags.Parse(args)
+
+	opts.NoUndefined = *noUndefined
+	opts.Refs = *refs
+	opts.Exclude = *exclude
+
+	if *stdin || *annotate {
+		return git.NameRevAnnotate(c, opts, os.Stdin, os.Stdout)
+	}
+	names, err := git.NameRev(c, opts, flags.Args())
+	for _, n := range names {
+		if opts.NameOnly {
+			fmt.Println(n.Name)
+		} else {
+			fmt.Printf("%s %s\n", n.Rev, n.Name)
+		}
+	}
+	return err
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/driusan/dgit/git"
+)
+
+func PackRefs(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("pack-refs", flag.ExitOnError)
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(os.Stderr, "\npack-refs options:\n\n")
+		flags.PrintDefaults()
+	}
+
+	opts := git.PackRefsOptions{}
+	flags.BoolVar(&opts.All, "all", false, "Pack all refs, not just tags and refs that are already packed")
+	flags.BoolVar(&opts.NoPrune, "no-prune", false, "Do not remove loose refs after packing them")
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return fmt.Errorf("Invalid usage")
+	}
+	return git.PackRefs(c, opts)
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/driusan/dgit/git"
+)
+
+// The options which control how commits are shown by log, show and
+// rev-list.
+type prettyArgs struct {
+	// The argument to --pretty or --format, and whether either of them
+	// was given.
+	format    string
+	formatSet bool
+
+	// The --date mode.
+	date string
+
+	abbrevCommit bool
+
+	// Whether authors and committers are mapped with the mailmap, and
+	// whether --use-mailmap or --no-use-mailmap was given.
+	mailmap, mailmapSet bool
+}
+
+// Parses the option at the start of args if it's one of the options which
+// control how commits are shown, and stores it in p. It returns the number
+// of arguments used, which is 0 if args[0] isn't one of them.
+func parsePrettyOption(args []string, p *prettyArgs) int {
+	arg := args[0]
+	switch {
+	case arg == "--pretty":
+		p.format, p.formatSet = "medium", true
+	case strings.HasPrefix(arg, "--pretty="):
+		p.format, p.formatSet = arg[len("--pretty="):], true
+	case strings.HasPrefix(arg, "--format="):
+		p.format, p.formatSet = arg[len("--format="):], true
+	case arg == "--oneline":
+		p.format, p.formatSet = "oneline", true
+		p.abbrevCommit = true
+	case arg == "--abbrev-commit":
+		p.abbrevCommit = true
+	case arg == "--no-abbrev-commit":
+		p.abbrevCommit = false
+	case arg == "--use-mailmap", arg == "--mailmap":
+		p.mailmap, p.mailmapSet = true, true
+	case arg == "--no-use-mailmap", arg == "--no-mailmap":
+		p.mailmap, p.mailmapSet = false, true
+	case arg == "--relative-date":
+		p.date = "relative"
+	case strings.HasPrefix(arg, "--date="):
+		p.date = arg[len("--date="):]
+	case arg == "--date" && len(args) > 1:
+		p.date = args[1]
+		return 2
+	default:
+		return 0
+	}
+	return 1
+}
+
+// Returns the format from the options, and a formatter for it. Tabs in
+// messages are expanded if expandTabs is set, and decorations are used for
+// %d if they aren't nil.
+func (p prettyArgs) formatter(c *git.Client, expandTabs bool, decorations map[git.Sha1][]string) (git.PrettyFormat, *git.CommitFormatter, error) {
+	format := git.PrettyFormat{Name: "medium"}
+	var err error
+	if p.formatSet {
+		if format, err = git.ParsePrettyFormat(c, p.format); err != nil {
+			return git.PrettyFormat{}, nil, err
+		}
+	}
+	f, err := git.NewCommitFormatter(c, git.PrettyOptions{
+		Format:      format,
+		Date:        p.date,
+		ExpandTabs:  expandTabs,
+		Decorations: decorations,
+		Mailmap:     p.mailmap,
+	})
+	return format, f, err
+}
+
+// Uses the mailmap unless the log.mailmap config is false, if neither
+// --use-mailmap nor --no-use-mailmap was given. Like git, this is only the
+// default for log and show.
+func (p *prettyArgs) defaultMailmap(c *git.Client) {
+	if p.mailmapSet {
+		return
+	}
+	switch c.GetConfig("log.mailmap") {
+	case "false", "no", "off", "0":
+		p.mailmap = false
+	default:
+		p.mailmap = true
+	}
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/driusan/dgit/git"
+)
+
+var NoReflog error = errors.New("Reflog does not exist")
+
+// Implements "git reflog", dispatching to the subcommand.
+func Reflog(c *git.Client, args []string) error {
+	if len(args) == 0 {
+		return reflogShow(c, nil)
+	}
+	switch args[0] {
+	case "show":
+		return reflogShow(c, args[1:])
+	case "expire":
+		return reflogExpire(c, args[1:])
+	case "delete":
+		return reflogDelete(c, args[1:])
+	case "exists":
+		return reflogExists(c, args[1:])
+	}
+	// Anything else is an implicit show.
+	return reflogShow(c, args)
+}
+
+func reflogShow(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("reflog show", flag.ExitOnError)
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(os.Stderr, "\nreflog show options:\n\n")
+		flags.PrintDefaults()
+	}
+	maxCount := flags.Int("max-count", -1, "Limit the number of entries to show")
+	flags.IntVar(maxCount, "n", -1, "Alias of --max-count")
+	flags.Parse(args)
+
+	name := "HEAD"
+	switch flags.NArg() {
+	case 0:
+	case 1:
+		name = flags.Arg(0)
+	default:
+		flags.Usage()
+		return fmt.Errorf("Invalid usage")
+	}
+
+	ref, err := c.DwimReflog(name)
+	if err != nil {
+		return err
+	}
+	entries, err := c.ReadReflog(ref)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(entries); i++ {
+		if *maxCount >= 0 && i >= *maxCount {
+			break
+		}
+		e := entries[len(entries)-1-i]
+		fmt.Printf("%s %s@{%d}: %s\n", e.New.Abbrev(c, 0), name, i, e.Message)
+	}
+	return nil
+}
+
+func reflogExpire(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("reflog expire", flag.ExitOnError)
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(os.Stderr, "\nreflog expire options:\n\n")
+		flags.PrintDefaults()
+	}
+	opts, err := c.DefaultReflogExpireOptions()
+	if err != nil {
+		return err
+	}
+	expire := flags.String("expire", "", "Prune entries older than the given time (default gc.reflogExpire)")
+	expireUnreachable := flags.String("expire-unreachable", "", "Prune entries older than the given time which aren't reachable from the ref (default gc.reflogExpireUnreachable)")
+	flags.BoolVar(&opts.All, "all", false, "Expire the reflogs of all refs")
+	flags.BoolVar(&opts.DryRun, "dry-run", false, "Do not actually prune any entries")
+	flags.BoolVar(&opts.DryRun, "n", false, "Alias of --dry-run")
+	flags.BoolVar(&opts.Rewrite, "rewrite", false, "Adjust the old value of entries following a pruned entry")
+	flags.BoolVar(&opts.UpdateRef, "updateref", false, "Update the ref to the value of the newest remaining entry")
+	flags.BoolVar(&opts.Verbose, "verbose", false, "Print the entries that are kept and pruned")
+	flags.Parse(args)
+
+	if *expire != "" {
+		if opts.Expire, err = git.ParseExpiry(*expire, time.Now()); err != nil {
+			return err
+		}
+	}
+	if *expireUnreachable != "" {
+		if opts.ExpireUnreachable, err = git.ParseExpiry(*expireUnreachable, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	var refs []git.RefSpec
+	for _, name := range flags.Args() {
+		ref, err := c.DwimReflog(name)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, ref)
+	}
+	if len(refs) == 0 && !opts.All {
+		flags.Usage()
+		return fmt.Errorf("No reflog specified")
+	}
+	return git.ReflogExpire(c, opts, refs)
+}
+
+func reflogDelete(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("reflog delete", flag.ExitOnError)
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(os.Stderr, "\nreflog delete options:\n\n")
+		flags.PrintDefaults()
+	}
+	opts := git.ReflogDeleteOptions{}
+	flags.BoolVar(&opts.DryRun, "dry-run", false, "Do not actually delete any entries")
+	flags.BoolVar(&opts.DryRun, "n", false, "Alias of --dry-run")
+	flags.BoolVar(&opts.Rewrite, "rewrite", false, "Adjust the old value of the entry following a deleted entry")
+	flags.BoolVar(&opts.UpdateRef, "updateref", false, "Update the ref to the value of the newest remaining entry")
+	flags.BoolVar(&opts.Verbose, "verbose", false, "Print the entries that are kept and deleted")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("No reflog specified")
+	}
+	return git.ReflogDelete(c, opts, flags.Args())
+}
+
+func reflogExists(c *git.Client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Usage: reflog exists <ref>")
+	}
+	if !git.ReflogExists(c, git.RefSpec(args[0])) {
+		return NoReflog
+	}
+	return nil
+}
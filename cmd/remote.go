@@ -0,0 +1,311 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/driusan/dgit/git"
+)
+
+func Remote(c *git.Client, args []string) error {
+	if len(args) == 0 {
+		return remoteList(c, args)
+	}
+	switch args[0] {
+	case "add":
+		return remoteAdd(c, args[1:])
+	case "remove", "rm":
+		return remoteRemove(c, args[1:])
+	case "rename":
+		return remoteRename(c, args[1:])
+	case "set-url":
+		return remoteSetURL(c, args[1:])
+	case "get-url":
+		return remoteGetURL(c, args[1:])
+	case "show":
+		return remoteShow(c, args[1:])
+	case "prune":
+		return remotePrune(c, args[1:])
+	}
+	return remoteList(c, args)
+}
+
+func remoteList(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("remote", flag.ExitOnError)
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(os.Stderr, "\nremote options:\n\n")
+		flags.PrintDefaults()
+	}
+	verbose := flags.Bool("verbose", false, "Show the URLs of each remote")
+	v := flags.Bool("v", false, "Alias of --verbose")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return fmt.Errorf("Invalid usage")
+	}
+
+	for _, name := range git.RemoteList(c) {
+		if !*verbose && !*v {
+			fmt.Println(name)
+			continue
+		}
+		fetch, err := git.RemoteGetURL(c, git.RemoteURLOptions{}, name)
+		if err != nil {
+			return err
+		}
+		push, err := git.RemoteGetURL(c, git.RemoteURLOptions{Push: true, All: true}, name)
+		if err != nil {
+			return err
+		}
+		for _, url := range fetch {
+			fmt.Printf("%s\t%s (fetch)\n", name, url)
+		}
+		for _, url := range push {
+			fmt.Printf("%s\t%s (push)\n", name, url)
+		}
+	}
+	return nil
+}
+
+func remoteAdd(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("remote add", flag.ExitOnError)
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(os.Stderr, "\nremote add options:\n\n")
+		flags.PrintDefaults()
+	}
+	opts := git.RemoteAddOptions{}
+	track := &multiStringFlag{}
+	flags.Var(track, "t", "Only track the given branch. May be given multiple times")
+	flags.StringVar(&opts.Master, "m", "", "Set up the remote's HEAD to point at the given branch")
+	fetch := flags.Bool("f", false, "Fetch from the remote after adding it")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return fmt.Errorf("Invalid usage")
+	}
+	opts.Track = *track
+
+	name := flags.Arg(0)
+	if err := git.RemoteAdd(c, opts, name, flags.Arg(1)); err != nil {
+		return err
+	}
+	if *fetch {
+		return Fetch(c, []string{name})
+	}
+	return nil
+}
+
+func remoteRemove(c *git.Client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Usage: remote remove <name>")
+	}
+	return git.RemoteRemove(c, args[0])
+}
+
+func remoteRename(c *git.Client, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("Usage: remote rename <old> <new>")
+	}
+	return git.RemoteRename(c, args[0], args[1])
+}
+
+func remoteSetURL(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("remote set-url", flag.ExitOnError)
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(os.Stderr, "\nremote set-url options:\n\n")
+		flags.PrintDefaults()
+	}
+	opts := git.RemoteURLOptions{}
+	flags.BoolVar(&opts.Push, "push", false, "Manipulate the push URLs instead of the fetch URLs")
+	flags.BoolVar(&opts.Add, "add", false, "Add a new URL instead of changing the existing one")
+	flags.BoolVar(&opts.Delete, "delete", false, "Remove the URLs matching the given pattern")
+	flags.Parse(args)
+
+	var oldurl string
+	switch flags.NArg() {
+	case 2:
+	case 3:
+		if opts.Add || opts.Delete {
+			flags.Usage()
+			return fmt.Errorf("Invalid usage")
+		}
+		oldurl = flags.Arg(2)
+	default:
+		flags.Usage()
+		return fmt.Errorf("Invalid usage")
+	}
+	if opts.Add && opts.Delete {
+		return fmt.Errorf("--add --delete doesn't make sense")
+	}
+	return git.RemoteSetURL(c, opts, flags.Arg(0), flags.Arg(1), oldurl)
+}
+
+func remoteGetURL(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("remote get-url", flag.ExitOnError)
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(os.Stderr, "\nremote get-url options:\n\n")
+		flags.PrintDefaults()
+	}
+	opts := git.RemoteURLOptions{}
+	flags.BoolVar(&opts.Push, "push", false, "Show the push URLs instead of the fetch URLs")
+	flags.BoolVar(&opts.All, "all", false, "Show all URLs instead of only the first")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("Invalid usage")
+	}
+
+	urls, err := git.RemoteGetURL(c, opts, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	for _, url := range urls {
+		fmt.Println(url)
+	}
+	return nil
+}
+
+func remoteShow(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("remote show", flag.ExitOnError)
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(os.Stderr, "\nremote show options:\n\n")
+		flags.PrintDefaults()
+	}
+	noQuery := flags.Bool("n", false, "Do not query the remote for its branches")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return remoteList(c, nil)
+	}
+
+	// Returns the plural form of s if n is not 1.
+	plural := func(n int, s, pl string) string {
+		if n == 1 {
+			return s
+		}
+		return pl
+	}
+	for _, name := range flags.Args() {
+		info, err := git.RemoteShow(c, name, *noQuery)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("* remote %s\n", info.Name)
+		fmt.Printf("  Fetch URL: %s\n", info.FetchURL)
+		for _, url := range info.PushURLs {
+			fmt.Printf("  Push  URL: %s\n", url)
+		}
+		if info.Queried {
+			fmt.Printf("  HEAD branch: %s\n", info.HEADBranch)
+		} else {
+			fmt.Printf("  HEAD branch: (not queried)\n")
+		}
+
+		if len(info.Branches) > 0 {
+			header := plural(len(info.Branches), "Remote branch:", "Remote branches:")
+			if !info.Queried {
+				header += " (status not queried)"
+			}
+			fmt.Printf("  %s\n", header)
+			width := 0
+			for _, b := range info.Branches {
+				if len(b.Name) > width {
+					width = len(b.Name)
+				}
+			}
+			for _, b := range info.Branches {
+				switch b.Status {
+				case "":
+					fmt.Printf("    %s\n", b.Name)
+				case "new":
+					fmt.Printf("    %-*s new (next fetch will store in remotes/%s)\n", width, b.Name, info.Name)
+				case "stale":
+					fmt.Printf("    %-*s stale (use 'git remote prune' to remove)\n", width, b.Name)
+				default:
+					fmt.Printf("    %-*s %s\n", width, b.Name, b.Status)
+				}
+			}
+		}
+
+		if len(info.Pulls) > 0 {
+			fmt.Printf("  %s configured for 'git pull':\n", plural(len(info.Pulls), "Local branch", "Local branches"))
+			width := 0
+			for _, p := range info.Pulls {
+				if len(p.Local) > width {
+					width = len(p.Local)
+				}
+			}
+			for _, p := range info.Pulls {
+				fmt.Printf("    %-*s merges with remote %s\n", width, p.Local, p.Merge)
+			}
+		}
+
+		if !info.Queried {
+			fmt.Printf("  Local ref configured for 'git push' (status not queried):\n")
+			fmt.Printf("    (matching) pushes to (matching)\n")
+		} else if len(info.Pushes) > 0 {
+			fmt.Printf("  %s configured for 'git push':\n", plural(len(info.Pushes), "Local ref", "Local refs"))
+			lwidth, rwidth := 0, 0
+			for _, p := range info.Pushes {
+				if len(p.Local) > lwidth {
+					lwidth = len(p.Local)
+				}
+				if len(p.Remote) > rwidth {
+					rwidth = len(p.Remote)
+				}
+			}
+			for _, p := range info.Pushes {
+				fmt.Printf("    %-*s pushes to %-*s (%s)\n", lwidth, p.Local, rwidth, p.Remote, p.Status)
+			}
+		}
+	}
+	return nil
+}
+
+func remotePrune(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("remote prune", flag.ExitOnError)
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(os.Stderr, "\nremote prune options:\n\n")
+		flags.PrintDefaults()
+	}
+	opts := git.RemotePruneOptions{}
+	flags.BoolVar(&opts.DryRun, "dry-run", false, "Report what would be pruned without pruning it")
+	flags.BoolVar(&opts.DryRun, "n", false, "Alias of --dry-run")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("Invalid usage")
+	}
+
+	for _, name := range flags.Args() {
+		stale, err := git.RemotePrune(c, opts, name)
+		if err != nil {
+			return err
+		}
+		if len(stale) == 0 {
+			continue
+		}
+		urls, err := git.RemoteGetURL(c, git.RemoteURLOptions{}, name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Pruning %s\n", name)
+		if len(urls) > 0 {
+			fmt.Printf("URL: %s\n", urls[0])
+		}
+		for _, ref := range stale {
+			if opts.DryRun {
+				fmt.Printf(" * [would prune] %s\n", ref.ShortName())
+			} else {
+				fmt.Printf(" * [pruned] %s\n", ref.ShortName())
+			}
+		}
+	}
+	return nil
+}
@@ -32,7 +32,7 @@ func Reset(c *git.Client, args []string) {
 		// we're in, but if we've already found a path already
 		// then the time for a treeish option is past.
 		if val[0] != '-' && resetPaths == false {
-			commits, err := RevParse(c, []string{val})
+			commits, err := revParse(c, []string{val})
 			if err != nil || len(commits) < 1 {
 				fmt.Fprintf(os.Stderr, "Can not find commit %s\n", val)
 				return
@@ -55,11 +55,10 @@ func Reset(c *git.Client, args []string) {
 		// no paths were found. This is the form
 		//  git reset [mode] commit
 		// First, update the head reference for all modes
-		branchName := c.GetHeadBranch()
-		err := c.GitDir.WriteFile(git.File(branchName.String()),
-			[]byte(fmt.Sprintf("%s", commitId)),
-			0644,
-		)
+		cid, err := git.CommitIDFromString(commitId)
+		if err == nil {
+			err = git.UpdateRef(c, git.UpdateRefOptions{}, "HEAD", cid, "reset: moving to "+commitId)
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error updating head reference: %s\n", err)
 			return
@@ -1,88 +1,306 @@
 package cmd
 
 import (
-	"flag"
+	"bufio"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/driusan/dgit/git"
 )
 
-func RevList(c *git.Client, args []string) ([]git.Sha1, error) {
-	flags := flag.NewFlagSet("rev-list", flag.ExitOnError)
+// Parses the option at the start of args if it's one of the options which
+// limit or order the commits in a walk, and stores it in opts. It returns
+// the number of arguments used, which is 0 if args[0] isn't a walk option.
+// Options which take a value accept it either after an "=" or as the next
+// argument.
+func parseWalkOption(args []string, opts *git.WalkOptions) (int, error) {
+	arg := args[0]
+	value := func(names ...string) (string, int, bool) {
+		for _, name := range names {
+			if strings.HasPrefix(arg, name+"=") {
+				return arg[len(name)+1:], 1, true
+			}
+			if arg == name && len(args) > 1 {
+				return args[1], 2, true
+			}
+		}
+		return "", 0, false
+	}
+	number := func(s string) (int, error) {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid number: %s", s)
+		}
+		return n, nil
+	}
+	// Like git, a negative count means there's no limit, but the
+	// WalkOptions use a negative MaxCount for --max-count=0.
+	maxCount := func(s string) (int, error) {
+		n, err := number(s)
+		switch {
+		case n == 0:
+			return -1, err
+		case n < 0:
+			return 0, err
+		}
+		return n, err
+	}
+	date := func(s string) (time.Time, error) {
+		return git.ParseDate(s, time.Now())
+	}
 
-	includeObjects := flags.Bool("objects", false, "include non-commit objects in output")
-	quiet := flags.Bool("quiet", false, "prevent printing of revisions")
-	flags.Parse(args)
-	args = flags.Args()
+	var err error
+	switch arg {
+	case "-i", "--regexp-ignore-case":
+		opts.IgnoreCase = true
+	case "-E", "--extended-regexp":
+		opts.ExtendedRegexp = true
+	case "--all-match":
+		opts.AllMatch = true
+	case "--merges":
+		opts.Merges = true
+	case "--no-merges":
+		opts.NoMerges = true
+	case "--first-parent":
+		opts.FirstParent = true
+	case "--topo-order":
+		opts.TopoOrder = true
+	case "--date-order":
+		opts.DateOrder = true
+	case "--reverse":
+		opts.Reverse = true
+	default:
+		if v, n, ok := value("--max-count", "-n"); ok {
+			opts.MaxCount, err = maxCount(v)
+			return n, err
+		}
+		if strings.HasPrefix(arg, "-n") {
+			opts.MaxCount, err = maxCount(arg[2:])
+			return 1, err
+		}
+		if len(arg) > 1 && arg[0] == '-' && arg[1] >= '0' && arg[1] <= '9' {
+			opts.MaxCount, err = maxCount(arg[1:])
+			return 1, err
+		}
+		if v, n, ok := value("--skip"); ok {
+			opts.Skip, err = number(v)
+			return n, err
+		}
+		if v, n, ok := value("--since", "--after"); ok {
+			opts.Since, err = date(v)
+			return n, err
+		}
+		if v, n, ok := value("--until", "--before"); ok {
+			opts.Until, err = date(v)
+			return n, err
+		}
+		if v, n, ok := value("--author"); ok {
+			opts.Author = append(opts.Author, v)
+			return n, nil
+		}
+		if v, n, ok := value("--committer"); ok {
+			opts.Committer = append(opts.Committer, v)
+			return n, nil
+		}
+		if v, n, ok := value("--grep"); ok {
+			opts.Grep = append(opts.Grep, v)
+			return n, nil
+		}
+		return 0, nil
+	}
+	return 1, nil
+}
 
-	excludeList := make(map[string]bool)
-	// First get a map of excluded commitIDs
-	for _, rev := range args {
-		if rev == "" {
-			continue
+// Implements "git rev-list". Options are parsed by hand instead of with
+// the flag package, since options such as --not and --all need to stay
+// in order with the revisions.
+func RevList(c *git.Client, args []string) ([]git.Sha1, error) {
+	var opts git.RevListOptions
+	var revs []string
+	var quiet, stdin, count, parents bool
+	var pretty prettyArgs
+	commitHeader := true
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			for _, p := range args[i+1:] {
+				path, err := git.File(p).IndexPath(c)
+				if err != nil {
+					return nil, err
+				}
+				opts.Paths = append(opts.Paths, git.IndexPath(strings.TrimSuffix(string(path), "/")))
+			}
+			break
 		}
-		if rev[0] == '^' && len(rev) > 1 {
-			commits, err := RevParse(c, []string{rev[1:]})
+		switch arg {
+		case "--objects":
+			opts.Objects = true
+		case "--quiet":
+			quiet = true
+		case "--boundary":
+			opts.Boundary = true
+		case "--left-right":
+			opts.LeftRight = true
+		case "--cherry-mark":
+			opts.CherryMark = true
+		case "--stdin":
+			stdin = true
+		case "--count":
+			count = true
+		case "--parents":
+			parents = true
+			opts.RewriteParents = true
+		case "--children":
+			opts.Children = true
+			opts.RewriteParents = true
+		case "--commit-header":
+			commitHeader = true
+		case "--no-commit-header":
+			commitHeader = false
+		default:
+			if n := parsePrettyOption(args[i:], &pretty); n > 0 {
+				i += n - 1
+				continue
+			}
+			n, err := parseWalkOption(args[i:], &opts.WalkOptions)
 			if err != nil {
-				panic(rev + ":" + err.Error())
+				return nil, err
+			}
+			if n == 0 {
+				revs = append(revs, arg)
+				continue
+			}
+			i += n - 1
+		}
+	}
+	if stdin {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				revs = append(revs, line)
 			}
-			for _, commit := range commits {
-				ancestors := commit.Ancestors(c)
-				for _, allC := range ancestors {
-					excludeList[git.Sha1(allC).String()] = true
-					if *includeObjects {
-						objs, err := allC.GetAllObjects(c)
-						if err != nil {
-							panic(err)
-						}
-						for _, o := range objs {
-							excludeList[o.String()] = true
-						}
-					}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
 
-				}
+	// Commits are only formatted if one of the pretty options was
+	// given.
+	var format git.PrettyFormat
+	var formatter *git.CommitFormatter
+	if pretty.formatSet {
+		var err error
+		if format, formatter, err = pretty.formatter(c, false, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := git.RevList(c, opts, revs)
+	if err != nil {
+		return nil, err
+	}
+	if count {
+		var left, right, same int
+		for _, e := range entries {
+			switch {
+			case e.Object || e.Boundary:
+			case opts.CherryMark && e.Equivalent:
+				same++
+			case e.Left:
+				left++
+			default:
+				right++
 			}
 		}
+		switch {
+		case opts.LeftRight && opts.CherryMark:
+			fmt.Printf("%d\t%d\t%d\n", left, right, same)
+		case opts.LeftRight:
+			fmt.Printf("%d\t%d\n", left, right)
+		case opts.CherryMark:
+			fmt.Printf("%d\t%d\n", left+right, same)
+		default:
+			fmt.Println(left + right)
+		}
+		quiet = true
 	}
-	objs := make([]git.Sha1, 0)
-	// Then follow the parents of the non-excluded ones until they hit
-	// something that was excluded.
-	for _, rev := range args {
-		if rev == "" {
+
+	objs := make([]git.Sha1, 0, len(entries))
+	for _, e := range entries {
+		objs = append(objs, e.Id)
+		if quiet {
 			continue
 		}
-		if rev[0] == '^' && len(rev) > 1 {
+		if e.Object {
+			fmt.Printf("%v %v\n", e.Id, e.Path)
 			continue
 		}
-		commits, err := RevParse(c, []string{rev})
-		if err != nil {
-			panic(err)
-		}
-		com := commits[0]
-		ancestors := com.Ancestors(c)
-		for _, allC := range ancestors {
-			if _, ok := excludeList[git.Sha1(allC).String()]; !ok {
-				if !*quiet {
-					fmt.Printf("%v\n", git.Sha1(allC).String())
-				}
-				objs = append(objs, git.Sha1(allC))
-				if *includeObjects {
-					objs2, err := allC.GetAllObjects(c)
-					if err != nil {
-						panic(err)
-					}
-					for _, o := range objs2 {
-						if _, okie := excludeList[o.String()]; !okie {
-							if !*quiet {
-								fmt.Printf("%v\n", o.String())
-							}
-							objs = append(objs, git.Sha1(o))
-						}
-						excludeList[o.String()] = true
-					}
-				}
+		if formatter != nil && format.IsUserFormat() && !commitHeader {
+			if err := printRevListCommit(formatter, e); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if formatter != nil && format.Name != "oneline" {
+			fmt.Print("commit ")
+		}
+		switch {
+		case e.Boundary:
+			fmt.Print("-")
+		case opts.CherryMark && e.Equivalent:
+			fmt.Print("=")
+		case opts.LeftRight && e.Left:
+			fmt.Print("<")
+		case opts.LeftRight:
+			fmt.Print(">")
+		case opts.CherryMark:
+			fmt.Print("+")
+		}
+		if pretty.abbrevCommit {
+			fmt.Print(e.Id.Abbrev(c, 0))
+		} else {
+			fmt.Print(e.Id)
+		}
+		if parents {
+			for _, p := range e.Parents {
+				fmt.Printf(" %v", p)
+			}
+		}
+		if opts.Children {
+			for _, child := range e.Children {
+				fmt.Printf(" %v", child)
 			}
 		}
+		if formatter == nil {
+			fmt.Println()
+			continue
+		}
+		if format.Name == "oneline" {
+			fmt.Print(" ")
+		} else {
+			fmt.Println()
+		}
+		if err := printRevListCommit(formatter, e); err != nil {
+			return nil, err
+		}
 	}
 	return objs, nil
 }
+
+// Prints the commit for rev-list with one of the pretty options, after the
+// line with its id. Unlike log, each non-empty commit is followed by a
+// newline, whatever the format.
+func printRevListCommit(formatter *git.CommitFormatter, e git.RevListEntry) error {
+	msg, err := formatter.Format(git.CommitID(e.Id), e.Parents)
+	if err != nil {
+		return err
+	}
+	if msg != "" {
+		fmt.Println(msg)
+	}
+	return nil
+}
@@ -1,9 +1,296 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
 	"github.com/driusan/dgit/git"
 )
 
-func RevParse(c *git.Client, args []string) (commits []git.ParsedRevision, err2 error) {
+// Parses args into revisions without any options, for commands which
+// take revisions as arguments.
+func revParse(c *git.Client, args []string) (commits []git.ParsedRevision, err2 error) {
 	return git.RevParse(c, git.RevParseOptions{}, args)
 }
+
+// Returned by RevParse when --verify fails with --quiet, in which case no
+// error should be printed.
+var VerifyFailed error = errors.New("Needed a single revision")
+
+// Returned by RevParse when --parseopt fails or shows the usage, after
+// the message has been printed. git exits with status 129 in this case.
+var ParseOptFailed error = errors.New("Could not parse options")
+
+const parseOptUsage = `usage: git rev-parse --parseopt [<options>] -- [<args>...]
+
+    --keep-dashdash       keep the ` + "`--`" + ` passed as an arg
+    --stop-at-non-option  stop parsing after the first non-option argument
+    --stuck-long          output in stuck long form
+
+`
+
+// Implements "git rev-parse --parseopt", reading the option specification
+// from stdin.
+func revParseParseOpt(args []string) error {
+	var opts git.RevParseOptions
+	for i, arg := range args {
+		switch arg {
+		case "--keep-dashdash":
+			opts.KeepDashDash = true
+		case "--stop-at-non-option":
+			opts.StopAtNonOption = true
+		case "--stuck-long":
+			opts.StuckLong = true
+		case "--":
+			out, err := git.RevParseParseOpt(opts, os.Stdin, args[i+1:])
+			switch e := err.(type) {
+			case nil:
+				fmt.Println(out)
+				return nil
+			case git.ParseOptError:
+				if e.Err != nil {
+					fmt.Fprintf(os.Stderr, "error: %v\n", e.Err)
+				}
+				if e.Help {
+					fmt.Printf("cat <<\\EOF\n%sEOF\n", e.Usage)
+				} else {
+					fmt.Fprint(os.Stderr, e.Usage)
+				}
+				return ParseOptFailed
+			default:
+				return err
+			}
+		default:
+			if strings.HasPrefix(arg, "--") {
+				fmt.Fprintf(os.Stderr, "error: unknown option `%s'\n", arg[2:])
+			}
+			fmt.Fprint(os.Stderr, parseOptUsage)
+			return ParseOptFailed
+		}
+	}
+	fmt.Fprint(os.Stderr, parseOptUsage)
+	return ParseOptFailed
+}
+
+// Implements "git rev-parse". Options are parsed by hand instead of with
+// the flag package, since rev-parse passes unknown options through to
+// its output and the output is in the same order as the arguments.
+func RevParse(c *git.Client, args []string) error {
+	// --parseopt and --sq-quote are separate modes, which are only
+	// recognized as the first argument.
+	if len(args) > 0 {
+		switch args[0] {
+		case "--parseopt":
+			return revParseParseOpt(args[1:])
+		case "--sq-quote":
+			fmt.Println(git.SQQuote(args[1:]))
+			return nil
+		}
+	}
+
+	var opts git.RevParseOptions
+
+	// Options which change the output for all of the arguments are
+	// handled first, since they may come after the revisions.
+	var short, symbolic bool
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			rest = append(rest, args[i:]...)
+			i = len(args)
+		case arg == "--short":
+			short = true
+			opts.Verify = true
+		case strings.HasPrefix(arg, "--short="):
+			n, err := strconv.Atoi(arg[8:])
+			if err != nil || n < 0 {
+				return fmt.Errorf("Invalid length for --short: %s", arg[8:])
+			}
+			opts.Short = uint(n)
+			short = true
+			opts.Verify = true
+		case strings.HasPrefix(arg, "--disambiguate="):
+			opts.Disambiguate = arg[15:]
+		case arg == "--verify":
+			opts.Verify = true
+		case arg == "-q", arg == "--quiet":
+			opts.Quiet = true
+		case arg == "--symbolic":
+			opts.Symbolic = true
+			symbolic = true
+		case arg == "--symbolic-full-name":
+			opts.SymbolicFullName = true
+			symbolic = true
+		case arg == "--abbrev-ref":
+			opts.AbbrefRev = "loose"
+			symbolic = true
+		case strings.HasPrefix(arg, "--abbrev-ref="):
+			opts.AbbrefRev = arg[13:]
+			symbolic = true
+		case arg == "--default":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--default requires an argument")
+			}
+			opts.Default = args[i+1]
+			i++
+		default:
+			rest = append(rest, arg)
+		}
+	}
+
+	print := func(revs []git.ParsedRevision) {
+		for _, rev := range revs {
+			if rev.Excluded {
+				fmt.Print("^")
+			}
+			switch {
+			case symbolic && rev.Name != "":
+				fmt.Println(rev.Name)
+			case short:
+				fmt.Println(rev.Id.Abbrev(c, int(opts.Short)))
+			default:
+				fmt.Println(rev.Id.String())
+			}
+		}
+	}
+
+	// Runs rev-parse with only the file or ref listing option set by
+	// set, and prints the result.
+	files := func(set func(*git.RevParseOptions)) error {
+		var o git.RevParseOptions
+		set(&o)
+		lines, err := git.RevParseFiles(c, o)
+		if err != nil {
+			return err
+		}
+		for _, l := range lines {
+			fmt.Println(l)
+		}
+		return nil
+	}
+	// Listing refs counts as giving revisions for --default.
+	hasRevs := false
+	refs := func(set func(*git.RevParseOptions)) error {
+		hasRevs = true
+		o := opts
+		o.Disambiguate, o.Default, o.Verify = "", "", false
+		set(&o)
+		// --exclude only applies to the next ref listing option.
+		opts.Exclude = ""
+		revs, err := git.RevParse(c, o, nil)
+		if err != nil {
+			return err
+		}
+		print(revs)
+		return nil
+	}
+	pattern := func(arg, option string) git.Pattern {
+		if arg == option {
+			return "*"
+		}
+		return git.Pattern(strings.TrimPrefix(arg, option+"="))
+	}
+
+	if opts.Disambiguate != "" {
+		revs, err := git.RevParse(c, opts, nil)
+		if err != nil {
+			return err
+		}
+		print(revs)
+	}
+	var err error
+	var verify []string
+	for i := 0; i < len(rest); i++ {
+		arg := rest[i]
+		switch {
+		case arg == "--":
+			// Everything after -- is a path, which is passed
+			// through.
+			for _, path := range rest[i:] {
+				fmt.Println(path)
+			}
+			i = len(rest)
+		case arg == "--git-dir":
+			err = files(func(o *git.RevParseOptions) { o.GitDir = true })
+		case arg == "--absolute-git-dir":
+			err = files(func(o *git.RevParseOptions) { o.AbsoluteGitDir = true })
+		case arg == "--git-common-dir":
+			err = files(func(o *git.RevParseOptions) { o.GitCommonDir = true })
+		case arg == "--is-inside-git-dir":
+			err = files(func(o *git.RevParseOptions) { o.IsInsideGitDir = true })
+		case arg == "--is-inside-work-tree":
+			err = files(func(o *git.RevParseOptions) { o.IsInsideWorkTree = true })
+		case arg == "--is-bare-repository":
+			err = files(func(o *git.RevParseOptions) { o.IsBareRepository = true })
+		case arg == "--show-cdup":
+			err = files(func(o *git.RevParseOptions) { o.ShowCDup = true })
+		case arg == "--show-prefix":
+			err = files(func(o *git.RevParseOptions) { o.ShowPrefix = true })
+		case arg == "--show-toplevel":
+			err = files(func(o *git.RevParseOptions) { o.ShowToplevel = true })
+		case arg == "--resolve-git-dir", arg == "--git-path":
+			if i+1 >= len(rest) {
+				return fmt.Errorf("%s requires an argument", arg)
+			}
+			path := git.File(rest[i+1])
+			i++
+			if arg == "--git-path" {
+				err = files(func(o *git.RevParseOptions) { o.GitPath = path })
+			} else {
+				err = files(func(o *git.RevParseOptions) { o.ResolveGitDir = path })
+			}
+		case arg == "--not":
+			opts.Not = !opts.Not
+		case strings.HasPrefix(arg, "--exclude="):
+			opts.Exclude = git.Pattern(arg[10:])
+		case arg == "--all":
+			err = refs(func(o *git.RevParseOptions) { o.All = true })
+		case arg == "--branches" || strings.HasPrefix(arg, "--branches="):
+			err = refs(func(o *git.RevParseOptions) { o.Branches = pattern(arg, "--branches") })
+		case arg == "--tags" || strings.HasPrefix(arg, "--tags="):
+			err = refs(func(o *git.RevParseOptions) { o.Tags = pattern(arg, "--tags") })
+		case arg == "--remotes" || strings.HasPrefix(arg, "--remotes="):
+			err = refs(func(o *git.RevParseOptions) { o.Remotes = pattern(arg, "--remotes") })
+		case strings.HasPrefix(arg, "--glob="):
+			err = refs(func(o *git.RevParseOptions) { o.Glob = pattern(arg, "--glob") })
+		case len(arg) > 1 && arg[0] == '-':
+			// Unknown options are passed through, so that scripts
+			// can pass them along to other commands.
+			fmt.Println(arg)
+		case opts.Verify:
+			// The revisions are verified together at the end.
+			verify = append(verify, arg)
+		default:
+			hasRevs = true
+			var revs []git.ParsedRevision
+			if revs, err = git.RevParse(c, opts, []string{arg}); err == nil {
+				print(revs)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if opts.Verify {
+		revs, err := git.RevParse(c, opts, verify)
+		if err != nil {
+			if opts.Quiet {
+				return VerifyFailed
+			}
+			return err
+		}
+		print(revs)
+	} else if !hasRevs && opts.Default != "" {
+		revs, err := git.RevParse(c, opts, nil)
+		if err != nil {
+			return err
+		}
+		print(revs)
+	}
+	return nil
+}
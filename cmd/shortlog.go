@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/driusan/dgit/git"
+)
+
+// Implements "git shortlog". Like log, options are parsed by hand instead
+// of with the flag package, since the revisions and paths need to stay in
+// order.
+func Shortlog(c *git.Client, args []string) error {
+	var opts git.ShortlogOptions
+	var logOpts git.LogOptions
+	var revs []string
+	var summary bool
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) > 2 && arg[0] == '-' && strings.Trim(arg[1:], "nsec") == "" {
+			// Short options may be combined, as in -sne.
+			var split []string
+			for _, c := range arg[1:] {
+				split = append(split, "-"+string(c))
+			}
+			args = append(append(args[:i:i], split...), args[i+1:]...)
+			arg = args[i]
+		}
+		if arg == "--" {
+			for _, p := range args[i+1:] {
+				if err := addPathArg(c, &logOpts.Paths, p); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		switch arg {
+		case "-n", "--numbered":
+			opts.Numbered = true
+		case "-s", "--summary":
+			summary = true
+		case "-e", "--email":
+			opts.Email = true
+		case "-c", "--committer":
+			opts.Groups = append(opts.Groups, "committer")
+		case "--group":
+			if i+1 >= len(args) {
+				return fmt.Errorf("option `group' requires a value")
+			}
+			opts.Groups = append(opts.Groups, args[i+1])
+			i++
+		default:
+			if strings.HasPrefix(arg, "--group=") {
+				opts.Groups = append(opts.Groups, arg[len("--group="):])
+				continue
+			}
+			if isRefOption(arg) {
+				revs = append(revs, arg)
+				continue
+			}
+			n, err := parseWalkOption(args[i:], &logOpts.WalkOptions)
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				i += n - 1
+				continue
+			}
+			if strings.HasPrefix(arg, "-") {
+				return fmt.Errorf("unknown option `%s'", strings.TrimLeft(arg, "-"))
+			}
+			if err := addRevisionOrPath(c, &revs, &logOpts.Paths, arg); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Like git, the commits are read from the output of log on stdin if
+	// there aren't any revisions and stdin isn't a terminal.
+	var groups []git.ShortlogGroup
+	stat, err := os.Stdin.Stat()
+	if len(revs) == 0 && err == nil && stat.Mode()&os.ModeCharDevice == 0 {
+		groups, err = git.ShortlogFromLog(c, opts, os.Stdin)
+	} else {
+		if len(revs) == 0 {
+			revs = []string{"HEAD"}
+		}
+		var entries []git.LogEntry
+		if entries, err = git.Log(c, logOpts, revs); err != nil {
+			return err
+		}
+		commits := make([]git.CommitID, len(entries))
+		for i, e := range entries {
+			commits[i] = e.Id
+		}
+		groups, err = git.Shortlog(c, opts, commits)
+	}
+	if err != nil {
+		return err
+	}
+	printShortlog(groups, summary)
+	return nil
+}
+
+// Prints the groups of commits for shortlog, or only the number of commits
+// in each group if summary is set.
+func printShortlog(groups []git.ShortlogGroup, summary bool) {
+	for _, g := range groups {
+		if summary {
+			fmt.Printf("%6d\t%s\n", len(g.Subjects), g.Ident)
+			continue
+		}
+		fmt.Printf("%s (%d):\n", g.Ident, len(g.Subjects))
+		for _, s := range g.Subjects {
+			fmt.Printf("      %s\n", s)
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/driusan/dgit/git"
+)
+
+// Prints the entries at the top level of a tree, in the order that
+// they're in the tree, with a "/" after the names of subtrees.
+func showTree(c *git.Client, tree git.TreeID) error {
+	entries, err := tree.GetAllObjects(c, "", false, false)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name, e := range entries {
+		if e.FileMode == git.ModeTree {
+			names = append(names, name.String()+"/")
+		} else {
+			names = append(names, name.String())
+		}
+	}
+	// Trees are sorted as if the names of subtrees end with a "/", so
+	// this is the same order.
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+// Shows the object named name, which has the id id.
+func (l *logPrinter) showObject(id git.Sha1, name string) error {
+	switch t := id.Type(l.c); t {
+	case "commit":
+		if len(l.paths) > 0 {
+			// Like git, commits which don't change the paths,
+			// including merges with an empty combined diff for
+			// them, aren't shown at all.
+			same, err := git.IsTreeSame(l.c, git.CommitID(id), l.paths)
+			if err != nil || same {
+				return err
+			}
+		}
+		parents, err := git.CommitID(id).Parents(l.c)
+		if err != nil {
+			return err
+		}
+		return l.print(git.LogEntry{Id: git.CommitID(id), Parents: parents})
+	case "tag":
+		tag, target, err := l.formatter.FormatTag(id)
+		if err != nil {
+			return err
+		}
+		if l.shown {
+			fmt.Println()
+		}
+		fmt.Print(tag)
+		l.shown = true
+		// Like git, the tagged object is shown with the tag's name.
+		return l.showObject(target, name)
+	case "tree":
+		if l.shown {
+			fmt.Println()
+		}
+		fmt.Printf("tree %s\n\n", name)
+		l.shown = true
+		return showTree(l.c, git.TreeID(id))
+	case "blob":
+		obj, err := l.c.GetObject(id)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(obj.GetContent())
+		return err
+	default:
+		return fmt.Errorf("unknown type %s of object %s", t, id)
+	}
+}
+
+// Implements "git show". Like log, options are parsed by hand instead of
+// with the flag package, since the objects and paths need to stay in
+// order.
+func Show(c *git.Client, args []string) error {
+	var names []string
+	var paths []git.IndexPath
+	var format changeFormat
+	var pretty prettyArgs
+	var noOutput bool
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			for _, p := range args[i+1:] {
+				if err := addPathArg(c, &paths, p); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		switch arg {
+		case "-p", "-u", "--patch":
+			format.Patch = true
+			noOutput = false
+		case "-s", "--no-patch":
+			format.Stat, format.Patch = false, false
+			noOutput = true
+		case "--stat":
+			format.Stat = true
+		case "--name-only":
+			format.NameOnly = true
+		case "--name-status":
+			format.NameStatus = true
+		default:
+			if n := parsePrettyOption(args[i:], &pretty); n > 0 {
+				i += n - 1
+				continue
+			}
+			if strings.HasPrefix(arg, "-") {
+				return fmt.Errorf("unrecognized argument: %s", arg)
+			}
+			if err := addRevisionOrPath(c, &names, &paths, arg); err != nil {
+				return err
+			}
+		}
+	}
+	if err := format.checkExclusive(noOutput); err != nil {
+		return err
+	}
+	if !format.any() && !noOutput {
+		// The patch is only the default if no other format was
+		// asked for.
+		format.Patch = true
+	}
+	if len(names) == 0 {
+		names = []string{"HEAD"}
+	}
+
+	l := &logPrinter{
+		c:            c,
+		abbrevCommit: pretty.abbrevCommit,
+		format:       format,
+		paths:        paths,
+		combined:     true,
+	}
+	var err error
+	pretty.defaultMailmap(c)
+	if l.pretty, l.formatter, err = pretty.formatter(c, true, nil); err != nil {
+		return err
+	}
+	for _, name := range names {
+		id, err := git.RevParseObject(c, &git.RevParseOptions{}, name)
+		if err != nil {
+			return err
+		}
+		if err := l.showObject(id, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/driusan/dgit/git"
+)
+
+var NoMatchingRefs error = errors.New("No matching refs")
+
+func ShowRef(c *git.Client, args []string) error {
+	flags := flag.NewFlagSet("show-ref", flag.ExitOnError)
+	flags.Usage = func() {
+		flag.Usage()
+		fmt.Fprintf(os.Stderr, "\nshow-ref options:\n\n")
+		flags.PrintDefaults()
+	}
+
+	opts := git.ShowRefOptions{}
+	flags.BoolVar(&opts.IncludeHead, "head", false, "Show the HEAD reference, even if it would normally be filtered out")
+	flags.BoolVar(&opts.Heads, "heads", false, "Limit to refs/heads")
+	flags.BoolVar(&opts.Tags, "tags", false, "Limit to refs/tags")
+	flags.BoolVar(&opts.Verify, "verify", false, "Enable stricter reference checking by requiring an exact ref path")
+	flags.BoolVar(&opts.Exists, "exists", false, "Check whether the given reference exists")
+
+	dereference := flags.Bool("dereference", false, "Dereference tags into object IDs as well")
+	d := flags.Bool("d", false, "Alias of --dereference")
+	hash := flags.Bool("hash", false, "Only show the SHA-1 hash, not the reference name")
+	s := flags.Bool("s", false, "Alias of --hash")
+	quiet := flags.Bool("quiet", false, "Do not print any results to stdout")
+	q := flags.Bool("q", false, "Alias of --quiet")
+	flags.Parse(args)
+
+	*dereference = *dereference || *d
+	*hash = *hash || *s
+	*quiet = *quiet || *q
+
+	refs, err := git.ShowRef(c, opts, flags.Args())
+	if err != nil {
+		return err
+	}
+	if opts.Exists {
+		return nil
+	}
+	if len(refs) == 0 {
+		return NoMatchingRefs
+	}
+	if *quiet {
+		return nil
+	}
+	for _, ref := range refs {
+		if *hash {
+			fmt.Println(ref.Value)
+		} else {
+			fmt.Printf("%s %s\n", ref.Value, ref.Name)
+		}
+		if *dereference {
+			peeled, err := ref.Peeled(c)
+			if err != nil {
+				return err
+			}
+			if peeled == ref.Value {
+				continue
+			}
+			// git includes the name of peeled refs even with
+			// --hash.
+			fmt.Printf("%s %s^{}\n", peeled, ref.Name)
+		}
+	}
+	return nil
+}
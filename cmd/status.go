@@ -264,6 +264,11 @@ func getStatus(c *git.Client, prefix string) (string, error) {
 	return msg, nil
 }
 func Status(c *git.Client, args []string) error {
+	if head := c.GetHeadBranch(); head != "" {
+		fmt.Printf("On branch %s\n", head.BranchName())
+	} else if id, err := c.GetHeadCommit(); err == nil {
+		fmt.Printf("%s\n", detachedHead(c, id))
+	}
 	s, err := getStatus(c, "")
 	if err != nil {
 		return err
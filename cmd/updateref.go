@@ -21,7 +21,7 @@ func UpdateRef(c *git.Client, args []string) error {
 	reason := flags.String("m", "", "Reason to record in reflog for updating the reference")
 	flags.BoolVar(&opts.Delete, "d", false, "Delete the reference after verifying oldvalue")
 	flags.BoolVar(&opts.NoDeref, "no-deref", false, "Do not dereference symbolic references")
-	flags.BoolVar(&opts.NoDeref, "create-reflog", false, "Create a reflog if it doesn't exist")
+	flags.BoolVar(&opts.CreateReflog, "create-reflog", false, "Create a reflog if it doesn't exist")
 
 	stdin := flags.Bool("stdin", false, "Read references from stdin in batch mode")
 	flags.BoolVar(&opts.NullTerminate, "z", false, `Use \0 instead of \n to terminate lines in batch mode`)
@@ -30,7 +30,12 @@ func UpdateRef(c *git.Client, args []string) error {
 	vals := flags.Args()
 
 	if *stdin {
+		if len(vals) != 0 {
+			flags.Usage()
+			return fmt.Errorf("Invalid usage")
+		}
 		opts.Stdin = os.Stdin
+		return git.UpdateRef(c, opts, "", git.CommitID{}, *reason)
 	}
 
 	switch len(vals) {
@@ -49,19 +54,21 @@ func UpdateRef(c *git.Client, args []string) error {
 			return git.UpdateRef(c, opts, vals[0], git.CommitID{}, *reason)
 
 		}
-		cmt, err := git.RevParseCommit(c, &git.RevParseOptions{}, vals[1])
+		// Refs can point to any object, so tags aren't peeled.
+		obj, err := git.RevParseObject(c, &git.RevParseOptions{}, vals[1])
 		if err != nil {
-			return fmt.Errorf("Invalid commit %s", vals[1])
+			return fmt.Errorf("%s: not a valid SHA1", vals[1])
 		}
-		return git.UpdateRef(c, opts, vals[0], cmt, *reason)
+		return git.UpdateRef(c, opts, vals[0], git.CommitID(obj), *reason)
 	case 3:
 		if opts.Delete {
 			// There is no delete variaton with 3 parameters, abort.
 			break
 		}
-		cmt, err := git.RevParseCommit(c, &git.RevParseOptions{}, vals[1])
+		// Refs can point to any object, so tags aren't peeled.
+		obj, err := git.RevParseObject(c, &git.RevParseOptions{}, vals[1])
 		if err != nil {
-			return fmt.Errorf("Invalid commit %s", vals[1])
+			return fmt.Errorf("%s: not a valid SHA1", vals[1])
 		}
 		oldval, err := git.CommitIDFromString(vals[2])
 		if err != nil {
@@ -69,7 +76,7 @@ func UpdateRef(c *git.Client, args []string) error {
 		}
 		opts.OldValue = oldval
 
-		return git.UpdateRef(c, opts, vals[0], cmt, *reason)
+		return git.UpdateRef(c, opts, vals[0], git.CommitID(obj), *reason)
 	}
 	flags.Usage()
 	return fmt.Errorf("Invalid usage")
@@ -0,0 +1,371 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BranchOptions represents the options that may be passed to "git branch".
+type BranchOptions struct {
+	// Allow deleting branches that aren't merged, and overwriting
+	// existing branches when creating, renaming or copying.
+	Force bool
+
+	// Operate on remote-tracking branches instead of local branches.
+	Remotes bool
+
+	// List both local and remote-tracking branches.
+	All bool
+
+	// Only list branches which contain this commit.
+	Contains Commitish
+
+	// Only list branches which are reachable from Merged.
+	Merged Commitish
+
+	// Only list branches which are not reachable from NoMerged.
+	NoMerged Commitish
+}
+
+// Returns the upstream that b is configured to track with the
+// branch.<name>.remote and branch.<name>.merge config variables, or the
+// empty string if it isn't tracking anything.
+func (b Branch) Upstream(c *Client) RefSpec {
+	if !RefSpec(b).HasPrefix("refs/heads/") {
+		return ""
+	}
+	name := b.BranchName()
+	remote := c.GetConfig("branch." + name + ".remote")
+	merge := c.GetConfig("branch." + name + ".merge")
+	if remote == "" || merge == "" {
+		return ""
+	}
+	if remote == "." {
+		return RefSpec(merge)
+	}
+	return RefSpec("refs/remotes/" + remote + "/" + strings.TrimPrefix(merge, "refs/heads/"))
+}
+
+// Returns the number of commits in a which are not in b (ahead), and the
+// number of commits in b which are not in a (behind.)
+func AheadBehind(c *Client, a, b Commitish) (ahead, behind int, err error) {
+	acmt, err := a.CommitID(c)
+	if err != nil {
+		return 0, 0, err
+	}
+	bcmt, err := b.CommitID(c)
+	if err != nil {
+		return 0, 0, err
+	}
+	// Like "rev-list --left-right a...b", paint the history of both
+	// down to their merge bases, and stop once only the commits that
+	// they have in common are left.
+	w := newRevWalker(c)
+	w.flags[acmt] |= symmetricLeft
+	w.flags[bcmt] |= symmetricRight
+	commits, err := w.limit([]CommitID{acmt, bcmt})
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, cmt := range commits {
+		if w.flags[cmt.Id]&symmetricLeft != 0 {
+			ahead++
+		} else {
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
+
+// Implements "git branch --list". It returns the branches matching any of
+// patterns (or all branches, if there are no patterns) after applying the
+// filters from opts. Local branches come before remote-tracking branches
+// when both are listed.
+func BranchList(c *Client, opts BranchOptions, patterns []string) ([]Branch, error) {
+	var prefixes []string
+	switch {
+	case opts.All:
+		prefixes = []string{"refs/heads/", "refs/remotes/"}
+	case opts.Remotes:
+		prefixes = []string{"refs/remotes/"}
+	default:
+		prefixes = []string{"refs/heads/"}
+	}
+
+	var exclude map[RefSpec]bool
+	if opts.NoMerged != nil {
+		merged, err := ForEachRef(c, ForEachRefOptions{Merged: opts.NoMerged}, prefixes)
+		if err != nil {
+			return nil, err
+		}
+		exclude = make(map[RefSpec]bool)
+		for _, ref := range merged {
+			exclude[ref.Name] = true
+		}
+	}
+
+	var branches []Branch
+	for _, prefix := range prefixes {
+		refs, err := ForEachRef(c, ForEachRefOptions{Merged: opts.Merged, Contains: opts.Contains}, []string{prefix})
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range refs {
+			if exclude[ref.Name] {
+				continue
+			}
+			if opts.NoMerged != nil && ref.Value.Type(c) != "commit" {
+				continue
+			}
+			if len(patterns) > 0 {
+				name := strings.TrimPrefix(ref.Name.String(), prefix)
+				matched := false
+				for _, p := range patterns {
+					if matchesWildcard(p, name) {
+						matched = true
+						break
+					}
+				}
+				if !matched {
+					continue
+				}
+			}
+			branches = append(branches, Branch(ref.Name))
+		}
+	}
+	return branches, nil
+}
+
+// Creates the branch name pointing at the commit start, or HEAD if start
+// is empty. If opts.Force is set, an existing branch is reset to start, as
+// long as it's not the current branch. start is recorded in the reflog as
+// it was given.
+func BranchCreate(c *Client, opts BranchOptions, name, start string) error {
+	if start == "" {
+		start = "HEAD"
+	}
+	id, err := RevParseCommit(c, &RevParseOptions{}, start)
+	if err != nil {
+		return fmt.Errorf("fatal: not a valid object name: '%s'", start)
+	}
+	b := Branch("refs/heads/" + name)
+	if !opts.Force || !b.Exists(c) {
+		return c.createBranch(name, id, start)
+	}
+	if c.GetHeadBranch() == b {
+		return fmt.Errorf("fatal: cannot force update the branch '%s' checked out at '%s'", name, c.WorkDir)
+	}
+	if err := validateBranchName(name); err != nil {
+		return err
+	}
+	t := NewRefTransaction(c)
+	if err := t.Update(b.String(), Sha1(id), nil, true, "branch: Reset to "+start); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+// Implements "git branch -d". It deletes the branch name and its config,
+// returning the commit that it pointed to. Unless opts.Force is set, the
+// branch must be merged into its upstream (or HEAD, if it doesn't have
+// one.) If opts.Remotes is set, name is a remote-tracking branch.
+func BranchDelete(c *Client, opts BranchOptions, name string) (CommitID, error) {
+	var b Branch
+	if opts.Remotes {
+		b = Branch("refs/remotes/" + name)
+		if !b.Exists(c) {
+			return CommitID{}, fmt.Errorf("error: remote-tracking branch '%s' not found.", name)
+		}
+	} else {
+		b = Branch("refs/heads/" + name)
+		if !b.Exists(c) {
+			return CommitID{}, fmt.Errorf("error: branch '%s' not found.", name)
+		}
+		if c.GetHeadBranch() == b {
+			return CommitID{}, fmt.Errorf("error: Cannot delete branch '%s' checked out at '%s'", name, c.WorkDir)
+		}
+	}
+	id, err := b.CommitID(c)
+	if err != nil {
+		return CommitID{}, err
+	}
+
+	if !opts.Force && !opts.Remotes {
+		var into Commitish = SymbolicRef("HEAD")
+		if upstream := b.Upstream(c); upstream != "" && upstream.Exists(c) {
+			into = upstream
+		}
+		if target, err := into.CommitID(c); err == nil && target != id && !id.IsAncestor(c, target) {
+			return CommitID{}, fmt.Errorf("error: The branch '%s' is not fully merged.\nIf you are sure you want to delete it, run 'git branch -D %s'.", name, name)
+		}
+	}
+
+	t := NewRefTransaction(c)
+	old := Sha1(id)
+	if err := t.Delete(b.String(), &old, true, ""); err != nil {
+		return CommitID{}, err
+	}
+	if err := t.Commit(); err != nil {
+		return CommitID{}, err
+	}
+	if opts.Remotes {
+		return id, nil
+	}
+	return id, c.updateConfig(func(config *GitConfig) error {
+		config.RemoveSection("branch", name)
+		return nil
+	})
+}
+
+// Moves or copies the branch oldname to newname, including its reflog and
+// config. If oldname is the empty string, the current branch is used.
+func moveBranch(c *Client, opts BranchOptions, oldname, newname string, copy bool) error {
+	head := c.GetHeadBranch()
+	if oldname == "" {
+		if head == "" {
+			return DetachedHead
+		}
+		oldname = head.BranchName()
+	}
+	oldb, newb := Branch("refs/heads/"+oldname), Branch("refs/heads/"+newname)
+	if !oldb.Exists(c) {
+		return fmt.Errorf("fatal: No branch named '%s'.", oldname)
+	}
+	if err := validateBranchName(newname); err != nil {
+		return err
+	}
+	if oldb == newb && copy {
+		return fmt.Errorf("fatal: a branch named '%s' already exists", newname)
+	}
+	if oldb != newb && newb.Exists(c) {
+		if !opts.Force {
+			return fmt.Errorf("fatal: a branch named '%s' already exists", newname)
+		}
+		if head == newb {
+			return fmt.Errorf("fatal: cannot force update the branch '%s' checked out at '%s'", newname, c.WorkDir)
+		}
+	}
+	id, err := oldb.CommitID(c)
+	if err != nil {
+		return err
+	}
+
+	verb := "renamed"
+	if copy {
+		verb = "copied"
+	}
+	reason := fmt.Sprintf("Branch: %s %s to %s", verb, oldb, newb)
+
+	if oldb != newb {
+		if err := c.moveRef(RefSpec(oldb), RefSpec(newb), id, reason, copy); err != nil {
+			return err
+		}
+	} else if ReflogExists(c, RefSpec(newb)) {
+		if err := updateReflog(c, false, c.reflogFile(RefSpec(newb)), id, id, reason); err != nil {
+			return err
+		}
+	}
+
+	if !copy && head == oldb {
+		// Like git, record the old branch going away in the HEAD
+		// reflog before pointing HEAD at the new one.
+		if ReflogExists(c, "HEAD") {
+			if err := updateReflog(c, false, c.reflogFile("HEAD"), id, nil, reason); err != nil {
+				return err
+			}
+		}
+		if err := SymbolicRefUpdate(c, SymbolicRefOptions{}, "HEAD", RefSpec(newb), reason); err != nil {
+			return err
+		}
+	}
+	if oldb == newb {
+		return nil
+	}
+	return c.updateConfig(func(config *GitConfig) error {
+		config.RemoveSection("branch", newname)
+		if copy {
+			config.CopySection("branch", oldname, newname)
+		} else {
+			config.RenameSection("branch", oldname, newname)
+		}
+		return nil
+	})
+}
+
+// Implements "git branch -m". Renames the branch oldname (or the current
+// branch, if it's empty) to newname, along with its reflog and config.
+func BranchRename(c *Client, opts BranchOptions, oldname, newname string) error {
+	return moveBranch(c, opts, oldname, newname, false)
+}
+
+// Implements "git branch -c". Copies the branch oldname (or the current
+// branch, if it's empty) to newname, along with its reflog and config.
+func BranchCopy(c *Client, opts BranchOptions, oldname, newname string) error {
+	return moveBranch(c, opts, oldname, newname, true)
+}
+
+// Implements "git branch --set-upstream-to". Configures the branch name
+// (or the current branch, if it's empty) to track upstream, which may be
+// either a remote-tracking branch or a local branch. It returns the
+// upstream ref.
+func BranchSetUpstream(c *Client, name, upstream string) (RefSpec, error) {
+	if name == "" {
+		head := c.GetHeadBranch()
+		if head == "" {
+			return "", DetachedHead
+		}
+		name = head.BranchName()
+	}
+	if !Branch("refs/heads/" + name).Exists(c) {
+		return "", fmt.Errorf("fatal: branch '%s' does not exist", name)
+	}
+
+	var remote, merge string
+	var ref RefSpec
+	if r := RefSpec("refs/remotes/" + upstream); r.Exists(c) {
+		// Find the remote that the remote-tracking branch belongs
+		// to. Remote names can contain slashes, so check the
+		// configured remotes instead of splitting the name.
+		for _, rname := range c.readConfig().Subsections("remote") {
+			if strings.HasPrefix(upstream, rname+"/") {
+				remote = rname
+				merge = "refs/heads/" + strings.TrimPrefix(upstream, rname+"/")
+			}
+		}
+		if remote == "" {
+			return "", fmt.Errorf("fatal: Cannot setup tracking information; starting point '%s' is not a branch.", upstream)
+		}
+		ref = r
+	} else if b := Branch("refs/heads/" + upstream); b.Exists(c) {
+		remote, merge, ref = ".", b.String(), RefSpec(b)
+	} else {
+		return "", fmt.Errorf("fatal: the requested upstream branch '%s' does not exist", upstream)
+	}
+
+	return ref, c.updateConfig(func(config *GitConfig) error {
+		if err := config.SetConfig("branch."+name+".remote", remote); err != nil {
+			return err
+		}
+		return config.SetConfig("branch."+name+".merge", merge)
+	})
+}
+
+// Implements "git branch --unset-upstream". Removes the upstream
+// configuration of the branch name, or the current branch if it's empty.
+func BranchUnsetUpstream(c *Client, name string) error {
+	if name == "" {
+		head := c.GetHeadBranch()
+		if head == "" {
+			return DetachedHead
+		}
+		name = head.BranchName()
+	}
+	if c.GetConfig("branch."+name+".merge") == "" {
+		return fmt.Errorf("fatal: Branch '%s' has no upstream information", name)
+	}
+	return c.updateConfig(func(config *GitConfig) error {
+		config.UnsetConfig("branch." + name + ".remote")
+		config.UnsetConfig("branch." + name + ".merge")
+		return nil
+	})
+}
@@ -0,0 +1,39 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestAheadBehind(t *testing.T) {
+	r := newTestRepo(t)
+	defer r.Close()
+	//     B---C
+	//    /     \
+	//   A---D---E---F
+	//        \
+	//         G
+	r.mergeHistory()
+	r.commit("G", 350, "D")
+
+	tests := []struct {
+		A, B          string
+		Ahead, Behind int
+	}{
+		{"F", "F", 0, 0},
+		{"F", "C", 3, 0},
+		{"C", "F", 0, 3},
+		{"C", "D", 2, 1},
+		{"F", "G", 4, 1},
+		{"G", "A", 2, 0},
+	}
+	for i, tc := range tests {
+		ahead, behind, err := AheadBehind(r.Client, r.commits[tc.A], r.commits[tc.B])
+		if err != nil {
+			t.Errorf("tc %d: %v", i, err)
+			continue
+		}
+		if ahead != tc.Ahead || behind != tc.Behind {
+			t.Errorf("tc %d: %s...%s: got ahead %d behind %d, want ahead %d behind %d", i, tc.A, tc.B, ahead, behind, tc.Ahead, tc.Behind)
+		}
+	}
+}
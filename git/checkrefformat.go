@@ -0,0 +1,132 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CheckRefFormatOptions are the options that may be passed to
+// "git check-ref-format", and that control which names ValidateRefName
+// accepts.
+type CheckRefFormatOptions struct {
+	// Allow names with only one component, such as "HEAD".
+	AllowOnelevel bool
+
+	// Allow a single "*" in the name, as used by refspecs.
+	RefspecPattern bool
+
+	// Remove leading slashes and collapse repeated slashes before
+	// checking the name.
+	Normalize bool
+}
+
+// ValidateRefName returns an error if name is not a valid ref name. The
+// rules are the same ones that "git check-ref-format" uses:
+//
+//   - no component may begin with "." or end with ".lock"
+//   - it must have at least 2 components, unless opts.AllowOnelevel is set
+//   - it can't contain "..", "@{", a backslash, ASCII control characters,
+//     or any of space, "~", "^", ":", "?", "*" or "["
+//   - it can't begin or end with "/", contain "//", end with "." or be "@"
+//
+// Every function that writes refs uses this to make sure that refs can be
+// read back (and parsed as revisions.)
+func ValidateRefName(name string, opts CheckRefFormatOptions) error {
+	if name == "" {
+		return fmt.Errorf("Ref name can not be empty")
+	}
+	if name == "@" {
+		return fmt.Errorf("'%s' is not a valid ref name", name)
+	}
+	if strings.HasSuffix(name, ".") {
+		return fmt.Errorf("'%s' is not a valid ref name: it ends with '.'", name)
+	}
+	if strings.Contains(name, "@{") {
+		return fmt.Errorf("'%s' is not a valid ref name: it contains '@{'", name)
+	}
+	sawStar := false
+	for _, r := range name {
+		if r < ' ' || r == 0x7f {
+			return fmt.Errorf("'%s' is not a valid ref name: it contains a control character", name)
+		}
+		switch r {
+		case '*':
+			if opts.RefspecPattern && !sawStar {
+				sawStar = true
+				continue
+			}
+			return fmt.Errorf("'%s' is not a valid ref name: it contains '%c'", name, r)
+		case ' ', '~', '^', ':', '?', '[', '\\':
+			return fmt.Errorf("'%s' is not a valid ref name: it contains '%c'", name, r)
+		}
+	}
+	components := strings.Split(name, "/")
+	for _, component := range components {
+		switch {
+		case component == "":
+			return fmt.Errorf("'%s' is not a valid ref name: it contains an empty component", name)
+		case strings.HasPrefix(component, "."):
+			return fmt.Errorf("'%s' is not a valid ref name: a component begins with '.'", name)
+		case strings.HasSuffix(component, ".lock"):
+			return fmt.Errorf("'%s' is not a valid ref name: a component ends with '.lock'", name)
+		case strings.Contains(component, ".."):
+			return fmt.Errorf("'%s' is not a valid ref name: it contains '..'", name)
+		}
+	}
+	if len(components) < 2 && !opts.AllowOnelevel {
+		return fmt.Errorf("'%s' is not a valid ref name: it only has one level", name)
+	}
+	return nil
+}
+
+// Removes leading slashes from name and collapses sequences of slashes
+// into a single slash, as is done by check-ref-format --normalize.
+func normalizeRefName(name string) string {
+	for strings.Contains(name, "//") {
+		name = strings.Replace(name, "//", "/", -1)
+	}
+	return strings.TrimPrefix(name, "/")
+}
+
+// Implements "git check-ref-format". It returns the name (after being
+// normalized, if requested), or an error if it's not valid.
+func CheckRefFormat(opts CheckRefFormatOptions, name string) (string, error) {
+	if opts.Normalize {
+		name = normalizeRefName(name)
+	}
+	if err := ValidateRefName(name, opts); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// Returns an error if name is not a valid branch name. Branches must be a
+// valid ref when placed under refs/heads/, and can't be named "HEAD" or
+// start with a "-", since that would be confused with other arguments.
+func validateBranchName(name string) error {
+	if name == "HEAD" || strings.HasPrefix(name, "-") || ValidateRefName("refs/heads/"+name, CheckRefFormatOptions{}) != nil {
+		return fmt.Errorf("fatal: '%s' is not a valid branch name", name)
+	}
+	return nil
+}
+
+// Implements "git check-ref-format --branch". The "@{-n}" syntax is
+// expanded to the name of the nth previously checked out branch, and the
+// resulting branch name is returned if it's valid.
+func CheckBranchName(c *Client, name string) (string, error) {
+	if strings.HasPrefix(name, "@{-") && strings.HasSuffix(name, "}") {
+		if c == nil {
+			return "", fmt.Errorf("Can not expand %s outside of a git repository", name)
+		}
+		n, err := strconv.Atoi(name[3 : len(name)-1])
+		if err != nil {
+			return "", fmt.Errorf("fatal: '%s' is not a valid branch name", name)
+		}
+		return c.previousBranch(n)
+	}
+	if err := validateBranchName(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
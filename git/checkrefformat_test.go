@@ -0,0 +1,54 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestCheckRefFormat(t *testing.T) {
+	tests := []struct {
+		Name  string
+		Opts  CheckRefFormatOptions
+		Want  string
+		Valid bool
+	}{
+		{"refs/heads/master", CheckRefFormatOptions{}, "refs/heads/master", true},
+		{"refs/heads/feature/login", CheckRefFormatOptions{}, "refs/heads/feature/login", true},
+		{"refs/heads/a..b", CheckRefFormatOptions{}, "", false},
+		{"refs/heads/.hidden", CheckRefFormatOptions{}, "", false},
+		{"refs/heads/foo.lock", CheckRefFormatOptions{}, "", false},
+		{"refs/heads/foo.lock/bar", CheckRefFormatOptions{}, "", false},
+		{"refs/heads/foo.", CheckRefFormatOptions{}, "", false},
+		{"refs/heads//foo", CheckRefFormatOptions{}, "", false},
+		{"refs/heads/foo/", CheckRefFormatOptions{}, "", false},
+		{"/refs/heads/foo", CheckRefFormatOptions{}, "", false},
+		{"refs/heads/with space", CheckRefFormatOptions{}, "", false},
+		{"refs/heads/a~1", CheckRefFormatOptions{}, "", false},
+		{"refs/heads/a^", CheckRefFormatOptions{}, "", false},
+		{"refs/heads/a:b", CheckRefFormatOptions{}, "", false},
+		{"refs/heads/a\\b", CheckRefFormatOptions{}, "", false},
+		{"refs/heads/a@{1}", CheckRefFormatOptions{}, "", false},
+		{"refs/heads/a@b", CheckRefFormatOptions{}, "refs/heads/a@b", true},
+		{"refs/heads/tab\t", CheckRefFormatOptions{}, "", false},
+		{"@", CheckRefFormatOptions{AllowOnelevel: true}, "", false},
+
+		{"HEAD", CheckRefFormatOptions{}, "", false},
+		{"HEAD", CheckRefFormatOptions{AllowOnelevel: true}, "HEAD", true},
+
+		{"refs/heads/*", CheckRefFormatOptions{}, "", false},
+		{"refs/heads/*", CheckRefFormatOptions{RefspecPattern: true}, "refs/heads/*", true},
+		{"refs/heads/foo*bar", CheckRefFormatOptions{RefspecPattern: true}, "refs/heads/foo*bar", true},
+		{"refs/*/foo*", CheckRefFormatOptions{RefspecPattern: true}, "", false},
+
+		{"//refs//heads/foo", CheckRefFormatOptions{Normalize: true}, "refs/heads/foo", true},
+		{"/foo", CheckRefFormatOptions{Normalize: true}, "", false},
+	}
+	for i, tc := range tests {
+		got, err := CheckRefFormat(tc.Opts, tc.Name)
+		if (err == nil) != tc.Valid {
+			t.Errorf("tc %d: %q: got %v want valid=%v", i, tc.Name, err, tc.Valid)
+		}
+		if got != tc.Want {
+			t.Errorf("tc %d: got %q want %q", i, got, tc.Want)
+		}
+	}
+}
@@ -2,16 +2,17 @@ package git
 
 import (
 	"bufio"
+	"compress/zlib"
 	"crypto/sha1"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
-
-	"github.com/driusan/dgit/zlib"
 )
 
 // An IndexPath represents a file in the index. ie. a File path relative
@@ -103,6 +104,11 @@ func findGitDir() GitDir {
 		if dirinfo, err := os.Stat(dir + "/.git"); err == nil && dirinfo.IsDir() {
 			return GitDir(dir) + "/.git"
 		}
+		// The directory may be a bare repository, or we may be
+		// inside of a .git directory.
+		if isGitDir(dir) {
+			return GitDir(dir)
+		}
 	}
 	return ""
 }
@@ -132,7 +138,12 @@ func NewClient(gitDir, workDir string) (*Client, error) {
 		// from the gitdir if it doesn't exist.
 	}
 	m := make(map[Sha1]objectLocation)
-	return &Client{GitDir(gitdir), WorkDir(workdir), m}, nil
+	c := &Client{GitDir(gitdir), WorkDir(workdir), m}
+	if workDir == "" && os.Getenv("GIT_WORK_TREE") == "" && c.GetConfig("core.bare") == "true" {
+		// Bare repositories don't have a work tree.
+		c.WorkDir = ""
+	}
+	return c, nil
 }
 
 // Returns the branchname of the HEAD branch, or the empty string if the
@@ -184,26 +195,53 @@ func (c *Client) ResetWorkTree() error {
 	return nil
 }
 
-// Return valid branches that a Client knows about.
+// Return valid branches that a Client knows about, sorted by name. This
+// includes both loose branches and those in the packed-refs file.
 func (c *Client) GetBranches() (branches []Branch, err error) {
-	files, err := ioutil.ReadDir(c.GitDir.String() + "/refs/heads")
+	refs, err := c.GetRefs("refs/heads/")
 	if err != nil {
 		return nil, err
 	}
-	for _, f := range files {
-		branches = append(branches, Branch("refs/heads/"+f.Name()))
+	for _, ref := range refs {
+		branches = append(branches, Branch(ref.Name))
 	}
-	return
+	return branches, nil
 }
 
-// Create a new branch in the Client's git repository.
+// Create a new branch in the Client's git repository. Branch names may be
+// hierarchical (ie. "feature/foo"), but can't conflict with the names of
+// existing branches.
 func (c *Client) CreateBranch(name string, commit Commitish) error {
+	from := ""
+	if b, ok := commit.(Branch); ok {
+		from = b.BranchName()
+	}
+	return c.createBranch(name, commit, from)
+}
+
+// Creates the branch name pointing at commit, recording that it was
+// created from the start point from in the reflog. If from is empty, the
+// commit ID is recorded.
+func (c *Client) createBranch(name string, commit Commitish, from string) error {
+	if err := validateBranchName(name); err != nil {
+		return err
+	}
 	id, err := commit.CommitID(c)
 	if err != nil {
 		return err
 	}
+	if Branch("refs/heads/" + name).Exists(c) {
+		return fmt.Errorf("fatal: a branch named '%s' already exists", name)
+	}
 
-	return c.GitDir.WriteFile(File("refs/heads/"+name), []byte(id.String()), 0644)
+	if from == "" {
+		from = id.String()
+	}
+	t := NewRefTransaction(c)
+	if err := t.Create("refs/heads/"+name, Sha1(id), true, "branch: Created from "+from); err != nil {
+		return err
+	}
+	return t.Commit()
 }
 
 // A Person is usually an Author, but might be a committer. It's someone
@@ -220,29 +258,88 @@ func (p Person) String() string {
 	if p.Time == nil {
 		return fmt.Sprintf("%s <%s>", p.Name, p.Email)
 	}
-	_, tzoff := p.Time.Zone()
-	// for some reason t.Zone() returns the timezone offset in seconds
-	// instead of hours, so convert it to an hour format string
-	tzStr := fmt.Sprintf("%+03d00", tzoff/(60*60))
-	return fmt.Sprintf("%s <%s> %d %s", p.Name, p.Email, p.Time.Unix(), tzStr)
+	return fmt.Sprintf("%s <%s> %d %s", p.Name, p.Email, p.Time.Unix(), p.Time.Format("-0700"))
 
 }
 
-// Returns the author that should be used for a commit message.
-// If time t is provided,
-func (c *Client) GetAuthor(t *time.Time) Person {
-	home := os.Getenv("HOME")
-	if home == "" {
-		home = os.Getenv("home") // On some OSes, it is home
+// Parses a Person from an identity line in a commit or tag, of the form
+// "Name <email> timestamp timezone".
+func parsePerson(ident string) (Person, error) {
+	lt := strings.IndexByte(ident, '<')
+	gt := strings.LastIndexByte(ident, '>')
+	if lt < 0 || gt < lt {
+		return Person{}, fmt.Errorf("Invalid identity: %s", ident)
+	}
+	p := Person{
+		Name:  strings.TrimSpace(ident[:lt]),
+		Email: ident[lt+1 : gt],
+	}
+	fields := strings.Fields(ident[gt+1:])
+	if len(fields) != 2 {
+		// No time, which is fine for things like mailmap.
+		return p, nil
 	}
-	configFile, err := os.Open(home + "/.gitconfig")
-	config := ParseConfig(configFile)
+	unix, err := strconv.ParseInt(fields[0], 10, 64)
 	if err != nil {
-		panic(err)
+		return Person{}, fmt.Errorf("Invalid time in identity: %s", ident)
+	}
+	tz, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return Person{}, fmt.Errorf("Invalid timezone in identity: %s", ident)
+	}
+	// The timezone is in the form +hhmm, not a number of seconds.
+	offset := (tz/100)*60*60 + (tz%100)*60
+	t := time.Unix(unix, 0).In(time.FixedZone(fields[1], offset))
+	p.Time = &t
+	return p, nil
+}
+
+// Returns the author that should be used for a commit message, from the
+// user.name and user.email config variables of the repository or the
+// user's global config. The time of the Person is set to t.
+func (c *Client) GetAuthor(t *time.Time) (Person, error) {
+	config := c.readConfig()
+	name := config.GetConfig("user.name")
+	email := config.GetConfig("user.email")
+	if name == "" || email == "" {
+		return Person{}, fmt.Errorf("Author identity unknown. Please set user.name and user.email in your git config.")
 	}
+	return Person{name, email, t}, nil
+}
 
+// Returns the identity to record in reflog entries. Unlike commits, git
+// doesn't require an identity to be configured to update a ref, so any
+// part of it that's missing from the config falls back to the user's
+// account and host name.
+func (c *Client) reflogIdentity(t *time.Time) Person {
+	config := c.readConfig()
 	name := config.GetConfig("user.name")
 	email := config.GetConfig("user.email")
+	if name != "" && email != "" {
+		return Person{name, email, t}
+	}
+
+	login := "unknown"
+	var fullname string
+	if u, err := user.Current(); err == nil {
+		login = u.Username
+		// The full name comes from the GECOS field, which may have
+		// other comma separated information after it.
+		fullname = strings.SplitN(u.Name, ",", 2)[0]
+	}
+	if name == "" {
+		name = fullname
+		if name == "" {
+			name = login
+		}
+	}
+	if email == "" {
+		host, err := os.Hostname()
+		if err != nil || host == "" {
+			host = "(none)"
+		}
+		email = login + "@" + host
+	}
 	return Person{name, email, t}
 }
 
@@ -314,6 +411,15 @@ func (f IndexPath) IsClean(c *Client, s Sha1) bool {
 }
 
 // Gets the Commit of the current HEAD as a string.
+func (c *Client) GetHeadID() (string, error) {
+	cmt, err := c.GetHeadCommit()
+	if err != nil {
+		return "", err
+	}
+	return cmt.String(), nil
+}
+
+// Gets the Commit of the current HEAD.
 func (c *Client) GetHeadCommit() (CommitID, error) {
 	// If it's a symbolic ref, dereference it
 	refspec, err := SymbolicRefGet(c, SymbolicRefOptions{}, "HEAD")
@@ -351,6 +457,10 @@ func (c *Client) HaveObject(id Sha1) (found bool, packedfile File, err error) {
 	// Then, check if it's in a pack file.
 	files, err := ioutil.ReadDir(c.GitDir.File("objects/pack").String())
 	if err != nil {
+		if os.IsNotExist(err) {
+			// No pack directory means no packed objects.
+			return false, "", nil
+		}
 		return false, "", err
 	}
 	for _, fi := range files {
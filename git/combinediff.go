@@ -0,0 +1,561 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// A CombinedChange is a file in a merge which is different from the file
+// in every one of the merge's parents. These are the files which are shown
+// by a combined diff.
+type CombinedChange struct {
+	Name IndexPath
+
+	// The file in each of the parents, and in the merge. The mode is 0
+	// if the file doesn't exist.
+	Parents []TreeEntry
+	Result  TreeEntry
+}
+
+// Returns the status letters for the change, as used by --name-status,
+// which has a letter for each parent.
+func (cc CombinedChange) Status() string {
+	var s strings.Builder
+	for _, p := range cc.Parents {
+		s.WriteString(FileChange{HashDiff: HashDiff{Name: cc.Name, Src: p, Dst: cc.Result}}.Status())
+	}
+	return s.String()
+}
+
+// CombinedChanges returns the files in merge which are different from the
+// files in every one of parents, sorted by name. If paths are given, only
+// the files under them are compared.
+func CombinedChanges(c *Client, parents []Treeish, merge Treeish, paths []string) ([]CombinedChange, error) {
+	changes := make(map[IndexPath]*CombinedChange)
+	for i, parent := range parents {
+		diffs, err := DiffTree(c, &DiffTreeOptions{Recurse: true}, parent, merge, paths)
+		if err != nil {
+			return nil, err
+		}
+		found := make(map[IndexPath]*CombinedChange)
+		for _, d := range diffs {
+			var cc *CombinedChange
+			if i == 0 {
+				cc = &CombinedChange{Name: d.Name, Parents: make([]TreeEntry, len(parents)), Result: d.Dst}
+			} else if cc = changes[d.Name]; cc == nil {
+				continue
+			}
+			cc.Parents[i] = d.Src
+			found[d.Name] = cc
+		}
+		// Only the files which were different from every parent so
+		// far are kept.
+		changes = found
+	}
+
+	result := make([]CombinedChange, 0, len(changes))
+	for _, cc := range changes {
+		result = append(result, *cc)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// A line which is in some of the parents of a merge, but which isn't in
+// the merge. parents has a bit set for each parent that it was in.
+type lostLine struct {
+	text    string
+	parents uint
+}
+
+// A line of the merge's version of a file, along with the lines from the
+// parents which were lost before it.
+type combinedLine struct {
+	text string
+
+	// The bits for the parents which don't have the line, followed by a
+	// bit to mark the line to be shown, and a bit to say that the lines
+	// lost before it aren't shown, because it's only shown as context.
+	flag uint
+
+	lost []lostLine
+
+	// The line number in each parent of the first line shown if a hunk
+	// starts at this line.
+	parentLine []int
+}
+
+// Returns the diff from a to b with no context lines.
+func diffNoContext(a, b []byte) (string, error) {
+	var files []string
+	for _, data := range [][]byte{a, b} {
+		f, err := ioutil.TempFile("", "gitdiff")
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(f.Name())
+		f.Write(data)
+		f.Close()
+		files = append(files, f.Name())
+	}
+	diffcmd := exec.Command(posixDiff, "-U", "0", files[0], files[1])
+	diffcmd.Stderr = os.Stderr
+	// diff returns an error code if there's any differences, so just
+	// throw away the error.
+	out, _ := diffcmd.Output()
+	return string(out), nil
+}
+
+// Parses a range of lines from a hunk header, such as "-3,2" or "+5".
+func parseHunkRange(s string) (start, count int) {
+	count = 1
+	if comma := strings.IndexByte(s, ','); comma >= 0 {
+		fmt.Sscanf(s[comma+1:], "%d", &count)
+		s = s[:comma]
+	}
+	fmt.Sscanf(s[1:], "%d", &start)
+	return start, count
+}
+
+// Merges the lines lost from a new parent into the lines lost from the
+// other parents, so that lines which were lost from more than one of them
+// are only shown once. This is the same longest common subsequence
+// algorithm that git uses.
+func coalesceLost(base, lost []lostLine, mask uint) []lostLine {
+	if len(lost) == 0 {
+		return base
+	}
+	if len(base) == 0 {
+		return lost
+	}
+	const (
+		match = iota
+		fromBase
+		fromLost
+	)
+	lcs := make([][]int, len(base)+1)
+	direction := make([][]int, len(base)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(lost)+1)
+		direction[i] = make([]int, len(lost)+1)
+		direction[i][0] = fromBase
+	}
+	for j := 1; j <= len(lost); j++ {
+		direction[0][j] = fromLost
+	}
+	for i := 1; i <= len(base); i++ {
+		for j := 1; j <= len(lost); j++ {
+			switch {
+			case base[i-1].text == lost[j-1].text:
+				lcs[i][j] = lcs[i-1][j-1] + 1
+				direction[i][j] = match
+			case lcs[i][j-1] >= lcs[i-1][j]:
+				lcs[i][j] = lcs[i][j-1]
+				direction[i][j] = fromLost
+			default:
+				lcs[i][j] = lcs[i-1][j]
+				direction[i][j] = fromBase
+			}
+		}
+	}
+
+	// Walk back through the table, which gives the merged lines in
+	// reverse.
+	var merged []lostLine
+	for i, j := len(base), len(lost); i > 0 || j > 0; {
+		switch direction[i][j] {
+		case match:
+			l := base[i-1]
+			l.parents |= mask
+			merged = append(merged, l)
+			i, j = i-1, j-1
+		case fromLost:
+			merged = append(merged, lost[j-1])
+			j--
+		default:
+			merged = append(merged, base[i-1])
+			i--
+		}
+	}
+	for i, j := 0, len(merged)-1; i < j; i, j = i+1, j-1 {
+		merged[i], merged[j] = merged[j], merged[i]
+	}
+	return merged
+}
+
+// Compares parent n of a merge to the merge's lines, marking the lines
+// which were added, and recording the lines which were lost.
+func combineParent(lines []combinedLine, result, parent []byte, n int) error {
+	mask := uint(1) << uint(n)
+	out, err := diffNoContext(parent, result)
+	if err != nil {
+		return err
+	}
+	lost := make([][]lostLine, len(lines))
+	bucket, lno := -1, 0
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "@@ -") {
+			fields := strings.Fields(line)
+			if len(fields) < 3 {
+				return fmt.Errorf("invalid hunk header: %s", line)
+			}
+			start, count := parseHunkRange(fields[2])
+			// The lines lost by the hunk are shown before the
+			// first line of the hunk, or the line after the
+			// hunk if it doesn't have any lines of the result.
+			lno = start
+			if count == 0 {
+				bucket = start
+			} else {
+				bucket = start - 1
+			}
+			continue
+		}
+		if bucket < 0 || line == "" {
+			continue
+		}
+		switch line[0] {
+		case '-':
+			lost[bucket] = append(lost[bucket], lostLine{text: line[1:], parents: mask})
+		case '+':
+			lines[lno-1].flag |= mask
+			lno++
+		}
+	}
+
+	cnt := len(lines) - 2
+	pLno := 1
+	for i := 0; i <= cnt; i++ {
+		lines[i].parentLine[n] = pLno
+		lines[i].lost = coalesceLost(lines[i].lost, lost[i], mask)
+		for _, l := range lines[i].lost {
+			if l.parents&mask != 0 {
+				pLno++
+			}
+		}
+		if i < cnt && lines[i].flag&mask == 0 {
+			pLno++
+		}
+	}
+	lines[cnt+1].parentLine[n] = pLno
+	return nil
+}
+
+// Copies the comparison with parent j to parent i, which has the same
+// file.
+func reuseParent(lines []combinedLine, i, j int) {
+	imask, jmask := uint(1)<<uint(i), uint(1)<<uint(j)
+	for k := range lines {
+		lines[k].parentLine[i] = lines[k].parentLine[j]
+		for l := range lines[k].lost {
+			if lines[k].lost[l].parents&jmask != 0 {
+				lines[k].lost[l].parents |= imask
+			}
+		}
+		if lines[k].flag&jmask != 0 {
+			lines[k].flag |= imask
+		}
+	}
+}
+
+// Returns the index of the next line from i which is marked, or which
+// isn't marked if unmarked is true. It returns cnt+1 if there isn't one.
+func findNextMarked(lines []combinedLine, mark uint, i, cnt int, unmarked bool) int {
+	for ; i <= cnt; i++ {
+		if (lines[i].flag&mark == 0) == unmarked {
+			return i
+		}
+	}
+	return i
+}
+
+// i is the first line after a hunk which starts at begin. If the last
+// line of the hunk is only in it because of the lines lost before it,
+// then it's already context for the hunk, so the hunk ends before it.
+func adjustHunkTail(lines []combinedLine, allMask uint, begin, i int) int {
+	if begin+1 <= i && lines[i-1].flag&allMask == 0 {
+		i--
+	}
+	return i
+}
+
+// Marks the lines to show as context around the marked lines. It
+// returns false if there aren't any lines to show.
+func giveContext(lines []combinedLine, cnt, numParents, context int) bool {
+	allMask := uint(1)<<uint(numParents) - 1
+	mark := uint(1) << uint(numParents)
+	noPreDelete := uint(2) << uint(numParents)
+
+	i := findNextMarked(lines, mark, 0, cnt, false)
+	if cnt < i {
+		return false
+	}
+	for i <= cnt {
+		j := 0
+		if context < i {
+			j = i - context
+		}
+		// The lines before the first interesting line are context,
+		// so the lines lost before them aren't shown.
+		for ; j < i; j++ {
+			if lines[j].flag&mark == 0 {
+				lines[j].flag |= noPreDelete
+			}
+			lines[j].flag |= mark
+		}
+		for {
+			j = findNextMarked(lines, mark, i, cnt, true)
+			if cnt < j {
+				return true
+			}
+			k := findNextMarked(lines, mark, j, cnt, false)
+			j = adjustHunkTail(lines, allMask, i, j)
+			if k < j+context {
+				// The gap to the next interesting line is
+				// small, so the hunks are joined.
+				for ; j < k; j++ {
+					lines[j].flag |= mark
+				}
+				i = k
+				continue
+			}
+			i = k
+			k = j + context
+			if k > cnt+1 {
+				k = cnt + 1
+			}
+			for ; j < k; j++ {
+				lines[j].flag |= mark
+			}
+			break
+		}
+	}
+	return true
+}
+
+// Marks the lines which are in the hunks of a dense combined diff, which
+// leaves out the hunks where the merge only took the lines from one of
+// the parents. It returns false if there aren't any hunks.
+func makeHunks(lines []combinedLine, cnt, numParents, context int) bool {
+	allMask := uint(1)<<uint(numParents) - 1
+	mark := uint(1) << uint(numParents)
+
+	for i := 0; i <= cnt; i++ {
+		if lines[i].flag&allMask != 0 || len(lines[i].lost) > 0 {
+			lines[i].flag |= mark
+		} else {
+			lines[i].flag &^= mark
+		}
+	}
+
+	for i := 0; i <= cnt; {
+		for i <= cnt && lines[i].flag&mark == 0 {
+			i++
+		}
+		if cnt < i {
+			break
+		}
+		begin := i
+		j := i + 1
+		for ; j <= cnt; j++ {
+			if lines[j].flag&mark != 0 {
+				continue
+			}
+			// The hunk continues if there's another interesting
+			// line within the context after it.
+			la := adjustHunkTail(lines, allMask, begin, j) + context
+			if la > cnt+1 {
+				la = cnt + 1
+			}
+			contin := false
+			for la > 0 {
+				la--
+				if la < j {
+					break
+				}
+				if lines[la].flag&mark != 0 {
+					contin = true
+					break
+				}
+			}
+			if !contin {
+				break
+			}
+			j = la
+		}
+		end := j
+
+		// The hunk is only interesting if there are more than two
+		// versions of the lines, or the merge doesn't match any of
+		// the parents.
+		var sameDiff uint
+		interesting := false
+		for j := i; j < end && !interesting; j++ {
+			if diff := lines[j].flag & allMask; diff != 0 {
+				if sameDiff == 0 {
+					sameDiff = diff
+				} else if sameDiff != diff {
+					interesting = true
+					break
+				}
+			}
+			for _, l := range lines[j].lost {
+				diff := l.parents
+				if sameDiff == 0 {
+					sameDiff = diff
+				} else if sameDiff != diff {
+					interesting = true
+					break
+				}
+			}
+		}
+		if !interesting && sameDiff != allMask {
+			for j := begin; j < end; j++ {
+				lines[j].flag &^= mark
+			}
+		}
+		i = end
+	}
+	return giveContext(lines, cnt, numParents, context)
+}
+
+// Returns true if line can be shown as the function name in a hunk
+// header.
+func isHunkComment(line string) bool {
+	if line == "" {
+		return false
+	}
+	ch := line[0]
+	return ch == '_' || ch == '$' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+// Returns the lines of the hunks for the marked lines.
+func dumpCombined(lines []combinedLine, cnt, numParents int) []string {
+	mark := uint(1) << uint(numParents)
+	noPreDelete := uint(2) << uint(numParents)
+	markers := strings.Repeat("@", numParents+1)
+
+	var out []string
+	for lno := 0; ; {
+		comment := ""
+		for lno <= cnt && lines[lno].flag&mark == 0 {
+			if isHunkComment(lines[lno].text) {
+				comment = lines[lno].text
+			}
+			lno++
+		}
+		if cnt < lno {
+			break
+		}
+		end := lno + 1
+		for end <= cnt && lines[end].flag&mark != 0 {
+			end++
+		}
+		rlines := end - lno
+		if cnt < end {
+			// The end is the lines lost at the end of the file.
+			rlines--
+		}
+
+		var header strings.Builder
+		header.WriteString(markers)
+		for i := 0; i < numParents; i++ {
+			start := lines[lno].parentLine[i]
+			fmt.Fprintf(&header, " -%d,%d", start, lines[end].parentLine[i]-start)
+		}
+		fmt.Fprintf(&header, " +%d,%d %s", lno+1, rlines, markers)
+		if comment != "" {
+			// Like git, the comment is cut off before the last
+			// non-space character in its first 40 bytes.
+			commentEnd := 0
+			for i := 0; i < 40 && i < len(comment); i++ {
+				if !strings.ContainsRune(" \t\n\v\f\r", rune(comment[i])) {
+					commentEnd = i
+				}
+			}
+			if commentEnd > 0 {
+				header.WriteString(" " + comment[:commentEnd])
+			}
+		}
+		out = append(out, header.String())
+
+		for lno < end {
+			l := &lines[lno]
+			lno++
+			if l.flag&noPreDelete == 0 {
+				for _, lost := range l.lost {
+					var b strings.Builder
+					for i := 0; i < numParents; i++ {
+						if lost.parents&(1<<uint(i)) != 0 {
+							b.WriteByte('-')
+						} else {
+							b.WriteByte(' ')
+						}
+					}
+					out = append(out, b.String()+lost.text)
+				}
+			}
+			if cnt < lno {
+				break
+			}
+			var b strings.Builder
+			for i := 0; i < numParents; i++ {
+				if l.flag&(1<<uint(i)) != 0 {
+					b.WriteByte('+')
+				} else {
+					b.WriteByte(' ')
+				}
+			}
+			out = append(out, b.String()+l.text)
+		}
+	}
+	return out
+}
+
+// CombinedDiff returns the hunks of the dense combined diff of result
+// against parents, in the same format as git's --cc, with context lines
+// of context. Hunks where result only has the lines from one of the
+// parents aren't included. It returns nil if there aren't any hunks to
+// show.
+func CombinedDiff(result []byte, parents [][]byte, context int) ([]string, error) {
+	text := strings.TrimSuffix(string(result), "\n")
+	var resultLines []string
+	if len(result) > 0 {
+		resultLines = strings.Split(text, "\n")
+	}
+	cnt := len(resultLines)
+
+	// There's an extra line at the end to hold the lines lost at the
+	// end of the file, and another for the line numbers after them.
+	lines := make([]combinedLine, cnt+2)
+	for i := range lines {
+		if i < cnt {
+			lines[i].text = resultLines[i]
+		}
+		lines[i].parentLine = make([]int, len(parents))
+	}
+	for i, parent := range parents {
+		j := 0
+		for ; j < i; j++ {
+			if bytes.Equal(parent, parents[j]) {
+				reuseParent(lines, i, j)
+				break
+			}
+		}
+		if j < i {
+			continue
+		}
+		if err := combineParent(lines, result, parent, i); err != nil {
+			return nil, err
+		}
+	}
+	if !makeHunks(lines, cnt, len(parents), context) {
+		return nil, nil
+	}
+	return dumpCombined(lines, cnt, len(parents)), nil
+}
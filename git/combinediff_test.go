@@ -0,0 +1,41 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCombinedDiff(t *testing.T) {
+	tests := []struct {
+		Result  string
+		Parents []string
+		Want    []string
+	}{
+		// A conflict which was resolved with a new line.
+		{
+			"a\nx\nc\n",
+			[]string{"a\nb\nc\n", "a\nB\nc\n"},
+			[]string{"@@@ -1,3 -1,3 +1,3 @@@", "  a", "- b", " -B", "++x", "  c"},
+		},
+		// Taking the lines from one of the parents isn't interesting.
+		{"a\nb\nc\n", []string{"a\nB\nc\n", "a\nb\nc\n"}, nil},
+		// A line added in the merge.
+		{"a\n", []string{"", ""}, []string{"@@@ -1,0 -1,0 +1,1 @@@", "++a"}},
+		// A file deleted in the merge.
+		{"", []string{"a\n", "b\n"}, []string{"@@@ -1,1 -1,1 +1,0 @@@", "- a", " -b"}},
+	}
+	for i, tc := range tests {
+		var parents [][]byte
+		for _, p := range tc.Parents {
+			parents = append(parents, []byte(p))
+		}
+		got, err := CombinedDiff([]byte(tc.Result), parents, 3)
+		if err != nil {
+			t.Errorf("tc %d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.Want) {
+			t.Errorf("tc %d: got %q want %q", i, got, tc.Want)
+		}
+	}
+}
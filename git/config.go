@@ -4,78 +4,229 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"strings"
 )
 
 // This file provides a stupid way of parsing git config files.
 // It's not very efficient, but for now it gets the job done.
 // (There's a lot more low hanging fruit before optimizing this..)
-type GitConfigValues map[string]string
+
+// A GitConfigValue is a single variable set in a section of a config
+// file. The same key may appear multiple times in a section for
+// multi-valued variables.
+type GitConfigValue struct {
+	Key, Value string
+}
 
 type GitConfigSection struct {
 	name, subsection string
-	values           GitConfigValues
+	values           []GitConfigValue
 }
 type GitConfig struct {
 	sections []GitConfigSection
 }
 
-func (g *GitConfig) SetConfig(name, value string) {
-	pieces := strings.Split(name, ".")
-	var key string
-	var sec *GitConfigSection
+// Splits a config variable name into its section, subsection and key. The
+// subsection may contain dots, but the section and key can't.
+func parseConfigName(name string) (section, subsection, key string, err error) {
+	first := strings.IndexByte(name, '.')
+	last := strings.LastIndexByte(name, '.')
+	if first < 0 {
+		return "", "", "", fmt.Errorf("Key does not contain a section: %s", name)
+	}
+	section, key = name[:first], name[last+1:]
+	if first != last {
+		subsection = name[first+1 : last]
+	}
+	if section == "" || key == "" {
+		return "", "", "", fmt.Errorf("Invalid key: %s", name)
+	}
+	return section, subsection, key, nil
+}
+
+// Returns true if s is the section named name and subsection. Section
+// names are case insensitive, but subsections are not.
+func (s GitConfigSection) matches(name, subsection string) bool {
+	return strings.EqualFold(s.name, name) && s.subsection == subsection
+}
+
+// Sets the config variable name to value, replacing the last value if
+// it's already set. The variable is added to the last matching section
+// if it's not, or a new section is created if there isn't one.
+func (g *GitConfig) SetConfig(name, value string) error {
+	section, subsection, key, err := parseConfigName(name)
+	if err != nil {
+		return err
+	}
 	value = strings.TrimSpace(value)
-argChecker:
-	switch len(pieces) {
-	case 2:
-		key = strings.TrimSpace(pieces[1])
-		for _, section := range g.sections {
-			fmt.Printf("Comparing %s to %s\n", section.name, pieces[0])
-			if section.name == pieces[0] {
-				sec = &section
-				break argChecker
+	for i := len(g.sections) - 1; i >= 0; i-- {
+		sec := &g.sections[i]
+		if !sec.matches(section, subsection) {
+			continue
+		}
+		for j := len(sec.values) - 1; j >= 0; j-- {
+			if strings.EqualFold(sec.values[j].Key, key) {
+				sec.values[j].Value = value
+				return nil
 			}
 		}
-		fmt.Printf("Couldn't find %s, creating\n", pieces[0])
-		section := GitConfigSection{pieces[0], "", make(map[string]string, 0)}
-		sec = &section
-		g.sections = append(g.sections, section)
-	case 3:
-		key = strings.TrimSpace(pieces[2])
-		for _, section := range g.sections {
-			if section.name == pieces[0] && section.subsection == pieces[1] {
-				sec = &section
-				break argChecker
+	}
+	return g.AddConfig(name, value)
+}
+
+// Adds a new value for the config variable name, without replacing any
+// existing values. This is used for multi-valued variables.
+func (g *GitConfig) AddConfig(name, value string) error {
+	section, subsection, key, err := parseConfigName(name)
+	if err != nil {
+		return err
+	}
+	value = strings.TrimSpace(value)
+	for i := len(g.sections) - 1; i >= 0; i-- {
+		if sec := &g.sections[i]; sec.matches(section, subsection) {
+			sec.values = append(sec.values, GitConfigValue{key, value})
+			return nil
+		}
+	}
+	g.sections = append(g.sections, GitConfigSection{section, subsection, []GitConfigValue{{key, value}}})
+	return nil
+}
+
+// Removes every value of the config variable name. It returns false if
+// it wasn't set.
+func (g *GitConfig) UnsetConfig(name string) bool {
+	section, subsection, key, err := parseConfigName(name)
+	if err != nil {
+		return false
+	}
+	found := false
+	for i := range g.sections {
+		sec := &g.sections[i]
+		if !sec.matches(section, subsection) {
+			continue
+		}
+		var values []GitConfigValue
+		for _, v := range sec.values {
+			if strings.EqualFold(v.Key, key) {
+				found = true
+				continue
 			}
+			values = append(values, v)
 		}
-		section := GitConfigSection{pieces[0], pieces[1], make(map[string]string, 0)}
-		sec = &section
-		g.sections = append(g.sections, section)
+		sec.values = values
 	}
+	return found
+}
 
-	sec.values[key] = value
-	fmt.Printf("%s", sec)
+// Removes the section name (and subsection) from the config entirely. It
+// returns false if there was no such section.
+func (g *GitConfig) RemoveSection(name, subsection string) bool {
+	var sections []GitConfigSection
+	for _, sec := range g.sections {
+		if !sec.matches(name, subsection) {
+			sections = append(sections, sec)
+		}
+	}
+	found := len(sections) != len(g.sections)
+	g.sections = sections
+	return found
+}
+
+// Removes the section name (and subsection) if there are no values left
+// in it.
+func (g *GitConfig) removeEmptySection(name, subsection string) {
+	for _, sec := range g.sections {
+		if sec.matches(name, subsection) && len(sec.values) > 0 {
+			return
+		}
+	}
+	g.RemoveSection(name, subsection)
 }
-func (g GitConfig) GetConfig(name string) string {
 
-	pieces := strings.Split(name, ".")
+// Renames the subsection of the section name from oldsub to newsub. It
+// returns false if there was no such section.
+func (g *GitConfig) RenameSection(name, oldsub, newsub string) bool {
+	found := false
+	for i := range g.sections {
+		if g.sections[i].matches(name, oldsub) {
+			g.sections[i].subsection = newsub
+			found = true
+		}
+	}
+	return found
+}
 
-	switch len(pieces) {
-	case 2:
-		for _, section := range g.sections {
-			if section.name == pieces[0] {
-				return section.values[pieces[1]]
-			}
+// Copies the subsection of the section name from oldsub to newsub,
+// leaving the original in place. It returns false if there was no such
+// section.
+func (g *GitConfig) CopySection(name, oldsub, newsub string) bool {
+	found := false
+	for _, sec := range g.sections {
+		if sec.matches(name, oldsub) {
+			values := make([]GitConfigValue, len(sec.values))
+			copy(values, sec.values)
+			g.sections = append(g.sections, GitConfigSection{sec.name, newsub, values})
+			found = true
 		}
-	case 3:
-		for _, section := range g.sections {
-			if section.name == pieces[0] && section.subsection == pieces[1] {
-				return section.values[pieces[2]]
+	}
+	return found
+}
+
+// Returns the value of the config variable name. If it's set more than
+// once, the last value wins. Returns the empty string if it's not set.
+func (g GitConfig) GetConfig(name string) string {
+	values := g.GetConfigAll(name)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+// Returns every value of the config variable name, in the order that they
+// appear in the config.
+func (g GitConfig) GetConfigAll(name string) []string {
+	section, subsection, key, err := parseConfigName(name)
+	if err != nil {
+		return nil
+	}
+	var values []string
+	for _, sec := range g.sections {
+		if !sec.matches(section, subsection) {
+			continue
+		}
+		for _, v := range sec.values {
+			if strings.EqualFold(v.Key, key) {
+				values = append(values, v.Value)
 			}
 		}
+	}
+	return values
+}
+
+// Returns the subsections of every section named name, in the order that
+// they first appear. For instance, Subsections("remote") returns the
+// name of every configured remote.
+func (g GitConfig) Subsections(name string) []string {
+	var subsections []string
+	seen := make(map[string]bool)
+	for _, sec := range g.sections {
+		if strings.EqualFold(sec.name, name) && sec.subsection != "" && !seen[sec.subsection] {
+			seen[sec.subsection] = true
+			subsections = append(subsections, sec.subsection)
+		}
+	}
+	return subsections
+}
 
+// Quotes the value v if it's necessary for it to be read back correctly.
+func quoteConfigValue(v string) string {
+	if v == "" || !strings.ContainsAny(v, "#;\"\\") && strings.TrimSpace(v) == v {
+		return v
 	}
-	return ""
+	v = strings.Replace(v, "\\", "\\\\", -1)
+	v = strings.Replace(v, "\"", "\\\"", -1)
+	return "\"" + v + "\""
 }
 
 func (g GitConfig) WriteFile(w io.Writer) {
@@ -86,87 +237,175 @@ func (g GitConfig) WriteFile(w io.Writer) {
 			fmt.Fprintf(w, "[%s \"%s\"]\n", section.name, section.subsection)
 		}
 
-		for key, value := range section.values {
-			fmt.Fprintf(w, "\t%s = %s\n", key, value)
+		for _, v := range section.values {
+			fmt.Fprintf(w, "\t%s = %s\n", v.Key, quoteConfigValue(v.Value))
 		}
 
 	}
 }
+
+// Parses the value of a config variable, removing quotes and comments.
+func parseConfigValue(v string) string {
+	var out []byte
+	quoted := false
+	for i := 0; i < len(v); i++ {
+		switch b := v[i]; {
+		case b == '"':
+			quoted = !quoted
+		case b == '\\' && i+1 < len(v):
+			i++
+			switch v[i] {
+			case 'n':
+				out = append(out, '\n')
+			case 't':
+				out = append(out, '\t')
+			default:
+				out = append(out, v[i])
+			}
+		case (b == '#' || b == ';') && !quoted:
+			return strings.TrimSpace(string(out))
+		default:
+			out = append(out, b)
+		}
+	}
+	return strings.TrimSpace(string(out))
+}
+
 func (s *GitConfigSection) ParseValues(valueslines string) {
 	lines := strings.Split(valueslines, "\n")
-	s.values = make(map[string]string)
+	s.values = nil
 
 	for _, line := range lines {
 		trimmed := strings.TrimSpace(line)
-		if trimmed == "" {
+		if trimmed == "" || trimmed[0] == '#' || trimmed[0] == ';' {
 			continue
 		}
-		split := strings.Split(trimmed, "=")
-		if len(split) < 1 {
-			panic("couldn't parse value")
+		eq := strings.IndexByte(trimmed, '=')
+		if eq < 0 {
+			// A variable without a value is a boolean true.
+			s.values = append(s.values, GitConfigValue{trimmed, "true"})
+			continue
 		}
-		varname := strings.TrimSpace(split[0])
-
-		s.values[varname] = strings.TrimSpace(strings.Join(split[1:], "="))
-
+		varname := strings.TrimSpace(trimmed[:eq])
+		s.values = append(s.values, GitConfigValue{varname, parseConfigValue(trimmed[eq+1:])})
 	}
 }
 
 func (s *GitConfigSection) ParseSectionHeader(headerline string) {
-	s.name = headerline
-	parsingSubsection := false
-	subsectionStart := 0
-	for idx, b := range headerline {
-
-		if b == '"' && parsingSubsection == true {
-
-			parsingSubsection = true
-			s.subsection = strings.TrimSpace(headerline[subsectionStart:idx])
-
-		}
-		if b == '"' && parsingSubsection == false {
-			parsingSubsection = true
-			subsectionStart = idx + 1
-
-			s.name = strings.TrimSpace(headerline[0:idx])
-
-		}
-	}
-	if subsectionStart == 0 {
-		s.name = headerline
+	s.name = strings.TrimSpace(headerline)
+	s.subsection = ""
+	if quote := strings.IndexByte(headerline, '"'); quote >= 0 {
+		s.name = strings.TrimSpace(headerline[:quote])
+		s.subsection = strings.TrimSuffix(headerline[quote+1:], "\"")
+		s.subsection = strings.Replace(s.subsection, "\\\"", "\"", -1)
+	} else if dot := strings.IndexByte(s.name, '.'); dot >= 0 {
+		// The deprecated [section.subsection] syntax
+		s.name, s.subsection = s.name[:dot], strings.ToLower(s.name[dot+1:])
 	}
 }
+
 func ParseConfig(configFile io.Reader) GitConfig {
 	rawdata, _ := ioutil.ReadAll(configFile)
-	section := &GitConfigSection{}
-	parsingSectionName := false
-	parsingValues := false
 	var sections []GitConfigSection
-	lastBracket := 0
-	lastClosingBracket := 0
-
-	for idx, b := range rawdata {
-		if b == '[' && parsingSectionName == false {
-
-			parsingSectionName = true
-			lastBracket = idx
-			if parsingValues == true {
-				section.ParseValues(string(rawdata[lastClosingBracket+1 : idx]))
-				parsingValues = false
-				sections = append(sections, *section)
-			}
-			section = &GitConfigSection{}
-		}
-		if b == ']' && parsingSectionName == true {
-			section.ParseSectionHeader(string(rawdata[lastBracket+1 : idx]))
-			parsingValues = true
-			parsingSectionName = false
-			lastClosingBracket = idx
-		}
-		if idx == len(rawdata)-1 && parsingValues == true {
-			section.ParseValues(string(rawdata[lastClosingBracket+1 : idx]))
+	var section *GitConfigSection
+	var values []string
+
+	finishSection := func() {
+		if section != nil {
+			section.ParseValues(strings.Join(values, "\n"))
 			sections = append(sections, *section)
 		}
+		values = nil
+	}
+	for _, line := range strings.Split(string(rawdata), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			if end := strings.IndexByte(trimmed, ']'); end > 0 {
+				finishSection()
+				section = &GitConfigSection{}
+				section.ParseSectionHeader(trimmed[1:end])
+				// Values are allowed on the same line as the
+				// header.
+				values = append(values, trimmed[end+1:])
+				continue
+			}
+		}
+		values = append(values, line)
 	}
+	finishSection()
 	return GitConfig{sections}
 }
+
+// Returns the combined config of the user's global ~/.gitconfig and the
+// repository's config file. The repository's sections come last, so that
+// they take precedence.
+func (c *Client) readConfig() GitConfig {
+	var config GitConfig
+	home := os.Getenv("HOME")
+	if home == "" {
+		home = os.Getenv("home") // On some OSes, it is home
+	}
+	if f, err := os.Open(home + "/.gitconfig"); err == nil {
+		config = ParseConfig(f)
+		f.Close()
+	}
+	if f, err := c.GitDir.Open("config"); err == nil {
+		local := ParseConfig(f)
+		f.Close()
+		config.sections = append(config.sections, local.sections...)
+	}
+	return config
+}
+
+// Returns the value of the config variable name for the repository. The
+// repository's config file takes precedence over the user's global
+// ~/.gitconfig. Returns the empty string if it's not set in either.
+func (c *Client) GetConfig(name string) string {
+	return c.readConfig().GetConfig(name)
+}
+
+// Returns all the values of the multi-valued config variable name, from
+// both the user's global ~/.gitconfig and the repository's config.
+func (c *Client) GetConfigAll(name string) []string {
+	return c.readConfig().GetConfigAll(name)
+}
+
+// Reads the repository's config file, calls modify to change it, and then
+// writes it back while holding a lock on it.
+func (c *Client) updateConfig(modify func(*GitConfig) error) error {
+	file := c.GitDir.File("config")
+	lock, err := file.Lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+
+	var config GitConfig
+	if f, err := file.Open(); err == nil {
+		config = ParseConfig(f)
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := modify(&config); err != nil {
+		return err
+	}
+	config.WriteFile(lock)
+	return lock.Commit()
+}
+
+// Sets the config variable name to value in the repository's config file.
+func (c *Client) SetConfig(name, value string) error {
+	return c.updateConfig(func(config *GitConfig) error {
+		return config.SetConfig(name, value)
+	})
+}
+
+// Removes every value of the config variable name from the repository's
+// config file. It's not an error if it wasn't set.
+func (c *Client) UnsetConfig(name string) error {
+	return c.updateConfig(func(config *GitConfig) error {
+		config.UnsetConfig(name)
+		return nil
+	})
+}
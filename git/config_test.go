@@ -0,0 +1,71 @@
+package git
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	config := ParseConfig(strings.NewReader(`# A comment
+[core]
+	bare = false
+	logAllRefUpdates
+[remote "origin"]
+	url = https://example.com/repo.git ; trailing comment
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	fetch = +refs/tags/*:refs/tags/*
+[branch "feature/a.b"]
+	remote = origin
+	merge = "refs/heads/with \"quotes\""
+`))
+	tests := []struct {
+		Name string
+		Want string
+	}{
+		{"core.bare", "false"},
+		{"CORE.LogAllRefUpdates", "true"},
+		{"remote.origin.url", "https://example.com/repo.git"},
+		{"remote.origin.fetch", "+refs/tags/*:refs/tags/*"},
+		{"branch.feature/a.b.remote", "origin"},
+		{"branch.feature/a.b.merge", `refs/heads/with "quotes"`},
+		{"branch.missing.merge", ""},
+	}
+	for i, tc := range tests {
+		if got := config.GetConfig(tc.Name); got != tc.Want {
+			t.Errorf("tc %d: got %q want %q", i, got, tc.Want)
+		}
+	}
+	if got := config.GetConfigAll("remote.origin.fetch"); len(got) != 2 {
+		t.Errorf("Unexpected fetch values: %v", got)
+	}
+	if got := config.Subsections("branch"); len(got) != 1 || got[0] != "feature/a.b" {
+		t.Errorf("Unexpected branch subsections: %v", got)
+	}
+}
+
+func TestModifyConfig(t *testing.T) {
+	config := ParseConfig(strings.NewReader("[branch \"a\"]\n\tremote = origin\n\tmerge = refs/heads/a\n"))
+	if !config.RenameSection("branch", "a", "b") {
+		t.Error("Could not rename section")
+	}
+	if err := config.SetConfig("branch.b.remote", "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.SetConfig("core.bare", "false"); err != nil {
+		t.Fatal(err)
+	}
+	if !config.UnsetConfig("branch.b.merge") {
+		t.Error("Could not unset branch.b.merge")
+	}
+	if config.UnsetConfig("branch.b.merge") {
+		t.Error("Unset a value that doesn't exist")
+	}
+
+	var buf bytes.Buffer
+	config.WriteFile(&buf)
+	want := "[branch \"b\"]\n\tremote = .\n[core]\n\tbare = false\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
@@ -0,0 +1,271 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats the time t using the date format mode, as given to the --date
+// option in git. The empty string and "default" use git's default format.
+// "format:" is followed by a strftime format, which is used in t's timezone,
+// or in the local timezone for "format-local:".
+func FormatDate(t time.Time, mode string) (string, error) {
+	switch mode {
+	case "", "default":
+		return t.Format("Mon Jan 2 15:04:05 2006 -0700"), nil
+	case "relative":
+		return relativeDate(t, time.Now()), nil
+	case "iso", "iso8601":
+		return t.Format("2006-01-02 15:04:05 -0700"), nil
+	case "iso-strict", "iso8601-strict":
+		// Unlike time.RFC3339, git doesn't use "Z" for UTC.
+		return t.Format("2006-01-02T15:04:05-07:00"), nil
+	case "rfc", "rfc2822":
+		return t.Format("Mon, 2 Jan 2006 15:04:05 -0700"), nil
+	case "short":
+		return t.Format("2006-01-02"), nil
+	case "unix":
+		return fmt.Sprintf("%d", t.Unix()), nil
+	case "raw":
+		return fmt.Sprintf("%d %s", t.Unix(), t.Format("-0700")), nil
+	case "local":
+		return t.Local().Format("Mon Jan 2 15:04:05 2006"), nil
+	}
+	if strings.HasPrefix(mode, "format:") {
+		return strftime(t, mode[len("format:"):], false), nil
+	}
+	if strings.HasPrefix(mode, "format-local:") {
+		return strftime(t.Local(), mode[len("format-local:"):], true), nil
+	}
+	if strings.HasSuffix(mode, "-local") {
+		return FormatDate(t.Local(), strings.TrimSuffix(mode, "-local"))
+	}
+	return "", fmt.Errorf("unknown date format %s", mode)
+}
+
+// Returns t relative to now in the same words as git, such as "3 hours
+// ago" or "2 years, 1 month ago".
+func relativeDate(t, now time.Time) string {
+	if t.After(now) {
+		return "in the future"
+	}
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	diff := now.Unix() - t.Unix()
+	if diff < 90 {
+		return plural(diff, "second") + " ago"
+	}
+	// Each unit is rounded to the nearest of the next unit.
+	diff = (diff + 30) / 60
+	if diff < 90 {
+		return plural(diff, "minute") + " ago"
+	}
+	diff = (diff + 30) / 60
+	if diff < 36 {
+		return plural(diff, "hour") + " ago"
+	}
+	diff = (diff + 12) / 24
+	switch {
+	case diff < 14:
+		return plural(diff, "day") + " ago"
+	case diff < 70:
+		return plural((diff+3)/7, "week") + " ago"
+	case diff < 365:
+		return plural((diff+15)/30, "month") + " ago"
+	case diff < 1825:
+		months := (diff*12*2 + 365) / (365 * 2)
+		if months%12 == 0 {
+			return plural(months/12, "year") + " ago"
+		}
+		return plural(months/12, "year") + ", " + plural(months%12, "month") + " ago"
+	}
+	return plural((diff+183)/365, "year") + " ago"
+}
+
+// Formats t with the C strftime format string format, in the C locale.
+// Unknown conversions are left as they are. Like git, %Z is only known
+// for times in the local timezone.
+func strftime(t time.Time, format string, local bool) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'a':
+			b.WriteString(t.Format("Mon"))
+		case 'A':
+			b.WriteString(t.Format("Monday"))
+		case 'b', 'h':
+			b.WriteString(t.Format("Jan"))
+		case 'B':
+			b.WriteString(t.Format("January"))
+		case 'c':
+			b.WriteString(t.Format("Mon Jan _2 15:04:05 2006"))
+		case 'C':
+			fmt.Fprintf(&b, "%02d", t.Year()/100)
+		case 'd':
+			b.WriteString(t.Format("02"))
+		case 'D', 'x':
+			b.WriteString(t.Format("01/02/06"))
+		case 'e':
+			b.WriteString(t.Format("_2"))
+		case 'F':
+			b.WriteString(t.Format("2006-01-02"))
+		case 'G':
+			year, _ := t.ISOWeek()
+			fmt.Fprintf(&b, "%d", year)
+		case 'H':
+			b.WriteString(t.Format("15"))
+		case 'I':
+			b.WriteString(t.Format("03"))
+		case 'j':
+			fmt.Fprintf(&b, "%03d", t.YearDay())
+		case 'k':
+			fmt.Fprintf(&b, "%2d", t.Hour())
+		case 'l':
+			fmt.Fprintf(&b, "%2d", (t.Hour()+11)%12+1)
+		case 'm':
+			b.WriteString(t.Format("01"))
+		case 'M':
+			b.WriteString(t.Format("04"))
+		case 'n':
+			b.WriteByte('\n')
+		case 'p':
+			b.WriteString(t.Format("PM"))
+		case 'P':
+			b.WriteString(t.Format("pm"))
+		case 'r':
+			b.WriteString(t.Format("03:04:05 PM"))
+		case 'R':
+			b.WriteString(t.Format("15:04"))
+		case 's':
+			fmt.Fprintf(&b, "%d", t.Unix())
+		case 'S':
+			b.WriteString(t.Format("05"))
+		case 't':
+			b.WriteByte('\t')
+		case 'T', 'X':
+			b.WriteString(t.Format("15:04:05"))
+		case 'u':
+			fmt.Fprintf(&b, "%d", (int(t.Weekday())+6)%7+1)
+		case 'U':
+			fmt.Fprintf(&b, "%02d", (t.YearDay()+6-int(t.Weekday()))/7)
+		case 'V':
+			_, week := t.ISOWeek()
+			fmt.Fprintf(&b, "%02d", week)
+		case 'w':
+			fmt.Fprintf(&b, "%d", t.Weekday())
+		case 'W':
+			fmt.Fprintf(&b, "%02d", (t.YearDay()+6-(int(t.Weekday())+6)%7)/7)
+		case 'y':
+			b.WriteString(t.Format("06"))
+		case 'Y':
+			fmt.Fprintf(&b, "%d", t.Year())
+		case 'z':
+			b.WriteString(t.Format("-0700"))
+		case 'Z':
+			if local {
+				b.WriteString(t.Format("MST"))
+			}
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(format[i])
+		}
+	}
+	return b.String()
+}
+
+// Layouts accepted by ParseDate for absolute dates. Dates without a
+// timezone are interpreted in the local timezone.
+var dateLayouts = []string{
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	time.RFC3339,
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006.01.02",
+	"Mon Jan 2 15:04:05 2006 -0700",
+	"Mon Jan 2 15:04:05 2006",
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 -0700",
+	"Jan 2 2006",
+	"2 Jan 2006",
+}
+
+// Units that can be used in relative dates such as "2 weeks ago".
+var dateUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+}
+
+// Parses the date s relative to now. It understands a subset of the
+// formats that git accepts for things like "@{date}" and --since: absolute
+// dates in common formats, unix timestamps prefixed with "@", "now",
+// "yesterday" and relative dates such as "2 weeks ago" or "3.days.ago".
+func ParseDate(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	switch s {
+	case "now":
+		return now, nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1), nil
+	}
+	if strings.HasPrefix(s, "@") {
+		if unix, err := strconv.ParseInt(s[1:], 10, 64); err == nil {
+			return time.Unix(unix, 0), nil
+		}
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	// Try a relative date, made of pairs of numbers and units,
+	// optionally followed by "ago".
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == '.' || r == ','
+	})
+	if len(fields) > 0 && fields[len(fields)-1] == "ago" {
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return time.Time{}, fmt.Errorf("Invalid date: %s", s)
+	}
+	t := now
+	for i := 0; i < len(fields); i += 2 {
+		n, err := strconv.Atoi(fields[i])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Invalid date: %s", s)
+		}
+		unit := strings.TrimSuffix(fields[i+1], "s")
+		switch unit {
+		case "month":
+			t = t.AddDate(0, -n, 0)
+		case "year":
+			t = t.AddDate(-n, 0, 0)
+		default:
+			d, ok := dateUnits[unit]
+			if !ok {
+				return time.Time{}, fmt.Errorf("Invalid date: %s", s)
+			}
+			t = t.Add(-time.Duration(n) * d)
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,55 @@
+package git
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRelativeDate(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	tests := []struct {
+		Ago  time.Duration
+		Want string
+	}{
+		{-time.Second, "in the future"},
+		{time.Second, "1 second ago"},
+		{89 * time.Second, "89 seconds ago"},
+		{90 * time.Second, "2 minutes ago"},
+		{89 * time.Minute, "89 minutes ago"},
+		{35 * time.Hour, "35 hours ago"},
+		{36 * time.Hour, "2 days ago"},
+		{13 * 24 * time.Hour, "13 days ago"},
+		{14 * 24 * time.Hour, "2 weeks ago"},
+		{70 * 24 * time.Hour, "2 months ago"},
+		{365 * 24 * time.Hour, "1 year ago"},
+		{400 * 24 * time.Hour, "1 year, 1 month ago"},
+		{730 * 24 * time.Hour, "2 years ago"},
+		{1825 * 24 * time.Hour, "5 years ago"},
+	}
+	for i, tc := range tests {
+		if got := relativeDate(now.Add(-tc.Ago), now); got != tc.Want {
+			t.Errorf("tc %d: got %v want %v", i, got, tc.Want)
+		}
+	}
+}
+
+func TestStrftime(t *testing.T) {
+	date := time.Unix(1600000000, 0).In(time.FixedZone("+0200", 2*60*60))
+	tests := []struct {
+		Format string
+		Want   string
+	}{
+		{"%Y-%m-%d %H:%M:%S %z", "2020-09-13 14:26:40 +0200"},
+		{"%a %A %b %B %e %j", "Sun Sunday Sep September 13 257"},
+		{"%I %p %y %s %%", "02 PM 20 1600000000 %"},
+		{"%U %W %V %u %w", "37 36 37 7 0"},
+		// Unknown conversions, and the timezone name of times
+		// which aren't local, are left out.
+		{"%q|%Z", "%q|"},
+	}
+	for i, tc := range tests {
+		if got := strftime(date, tc.Format, false); got != tc.Want {
+			t.Errorf("tc %d: got %v want %v", i, got, tc.Want)
+		}
+	}
+}
@@ -0,0 +1,518 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Options for describing commits with "git describe".
+type DescribeOptions struct {
+	// Use any ref, or any tag, to describe commits instead of only
+	// annotated tags.
+	All, Tags bool
+
+	// Find the oldest tag which contains the commit, rather than the
+	// newest tag that the commit contains. This uses NameRev.
+	Contains bool
+
+	// The minimum length of the abbreviated commit id in the suffix.
+	// If 0, core.abbrev is used. If negative, the suffix is omitted, as
+	// with --abbrev=0.
+	Abbrev int
+
+	// Always include the suffix, even if a tag matches exactly.
+	Long bool
+
+	// Use the abbreviated commit id if no tag describes the commit.
+	Always bool
+
+	// If not empty, HEAD is described and Dirty is appended if the work
+	// tree has been modified.
+	Dirty string
+
+	// Only use tags matching one of the Match patterns (if any) and none
+	// of the Exclude patterns. The patterns match the name of the ref
+	// without its refs/tags/ prefix (or refs/heads/ or refs/remotes/
+	// with All.)
+	Match, Exclude []string
+
+	// Only follow the first parent of merge commits.
+	FirstParent bool
+
+	// The number of candidate tags to consider. 0 means 10.
+	Candidates int
+
+	// Only output exact matches, as with --candidates=0.
+	ExactMatch bool
+}
+
+// A ref which may be used to describe commits.
+type describeName struct {
+	// The name of the ref that's shown, without refs/tags/ (or refs/
+	// with the All option.)
+	Path string
+
+	// 2 for annotated tags, 1 for lightweight tags and 0 for other
+	// refs.
+	Prio int
+
+	// The tag object, for annotated tags.
+	Tag Sha1
+
+	checked, misnamed bool
+	tagName           string
+}
+
+// A tag that may describe the commit, and how far away it is.
+type describeCandidate struct {
+	name       *describeName
+	depth      int
+	flag       uint32
+	foundOrder int
+}
+
+// Returns the refs that may be used to describe commits, keyed by the
+// commit (or other object) that they point to after peeling tags.
+func describeNames(c *Client, opts DescribeOptions) (map[Sha1]*describeName, error) {
+	refs, err := c.GetRefs("refs/")
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[Sha1]*describeName)
+refs:
+	for _, ref := range refs {
+		path := ref.Name.String()
+		isTag := strings.HasPrefix(path, "refs/tags/")
+		var match string
+		switch {
+		case isTag:
+			match = strings.TrimPrefix(path, "refs/tags/")
+		case !opts.All:
+			continue
+		case strings.HasPrefix(path, "refs/heads/"):
+			match = strings.TrimPrefix(path, "refs/heads/")
+		case strings.HasPrefix(path, "refs/remotes/"):
+			match = strings.TrimPrefix(path, "refs/remotes/")
+		case len(opts.Match) > 0 || len(opts.Exclude) > 0:
+			// Only refs of known types can be matched.
+			continue
+		}
+		for _, pattern := range opts.Exclude {
+			if matchesWildcard(pattern, match) {
+				continue refs
+			}
+		}
+		if len(opts.Match) > 0 {
+			found := false
+			for _, pattern := range opts.Match {
+				if matchesWildcard(pattern, match) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+
+		peeled, err := ref.Value.Peel(c)
+		if err != nil {
+			return nil, err
+		}
+		n := &describeName{Path: strings.TrimPrefix(path, "refs/tags/")}
+		if opts.All {
+			n.Path = strings.TrimPrefix(path, "refs/")
+		}
+		switch {
+		case peeled != ref.Value:
+			n.Prio = 2
+			n.Tag = ref.Value
+		case isTag:
+			n.Prio = 1
+		}
+
+		if e, ok := names[peeled]; ok {
+			if e.Prio > n.Prio {
+				continue
+			}
+			if e.Prio == 2 && n.Prio == 2 {
+				// Prefer the newer tag if multiple annotated
+				// tags point to the same commit.
+				ed, err := describeTagDate(c, e.Tag)
+				if err != nil {
+					return nil, err
+				}
+				nd, err := describeTagDate(c, n.Tag)
+				if err != nil {
+					return nil, err
+				}
+				if ed >= nd {
+					continue
+				}
+			} else if e.Prio == n.Prio {
+				continue
+			}
+		}
+		names[peeled] = n
+	}
+	return names, nil
+}
+
+// Returns the date of the annotated tag id.
+func describeTagDate(c *Client, id Sha1) (int64, error) {
+	obj, err := c.GetObject(id)
+	if err != nil {
+		return 0, err
+	}
+	headers, _ := parseObjectHeaders(obj.GetContent())
+	return tagDate(headers), nil
+}
+
+// Returns the name of n for the description of a commit, warning if an
+// annotated tag's name doesn't match the name of its ref.
+func (n *describeName) name(c *Client, opts DescribeOptions) (string, error) {
+	if n.Prio != 2 {
+		return n.Path, nil
+	}
+	if !n.checked {
+		obj, err := c.GetObject(n.Tag)
+		if err != nil {
+			return "", fmt.Errorf("annotated tag %s not available", n.Path)
+		}
+		headers, _ := parseObjectHeaders(obj.GetContent())
+		n.tagName = getObjectHeader(headers, "tag")
+		path := n.Path
+		if opts.All {
+			path = strings.TrimPrefix(path, "tags/")
+		}
+		if n.tagName != path {
+			fmt.Fprintf(os.Stderr, "warning: tag '%s' is externally known as '%s'\n", n.Path, n.tagName)
+			n.misnamed = true
+		}
+		n.checked = true
+	}
+	if opts.All {
+		return "tags/" + n.tagName, nil
+	}
+	return n.tagName, nil
+}
+
+// Returns the "-<depth>-g<abbrev>" suffix of a description.
+func describeSuffix(c *Client, opts DescribeOptions, depth int, id CommitID) string {
+	abbrev := Sha1(id).String()
+	if opts.Abbrev >= 0 {
+		abbrev = Sha1(id).Abbrev(c, opts.Abbrev)
+	}
+	return fmt.Sprintf("-%d-g%s", depth, abbrev)
+}
+
+// Returns true if the work tree or index has been modified since the
+// HEAD commit.
+func workTreeDirty(c *Client) (bool, error) {
+	diffs, err := DiffFiles(c, DiffFilesOptions{}, nil)
+	if err != nil {
+		return false, err
+	}
+	if len(diffs) > 0 {
+		return true, nil
+	}
+
+	head, err := SymbolicRef("HEAD").CommitID(c)
+	if err != nil {
+		return false, err
+	}
+	tree, err := head.TreeID(c)
+	if err != nil {
+		return false, err
+	}
+	objects, err := tree.GetAllObjects(c, "", true, true)
+	if err != nil {
+		return false, err
+	}
+	index, err := c.GitDir.ReadIndex()
+	if err != nil {
+		return false, err
+	}
+	files := 0
+	for _, entry := range objects {
+		if entry.FileMode != ModeTree {
+			files++
+		}
+	}
+	if len(index.Objects) != files {
+		return true, nil
+	}
+	for _, entry := range index.Objects {
+		t, ok := objects[entry.PathName]
+		if !ok || t.Sha1 != entry.Sha1 || t.FileMode != entry.Mode {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Implements "git describe". Each revision is described by the most
+// recent tag that it contains, followed by the number of commits since
+// the tag and the abbreviated commit id, such as "v1.0-3-g1234567". If
+// no revisions are given, HEAD is described.
+//
+// If a revision can't be described, the descriptions of the revisions
+// before it are returned along with the error.
+func Describe(c *Client, opts DescribeOptions, revs []string) ([]string, error) {
+	if opts.Long && opts.Abbrev < 0 {
+		return nil, fmt.Errorf("options '--long' and '--abbrev=0' cannot be used together")
+	}
+	if opts.Dirty != "" && len(revs) > 0 {
+		return nil, fmt.Errorf("option '--dirty' and commit-ishes cannot be used together")
+	}
+	if len(revs) == 0 {
+		revs = []string{"HEAD"}
+	}
+
+	if opts.Contains {
+		nopts := NameRevOptions{
+			PeelTag:     true,
+			NameOnly:    true,
+			NoUndefined: true,
+			Always:      opts.Always,
+		}
+		if !opts.All {
+			nopts.Tags = true
+			for _, p := range opts.Match {
+				nopts.Refs = append(nopts.Refs, "refs/tags/"+p)
+			}
+			for _, p := range opts.Exclude {
+				nopts.Exclude = append(nopts.Exclude, "refs/tags/"+p)
+			}
+		}
+		named, err := NameRev(c, nopts, revs)
+		var descriptions []string
+		for _, n := range named {
+			descriptions = append(descriptions, n.Name)
+		}
+		return descriptions, err
+	}
+
+	names, err := describeNames(c, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 && !opts.Always {
+		return nil, fmt.Errorf("No names found, cannot describe anything.")
+	}
+	suffix := ""
+	if opts.Dirty != "" {
+		dirty, err := workTreeDirty(c)
+		if err != nil {
+			return nil, err
+		}
+		if dirty {
+			suffix = opts.Dirty
+		}
+	}
+
+	w := newRevWalker(c)
+	var descriptions []string
+	for _, rev := range revs {
+		id, err := RevParseObject(c, &RevParseOptions{}, rev)
+		if err != nil {
+			return descriptions, fmt.Errorf("Not a valid object name %s", rev)
+		}
+		cmt, err := peelObject(c, id, "")
+		if err != nil {
+			return descriptions, err
+		}
+		switch cmt.Type(c) {
+		case "commit":
+		case "blob":
+			return descriptions, fmt.Errorf("Describing blobs is not supported")
+		default:
+			return descriptions, fmt.Errorf("%s is neither a commit nor blob", rev)
+		}
+		desc, err := describeCommit(w, opts, names, CommitID(cmt))
+		if err != nil {
+			return descriptions, err
+		}
+		descriptions = append(descriptions, desc+suffix)
+	}
+	return descriptions, nil
+}
+
+// Describes a single commit, the same way as git. The walk stops once
+// enough candidate tags have been found, and the best candidate is the
+// one with the fewest commits which aren't reachable from it.
+func describeCommit(w *revWalker, opts DescribeOptions, names map[Sha1]*describeName, id CommitID) (string, error) {
+	c := w.c
+	if n, ok := names[Sha1(id)]; ok && (opts.Tags || opts.All || n.Prio == 2) {
+		// Exact match to an existing ref.
+		name, err := n.name(c, opts)
+		if err != nil {
+			return "", err
+		}
+		if n.misnamed || opts.Long {
+			name += describeSuffix(c, opts, 0, id)
+		}
+		return name, nil
+	}
+
+	maxCandidates := opts.Candidates
+	switch {
+	case opts.ExactMatch:
+		maxCandidates = 0
+	case maxCandidates <= 0:
+		maxCandidates = 10
+	case maxCandidates > 27:
+		maxCandidates = 27
+	}
+	if maxCandidates == 0 {
+		return "", fmt.Errorf("no tag exactly matches '%s'", id)
+	}
+
+	// The flags for each commit. The lowest bit is set when the commit
+	// has been queued, and the other bits are set when the commit is
+	// reachable from the corresponding candidate.
+	const seenFlag = 1
+	flags := make(map[CommitID]uint32)
+
+	var candidates []describeCandidate
+	annotated, unannotated, seenCommits := 0, 0, 0
+	var gaveUpOn *walkCommit
+
+	start, err := w.parse(id)
+	if err != nil {
+		return "", err
+	}
+	flags[id] = seenFlag
+	queue := &commitQueue{}
+	queue.push(start)
+	for queue.Len() > 0 {
+		cmt := queue.pop()
+		seenCommits++
+		if n, ok := names[Sha1(cmt.Id)]; ok {
+			switch {
+			case !opts.Tags && !opts.All && n.Prio < 2:
+				unannotated++
+			case len(candidates) < maxCandidates:
+				t := describeCandidate{
+					name:       n,
+					depth:      seenCommits - 1,
+					flag:       1 << uint(len(candidates)+1),
+					foundOrder: len(candidates) + 1,
+				}
+				candidates = append(candidates, t)
+				flags[cmt.Id] |= t.flag
+				if n.Prio == 2 {
+					annotated++
+				}
+			default:
+				gaveUpOn = cmt
+			}
+			if gaveUpOn != nil {
+				break
+			}
+		}
+		for i := range candidates {
+			if flags[cmt.Id]&candidates[i].flag == 0 {
+				candidates[i].depth++
+			}
+		}
+
+		// Stop if the last remaining path is already covered by the
+		// best candidates.
+		if annotated > 0 && queue.Len() == 0 {
+			bestDepth := -1
+			var bestWithin uint32
+			for _, t := range candidates {
+				switch {
+				case bestDepth < 0 || t.depth < bestDepth:
+					bestDepth, bestWithin = t.depth, t.flag
+				case t.depth == bestDepth:
+					bestWithin |= t.flag
+				}
+			}
+			if flags[cmt.Id]&bestWithin == bestWithin {
+				break
+			}
+		}
+		for _, pid := range cmt.Parents {
+			p, err := w.parse(pid)
+			if err != nil {
+				return "", err
+			}
+			if flags[pid]&seenFlag == 0 {
+				queue.push(p)
+			}
+			flags[pid] |= flags[cmt.Id]
+			if opts.FirstParent {
+				break
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		switch {
+		case opts.Always:
+			if opts.Abbrev < 0 {
+				return id.String(), nil
+			}
+			return Sha1(id).Abbrev(c, opts.Abbrev), nil
+		case unannotated > 0:
+			return "", fmt.Errorf("No annotated tags can describe '%s'.\nHowever, there were unannotated tags: try --tags.", id)
+		default:
+			return "", fmt.Errorf("No tags can describe '%s'.\nTry --always, or create some tags.", id)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].depth != candidates[j].depth {
+			return candidates[i].depth < candidates[j].depth
+		}
+		return candidates[i].foundOrder < candidates[j].foundOrder
+	})
+	best := &candidates[0]
+
+	// Finish computing the depth of the best candidate, by counting
+	// the commits which are reachable from the commit being described
+	// but not from the candidate.
+	if gaveUpOn != nil {
+		queue.push(gaveUpOn)
+	}
+	for queue.Len() > 0 {
+		cmt := queue.pop()
+		if flags[cmt.Id]&best.flag != 0 {
+			done := true
+			for _, other := range queue.items {
+				if flags[other.Id]&best.flag == 0 {
+					done = false
+					break
+				}
+			}
+			if done {
+				break
+			}
+		} else {
+			best.depth++
+		}
+		for _, pid := range cmt.Parents {
+			p, err := w.parse(pid)
+			if err != nil {
+				return "", err
+			}
+			if flags[pid]&seenFlag == 0 {
+				queue.push(p)
+			}
+			flags[pid] |= flags[cmt.Id]
+		}
+	}
+
+	name, err := best.name.name(c, opts)
+	if err != nil {
+		return "", err
+	}
+	if best.name.misnamed || opts.Abbrev >= 0 {
+		name += describeSuffix(c, opts, best.depth, id)
+	}
+	return name, nil
+}
@@ -3,6 +3,7 @@ package git
 import (
 	"regexp"
 	"sort"
+	"strings"
 )
 
 // Describes the options that may be specified on the command line for
@@ -63,28 +64,42 @@ type DiffTreeOptions struct {
 	// format anyways.
 }
 
+// DiffTree compares the objects in tree1 and tree2, returning the ones
+// which differ. If tree1 is nil, every object in tree2 is treated as
+// being added, as is needed for root commits. If any paths are given,
+// only the objects at or under one of them are compared.
 func DiffTree(c *Client, opt *DiffTreeOptions, tree1, tree2 Treeish, paths []string) ([]HashDiff, error) {
-	t1, err := tree1.TreeID(c)
-	if err != nil {
-		return nil, err
+	tree1Objects := make(map[IndexPath]TreeEntry)
+	if tree1 != nil {
+		t1, err := tree1.TreeID(c)
+		if err != nil {
+			return nil, err
+		}
+		tree1Objects, err = t1.GetAllObjects(c, "", opt.Recurse, opt.Recurse)
+		if err != nil {
+			return nil, err
+		}
 	}
 	t2, err := tree2.TreeID(c)
 	if err != nil {
 		return nil, err
 	}
-
-	tree1Objects, err := t1.GetAllObjects(c, "", opt.Recurse, opt.Recurse)
-	if err != nil {
-		return nil, err
-	}
 	tree2Objects, err := t2.GetAllObjects(c, "", opt.Recurse, opt.Recurse)
 	if err != nil {
 		return nil, err
 	}
 
+	var limit []IndexPath
+	for _, p := range paths {
+		limit = append(limit, IndexPath(strings.TrimSuffix(p, "/")))
+	}
+
 	var val []HashDiff
 
 	for name, sha := range tree1Objects {
+		if !pathIncluded(name, sha.FileMode == ModeTree, limit) {
+			continue
+		}
 		if osha := tree2Objects[name]; sha != osha {
 			val = append(val, HashDiff{name, sha, osha})
 		}
@@ -93,6 +108,9 @@ func DiffTree(c *Client, opt *DiffTreeOptions, tree1, tree2 Treeish, paths []str
 	// Check for files that were added in tree2 but missing in tree1, which
 	// would have gotten caught by the above ranging.
 	for name, sha := range tree2Objects {
+		if !pathIncluded(name, sha.FileMode == ModeTree, limit) {
+			continue
+		}
 		if _, ok := tree1Objects[name]; !ok {
 			val = append(val, HashDiff{name, TreeEntry{Sha1{}, 0}, sha})
 		}
@@ -6,5 +6,6 @@ import (
 
 var InvalidHead error = errors.New("Invalid HEAD")
 var InvalidBranch error = errors.New("Invalid branch")
+var InvalidRef error = errors.New("Invalid reference")
 var InvalidCommit error = errors.New("Invalid commit")
 var InvalidTree error = errors.New("Invalid tree")
@@ -107,3 +107,50 @@ func (f File) Remove() error {
 func (f File) Open() (*os.File, error) {
 	return os.Open(f.String())
 }
+
+// A LockFile is a file named "f.lock" used to atomically replace the
+// contents of f while preventing other processes from modifying it.
+type LockFile struct {
+	*os.File
+	target File
+	done   bool
+}
+
+// Lock acquires a lock on f by exclusively creating the file f.lock. The
+// new contents of f should be written to the returned LockFile, and then
+// either Commit or Rollback must be called to release the lock.
+func (f File) Lock() (*LockFile, error) {
+	lock, err := os.OpenFile(f.String()+".lock", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("Unable to create %s.lock: File exists. Another git process seems to be running", f)
+		}
+		return nil, err
+	}
+	return &LockFile{File: lock, target: f}, nil
+}
+
+// Commit replaces the locked file with the contents that were written to the
+// lock.
+func (l *LockFile) Commit() error {
+	if l.done {
+		return nil
+	}
+	l.done = true
+	if err := l.File.Close(); err != nil {
+		os.Remove(l.Name())
+		return err
+	}
+	return os.Rename(l.Name(), l.target.String())
+}
+
+// Rollback releases the lock without modifying the locked file. It does
+// nothing if the lock was already committed, so it is safe to defer.
+func (l *LockFile) Rollback() error {
+	if l.done {
+		return nil
+	}
+	l.done = true
+	l.File.Close()
+	return os.Remove(l.Name())
+}
@@ -0,0 +1,420 @@
+package git
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ForEachRefOptions represents the options that may be passed to
+// "git for-each-ref"
+type ForEachRefOptions struct {
+	// The keys to sort by, in the order that they were passed on the
+	// command line. The last key is the primary sort key. A key prefixed
+	// with "-" sorts in descending order. Refs are sorted by refname if
+	// no keys are specified.
+	Sort []string
+
+	// The maximum number of refs to return after sorting. 0 means
+	// there is no limit.
+	Count int
+
+	// Only include refs which point at this object, either directly
+	// or after peeling a tag. Ignored if it's the zero value.
+	PointsAt Sha1
+
+	// Only include refs whose commits are reachable from Merged.
+	Merged Commitish
+
+	// Only include refs whose commits contain Contains. (ie. Contains
+	// is reachable from them.)
+	Contains Commitish
+}
+
+// ForEachRef implements "git for-each-ref". It returns the refs which
+// match any of patterns (or all refs if there are no patterns), after
+// applying the filters and sorting from opts.
+func ForEachRef(c *Client, opts ForEachRefOptions, patterns []string) ([]Ref, error) {
+	all, err := c.GetRefs("refs/")
+	if err != nil {
+		return nil, err
+	}
+
+	var merged, contains CommitID
+	if opts.Merged != nil {
+		if merged, err = opts.Merged.CommitID(c); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Contains != nil {
+		if contains, err = opts.Contains.CommitID(c); err != nil {
+			return nil, err
+		}
+	}
+
+	var refs []Ref
+	for _, ref := range all {
+		if len(patterns) > 0 {
+			matched := false
+			for _, p := range patterns {
+				if refMatchesPattern(ref.Name, p) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		if opts.PointsAt != (Sha1{}) && ref.Value != opts.PointsAt {
+			if peeled, err := ref.Peeled(c); err != nil || peeled != opts.PointsAt {
+				continue
+			}
+		}
+
+		if opts.Merged != nil || opts.Contains != nil {
+			// Only refs which point to commits can be merged or
+			// contain anything.
+			peeled, err := ref.Peeled(c)
+			if err != nil || peeled.Type(c) != "commit" {
+				continue
+			}
+			cmt := CommitID(peeled)
+			if opts.Merged != nil && !cmt.IsAncestor(c, merged) {
+				continue
+			}
+			if opts.Contains != nil && !contains.IsAncestor(c, cmt) {
+				continue
+			}
+		}
+		refs = append(refs, ref)
+	}
+
+	// Each key is sorted stably in the order given, so that the last
+	// one ends up being the primary key.
+	for _, key := range opts.Sort {
+		reverse := strings.HasPrefix(key, "-")
+		key = strings.TrimPrefix(key, "-")
+		values := make(map[RefSpec]refSortValue, len(refs))
+		for _, ref := range refs {
+			v, err := newRefInfo(c, ref).sortValue(key)
+			if err != nil {
+				return nil, err
+			}
+			values[ref.Name] = v
+		}
+		sort.SliceStable(refs, func(i, j int) bool {
+			if reverse {
+				return values[refs[j].Name].less(values[refs[i].Name])
+			}
+			return values[refs[i].Name].less(values[refs[j].Name])
+		})
+	}
+
+	if opts.Count > 0 && len(refs) > opts.Count {
+		refs = refs[:opts.Count]
+	}
+	return refs, nil
+}
+
+// FormatRef formats ref according to format, as used by the --format
+// option of for-each-ref. %(fieldname) is replaced by the value of the
+// field, %% by a literal % and %xx (where xx is a hex number) by the
+// character xx. Fieldnames prefixed with "*" use the object that a tag
+// points to, instead of the tag.
+func FormatRef(c *Client, ref Ref, format string) (string, error) {
+	ri := newRefInfo(c, ref)
+	var out []byte
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			out = append(out, format[i])
+			continue
+		}
+		switch next := format[i+1]; {
+		case next == '%':
+			out = append(out, '%')
+			i++
+		case next == '(':
+			end := strings.IndexByte(format[i:], ')')
+			if end < 0 {
+				return "", fmt.Errorf("Malformed format string %s", format[i:])
+			}
+			val, err := ri.atom(format[i+2 : i+end])
+			if err != nil {
+				return "", err
+			}
+			out = append(out, val...)
+			i += end
+		default:
+			if i+2 < len(format) {
+				if b, err := strconv.ParseUint(format[i+1:i+3], 16, 8); err == nil {
+					out = append(out, byte(b))
+					i += 2
+					continue
+				}
+			}
+			out = append(out, '%')
+		}
+	}
+	return string(out), nil
+}
+
+// refInfo lazily looks up the information about a ref that's needed to
+// evaluate the fields of a format string.
+type refInfo struct {
+	c   *Client
+	ref Ref
+
+	// The object that the fields describe, and its parsed content if
+	// it's a commit or tag.
+	id      Sha1
+	obj     GitObject
+	headers []objectHeader
+	message string
+
+	// The refInfo for the object that a tag points to, for "*" fields.
+	deref *refInfo
+}
+
+func newRefInfo(c *Client, ref Ref) *refInfo {
+	return &refInfo{c: c, ref: ref, id: ref.Value}
+}
+
+func (ri *refInfo) object() (GitObject, error) {
+	if ri.obj != nil {
+		return ri.obj, nil
+	}
+	obj, err := ri.c.GetObject(ri.id)
+	if err != nil {
+		return nil, err
+	}
+	ri.obj = obj
+	switch obj.GetType() {
+	case "commit", "tag":
+		ri.headers, ri.message = parseObjectHeaders(obj.GetContent())
+	}
+	return obj, nil
+}
+
+// Returns the value of the field name for the ref.
+func (ri *refInfo) atom(name string) (string, error) {
+	if strings.HasPrefix(name, "*") {
+		if ri.deref == nil {
+			obj, err := ri.object()
+			if err != nil {
+				return "", err
+			}
+			tag, ok := obj.(GitTagObject)
+			if !ok {
+				// Only tags can be dereferenced. Anything
+				// else has empty values.
+				return "", nil
+			}
+			target, err := tag.GetObject()
+			if err != nil {
+				return "", err
+			}
+			ri.deref = &refInfo{c: ri.c, ref: ri.ref, id: target}
+		}
+		return ri.deref.atom(name[1:])
+	}
+
+	field, modifier := name, ""
+	if colon := strings.IndexByte(name, ':'); colon >= 0 {
+		field, modifier = name[:colon], name[colon+1:]
+	}
+
+	switch field {
+	case "refname":
+		switch modifier {
+		case "":
+			return ri.ref.Name.String(), nil
+		case "short":
+			return ri.ref.Name.ShortName(), nil
+		}
+	case "objectname":
+		switch modifier {
+		case "":
+			return ri.id.String(), nil
+		case "short":
+			return ri.id.Abbrev(ri.c, 0), nil
+		}
+		if strings.HasPrefix(modifier, "short=") {
+			n, err := strconv.Atoi(modifier[6:])
+			if err != nil {
+				return "", fmt.Errorf("Invalid length in %%(%s)", name)
+			}
+			return ri.id.Abbrev(ri.c, n), nil
+		}
+	case "objecttype", "objectsize":
+		obj, err := ri.object()
+		if err != nil {
+			return "", err
+		}
+		if field == "objecttype" {
+			return obj.GetType(), nil
+		}
+		return strconv.Itoa(obj.GetSize()), nil
+	case "upstream":
+		upstream := ri.upstream()
+		switch modifier {
+		case "":
+			return upstream.String(), nil
+		case "short":
+			if upstream == "" {
+				return "", nil
+			}
+			return upstream.ShortName(), nil
+		}
+	case "HEAD":
+		if ri.c.GetHeadBranch() == Branch(ri.ref.Name) {
+			return "*", nil
+		}
+		return " ", nil
+	case "tree", "parent", "object", "type", "tag":
+		if _, err := ri.object(); err != nil {
+			return "", err
+		}
+		var vals []string
+		for _, h := range ri.headers {
+			if h.Name == field {
+				vals = append(vals, h.Value)
+			}
+		}
+		return strings.Join(vals, " "), nil
+	case "author", "committer", "tagger", "creator":
+		p, ok, err := ri.person(field)
+		if err != nil || !ok {
+			return "", err
+		}
+		return p.String(), nil
+	case "authorname", "committername", "taggername":
+		p, _, err := ri.person(strings.TrimSuffix(field, "name"))
+		return p.Name, err
+	case "authoremail", "committeremail", "taggeremail":
+		p, ok, err := ri.person(strings.TrimSuffix(field, "email"))
+		if err != nil || !ok {
+			return "", err
+		}
+		return "<" + p.Email + ">", nil
+	case "authordate", "committerdate", "taggerdate", "creatordate":
+		p, ok, err := ri.person(strings.TrimSuffix(field, "date"))
+		if err != nil || !ok || p.Time == nil {
+			return "", err
+		}
+		return FormatDate(*p.Time, modifier)
+	case "subject", "body", "contents":
+		if _, err := ri.object(); err != nil {
+			return "", err
+		}
+		subject, body := splitSubject(ri.message)
+		switch {
+		case field == "subject" || name == "contents:subject":
+			return subject, nil
+		case field == "body" || name == "contents:body":
+			return body, nil
+		case name == "contents":
+			return ri.message, nil
+		}
+	}
+	return "", fmt.Errorf("Unknown field name: %s", name)
+}
+
+// Returns the person from the header named field of the object. creator
+// is the committer of a commit or the tagger of a tag. The bool is false
+// if the object doesn't have that header.
+func (ri *refInfo) person(field string) (Person, bool, error) {
+	obj, err := ri.object()
+	if err != nil {
+		return Person{}, false, err
+	}
+	if field == "creator" {
+		switch obj.GetType() {
+		case "commit":
+			field = "committer"
+		case "tag":
+			field = "tagger"
+		}
+	}
+	ident := getObjectHeader(ri.headers, field)
+	if ident == "" {
+		return Person{}, false, nil
+	}
+	p, err := parsePerson(ident)
+	return p, err == nil, err
+}
+
+// Returns the upstream of the ref if it's a branch which is configured to
+// track one.
+func (ri *refInfo) upstream() RefSpec {
+	return Branch(ri.ref.Name).Upstream(ri.c)
+}
+
+// A refSortValue is the value of a field used as a sort key.
+type refSortValue struct {
+	str     string
+	num     int64
+	numeric bool
+}
+
+func (v refSortValue) less(o refSortValue) bool {
+	if v.numeric && o.numeric {
+		return v.num < o.num
+	}
+	return v.str < o.str
+}
+
+// Returns the value of the field name to use for sorting. Dates and sizes
+// sort numerically, everything else sorts as a string.
+func (ri *refInfo) sortValue(name string) (refSortValue, error) {
+	deref := ""
+	if strings.HasPrefix(name, "*") {
+		deref = "*"
+	}
+	field := strings.TrimPrefix(name, "*")
+	if colon := strings.IndexByte(field, ':'); colon >= 0 {
+		field = field[:colon]
+	}
+	switch field {
+	case "authordate", "committerdate", "taggerdate", "creatordate":
+		val, err := ri.atom(deref + field + ":unix")
+		if err != nil {
+			return refSortValue{}, err
+		}
+		n, _ := strconv.ParseInt(val, 10, 64)
+		return refSortValue{val, n, true}, nil
+	case "objectsize":
+		val, err := ri.atom(name)
+		if err != nil {
+			return refSortValue{}, err
+		}
+		n, _ := strconv.ParseInt(val, 10, 64)
+		return refSortValue{val, n, true}, nil
+	}
+	val, err := ri.atom(name)
+	return refSortValue{str: val}, err
+}
+
+// Splits a commit or tag message into its subject (the first paragraph,
+// joined into a single line) and body (everything after the first
+// paragraph.)
+func splitSubject(message string) (subject, body string) {
+	lines := strings.Split(message, "\n")
+	// Skip any leading blank lines.
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	var i int
+	for i = 0; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+	}
+	subject = strings.Join(lines[:i], " ")
+	for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+		i++
+	}
+	if i < len(lines) {
+		body = strings.Join(lines[i:], "\n")
+	}
+	return subject, body
+}
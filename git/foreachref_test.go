@@ -0,0 +1,67 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestRefMatchesPattern(t *testing.T) {
+	tests := []struct {
+		Ref     RefSpec
+		Pattern string
+		Match   bool
+	}{
+		{"refs/heads/master", "refs/heads/master", true},
+		{"refs/heads/master", "refs/heads", true},
+		{"refs/heads/master", "refs/heads/", true},
+		{"refs/heads/master", "refs/head", false},
+		{"refs/heads/master", "refs/heads/*", true},
+		{"refs/heads/feature/x", "refs/heads/*", false},
+		{"refs/heads/feature/x", "refs/heads/*/x", true},
+		{"refs/tags/v1.0", "refs/tags/v1.?", true},
+		{"refs/tags/v1.0", "refs/heads", false},
+	}
+	for i, tc := range tests {
+		if got := refMatchesPattern(tc.Ref, tc.Pattern); got != tc.Match {
+			t.Errorf("tc %d: %s matching %s: got %v want %v", i, tc.Ref, tc.Pattern, got, tc.Match)
+		}
+	}
+}
+
+func TestRefShortName(t *testing.T) {
+	tests := []struct {
+		Ref   RefSpec
+		Short string
+	}{
+		{"refs/heads/master", "master"},
+		{"refs/heads/feature/x", "feature/x"},
+		{"refs/tags/v1", "v1"},
+		{"refs/remotes/origin/master", "origin/master"},
+		{"refs/stash", "stash"},
+	}
+	for i, tc := range tests {
+		if got := tc.Ref.ShortName(); got != tc.Short {
+			t.Errorf("tc %d: got %v want %v", i, got, tc.Short)
+		}
+	}
+}
+
+func TestSplitSubject(t *testing.T) {
+	tests := []struct {
+		Message, Subject, Body string
+	}{
+		{"", "", ""},
+		{"One line\n", "One line", ""},
+		{"Subject\n\nBody\n", "Subject", "Body\n"},
+		{"Two line\nsubject\n\n\nBody\n\nMore body\n", "Two line subject", "Body\n\nMore body\n"},
+		{"\nLeading blank\n", "Leading blank", ""},
+	}
+	for i, tc := range tests {
+		subject, body := splitSubject(tc.Message)
+		if subject != tc.Subject {
+			t.Errorf("tc %d: got subject %q want %q", i, subject, tc.Subject)
+		}
+		if body != tc.Body {
+			t.Errorf("tc %d: got body %q want %q", i, body, tc.Body)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// An objectLink is a reference from one object to another, along with the
+// type that the referencing object expects the target to be. (A Type of 0
+// means that any type is acceptable.)
+type objectLink struct {
+	From, To Sha1
+	Type     PackEntryType
+}
+
+// An objectChecker validates objects as they're added to it, and keeps
+// track of every object that they reference so that the links can be
+// verified once all the objects (ie. of a pack) have been seen.
+type objectChecker struct {
+	mu sync.Mutex
+
+	// The type of every object that has been added.
+	objects map[Sha1]PackEntryType
+
+	// Every reference from an object that was added to another object.
+	// The same object may be referenced by many others, and they may not
+	// all agree on its type.
+	links []objectLink
+}
+
+func newObjectChecker() *objectChecker {
+	return &objectChecker{
+		objects: make(map[Sha1]PackEntryType),
+	}
+}
+
+// Add parses the object sha of type t with the content data, and returns
+// an error if it's malformed. Any objects that it references are recorded
+// to be verified by Verify.
+func (oc *objectChecker) Add(sha Sha1, t PackEntryType, data []byte) error {
+	var links []objectLink
+	var err error
+	switch t {
+	case OBJ_COMMIT:
+		links, err = fsckCommit(data)
+	case OBJ_TREE:
+		links, err = fsckTree(data)
+	case OBJ_TAG:
+		links, err = fsckTag(data)
+	case OBJ_BLOB:
+		// Anything is valid in a blob.
+	default:
+		return fmt.Errorf("Invalid object type for %s: %s", sha, t)
+	}
+	if err != nil {
+		return fmt.Errorf("Invalid %s %s: %v", t, sha, err)
+	}
+
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	oc.objects[sha] = t
+	for _, link := range links {
+		link.From = sha
+		oc.links = append(oc.links, link)
+	}
+	return nil
+}
+
+// Verify ensures that every object referenced by an object that was added
+// to the checker exists, and is the type that the reference expects. If
+// selfContained is true, the referenced objects must have been added to
+// the checker, otherwise they may also exist in c's object directory.
+func (oc *objectChecker) Verify(c *Client, selfContained bool) error {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	// The types of the referenced objects found in c's object
+	// directory.
+	existing := make(map[Sha1]string)
+	for _, link := range oc.links {
+		var t string
+		if pt, ok := oc.objects[link.To]; ok {
+			t = pt.String()
+		} else if selfContained {
+			return fmt.Errorf("Not self-contained: %s references %s which is not in the pack", link.From, link.To)
+		} else if t, ok = existing[link.To]; !ok {
+			have, _, err := c.HaveObject(link.To)
+			if err != nil {
+				return err
+			}
+			if !have {
+				return fmt.Errorf("Broken link from %s to %s", link.From, link.To)
+			}
+			t = link.To.Type(c)
+			existing[link.To] = t
+		}
+		if link.Type != 0 && t != link.Type.String() {
+			return fmt.Errorf("%s references %s as a %s, but it is a %s", link.From, link.To, link.Type, t)
+		}
+	}
+	return nil
+}
+
+// Parses the next header line from the commit or tag data, expecting
+// it to be named name, and returns the value and the remaining data.
+func fsckHeader(data []byte, name string) (string, []byte, error) {
+	prefix := []byte(name + " ")
+	if !bytes.HasPrefix(data, prefix) {
+		return "", data, fmt.Errorf("missing %s", name)
+	}
+	eol := bytes.IndexByte(data, '\n')
+	if eol < 0 {
+		return "", data, fmt.Errorf("unterminated %s line", name)
+	}
+	return string(data[len(prefix):eol]), data[eol+1:], nil
+}
+
+// Validates a Sha1 as it's stored in the header of a commit or tag.
+func fsckSha1(s string) (Sha1, error) {
+	if len(s) != 40 {
+		return Sha1{}, fmt.Errorf("invalid object name %q", s)
+	}
+	// Sha1FromString trims whitespace, but it's not valid here.
+	for _, c := range s {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') {
+			return Sha1{}, fmt.Errorf("invalid object name %q", s)
+		}
+	}
+	return Sha1FromString(s)
+}
+
+// Validates an identity line of the form "Name <email> timestamp tz"
+func fsckIdent(ident string) error {
+	lt := strings.IndexByte(ident, '<')
+	gt := strings.IndexByte(ident, '>')
+	if lt < 0 || gt < lt {
+		return fmt.Errorf("bad email in %q", ident)
+	}
+	if lt == 0 || ident[lt-1] != ' ' {
+		return fmt.Errorf("missing space before email in %q", ident)
+	}
+	if gt+1 >= len(ident) || ident[gt+1] != ' ' {
+		return fmt.Errorf("missing date in %q", ident)
+	}
+	fields := strings.Fields(ident[gt+1:])
+	if len(fields) != 2 {
+		return fmt.Errorf("bad date in %q", ident)
+	}
+	date, tz := fields[0], fields[1]
+	if _, err := strconv.ParseUint(date, 10, 64); err != nil {
+		return fmt.Errorf("bad date in %q", ident)
+	}
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') {
+		return fmt.Errorf("bad timezone in %q", ident)
+	}
+	if _, err := strconv.ParseUint(tz[1:], 10, 16); err != nil {
+		return fmt.Errorf("bad timezone in %q", ident)
+	}
+	return nil
+}
+
+// Checks that data is a well-formed commit and returns the objects that
+// it references.
+func fsckCommit(data []byte) ([]objectLink, error) {
+	var links []objectLink
+	tree, data, err := fsckHeader(data, "tree")
+	if err != nil {
+		return nil, err
+	}
+	treeid, err := fsckSha1(tree)
+	if err != nil {
+		return nil, err
+	}
+	links = append(links, objectLink{To: treeid, Type: OBJ_TREE})
+
+	for bytes.HasPrefix(data, []byte("parent ")) {
+		var parent string
+		parent, data, err = fsckHeader(data, "parent")
+		if err != nil {
+			return nil, err
+		}
+		pid, err := fsckSha1(parent)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, objectLink{To: pid, Type: OBJ_COMMIT})
+	}
+
+	for _, name := range []string{"author", "committer"} {
+		var ident string
+		ident, data, err = fsckHeader(data, name)
+		if err != nil {
+			return nil, err
+		}
+		if err := fsckIdent(ident); err != nil {
+			return nil, err
+		}
+	}
+	return links, nil
+}
+
+// Checks that data is a well-formed tag and returns the object that it
+// references.
+func fsckTag(data []byte) ([]objectLink, error) {
+	object, data, err := fsckHeader(data, "object")
+	if err != nil {
+		return nil, err
+	}
+	oid, err := fsckSha1(object)
+	if err != nil {
+		return nil, err
+	}
+	typ, data, err := fsckHeader(data, "type")
+	if err != nil {
+		return nil, err
+	}
+	var t PackEntryType
+	switch typ {
+	case "commit":
+		t = OBJ_COMMIT
+	case "tree":
+		t = OBJ_TREE
+	case "blob":
+		t = OBJ_BLOB
+	case "tag":
+		t = OBJ_TAG
+	default:
+		return nil, fmt.Errorf("invalid type %q", typ)
+	}
+	name, data, err := fsckHeader(data, "tag")
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, fmt.Errorf("empty tag name")
+	}
+	// The tagger is optional, since very old versions of git didn't
+	// include it, but it must be valid if it's there.
+	if bytes.HasPrefix(data, []byte("tagger ")) {
+		tagger, _, err := fsckHeader(data, "tagger")
+		if err != nil {
+			return nil, err
+		}
+		if err := fsckIdent(tagger); err != nil {
+			return nil, err
+		}
+	}
+	return []objectLink{{To: oid, Type: t}}, nil
+}
+
+// Checks that data is a well-formed tree and returns the objects that it
+// references.
+func fsckTree(data []byte) ([]objectLink, error) {
+	var links []objectLink
+	var lastName string
+	var lastMode EntryMode
+	// A file and a directory with the same name don't sort next to each
+	// other, so every name is needed to find duplicates.
+	names := make(map[string]bool)
+	for len(data) > 0 {
+		// The format of each tree entry is:
+		// 	[permission] [name] \0 [20 bytes of Sha1]
+		sp := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if sp <= 0 || nul < sp || nul+21 > len(data) {
+			return nil, fmt.Errorf("truncated entry")
+		}
+		perm := string(data[:sp])
+		if perm[0] == '0' {
+			return nil, fmt.Errorf("zero-padded file mode %s", perm)
+		}
+		m, err := strconv.ParseUint(perm, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file mode %s", perm)
+		}
+		mode := EntryMode(m)
+
+		name := string(data[sp+1 : nul])
+		switch name {
+		case "":
+			return nil, fmt.Errorf("empty filename")
+		case ".", "..", ".git":
+			return nil, fmt.Errorf("invalid filename %q", name)
+		}
+		if strings.IndexByte(name, '/') >= 0 {
+			return nil, fmt.Errorf("filename %q contains a slash", name)
+		}
+		sha, err := Sha1FromSlice(data[nul+1 : nul+21])
+		if err != nil {
+			return nil, err
+		}
+		switch mode {
+		case ModeTree:
+			links = append(links, objectLink{To: sha, Type: OBJ_TREE})
+		case ModeBlob, ModeExec, ModeSymlink:
+			links = append(links, objectLink{To: sha, Type: OBJ_BLOB})
+		case ModeCommit:
+			// Submodules refer to commits in a different
+			// repository, so there's nothing to verify.
+		default:
+			return nil, fmt.Errorf("invalid file mode %s", perm)
+		}
+
+		if names[name] {
+			return nil, fmt.Errorf("duplicate entry %q", name)
+		}
+		if lastName != "" && compareTreeEntries(lastName, lastMode, name, mode) > 0 {
+			return nil, fmt.Errorf("entries not sorted (%q before %q)", lastName, name)
+		}
+		names[name] = true
+		lastName, lastMode = name, mode
+		data = data[nul+21:]
+	}
+	return links, nil
+}
+
+// Compares two tree entries in the order that git requires them to be
+// stored in a tree, where trees sort as if they had a trailing slash.
+func compareTreeEntries(name1 string, mode1 EntryMode, name2 string, mode2 EntryMode) int {
+	if name1 == name2 {
+		return 0
+	}
+	if mode1 == ModeTree {
+		name1 += "/"
+	}
+	if mode2 == ModeTree {
+		name2 += "/"
+	}
+	if name1 < name2 {
+		return -1
+	}
+	return 1
+}
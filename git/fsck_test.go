@@ -0,0 +1,157 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestFsckObjects(t *testing.T) {
+	tests := []struct {
+		Type  PackEntryType
+		Data  string
+		Valid bool
+	}{
+		{
+			OBJ_COMMIT,
+			`tree adbfd4aadd70c1b26fcfff59b085045786d3b7c0
+parent 20648e724aaed71fcdc88aa806ee2f8ebe3fed07
+author Dave MacFarlane <driusan@gmail.com> 1481944775 -0500
+committer Dave MacFarlane <driusan@gmail.com> 1481944775 -0500
+
+Fixed bug where git push wasn't working since refactoring Sha1 to own type
+`,
+			true,
+		},
+		{
+			// Missing tree
+			OBJ_COMMIT,
+			`parent 20648e724aaed71fcdc88aa806ee2f8ebe3fed07
+author Dave MacFarlane <driusan@gmail.com> 1481944775 -0500
+committer Dave MacFarlane <driusan@gmail.com> 1481944775 -0500
+
+Message
+`,
+			false,
+		},
+		{
+			// Bad timezone in committer
+			OBJ_COMMIT,
+			`tree adbfd4aadd70c1b26fcfff59b085045786d3b7c0
+author Dave MacFarlane <driusan@gmail.com> 1481944775 -0500
+committer Dave MacFarlane <driusan@gmail.com> 1481944775 EST
+
+Message
+`,
+			false,
+		},
+		{
+			OBJ_TAG,
+			`object adbfd4aadd70c1b26fcfff59b085045786d3b7c0
+type commit
+tag v1.0
+tagger Dave MacFarlane <driusan@gmail.com> 1481944775 -0500
+
+Version 1.0
+`,
+			true,
+		},
+		{
+			// Invalid type
+			OBJ_TAG,
+			`object adbfd4aadd70c1b26fcfff59b085045786d3b7c0
+type bogus
+tag v1.0
+
+Version 1.0
+`,
+			false,
+		},
+		{
+			OBJ_TREE,
+			"100644 a\000aaaaaaaaaaaaaaaaaaaa40000 b\000bbbbbbbbbbbbbbbbbbbb",
+			true,
+		},
+		{
+			// Unsorted entries
+			OBJ_TREE,
+			"100644 b\000aaaaaaaaaaaaaaaaaaaa100644 a\000bbbbbbbbbbbbbbbbbbbb",
+			false,
+		},
+		{
+			// Trees sort as if they have a trailing slash, so
+			// "a.c" comes before the tree "a".
+			OBJ_TREE,
+			"100644 a.c\000aaaaaaaaaaaaaaaaaaaa40000 a\000bbbbbbbbbbbbbbbbbbbb",
+			true,
+		},
+		{
+			// A file and a directory with the same name, which
+			// don't sort next to each other.
+			OBJ_TREE,
+			"100644 a\000aaaaaaaaaaaaaaaaaaaa100644 a.c\000bbbbbbbbbbbbbbbbbbbb40000 a\000cccccccccccccccccccc",
+			false,
+		},
+		{
+			// Zero padded mode
+			OBJ_TREE,
+			"040000 a\000aaaaaaaaaaaaaaaaaaaa",
+			false,
+		},
+		{
+			// Truncated sha
+			OBJ_TREE,
+			"100644 a\000aaaa",
+			false,
+		},
+	}
+	for i, tc := range tests {
+		oc := newObjectChecker()
+		err := oc.Add(Sha1{}, tc.Type, []byte(tc.Data))
+		if tc.Valid && err != nil {
+			t.Errorf("Unexpected error for test %d: %v", i, err)
+		} else if !tc.Valid && err == nil {
+			t.Errorf("Expected error for test %d", i)
+		}
+	}
+}
+
+func TestFsckLinks(t *testing.T) {
+	hash := func(typ, data string) Sha1 {
+		id, _, err := HashSlice(typ, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	blob := hash("blob", "hello\n")
+	blobEntry := func(mode, name string) string {
+		return mode + " " + name + "\000" + string(blob[:])
+	}
+	tests := []struct {
+		Trees []string
+		Valid bool
+	}{
+		{[]string{blobEntry("100644", "a")}, true},
+		{[]string{blobEntry("40000", "a")}, false},
+		// Every tree that references the blob is checked, not only
+		// the last one.
+		{[]string{blobEntry("40000", "a"), blobEntry("100644", "a")}, false},
+		{[]string{blobEntry("100644", "a"), blobEntry("40000", "b")}, false},
+	}
+	for i, tc := range tests {
+		oc := newObjectChecker()
+		if err := oc.Add(blob, OBJ_BLOB, []byte("hello\n")); err != nil {
+			t.Fatal(err)
+		}
+		for _, tree := range tc.Trees {
+			if err := oc.Add(hash("tree", tree), OBJ_TREE, []byte(tree)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := oc.Verify(nil, true)
+		if tc.Valid && err != nil {
+			t.Errorf("Unexpected error for test %d: %v", i, err)
+		} else if !tc.Valid && err == nil {
+			t.Errorf("Expected error for test %d", i)
+		}
+	}
+}
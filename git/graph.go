@@ -0,0 +1,518 @@
+package git
+
+import (
+	"strings"
+)
+
+// The states that a LogGraph goes through while drawing the lines for a
+// commit.
+type graphState int
+
+const (
+	graphPadding graphState = iota
+	graphSkip
+	graphPreCommit
+	graphCommit
+	graphPostMerge
+	graphCollapsing
+)
+
+// A LogGraph draws the ASCII art history graph shown by "git log --graph",
+// one line at a time. It's a port of git's graph.c, so that the output is
+// laid out the same way.
+//
+// For each commit, Update must be called with the commit and its parents.
+// NextLine then returns lines of the graph until the line for the commit
+// itself has been returned. Lines of output for the commit after that
+// should be prefixed with NextLine (or PaddingLine, for separators) until
+// IsCommitFinished returns true.
+type LogGraph struct {
+	commit  CommitID
+	parents []CommitID
+
+	// The number of characters that the graph takes up on the current
+	// line.
+	width int
+
+	// The number of lines of the pre-commit expansion of an octopus
+	// merge that have been output.
+	expansionRow int
+
+	state, prevState graphState
+
+	// The column of the current commit, and the column of the previous
+	// one.
+	commitIndex, prevCommitIndex int
+
+	// Whether the first parent of a merge is to the left (0) or right
+	// (1) of the commit, or -1 if it isn't a merge.
+	mergeLayout int
+
+	// The number of columns added by the current commit, and by the
+	// previous one.
+	edgesAdded, prevEdgesAdded int
+
+	// The commits that each column is waiting for, before and after
+	// the current commit.
+	columns, newColumns []CommitID
+
+	// Maps the screen positions in the current line to the index of
+	// the column in newColumns that they lead to, or -1.
+	mapping, oldMapping []int
+}
+
+// NewLogGraph returns a LogGraph which hasn't drawn any commits.
+func NewLogGraph() *LogGraph {
+	return &LogGraph{state: graphPadding, prevState: graphPadding}
+}
+
+// Update moves the graph on to the next commit, which has the given
+// parents. Only the parents which will be shown by the log should be
+// included.
+func (g *LogGraph) Update(cmt CommitID, parents []CommitID) {
+	g.commit = cmt
+	g.parents = parents
+	g.prevCommitIndex = g.commitIndex
+	g.updateColumns()
+	g.expansionRow = 0
+
+	// If the previous commit didn't get to finish drawing, the rest
+	// of it is skipped.
+	switch {
+	case g.state != graphPadding:
+		g.state = graphSkip
+	case g.needsPreCommitLine():
+		g.state = graphPreCommit
+	default:
+		g.state = graphCommit
+	}
+}
+
+func (g *LogGraph) updateState(s graphState) {
+	g.prevState = g.state
+	g.state = s
+}
+
+func (g *LogGraph) findNewColumn(cmt CommitID) int {
+	for i, c := range g.newColumns {
+		if c == cmt {
+			return i
+		}
+	}
+	return -1
+}
+
+func (g *LogGraph) insertIntoNewColumns(cmt CommitID, idx int) {
+	i := g.findNewColumn(cmt)
+	if i < 0 {
+		i = len(g.newColumns)
+		g.newColumns = append(g.newColumns, cmt)
+	}
+
+	var mappingIdx int
+	switch {
+	case len(g.parents) > 1 && idx > -1 && g.mergeLayout == -1:
+		// This is the first parent of a merge, so the layout of the
+		// merge line depends on whether the parent is to the left.
+		dist := idx - i
+		shift := 1
+		if dist > 1 {
+			shift = 2*dist - 3
+		}
+		if dist > 0 {
+			g.mergeLayout = 0
+		} else {
+			g.mergeLayout = 1
+		}
+		g.edgesAdded = len(g.parents) + g.mergeLayout - 2
+		mappingIdx = g.width + (g.mergeLayout-1)*shift
+		g.width += 2 * g.mergeLayout
+	case g.edgesAdded > 0 && g.width >= 2 && i == g.mapping[g.width-2]:
+		// The commit was found in the last existing column, so the
+		// two edges join immediately.
+		mappingIdx = g.width - 2
+		g.edgesAdded = -1
+	default:
+		mappingIdx = g.width
+		g.width += 2
+	}
+	g.mapping[mappingIdx] = i
+}
+
+func (g *LogGraph) updateColumns() {
+	g.columns, g.newColumns = g.newColumns, g.columns[:0]
+
+	maxNewColumns := len(g.columns) + len(g.parents)
+	g.mapping = make([]int, 2*maxNewColumns)
+	for i := range g.mapping {
+		g.mapping[i] = -1
+	}
+	for len(g.oldMapping) < len(g.mapping) {
+		g.oldMapping = append(g.oldMapping, -1)
+	}
+
+	g.width = 0
+	g.prevEdgesAdded = g.edgesAdded
+	g.edgesAdded = 0
+
+	seenThis := false
+	for i := 0; i <= len(g.columns); i++ {
+		var colCommit CommitID
+		if i == len(g.columns) {
+			if seenThis {
+				break
+			}
+			colCommit = g.commit
+		} else {
+			colCommit = g.columns[i]
+		}
+
+		if colCommit == g.commit {
+			seenThis = true
+			g.commitIndex = i
+			g.mergeLayout = -1
+			for _, p := range g.parents {
+				g.insertIntoNewColumns(p, i)
+			}
+			// The commit always takes up at least 2 spaces.
+			if len(g.parents) == 0 {
+				g.width += 2
+			}
+		} else {
+			g.insertIntoNewColumns(colCommit, -1)
+		}
+	}
+
+	// Shrink the mapping to the minimum size that's needed.
+	size := len(g.mapping)
+	for size > 1 && g.mapping[size-1] < 0 {
+		size--
+	}
+	g.mapping = g.mapping[:size]
+}
+
+func (g *LogGraph) needsPreCommitLine() bool {
+	return len(g.parents) >= 3 &&
+		g.commitIndex < len(g.columns)-1 &&
+		g.expansionRow < len(g.parents)-2
+}
+
+func (g *LogGraph) isMappingCorrect() bool {
+	for i, target := range g.mapping {
+		if target >= 0 && target != i/2 {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the column of the current commit for the loops which go one
+// past the last column, in case the commit isn't in any of them.
+func (g *LogGraph) columnCommit(i int) (CommitID, bool) {
+	if i == len(g.columns) {
+		return g.commit, true
+	}
+	return g.columns[i], false
+}
+
+// Returns the column that position i of mapping leads to, or -1 if it's
+// past the end of the mapping.
+func mappingAt(mapping []int, i int) int {
+	if i >= len(mapping) {
+		return -1
+	}
+	return mapping[i]
+}
+
+func (g *LogGraph) outputPaddingLine(line *strings.Builder) {
+	for range g.newColumns {
+		line.WriteString("| ")
+	}
+}
+
+func (g *LogGraph) outputSkipLine(line *strings.Builder) {
+	line.WriteString("...")
+	if g.needsPreCommitLine() {
+		g.updateState(graphPreCommit)
+	} else {
+		g.updateState(graphCommit)
+	}
+}
+
+func (g *LogGraph) outputPreCommitLine(line *strings.Builder) {
+	seenThis := false
+	for i, col := range g.columns {
+		switch {
+		case col == g.commit:
+			seenThis = true
+			line.WriteByte('|')
+			line.WriteString(strings.Repeat(" ", g.expansionRow))
+		case seenThis && g.expansionRow == 0:
+			if g.prevState == graphPostMerge && g.prevCommitIndex < i {
+				line.WriteByte('\\')
+			} else {
+				line.WriteByte('|')
+			}
+		case seenThis && g.expansionRow > 0:
+			line.WriteByte('\\')
+		default:
+			line.WriteByte('|')
+		}
+		line.WriteByte(' ')
+	}
+
+	g.expansionRow++
+	if !g.needsPreCommitLine() {
+		g.updateState(graphCommit)
+	}
+}
+
+func (g *LogGraph) numDashedParents() int {
+	return len(g.parents) + g.mergeLayout - 3
+}
+
+func (g *LogGraph) outputCommitLine(line *strings.Builder) {
+	seenThis := false
+	for i := 0; i <= len(g.columns); i++ {
+		colCommit, last := g.columnCommit(i)
+		if last && seenThis {
+			break
+		}
+		switch {
+		case colCommit == g.commit:
+			seenThis = true
+			line.WriteByte('*')
+			if len(g.parents) > 2 {
+				// Draw the extra edges of an octopus merge.
+				dashed := g.numDashedParents()
+				for j := 0; j < dashed; j++ {
+					line.WriteByte('-')
+					if j == dashed-1 {
+						line.WriteByte('.')
+					} else {
+						line.WriteByte('-')
+					}
+				}
+			}
+		case seenThis && g.edgesAdded > 1:
+			line.WriteByte('\\')
+		case seenThis && g.edgesAdded == 1:
+			// If the previous line was a post merge line, the
+			// branch line coming into this commit may have been
+			// '\', so it's kept that way.
+			if g.prevState == graphPostMerge && g.prevEdgesAdded > 0 && g.prevCommitIndex < i {
+				line.WriteByte('\\')
+			} else {
+				line.WriteByte('|')
+			}
+		case g.prevState == graphCollapsing && mappingAt(g.oldMapping, 2*i+1) == i && mappingAt(g.mapping, 2*i) < i:
+			line.WriteByte('/')
+		default:
+			line.WriteByte('|')
+		}
+		line.WriteByte(' ')
+	}
+
+	switch {
+	case len(g.parents) > 1:
+		g.updateState(graphPostMerge)
+	case g.isMappingCorrect():
+		g.updateState(graphPadding)
+	default:
+		g.updateState(graphCollapsing)
+	}
+}
+
+func (g *LogGraph) outputPostMergeLine(line *strings.Builder) {
+	mergeChars := []byte{'/', '|', '\\'}
+	seenThis := false
+	parentCol := false
+	for i := 0; i <= len(g.columns); i++ {
+		colCommit, last := g.columnCommit(i)
+		if last && seenThis {
+			break
+		}
+		switch {
+		case colCommit == g.commit:
+			// Draw an edge to each of the parents' columns.
+			seenThis = true
+			idx := g.mergeLayout
+			for j := range g.parents {
+				line.WriteByte(mergeChars[idx])
+				if idx == 2 {
+					if g.edgesAdded > 0 || j < len(g.parents)-1 {
+						line.WriteByte(' ')
+					}
+				} else {
+					idx++
+				}
+			}
+			if g.edgesAdded == 0 {
+				line.WriteByte(' ')
+			}
+		case seenThis:
+			if g.edgesAdded > 0 {
+				line.WriteByte('\\')
+			} else {
+				line.WriteByte('|')
+			}
+			line.WriteByte(' ')
+		default:
+			line.WriteByte('|')
+			if g.mergeLayout != 0 || i != g.commitIndex-1 {
+				if parentCol {
+					line.WriteByte('_')
+				} else {
+					line.WriteByte(' ')
+				}
+			}
+		}
+		if colCommit == g.parents[0] {
+			parentCol = true
+		}
+	}
+
+	if g.isMappingCorrect() {
+		g.updateState(graphPadding)
+	} else {
+		g.updateState(graphCollapsing)
+	}
+}
+
+func (g *LogGraph) outputCollapsingLine(line *strings.Builder) {
+	usedHorizontal := false
+	horizontalEdge := -1
+	horizontalEdgeTarget := -1
+
+	size := len(g.mapping)
+	g.mapping, g.oldMapping = g.oldMapping[:size], g.mapping
+	for i := range g.mapping {
+		g.mapping[i] = -1
+	}
+
+	for i := 0; i < size; i++ {
+		target := g.oldMapping[i]
+		if target < 0 {
+			continue
+		}
+		switch {
+		case target*2 == i:
+			// The column is already in the right place.
+			g.mapping[i] = target
+		case g.mapping[i-1] < 0:
+			// Nothing is to the left, so move left by one.
+			g.mapping[i-1] = target
+			if horizontalEdge == -1 {
+				horizontalEdge = i
+				horizontalEdgeTarget = target
+				for j := target*2 + 3; j < i-2; j += 2 {
+					g.mapping[j] = target
+				}
+			}
+		case g.mapping[i-1] == target:
+			// The branch to the left has the same target, so
+			// they're combined.
+		default:
+			// Cross over the branch to the left.
+			g.mapping[i-2] = target
+			if horizontalEdge == -1 {
+				horizontalEdgeTarget = target
+				horizontalEdge = i - 1
+				for j := target*2 + 3; j < i-2; j += 2 {
+					g.mapping[j] = target
+				}
+			}
+		}
+	}
+
+	copy(g.oldMapping, g.mapping)
+
+	// The new mapping may be 1 smaller than the old one.
+	if g.mapping[len(g.mapping)-1] < 0 {
+		g.mapping = g.mapping[:len(g.mapping)-1]
+	}
+
+	for i, target := range g.mapping {
+		switch {
+		case target < 0:
+			line.WriteByte(' ')
+		case target*2 == i:
+			line.WriteByte('|')
+		case target == horizontalEdgeTarget && i != horizontalEdge-1:
+			// Only the first segment of the horizontal edge
+			// continues into the next line.
+			if i != target*2+3 {
+				g.mapping[i] = -1
+			}
+			usedHorizontal = true
+			line.WriteByte('_')
+		default:
+			if usedHorizontal && i < horizontalEdge {
+				g.mapping[i] = -1
+			}
+			line.WriteByte('/')
+		}
+	}
+
+	if g.isMappingCorrect() {
+		g.updateState(graphPadding)
+	}
+}
+
+// Pads the line with spaces to the width of the graph.
+func (g *LogGraph) pad(line *strings.Builder) string {
+	s := line.String()
+	if len(s) < g.width {
+		s += strings.Repeat(" ", g.width-len(s))
+	}
+	return s
+}
+
+// NextLine returns the next line of the graph, and true if it's the line
+// for the commit itself.
+func (g *LogGraph) NextLine() (string, bool) {
+	var line strings.Builder
+	commitLine := false
+	switch g.state {
+	case graphPadding:
+		g.outputPaddingLine(&line)
+	case graphSkip:
+		g.outputSkipLine(&line)
+	case graphPreCommit:
+		g.outputPreCommitLine(&line)
+	case graphCommit:
+		g.outputCommitLine(&line)
+		commitLine = true
+	case graphPostMerge:
+		g.outputPostMergeLine(&line)
+	case graphCollapsing:
+		g.outputCollapsingLine(&line)
+	}
+	return g.pad(&line), commitLine
+}
+
+// PaddingLine returns a line of the graph which doesn't change its
+// state, to go before a separator between commits.
+func (g *LogGraph) PaddingLine() string {
+	if g.state != graphCommit {
+		l, _ := g.NextLine()
+		return l
+	}
+	var line strings.Builder
+	for _, col := range g.columns {
+		line.WriteByte('|')
+		if col == g.commit && len(g.parents) > 2 {
+			line.WriteString(strings.Repeat(" ", (len(g.parents)-2)*2))
+		} else {
+			line.WriteByte(' ')
+		}
+	}
+	g.prevState = graphPadding
+	return g.pad(&line)
+}
+
+// IsCommitFinished returns true if all the lines for the current commit
+// have been drawn.
+func (g *LogGraph) IsCommitFinished() bool {
+	return g.state == graphPadding
+}
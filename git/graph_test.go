@@ -0,0 +1,147 @@
+package git
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLogGraph(t *testing.T) {
+	type commit struct {
+		Name    string
+		Date    int
+		Parents []string
+	}
+	merge := []commit{{"A", 100, nil}, {"B", 200, []string{"A"}}, {"C", 300, []string{"B"}}, {"D", 250, []string{"A"}}, {"E", 400, []string{"D", "C"}}, {"F", 500, []string{"E"}}}
+	octopus := []commit{{"A", 100, nil}, {"B", 200, []string{"A"}}, {"C", 300, []string{"A"}}, {"D", 400, []string{"A"}}, {"E", 500, []string{"B", "C", "D"}}, {"F", 600, []string{"E"}}}
+	// Merges whose branches cross, and a second tip.
+	crossing := []commit{{"A", 100, nil}, {"B", 200, []string{"A"}}, {"C", 300, []string{"A"}}, {"D", 400, []string{"B"}}, {"E", 500, []string{"C"}}, {"F", 600, []string{"D", "E"}}, {"G", 700, []string{"B"}}, {"H", 800, []string{"F", "G"}}, {"X", 750, []string{"C"}}}
+
+	// The expected graphs are the output of "git log --graph --format=%s"
+	// for the same history.
+	tests := []struct {
+		History     []commit
+		Revs        []string
+		FirstParent bool
+		Want        []string
+	}{
+		{
+			merge,
+			[]string{"F"},
+			false,
+			[]string{
+				"* F",
+				"*   E",
+				"|\\  ",
+				"| * C",
+				"| * B",
+				"* | D",
+				"|/  ",
+				"* A",
+			},
+		},
+		{
+			merge,
+			[]string{"F"},
+			true,
+			[]string{
+				"* F",
+				"* E",
+				"* D",
+				"* A",
+			},
+		},
+		{
+			octopus,
+			[]string{"F"},
+			false,
+			[]string{
+				"* F",
+				"*-.   E",
+				"|\\ \\  ",
+				"| | * D",
+				"| * | C",
+				"| |/  ",
+				"* / B",
+				"|/  ",
+				"* A",
+			},
+		},
+		{
+			crossing,
+			[]string{"H", "X"},
+			false,
+			[]string{
+				"*   H",
+				"|\\  ",
+				"| * G",
+				"* |   F",
+				"|\\ \\  ",
+				"| * | E",
+				"* | | D",
+				"| |/  ",
+				"|/|   ",
+				"* | B",
+				"| | * X",
+				"| |/  ",
+				"| * C",
+				"|/  ",
+				"* A",
+			},
+		},
+		{
+			crossing,
+			[]string{"H", "X"},
+			true,
+			[]string{
+				"* H",
+				"* F",
+				"* D",
+				"* B",
+				"| * X",
+				"| * C",
+				"|/  ",
+				"* A",
+			},
+		},
+	}
+	for i, tc := range tests {
+		r := newTestRepo(t)
+		for _, cmt := range tc.History {
+			r.commit(cmt.Name, cmt.Date, cmt.Parents...)
+		}
+		var revs []string
+		for _, rev := range tc.Revs {
+			revs = append(revs, r.commits[rev].String())
+		}
+		// Log is set up the same way as for "git log --graph".
+		opts := LogOptions{WalkOptions: WalkOptions{TopoOrder: true, RewriteParents: true, FirstParent: tc.FirstParent}}
+		entries, err := Log(r.Client, opts, revs)
+		if err != nil {
+			t.Errorf("tc %d: %v", i, err)
+			r.Close()
+			continue
+		}
+
+		var got []string
+		g := NewLogGraph()
+		for _, e := range entries {
+			g.Update(e.Id, e.GraphParents)
+			for {
+				line, isCommit := g.NextLine()
+				if isCommit {
+					got = append(got, line+r.names[e.Id])
+					break
+				}
+				got = append(got, line)
+			}
+			for !g.IsCommitFinished() {
+				line, _ := g.NextLine()
+				got = append(got, line)
+			}
+		}
+		if strings.Join(got, "\n") != strings.Join(tc.Want, "\n") {
+			t.Errorf("tc %d: got\n%s\nwant\n%s", i, strings.Join(got, "\n"), strings.Join(tc.Want, "\n"))
+		}
+		r.Close()
+	}
+}
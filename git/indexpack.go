@@ -1,10 +1,15 @@
 package git
 
 import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
+	"runtime"
 	"sort"
 	"sync"
 
@@ -33,9 +38,15 @@ type IndexPackOptions struct {
 	// Not implemented
 	IndexVersion int
 
-	// Die if the pack contains broken links. (Not implemented)
+	// Die if the pack contains broken objects or links. Every commit,
+	// tree and tag in the pack is parsed, and any objects that they
+	// reference must exist either in the pack or in the repository.
 	Strict bool
 
+	// Like Strict, but every object referenced must be contained in
+	// the pack itself.
+	CheckSelfContainedAndConnected bool
+
 	// A number of threads to use for resolving deltas.  The 0-value
 	// will use GOMAXPROCS.
 	Threads uint
@@ -110,6 +121,8 @@ func (idx PackfileIndexV2) getObjectAtOffset(r io.ReadSeeker, offset int64) (Git
 		return GitTreeObject{len(rawdata), rawdata}, nil
 	case OBJ_BLOB:
 		return GitBlobObject{len(rawdata), rawdata}, nil
+	case OBJ_TAG:
+		return GitTagObject{len(rawdata), rawdata}, nil
 	case OBJ_OFS_DELTA:
 		// Things aren't very consistent with if types are strings, types,
 		// or interfaces, making this far more difficult than it needs to be.
@@ -128,6 +141,8 @@ func (idx PackfileIndexV2) getObjectAtOffset(r io.ReadSeeker, offset int64) (Git
 			res.Type = OBJ_TREE
 		case "blob":
 			res.Type = OBJ_BLOB
+		case "tag":
+			res.Type = OBJ_TAG
 		default:
 			return nil, InvalidObject
 		}
@@ -144,6 +159,8 @@ func (idx PackfileIndexV2) getObjectAtOffset(r io.ReadSeeker, offset int64) (Git
 			return GitTreeObject{len(val), val}, nil
 		case OBJ_BLOB:
 			return GitBlobObject{len(val), val}, nil
+		case OBJ_TAG:
+			return GitTagObject{len(val), val}, nil
 		default:
 			return nil, InvalidObject
 		}
@@ -163,6 +180,8 @@ func (idx PackfileIndexV2) getObjectAtOffset(r io.ReadSeeker, offset int64) (Git
 			res.Type = OBJ_TREE
 		case "blob":
 			res.Type = OBJ_BLOB
+		case "tag":
+			res.Type = OBJ_TAG
 		default:
 			return nil, InvalidObject
 		}
@@ -179,6 +198,8 @@ func (idx PackfileIndexV2) getObjectAtOffset(r io.ReadSeeker, offset int64) (Git
 			return GitTreeObject{len(val), val}, nil
 		case OBJ_BLOB:
 			return GitBlobObject{len(val), val}, nil
+		case OBJ_TAG:
+			return GitTagObject{len(val), val}, nil
 		default:
 			return nil, InvalidObject
 		}
@@ -350,194 +371,447 @@ func (p *PackfileIndexV2) calculateTrailer() error {
 	return nil
 }
 
-func IndexPack(c *Client, opts IndexPackOptions, r io.ReadSeeker) (PackfileIndex, error) {
+// A packObject is what's known about an object in a packfile while it's
+// being indexed.
+type packObject struct {
+	Offset int64
+	CRC32  uint32
+	Type   PackEntryType
+
+	// The base object, if Type is a delta.
+	BaseOffset int64
+	BaseRef    Sha1
+
+	// The hash of the object. For deltas, this is the zero value until
+	// the delta is resolved.
+	Sha1 Sha1
+}
+
+// A packIndexer indexes a packfile in two phases. First, the pack is read
+// from a stream in a single pass, hashing everything that isn't a delta
+// and recording where every object lives. Then, once the whole pack has
+// been received, the deltas are resolved in parallel by reading their
+// data back from the pack.
+type packIndexer struct {
+	c       *Client
+	opts    IndexPackOptions
+	objects []packObject
+
+	// Maps from a base object to the deltas that are based on it.
+	ofsChildren map[int64][]int
+	refChildren map[Sha1][]int
+	numDeltas   int
+
+	checker *objectChecker
+	trailer Sha1
+
+	// Protects progress output while resolving deltas.
+	mu       sync.Mutex
+	resolved int
+}
+
+func newPackIndexer(c *Client, opts IndexPackOptions) *packIndexer {
+	pi := &packIndexer{
+		c:           c,
+		opts:        opts,
+		ofsChildren: make(map[int64][]int),
+		refChildren: make(map[Sha1][]int),
+	}
+	if opts.Strict || opts.CheckSelfContainedAndConnected {
+		pi.checker = newObjectChecker()
+	}
+	return pi
+}
+
+// Reads the packfile from r in a single pass, printing progress as phase
+// if verbose. If copy is not nil, the pack is copied to it while it's read.
+func (pi *packIndexer) readPack(r io.Reader, copy io.Writer, phase string) (err error) {
+	pr := newPackReader(r)
+	pr.Sum = sha1.New()
+	pr.CRC = crc32.NewIEEE()
+	if copy != nil {
+		// The packReader writes a byte at a time while zlib is
+		// reading, so make sure the copy is buffered. The deltas are
+		// resolved by reading the copy back, so it isn't complete
+		// unless the buffer is flushed.
+		bw := bufio.NewWriter(copy)
+		defer func() {
+			if ferr := bw.Flush(); err == nil {
+				err = ferr
+			}
+		}()
+		pr.Tee = bw
+	}
+
 	var p PackfileHeader
-	binary.Read(r, binary.BigEndian, &p)
+	if err := binary.Read(pr, binary.BigEndian, &p); err != nil {
+		return err
+	}
 	if p.Signature != [4]byte{'P', 'A', 'C', 'K'} {
-		return nil, fmt.Errorf("Invalid packfile.")
+		return fmt.Errorf("Invalid packfile.")
 	}
 	if p.Version != 2 {
-		return nil, fmt.Errorf("Unsupported packfile version: %d", p.Version)
+		return fmt.Errorf("Unsupported packfile version: %d", p.Version)
 	}
 
-	//	deltaChains := make(map[ObjectOffset]resolvedDelta)
-	var mu sync.Mutex
-	var wg sync.WaitGroup
-	wg.Add(int(p.Size))
-
-	var indexfile PackfileIndexV2
-	indexfile.magic = [4]byte{0377, 't', 'O', 'c'}
-	indexfile.Version = 2
-
-	indexfile.Sha1Table = make([]Sha1, p.Size)
-	indexfile.CRC32 = make([]uint32, p.Size)
-	indexfile.FourByteOffsets = make([]uint32, p.Size)
-	ofsChains := make(map[ObjectOffset]resolvedDelta)
-	refChains := make(map[Sha1]resolvedDelta)
-	for i := uint32(0); i < p.Size; i += 1 {
-		if opts.Verbose {
-			progressF("Indexing objects: %2.f%% (%d/%d)", (float32(i+1) / float32(p.Size) * 100), i+1, p.Size)
-		}
-		location, err := r.Seek(0, io.SeekCurrent)
-		if err != nil {
-			// It's not worth trying to recover from being unable to
-			// find the current location, since it's required for
-			// the offset table.
-			return nil, err
+	pi.objects = make([]packObject, p.Size)
+	for i := range pi.objects {
+		if pi.opts.Verbose {
+			progressF("%s: %2.f%% (%d/%d)", phase, (float32(i+1) / float32(p.Size) * 100), i+1, p.Size)
 		}
-		//t, s, ref, offset := p.ReadHeaderSize(r)
-		t, _, ref, offset, rawheader := p.ReadHeaderSize(r)
-		rawdata, compressed := p.ReadEntryDataStream(r)
-		checksum := crc32.ChecksumIEEE(append(rawheader, compressed...))
+		o := &pi.objects[i]
+		o.Offset = pr.n
+		pr.CRC.Reset()
 
-		// The CRC32 checksum of the compressed data and the offset in
-		// the file don't change regardless of type.
-		mu.Lock()
-		indexfile.CRC32[i] = checksum
-
-		if location < (1 << 31) {
-			indexfile.FourByteOffsets[i] = uint32(location)
-		} else {
-			indexfile.FourByteOffsets[i] = uint32(len(indexfile.EightByteOffsets)) | (1 << 31)
-			indexfile.EightByteOffsets = append(indexfile.EightByteOffsets, uint64(location))
+		t, size, ref, offset, _ := p.ReadHeaderSize(pr)
+		o.Type = t
+		zr, err := zlib.NewReader(pr)
+		if err != nil {
+			return err
 		}
-		mu.Unlock()
-
-		// The way we calculate the hash changes based on if it's a delta
-		// or not.
 		switch t {
-		case OBJ_COMMIT, OBJ_TREE, OBJ_BLOB:
-			sha1, _, err := HashSlice(t.String(), rawdata)
-			if err != nil && opts.Strict {
-				return indexfile, err
+		case OBJ_COMMIT, OBJ_TREE, OBJ_BLOB, OBJ_TAG:
+			h := sha1.New()
+			fmt.Fprintf(h, "%s %d\000", t, size)
+
+			// Blobs are the only thing that could be large, and
+			// there's nothing to check in them, so only keep the
+			// data around for the checker if it's something else.
+			var w io.Writer = h
+			var data bytes.Buffer
+			if pi.checker != nil && t != OBJ_BLOB {
+				w = io.MultiWriter(h, &data)
 			}
-			mu.Lock()
-			for j := int(sha1[0]); j < 256; j++ {
-				indexfile.Fanout[j]++
+			n, err := io.Copy(w, zr)
+			if err != nil {
+				return err
 			}
-			indexfile.Sha1Table[i] = sha1
-			mu.Unlock()
-
-			// Maintain the list of references for further chains
-			// to use.
-			mu.Lock()
-			refChains[sha1] = resolvedDelta{rawdata, t}
-			ofsChains[ObjectOffset(location)] = resolvedDelta{rawdata, t}
-			mu.Unlock()
-
-			wg.Done()
-		case OBJ_OFS_DELTA:
-			t, deltadata, err := calculateOfsDelta(ObjectOffset(location)-offset, rawdata, ofsChains)
-			if err != nil && opts.Strict {
-				return indexfile, err
+			if n != int64(size) {
+				return fmt.Errorf("Incorrect size of object at offset %d: %d not %d", o.Offset, n, size)
 			}
-			mu.Lock()
-			ofsChains[ObjectOffset(location)] = resolvedDelta{deltadata, t}
-			mu.Unlock()
-			if err != nil && opts.Strict {
-				return nil, err
+			sha, err := Sha1FromSlice(h.Sum(nil))
+			if err != nil {
+				return err
 			}
-			sha1, _, err := HashSlice(t.String(), deltadata)
-			if err != nil && opts.Strict {
-				return nil, err
+			o.Sha1 = sha
+			if pi.checker != nil {
+				if err := pi.checker.Add(sha, t, data.Bytes()); err != nil {
+					return err
+				}
 			}
-
-			mu.Lock()
-			for j := int(sha1[0]); j < 256; j++ {
-				indexfile.Fanout[j]++
+		case OBJ_OFS_DELTA:
+			o.BaseOffset = o.Offset - int64(offset)
+			pi.ofsChildren[o.BaseOffset] = append(pi.ofsChildren[o.BaseOffset], i)
+			pi.numDeltas++
+			if _, err := io.Copy(ioutil.Discard, zr); err != nil {
+				return err
 			}
-			indexfile.Sha1Table[i] = sha1
-
-			mu.Unlock()
-			wg.Done()
 		case OBJ_REF_DELTA:
-			t, deltadata, err := calculateRefDelta(ref, rawdata, refChains)
-			if err != nil && opts.Strict {
-				return indexfile, err
-			}
-			if err != nil && opts.Strict {
-				return nil, err
+			o.BaseRef = ref
+			pi.refChildren[ref] = append(pi.refChildren[ref], i)
+			pi.numDeltas++
+			if _, err := io.Copy(ioutil.Discard, zr); err != nil {
+				return err
 			}
-			sha1, _, err := HashSlice(t.String(), deltadata)
-			mu.Lock()
-			refChains[sha1] = resolvedDelta{deltadata, t}
-			mu.Unlock()
+		default:
+			return fmt.Errorf("Invalid object type %d at offset %d", t, o.Offset)
+		}
+		zr.Close()
+		o.CRC32 = pr.CRC.Sum32()
+	}
+	if pi.opts.Verbose && p.Size > 0 {
+		progressF("%s: 100%% (%d/%d), done.\n", phase, p.Size, p.Size)
+	}
+
+	// Verify the trailer, which is a hash of everything that came
+	// before it.
+	expected := pr.Sum.Sum(nil)
+	if _, err := io.ReadFull(pr, pi.trailer[:]); err != nil {
+		return err
+	}
+	if !bytes.Equal(expected, pi.trailer[:]) {
+		return fmt.Errorf("Packfile checksum mismatch: got %x want %s", expected, pi.trailer)
+	}
+	return nil
+}
+
+// Reads the object at offset from the packfile r and returns its type and
+// (uncompressed) data. For deltas, the data is the delta itself.
+func readPackObjectAt(r io.ReaderAt, offset int64) (PackEntryType, []byte, error) {
+	br := bufio.NewReader(io.NewSectionReader(r, offset, math.MaxInt64-offset))
+	var p PackfileHeader
+	t, _, _, _, _ := p.ReadHeaderSize(br)
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer zr.Close()
+	data, err := ioutil.ReadAll(zr)
+	return t, data, err
+}
+
+// Resolves all the deltas in the pack, reading their data from r, using
+// opts.Threads goroutines.
+func (pi *packIndexer) resolveDeltas(r io.ReaderAt) error {
+	if pi.numDeltas == 0 {
+		return nil
+	}
+	threads := int(pi.opts.Threads)
+	if threads <= 0 {
+		threads = runtime.GOMAXPROCS(0)
+	}
+
+	// Every object that isn't a delta is the root of a (possibly empty)
+	// tree of deltas based on it. The trees are independent, so each
+	// one can be resolved in parallel.
+	var roots []int
+	for i, o := range pi.objects {
+		if o.Type != OBJ_OFS_DELTA && o.Type != OBJ_REF_DELTA {
+			roots = append(roots, i)
+		}
+	}
 
-			if err != nil && opts.Strict {
-				return nil, err
+	work := make(chan int)
+	errs := make(chan error, threads)
+	var wg sync.WaitGroup
+	wg.Add(threads)
+	for i := 0; i < threads; i++ {
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				if err := pi.resolveChildren(r, i, resolvedDelta{}); err != nil {
+					errs <- err
+					// Drain the rest of the work so that
+					// the sender doesn't block.
+					for range work {
+					}
+					return
+				}
 			}
+		}()
+	}
+	for _, i := range roots {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+
+	if pi.opts.Verbose {
+		progressF("Resolving deltas: 100%% (%d/%d), done.\n", pi.numDeltas, pi.numDeltas)
+	}
+	if pi.resolved != pi.numDeltas {
+		return fmt.Errorf("Thin packs are not currently supported.")
+	}
+	return nil
+}
+
+// Resolves every delta that has the object at index i as a base, and
+// recursively any deltas based on them. base is the resolved value of
+// the object at i, or the zero value if it hasn't been read yet.
+func (pi *packIndexer) resolveChildren(r io.ReaderAt, i int, base resolvedDelta) error {
+	o := pi.objects[i]
+	children := make([]int, 0, len(pi.ofsChildren[o.Offset])+len(pi.refChildren[o.Sha1]))
+	children = append(children, pi.ofsChildren[o.Offset]...)
+	children = append(children, pi.refChildren[o.Sha1]...)
+	if len(children) == 0 {
+		return nil
+	}
+
+	if base.Value == nil {
+		t, data, err := readPackObjectAt(r, o.Offset)
+		if err != nil {
+			return err
+		}
+		base = resolvedDelta{data, t}
+	}
 
-			mu.Lock()
-			for j := int(sha1[0]); j < 256; j++ {
-				indexfile.Fanout[j]++
+	for _, child := range children {
+		_, delta, err := readPackObjectAt(r, pi.objects[child].Offset)
+		if err != nil {
+			return err
+		}
+		t, data, err := calculateDelta(base, delta)
+		if err != nil {
+			return err
+		}
+		sha, _, err := HashSlice(t.String(), data)
+		if err != nil {
+			return err
+		}
+		pi.objects[child].Sha1 = sha
+		if pi.checker != nil {
+			if err := pi.checker.Add(sha, t, data); err != nil {
+				return err
 			}
-			indexfile.Sha1Table[i] = sha1
-			mu.Unlock()
-			wg.Done()
-		default:
-			panic("Unhandled type in IndexPack")
+		}
 
+		pi.mu.Lock()
+		pi.resolved++
+		if pi.opts.Verbose {
+			progressF("Resolving deltas: %2.f%% (%d/%d)", (float32(pi.resolved) / float32(pi.numDeltas) * 100), pi.resolved, pi.numDeltas)
+		}
+		pi.mu.Unlock()
+
+		if err := pi.resolveChildren(r, child, resolvedDelta{data, t}); err != nil {
+			return err
 		}
 	}
-	/* It's probably premature to require a Go 1.8 feature
-	sort.Slice(index, func(i, j int) bool {
-		return index[i] < index[j]
-	})*/
-	// Read the packfile trailer into the index trailer.
-	binary.Read(r, binary.BigEndian, &indexfile.Packfile)
-	sort.Sort(&indexfile)
+	return nil
+}
 
-	// The sorting may have changed things, so as a final pass, hash
-	// everything to get the trailer (instead of doing it while we
-	// were calculating everything.)
+// Generates the pack index from the objects that have been read.
+func (pi *packIndexer) index() (PackfileIndexV2, error) {
+	var indexfile PackfileIndexV2
+	indexfile.magic = [4]byte{0377, 't', 'O', 'c'}
+	indexfile.Version = 2
+	indexfile.Packfile = pi.trailer
+
+	// Sort the objects first, so that the large offset table is in the
+	// same order as the objects that refer to it.
+	objects := make([]packObject, len(pi.objects))
+	copy(objects, pi.objects)
+	sort.Sort(packObjectsBySha1(objects))
+
+	indexfile.Sha1Table = make([]Sha1, len(objects))
+	indexfile.CRC32 = make([]uint32, len(objects))
+	indexfile.FourByteOffsets = make([]uint32, len(objects))
+	for i, o := range objects {
+		for j := int(o.Sha1[0]); j < 256; j++ {
+			indexfile.Fanout[j]++
+		}
+		indexfile.Sha1Table[i] = o.Sha1
+		indexfile.CRC32[i] = o.CRC32
+		if o.Offset < (1 << 31) {
+			indexfile.FourByteOffsets[i] = uint32(o.Offset)
+		} else {
+			indexfile.FourByteOffsets[i] = uint32(len(indexfile.EightByteOffsets)) | (1 << 31)
+			indexfile.EightByteOffsets = append(indexfile.EightByteOffsets, uint64(o.Offset))
+		}
+	}
 	err := indexfile.calculateTrailer()
 	return indexfile, err
 }
 
+// Verifies the links between objects if a strict mode was requested, and
+// then generates the index.
+func (pi *packIndexer) finish() (PackfileIndex, error) {
+	// Now that everything in the pack has been seen, make sure that
+	// nothing refers to an object that doesn't exist.
+	if pi.checker != nil {
+		if err := pi.checker.Verify(pi.c, pi.opts.CheckSelfContainedAndConnected); err != nil {
+			return nil, err
+		}
+	}
+	idx, err := pi.index()
+	if err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+type packObjectsBySha1 []packObject
+
+func (p packObjectsBySha1) Len() int      { return len(p) }
+func (p packObjectsBySha1) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p packObjectsBySha1) Less(i, j int) bool {
+	return bytes.Compare(p[i].Sha1[:], p[j].Sha1[:]) < 0
+}
+
+// A seekReaderAt adapts an io.ReadSeeker to an io.ReaderAt for packs that
+// were passed to IndexPack in something that isn't an *os.File.
+type seekReaderAt struct {
+	mu sync.Mutex
+	r  io.ReadSeeker
+}
+
+func (s *seekReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.ReadFull(s.r, p)
+}
+
+// IndexPack indexes the packfile read from r and returns the index. It does
+// not write the index anywhere, that is the responsibility of the caller.
+func IndexPack(c *Client, opts IndexPackOptions, r io.ReadSeeker) (PackfileIndex, error) {
+	pi := newPackIndexer(c, opts)
+	if err := pi.readPack(r, nil, "Indexing objects"); err != nil {
+		return nil, err
+	}
+
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		ra = &seekReaderAt{r: r}
+	}
+	if err := pi.resolveDeltas(ra); err != nil {
+		return nil, err
+	}
+	return pi.finish()
+}
+
 // Indexes the pack, and stores a copy in Client's .git/objects/pack directory as it's
 // doing so. This is the equivalent of "git index-pack --stdin", but works with any
-// reader.
+// reader, which is only read once and never seeked.
 func IndexAndCopyPack(c *Client, opts IndexPackOptions, r io.Reader) (PackfileIndex, error) {
-	// Generate a temp file for the pack index.
+	// Use temp files for the index and the pack while they're being
+	// generated. They'll be renamed based on the pack's trailer when
+	// they're done.
 	fidx, err := ioutil.TempFile(c.GitDir.File("objects/pack").String(), ".tmppackfileidx")
 	if err != nil {
 		return nil, err
 	}
 	defer fidx.Close()
 
-	opts.Output = fidx
-	// Also use a temp file for copying the packfile to.
-	pack, err := ioutil.TempFile(c.GitDir.File("objects/pack").String(), ".tmppackfileidx")
+	pack, err := ioutil.TempFile(c.GitDir.File("objects/pack").String(), ".tmppackfile")
 	if err != nil {
-		// We handle fidx and pack in one defer, so we need to
-		// manually close fidx if we haven't set up the defer yet.
+		os.Remove(fidx.Name())
 		return nil, err
 	}
 	defer pack.Close()
-	// Use a temp file for the index.
-
-	// We need a ReadSeeker, not a Reader, so copy the whole thing before
-	// starting. (We can't just make the parameter a ReadSeeker, because
-	// os.Stdin is an *os.File which has a Seek method which always returns
-	// an error.)
-	io.Copy(pack, r)
-	pack.Seek(0, io.SeekStart)
 
 	var idx PackfileIndex
 	defer func() {
-		if idx != nil {
-			packhash, _ := idx.GetTrailer()
-			base := fmt.Sprintf("%s/pack-%s", c.GitDir.File("objects/pack").String(), packhash)
-			os.Rename(fidx.Name(), base+".idx")
-			os.Rename(pack.Name(), base+".pack")
+		if idx == nil {
+			os.Remove(fidx.Name())
+			os.Remove(pack.Name())
+			return
 		}
+		packhash, _ := idx.GetTrailer()
+		base := fmt.Sprintf("%s/pack-%s", c.GitDir.File("objects/pack").String(), packhash)
+		os.Rename(fidx.Name(), base+".idx")
+		os.Rename(pack.Name(), base+".pack")
 	}()
-	idx, err = IndexPack(c, opts, pack)
+
+	i, err := IndexAndCopyPackTo(c, opts, r, pack)
 	if err != nil {
-		return idx, err
+		return nil, err
+	}
+	if err := i.WriteIndex(fidx); err != nil {
+		return nil, err
+	}
+	idx = i
+	return idx, nil
+}
+
+// Indexes the pack read from r, and copies it to pack as it's doing so.
+// This is the equivalent of "git index-pack --stdin <pack>". Like
+// IndexAndCopyPack, r is only read once and never seeked, so it may be a
+// pipe. The deltas are resolved by reading back from pack.
+func IndexAndCopyPackTo(c *Client, opts IndexPackOptions, r io.Reader, pack *os.File) (PackfileIndex, error) {
+	pi := newPackIndexer(c, opts)
+	if err := pi.readPack(r, pack, "Receiving objects"); err != nil {
+		return nil, err
 	}
-	if idx != nil {
-		return idx, idx.WriteIndex(opts.Output)
+	// The deltas are resolved by reading back from the copy that was
+	// just written.
+	if err := pi.resolveDeltas(pack); err != nil {
+		return nil, err
 	}
-	return nil, fmt.Errorf("Invalid packfile index.")
+	return pi.finish()
 }
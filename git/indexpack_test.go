@@ -0,0 +1,119 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// A pack with 4 versions of a blob, each one line longer than the last.
+// The second is an OFS_DELTA against the first, the third is a REF_DELTA
+// against the second, and the fourth is an OFS_DELTA against the third.
+var deltaPack = []byte{
+	0x50, 0x41, 0x43, 0x4b, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x04, 0xb3, 0x02, 0x78, 0x9c,
+	0x00, 0x23, 0x00, 0xdc, 0xff, 0x6c, 0x69, 0x6e, 0x65, 0x20, 0x31, 0x0a, 0x6c, 0x69, 0x6e, 0x65,
+	0x20, 0x32, 0x0a, 0x6c, 0x69, 0x6e, 0x65, 0x20, 0x33, 0x0a, 0x6c, 0x69, 0x6e, 0x65, 0x20, 0x34,
+	0x0a, 0x6c, 0x69, 0x6e, 0x65, 0x20, 0x35, 0x0a, 0x03, 0x00, 0xbe, 0xff, 0x0a, 0x1a, 0x6c, 0x32,
+	0x78, 0x9c, 0x00, 0x0c, 0x00, 0xf3, 0xff, 0x23, 0x2a, 0x90, 0x23, 0x07, 0x6c, 0x69, 0x6e, 0x65,
+	0x20, 0x36, 0x0a, 0x03, 0x00, 0x14, 0x8b, 0x03, 0x10, 0x7c, 0xf9, 0x85, 0x85, 0x72, 0x24, 0x13,
+	0xe2, 0x77, 0x53, 0x99, 0xbf, 0x49, 0xfd, 0x98, 0x7a, 0x83, 0x7d, 0x5a, 0xad, 0x5a, 0x78, 0x9c,
+	0x00, 0x0c, 0x00, 0xf3, 0xff, 0x2a, 0x31, 0x90, 0x2a, 0x07, 0x6c, 0x69, 0x6e, 0x65, 0x20, 0x37,
+	0x0a, 0x03, 0x00, 0x15, 0x6d, 0x03, 0x26, 0x6c, 0x2e, 0x78, 0x9c, 0x00, 0x0c, 0x00, 0xf3, 0xff,
+	0x31, 0x38, 0x90, 0x31, 0x07, 0x6c, 0x69, 0x6e, 0x65, 0x20, 0x38, 0x0a, 0x03, 0x00, 0x16, 0x4f,
+	0x03, 0x3c, 0x4d, 0x35, 0xb3, 0x25, 0xc0, 0xcf, 0x16, 0xc7, 0xd1, 0x5c, 0x03, 0xa1, 0x8c, 0xce,
+	0x84, 0x0e, 0x84, 0x7d, 0x4b, 0x15,
+}
+
+// The blobs in deltaPack.
+var deltaPackBlobs = map[string]string{
+	"94c99a3280d27d2ebb75c61b3dcf7eb09a716ff7": "line 1\nline 2\nline 3\nline 4\nline 5\n",
+	"f98585722413e2775399bf49fd987a837d5aad5a": "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\n",
+	"734156dc73cccb9703067e6366f3d09266e090dd": "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\nline 7\n",
+	"c8b13a53e90e6442b04f9019e04717dff329722a": "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\nline 7\nline 8\n",
+}
+
+// Checks that idx is the same index that "git index-pack" generates for
+// deltaPack, and that every object can be read through it.
+func checkDeltaPackIndex(t *testing.T, label string, idx PackfileIndex) {
+	var buf bytes.Buffer
+	if err := idx.WriteIndex(&buf); err != nil {
+		t.Fatalf("%s: %v", label, err)
+	}
+	// The sha1 of the .idx file written by git 2.39.5.
+	if got := fmt.Sprintf("%x", sha1.Sum(buf.Bytes())); got != "081e37f8242cac6778ff58a3f668fa49bfc803d2" {
+		t.Errorf("%s: unexpected index file with hash %s", label, got)
+	}
+	packsum, idxsum := idx.GetTrailer()
+	if want := fmt.Sprintf("%x", deltaPack[len(deltaPack)-20:]); packsum.String() != want {
+		t.Errorf("%s: unexpected pack checksum: got %v want %v", label, packsum, want)
+	}
+	if want := "0c40c662304bec46f17db6c7f466bfd636ba7ef2"; idxsum.String() != want {
+		t.Errorf("%s: unexpected index checksum: got %v want %v", label, idxsum, want)
+	}
+
+	for id, content := range deltaPackBlobs {
+		sha, _ := Sha1FromString(id)
+		if !idx.HasObject(sha) {
+			t.Errorf("%s: missing object %s", label, id)
+			continue
+		}
+		obj, err := idx.GetObject(bytes.NewReader(deltaPack), sha)
+		if err != nil {
+			t.Errorf("%s: %s: %v", label, id, err)
+			continue
+		}
+		if obj.GetType() != "blob" || string(obj.GetContent()) != content {
+			t.Errorf("%s: %s: got %s %q want blob %q", label, id, obj.GetType(), obj.GetContent(), content)
+		}
+	}
+}
+
+func TestIndexPack(t *testing.T) {
+	r := newTestRepo(t)
+	defer r.Close()
+
+	for _, threads := range []uint{1, 4} {
+		opts := IndexPackOptions{Threads: threads, Strict: true}
+		idx, err := IndexPack(r.Client, opts, bytes.NewReader(deltaPack))
+		if err != nil {
+			t.Fatalf("threads=%d: %v", threads, err)
+		}
+		checkDeltaPackIndex(t, fmt.Sprintf("IndexPack threads=%d", threads), idx)
+	}
+}
+
+func TestIndexAndCopyPackTo(t *testing.T) {
+	r := newTestRepo(t)
+	defer r.Close()
+
+	for _, threads := range []uint{1, 4} {
+		label := fmt.Sprintf("IndexAndCopyPackTo threads=%d", threads)
+		pack, err := ioutil.TempFile("", "gittestpack")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(pack.Name())
+		defer pack.Close()
+
+		// Hide everything but Read, so that the pack is read like
+		// it's coming from a pipe.
+		src := struct{ io.Reader }{bytes.NewReader(deltaPack)}
+		idx, err := IndexAndCopyPackTo(r.Client, IndexPackOptions{Threads: threads}, src, pack)
+		if err != nil {
+			t.Fatalf("%s: %v", label, err)
+		}
+		checkDeltaPackIndex(t, label, idx)
+
+		copied, err := ioutil.ReadFile(pack.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(copied, deltaPack) {
+			t.Errorf("%s: pack was not copied correctly", label)
+		}
+	}
+}
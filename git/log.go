@@ -0,0 +1,278 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LogOptions represents the options that may be passed to "git log".
+type LogOptions struct {
+	WalkOptions
+
+	// Follow the history of the single file in Paths past renames.
+	Follow bool
+}
+
+// A LogEntry is a commit found by Log.
+type LogEntry struct {
+	Id CommitID
+
+	// The parents of the commit. With the RewriteParents option,
+	// they're rewritten to the nearest ancestors which modify the
+	// paths that the log is limited to.
+	Parents []CommitID
+
+	// The parents which are also part of the log, as needed to draw
+	// the commit graph. Commits which were only left out because of
+	// MaxCount or Skip still count as being part of the log.
+	GraphParents []CommitID
+
+	// With the Follow option, the name of the followed file in the
+	// commit.
+	Path IndexPath
+}
+
+// Implements the history walk for "git log". revs are the same as for
+// RevList, and HEAD is used if there aren't any.
+func Log(c *Client, opts LogOptions, revs []string) ([]LogEntry, error) {
+	if len(revs) == 0 {
+		revs = []string{"HEAD"}
+	}
+	filter, err := newCommitFilter(opts.WalkOptions)
+	if err != nil {
+		return nil, err
+	}
+	w := newRevWalker(c)
+	if opts.Follow {
+		return w.follow(opts, filter, revs)
+	}
+	entries, err := w.revList(RevListOptions{WalkOptions: opts.WalkOptions}, revs)
+	if err != nil {
+		return nil, err
+	}
+	log := make([]LogEntry, 0, len(entries))
+	for _, e := range entries {
+		cmt, err := w.parse(CommitID(e.Id))
+		if err != nil {
+			return nil, err
+		}
+		entry := LogEntry{Id: cmt.Id, Parents: e.Parents}
+		if entry.GraphParents, err = w.graphParents(e.Parents, filter); err != nil {
+			return nil, err
+		}
+		log = append(log, entry)
+	}
+	return log, nil
+}
+
+// Returns the parents which would be included in the walk if it weren't
+// for MaxCount and Skip.
+func (w *revWalker) graphParents(parents []CommitID, filter *commitFilter) ([]CommitID, error) {
+	var graph []CommitID
+	for i, pid := range parents {
+		if i > 0 && w.firstParent {
+			break
+		}
+		if w.flags[pid]&uninteresting != 0 {
+			continue
+		}
+		p, err := w.parse(pid)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := w.include(p, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			graph = append(graph, pid)
+		}
+	}
+	return graph, nil
+}
+
+// Implements Log with the Follow option. Every commit reachable from revs
+// is walked, and the commits other than merges which change the followed
+// file are included.
+// When the file was created by a commit, the commit's other changes are
+// checked for a rename, and the old name is followed from then on.
+func (w *revWalker) follow(opts LogOptions, filter *commitFilter, revs []string) ([]LogEntry, error) {
+	if len(opts.Paths) != 1 {
+		return nil, fmt.Errorf("--follow requires exactly one pathspec")
+	}
+	c := w.c
+	walk := RevListOptions{WalkOptions: opts.WalkOptions}
+	walk.Paths = nil
+	walk.MaxCount, walk.Skip, walk.Reverse = 0, 0, false
+	entries, err := w.revList(walk, revs)
+	if err != nil {
+		return nil, err
+	}
+
+	path := opts.Paths[0]
+	var log []LogEntry
+	for _, e := range entries {
+		cmt, err := w.parse(CommitID(e.Id))
+		if err != nil {
+			return nil, err
+		}
+		cur, err := treeEntryAt(c, cmt.Tree, path)
+		if err != nil {
+			return nil, err
+		}
+		// Like git, which only shows the commits whose diff includes
+		// the followed file, merges are left out, even if they change
+		// the file compared to every parent, since they aren't diffed
+		// unless only first parents are followed. Commits which delete
+		// the file (or rename it away) change it, but a root commit
+		// only does if it has the file.
+		if len(cmt.Parents) > 1 && !w.firstParent {
+			continue
+		}
+		changed := len(cmt.Parents) == 0 && cur != (TreeEntry{})
+		var created bool
+		if len(cmt.Parents) > 0 {
+			p, err := w.parse(cmt.Parents[0])
+			if err != nil {
+				return nil, err
+			}
+			old, err := treeEntryAt(c, p.Tree, path)
+			if err != nil {
+				return nil, err
+			}
+			changed = old != cur
+			created = changed && old == (TreeEntry{})
+		}
+		if !changed {
+			continue
+		}
+		entry := LogEntry{Id: cmt.Id, Parents: e.Parents, Path: path}
+		if entry.GraphParents, err = w.graphParents(e.Parents, filter); err != nil {
+			return nil, err
+		}
+		log = append(log, entry)
+		if !created {
+			continue
+		}
+		diffs, err := DiffTree(c, &DiffTreeOptions{Recurse: true}, cmt.Parents[0], cmt.Id, nil)
+		if err != nil {
+			return nil, err
+		}
+		changes, err := DetectRenames(c, diffs)
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range changes {
+			if change.Name == path && change.OldName != "" {
+				path = change.OldName
+				break
+			}
+		}
+	}
+
+	if opts.Skip > 0 {
+		if opts.Skip >= len(log) {
+			log = nil
+		} else {
+			log = log[opts.Skip:]
+		}
+	}
+	if opts.MaxCount < 0 {
+		log = nil
+	} else if opts.MaxCount > 0 && len(log) > opts.MaxCount {
+		log = log[:opts.MaxCount]
+	}
+	if opts.Reverse {
+		for i, j := 0, len(log)-1; i < j; i, j = i+1, j-1 {
+			log[i], log[j] = log[j], log[i]
+		}
+	}
+	return log, nil
+}
+
+// Returns the refs which are used to decorate commits, and the names to
+// show for them, in the order that git lists them in a decoration.
+func decorationRefs(c *Client, full bool) ([]Ref, []string, error) {
+	all, err := c.GetRefs("refs/")
+	if err != nil {
+		return nil, nil, err
+	}
+	var refs []Ref
+	var names []string
+	for _, ref := range all {
+		name := ref.Name.String()
+		switch {
+		case ref.Name == "refs/stash":
+		case strings.HasPrefix(name, "refs/heads/"), strings.HasPrefix(name, "refs/remotes/"):
+			if !full {
+				name = ref.Name.ShortName()
+			}
+		case strings.HasPrefix(name, "refs/tags/"):
+			if !full {
+				name = ref.Name.ShortName()
+			}
+			name = "tag: " + name
+		default:
+			// Other refs, such as notes, aren't shown.
+			continue
+		}
+		refs = append(refs, ref)
+		names = append(names, name)
+	}
+	if head, err := c.GetHeadCommit(); err == nil {
+		refs = append(refs, Ref{Name: "HEAD", Value: Sha1(head)})
+		names = append(names, "HEAD")
+	}
+
+	// The refs are listed in the reverse of the order that git loads
+	// them in.
+	for i, j := 0, len(refs)-1; i < j; i, j = i+1, j-1 {
+		refs[i], refs[j] = refs[j], refs[i]
+		names[i], names[j] = names[j], names[i]
+	}
+	return refs, names, nil
+}
+
+// Decorations returns the names of the refs which point to each object,
+// in the format used by "git log --decorate". Branches are shown by name,
+// tags are prefixed with "tag: ", and HEAD is shown as "HEAD -> branch"
+// when it's a symbolic ref. Annotated tags decorate both the tag and the
+// object that it points to. If full is set, the full ref names are used
+// instead of the short ones.
+func Decorations(c *Client, full bool) (map[Sha1][]string, error) {
+	refs, names, err := decorationRefs(c, full)
+	if err != nil {
+		return nil, err
+	}
+	branch, _ := SymbolicRefGet(c, SymbolicRefOptions{}, "HEAD")
+
+	decorations := make(map[Sha1][]string)
+	for i, ref := range refs {
+		if ref.Name == branch && branch.HasPrefix("refs/heads/") {
+			// It's shown along with HEAD instead.
+			continue
+		}
+		name := names[i]
+		if ref.Name == "HEAD" && branch.HasPrefix("refs/heads/") {
+			if full {
+				name += " -> " + branch.String()
+			} else {
+				name += " -> " + branch.ShortName()
+			}
+		}
+		id := ref.Value
+		decorations[id] = append(decorations[id], name)
+		for id.Type(c) == "tag" {
+			obj, err := c.GetObject(id)
+			if err != nil {
+				return nil, err
+			}
+			headers, _ := parseObjectHeaders(obj.GetContent())
+			if id, err = Sha1FromString(getObjectHeader(headers, "object")); err != nil {
+				return nil, err
+			}
+			decorations[id] = append(decorations[id], name)
+		}
+	}
+	return decorations, nil
+}
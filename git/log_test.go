@@ -0,0 +1,46 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestLogFollow(t *testing.T) {
+	r := newTestRepo(t)
+	defer r.Close()
+	r.setFiles(map[string]string{"f": "base\n"})
+	r.commit("base", 100)
+	r.setFiles(map[string]string{"f": "side\n"})
+	r.commit("side", 200, "base")
+	r.setFiles(map[string]string{"f": "main\n"})
+	r.commit("main", 300, "base")
+	// An evil merge, which changes f compared to both parents.
+	r.setFiles(map[string]string{"f": "evil\n"})
+	r.commit("evil", 400, "main", "side")
+	r.setFiles(map[string]string{"f": "evil\n", "g": "other\n"})
+	r.commit("other", 500, "evil")
+
+	tests := []struct {
+		Opts WalkOptions
+		Want string
+	}{
+		// Like git, merges are left out since they aren't diffed.
+		{WalkOptions{}, "main side base"},
+		{WalkOptions{FirstParent: true}, "evil main base"},
+		{WalkOptions{MaxCount: 2}, "main side"},
+	}
+	for i, tc := range tests {
+		tc.Opts.Paths = []IndexPath{"f"}
+		entries, err := Log(r.Client, LogOptions{WalkOptions: tc.Opts, Follow: true}, []string{r.commits["other"].String()})
+		if err != nil {
+			t.Errorf("tc %d: %v", i, err)
+			continue
+		}
+		var ids []CommitID
+		for _, e := range entries {
+			ids = append(ids, e.Id)
+		}
+		if got := r.nameList(ids); got != tc.Want {
+			t.Errorf("tc %d: got %v want %v", i, got, tc.Want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package git
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// LsRemoteOptions represents the options that may be passed to
+// "git ls-remote"
+type LsRemoteOptions struct {
+	// Limit to branches and/or tags. If neither are set, all refs
+	// are returned.
+	Heads, Tags bool
+
+	// Populate the Symref field of references which are symbolic refs
+	// on the remote.
+	Symref bool
+}
+
+// Returns true if s matches the shell wildcard pattern, where (unlike
+// path.Match) "*" may match a "/".
+func matchesWildcard(pattern, s string) bool {
+	// Replace the slashes with something that path.Match doesn't
+	// treat as a separator.
+	match, _ := path.Match(strings.Replace(pattern, "/", "\001", -1), strings.Replace(s, "/", "\001", -1))
+	return match
+}
+
+// Returns true if the pattern matches the ref name in the way that
+// ls-remote matches patterns, which is against the end of the name
+// after a "/", with shell wildcards.
+func lsRemoteMatches(name RefSpec, pattern string) bool {
+	s := name.String()
+	if matchesWildcard(pattern, s) {
+		return true
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '/' && matchesWildcard(pattern, s[i+1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// LsRemote implements "git ls-remote". remote may be the name of a remote
+// configured in c, or a URL. It returns the references that the remote
+// advertises, filtered by opts and patterns.
+func LsRemote(c *Client, opts LsRemoteOptions, remote string, patterns []string) ([]*Reference, error) {
+	location := remote
+	if url := c.GetConfig("remote." + remote + ".url"); url != "" {
+		location = url
+	}
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return nil, fmt.Errorf("Unknown protocol for %s", location)
+	}
+	ups := &SmartHTTPServerRetriever{Location: location, C: c}
+	r, err := ups.getRefs("git-upload-pack", "application/x-git-upload-pack-advertisement")
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	refs, capabilities, err := ups.RetrieveReferences("git-upload-pack", r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Symbolic refs are advertised as capabilities of the form
+	// symref=HEAD:refs/heads/master
+	symrefs := make(map[RefSpec]RefSpec)
+	for _, cap := range capabilities {
+		cap = strings.TrimSpace(cap)
+		if !strings.HasPrefix(cap, "symref=") {
+			continue
+		}
+		if pieces := strings.SplitN(cap[7:], ":", 2); len(pieces) == 2 {
+			symrefs[RefSpec(pieces[0])] = RefSpec(pieces[1])
+		}
+	}
+
+	var matched []*Reference
+	for _, ref := range refs {
+		if ref == nil {
+			continue
+		}
+		name := RefSpec(ref.Refname.String())
+		if opts.Heads || opts.Tags {
+			if !(opts.Heads && name.HasPrefix("refs/heads/")) &&
+				!(opts.Tags && name.HasPrefix("refs/tags/")) {
+				continue
+			}
+		}
+		if len(patterns) > 0 {
+			found := false
+			for _, p := range patterns {
+				if lsRemoteMatches(name, p) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		r := &Reference{Sha1: ref.Sha1, Refname: name}
+		if opts.Symref {
+			r.Symref = symrefs[name]
+		}
+		matched = append(matched, r)
+	}
+	return matched, nil
+}
@@ -0,0 +1,31 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestRefPatternMatching(t *testing.T) {
+	tests := []struct {
+		Ref      RefSpec
+		Pattern  string
+		ShowRef  bool
+		LsRemote bool
+	}{
+		{"refs/heads/master", "master", true, true},
+		{"refs/heads/master", "heads/master", true, true},
+		{"refs/heads/master", "refs/heads/master", true, true},
+		{"refs/heads/master", "aster", false, false},
+		{"refs/heads/master", "mast*", false, true},
+		{"refs/heads/feature/x", "refs/*/x", false, true},
+		{"refs/tags/v1.0", "v1.?", false, true},
+		{"refs/tags/v1.0", "v2.?", false, false},
+	}
+	for i, tc := range tests {
+		if got := showRefMatches(tc.Ref, tc.Pattern); got != tc.ShowRef {
+			t.Errorf("tc %d: show-ref %s matching %s: got %v want %v", i, tc.Ref, tc.Pattern, got, tc.ShowRef)
+		}
+		if got := lsRemoteMatches(tc.Ref, tc.Pattern); got != tc.LsRemote {
+			t.Errorf("tc %d: ls-remote %s matching %s: got %v want %v", i, tc.Ref, tc.Pattern, got, tc.LsRemote)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A Mailmap maps the names and email addresses that people have used in
+// commits to their canonical ones, as configured by .mailmap files.
+type Mailmap struct {
+	// The mappings, keyed by the lower case email address that they
+	// replace.
+	entries map[string]*mailmapEntry
+}
+
+// The canonical name and email for an identity. Either may be empty, if
+// it isn't replaced.
+type mailmapInfo struct {
+	name, email string
+}
+
+// The mapping for an email address. The names map is for entries which
+// only replace the identity if the name also matches, keyed by the lower
+// case name. Otherwise, mailmapInfo is used.
+type mailmapEntry struct {
+	mailmapInfo
+	names map[string]mailmapInfo
+}
+
+// ReadMailmap reads the mailmap for the repository. Like git, it reads the
+// .mailmap file at the top of the work tree, followed by the blob named by
+// mailmap.blob (which defaults to HEAD:.mailmap in bare repositories) and
+// the file named by mailmap.file, with later entries taking precedence.
+func ReadMailmap(c *Client) (*Mailmap, error) {
+	m := &Mailmap{entries: make(map[string]*mailmapEntry)}
+	if c.WorkDir != "" {
+		if err := m.readFile(filepath.Join(c.WorkDir.String(), ".mailmap")); err != nil {
+			return nil, err
+		}
+	}
+
+	blob := c.GetConfig("mailmap.blob")
+	if blob == "" && c.WorkDir == "" {
+		blob = "HEAD:.mailmap"
+	}
+	if blob != "" {
+		// Like git, a blob which doesn't exist is ignored.
+		if id, err := RevParseObject(c, &RevParseOptions{}, blob); err == nil {
+			obj, err := c.GetObject(id)
+			if err != nil {
+				return nil, err
+			}
+			if obj.GetType() != "blob" {
+				return nil, fmt.Errorf("mailmap is not a blob: %s", blob)
+			}
+			m.Parse(obj.GetContent())
+		}
+	}
+
+	if file := c.GetConfig("mailmap.file"); file != "" {
+		if strings.HasPrefix(file, "~/") {
+			file = filepath.Join(os.Getenv("HOME"), file[2:])
+		} else if !filepath.IsAbs(file) && c.WorkDir != "" {
+			file = filepath.Join(c.WorkDir.String(), file)
+		}
+		if err := m.readFile(file); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Adds the entries from the mailmap file at path, if it exists.
+func (m *Mailmap) readFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	m.Parse(data)
+	return nil
+}
+
+// Parses the name and email at the start of s, in the form
+// "Name <email>", where the name is optional. The email must not be empty
+// unless allowEmpty is set. It returns the rest of s after the email, and
+// false if there isn't an email.
+func parseMailmapIdent(s string, allowEmpty bool) (name, email, rest string, ok bool) {
+	lt := strings.IndexByte(s, '<')
+	if lt < 0 {
+		return "", "", "", false
+	}
+	gt := strings.IndexByte(s[lt+1:], '>')
+	if gt < 0 || (gt == 0 && !allowEmpty) {
+		return "", "", "", false
+	}
+	return strings.TrimSpace(s[:lt]), s[lt+1 : lt+1+gt], s[lt+gt+2:], true
+}
+
+// Parse adds the entries from data, which is in the format of a .mailmap
+// file, to the mailmap. Each line has one of the forms:
+//
+//	Proper Name <commit@email>
+//	<proper@email> <commit@email>
+//	Proper Name <proper@email> <commit@email>
+//	Proper Name <proper@email> Commit Name <commit@email>
+func (m *Mailmap) Parse(data []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		newName, newEmail, rest, ok := parseMailmapIdent(line, false)
+		if !ok {
+			continue
+		}
+		oldName, oldEmail, _, ok := parseMailmapIdent(rest, true)
+		if !ok {
+			// There's only one email, which is the one that's
+			// replaced.
+			oldName, oldEmail, newEmail = "", newEmail, ""
+		}
+
+		key := strings.ToLower(oldEmail)
+		e := m.entries[key]
+		if e == nil {
+			e = &mailmapEntry{}
+			m.entries[key] = e
+		}
+		if oldName == "" {
+			if newName != "" {
+				e.name = newName
+			}
+			if newEmail != "" {
+				e.email = newEmail
+			}
+			continue
+		}
+		if e.names == nil {
+			e.names = make(map[string]mailmapInfo)
+		}
+		e.names[strings.ToLower(oldName)] = mailmapInfo{newName, newEmail}
+	}
+}
+
+// Map returns p with its name and email replaced by the canonical ones
+// from the mailmap. Email addresses and names are matched without regard
+// to case.
+func (m *Mailmap) Map(p Person) Person {
+	e := m.entries[strings.ToLower(p.Email)]
+	if e == nil {
+		return p
+	}
+	info := e.mailmapInfo
+	if named, ok := e.names[strings.ToLower(p.Name)]; ok {
+		info = named
+	}
+	if info.name != "" {
+		p.Name = info.name
+	}
+	if info.email != "" {
+		p.Email = info.email
+	}
+	return p
+}
+
+// Parses a contact in the form "Name <email>" or "<email>". Unlike
+// parsePerson, whitespace at the start of the name is kept and anything
+// after the email is ignored, the same way as git's mailmap lookups.
+func parseContact(contact string) (Person, bool) {
+	lt := strings.IndexByte(contact, '<')
+	if lt < 0 {
+		return Person{}, false
+	}
+	gt := strings.IndexByte(contact[lt:], '>')
+	if gt < 0 {
+		return Person{}, false
+	}
+	return Person{
+		Name:  strings.TrimRight(contact[:lt], " \t\r\n\v\f"),
+		Email: contact[lt+1 : lt+gt],
+	}, true
+}
+
+// MapContact maps contact, which is in the form "Name <email>" or
+// "<email>", with the mailmap, and returns it in the same form.
+func (m *Mailmap) MapContact(contact string) (string, error) {
+	p, ok := parseContact(contact)
+	if !ok {
+		return "", fmt.Errorf("unable to parse contact: %s", contact)
+	}
+	p = m.Map(p)
+	if p.Name == "" {
+		return fmt.Sprintf("<%s>", p.Email), nil
+	}
+	return fmt.Sprintf("%s <%s>", p.Name, p.Email), nil
+}
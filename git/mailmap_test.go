@@ -0,0 +1,41 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestMailmap(t *testing.T) {
+	m := &Mailmap{entries: make(map[string]*mailmapEntry)}
+	m.Parse([]byte(`# A comment <not@used>
+Ann Author <ann@new> <ann@old>
+Robert <bob@x>
+<bob@canon> <bob@y>
+New Name <new@z> Old Name <old@z>
+`))
+	tests := []struct {
+		Contact string
+		Want    string
+	}{
+		{"Someone <ann@old>", "Ann Author <ann@new>"},
+		{"<ANN@OLD>", "Ann Author <ann@new>"},
+		{"Bob <bob@x>", "Robert <bob@x>"},
+		{"Bob <bob@y>", "Bob <bob@canon>"},
+		{"old name <old@z>", "New Name <new@z>"},
+		{"Other Name <old@z>", "Other Name <old@z>"},
+		{"<not@used>", "<not@used>"},
+		{"  Spaced <x@y>  ", "  Spaced <x@y>"},
+	}
+	for i, tc := range tests {
+		got, err := m.MapContact(tc.Contact)
+		if err != nil {
+			t.Errorf("tc %d: unexpected error %v", i, err)
+			continue
+		}
+		if got != tc.Want {
+			t.Errorf("tc %d: got %v want %v", i, got, tc.Want)
+		}
+	}
+	if _, err := m.MapContact("foo"); err == nil {
+		t.Errorf("expected error for contact without an email")
+	}
+}
@@ -1,16 +1,171 @@
 package git
 
-import ()
+import (
+	"fmt"
+)
 
-func MergeBaseOctopus(c *Client, commits []Commitish) (CommitID, error) {
-	var bestSoFar Commitish = commits[0]
-	for _, commit := range commits[1:] {
-		closest, err := NearestCommonParent(c, bestSoFar, commit)
+// MergeBaseOptions represents the options that may be passed to
+// "git merge-base".
+type MergeBaseOptions struct {
+	// Return all of the best common ancestors, instead of only the
+	// first one.
+	All bool
+
+	// Find the best common ancestors of all of the commits, instead of
+	// the ancestors of the first commit and a hypothetical merge of the
+	// others.
+	Octopus bool
+}
+
+// Returns the commits that commits refer to.
+func mergeBaseCommits(c *Client, commits []Commitish) ([]CommitID, error) {
+	ids := make([]CommitID, 0, len(commits))
+	for _, cmt := range commits {
+		id, err := cmt.CommitID(c)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// MergeBase returns the best common ancestors of the first commit and the
+// rest of commits, newest first. No commit in the result is an ancestor
+// of another one, and criss-cross merges may have more than one best
+// common ancestor. Only the first is returned unless opts.All is set. If
+// the commits have nothing in common, the result is empty.
+func MergeBase(c *Client, opts MergeBaseOptions, commits []Commitish) ([]CommitID, error) {
+	ids, err := mergeBaseCommits(c, commits)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	w := newRevWalker(c)
+	var bases []CommitID
+	if opts.Octopus {
+		// The bases of all the commits so far are merged with each
+		// commit in turn.
+		bases = ids[:1]
+		for _, id := range ids[1:] {
+			var next []CommitID
+			for _, base := range bases {
+				b, err := w.mergeBases(id, []CommitID{base})
+				if err != nil {
+					return nil, err
+				}
+				next = append(next, b...)
+			}
+			bases = next
+		}
+		if bases, err = reduceHeads(w, bases); err != nil {
+			return nil, err
+		}
+	} else if len(ids) == 1 {
+		return nil, fmt.Errorf("At least two commits are needed")
+	} else if bases, err = w.mergeBases(ids[0], ids[1:]); err != nil {
+		return nil, err
+	}
+	if !opts.All && len(bases) > 1 {
+		bases = bases[:1]
+	}
+	return bases, nil
+}
+
+// Removes duplicates and commits which are reachable from other commits,
+// keeping the order of the rest.
+func reduceHeads(w *revWalker, commits []CommitID) ([]CommitID, error) {
+	var unique []CommitID
+	added := make(map[CommitID]bool)
+	for _, id := range commits {
+		if !added[id] {
+			added[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return w.removeRedundant(unique)
+}
+
+// MergeBaseIndependent returns the commits which can't be reached from
+// any of the others, in the order that they were given.
+func MergeBaseIndependent(c *Client, commits []Commitish) ([]CommitID, error) {
+	ids, err := mergeBaseCommits(c, commits)
+	if err != nil {
+		return nil, err
+	}
+	return reduceHeads(newRevWalker(c), ids)
+}
+
+// MergeBaseForkPoint returns the point at which commit forked from the
+// ref named ref, taking the ref's reflog into account in case it has been
+// rewritten since. It returns the zero CommitID if there's no fork point.
+func MergeBaseForkPoint(c *Client, ref string, commit Commitish) (CommitID, error) {
+	full, err := c.DwimRef(ref)
+	if err != nil {
+		return CommitID{}, fmt.Errorf("No such ref: '%s'", ref)
+	}
+	derived, err := commit.CommitID(c)
+	if err != nil {
+		return CommitID{}, err
+	}
+
+	// Every commit that the ref has pointed to is a candidate.
+	var candidates []CommitID
+	added := make(map[CommitID]bool)
+	add := func(id Sha1) {
+		if id == (Sha1{}) || added[CommitID(id)] {
+			return
+		}
+		if id.Type(c) != "commit" {
+			return
+		}
+		added[CommitID(id)] = true
+		candidates = append(candidates, CommitID(id))
+	}
+	if ReflogExists(c, full) {
+		log, err := c.ReadReflog(full)
 		if err != nil {
 			return CommitID{}, err
 		}
-		bestSoFar = closest
+		for i, e := range log {
+			if i == 0 {
+				add(e.Old)
+			}
+			add(e.New)
+		}
 	}
-	return bestSoFar.CommitID(c)
+	if len(candidates) == 0 {
+		if id, err := full.CommitID(c); err == nil {
+			add(Sha1(id))
+		}
+	}
+	if len(candidates) == 0 {
+		return CommitID{}, nil
+	}
+
+	bases, err := newRevWalker(c).mergeBases(derived, candidates)
+	if err != nil {
+		return CommitID{}, err
+	}
+	// There's only a fork point if the one best common ancestor is
+	// somewhere that the ref pointed to.
+	if len(bases) != 1 || !added[bases[0]] {
+		return CommitID{}, nil
+	}
+	return bases[0], nil
+}
 
+// MergeBaseOctopus returns the first best common ancestor of all of
+// commits, or the zero CommitID if they have nothing in common.
+func MergeBaseOctopus(c *Client, commits []Commitish) (CommitID, error) {
+	bases, err := MergeBase(c, MergeBaseOptions{Octopus: true}, commits)
+	if err != nil {
+		return CommitID{}, err
+	}
+	if len(bases) == 0 {
+		return CommitID{}, nil
+	}
+	return bases[0], nil
 }
@@ -0,0 +1,59 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestMergeBase(t *testing.T) {
+	r := newTestRepo(t)
+	defer r.Close()
+
+	// A criss-cross merge, where D and E both have B and C as
+	// parents.
+	//
+	//     B---D---F
+	//    / \ /
+	//   A   X
+	//    \ / \
+	//     C---E
+	r.commit("A", 100)
+	r.commit("B", 200, "A")
+	r.commit("C", 300, "A")
+	r.commit("D", 400, "B", "C")
+	r.commit("E", 500, "C", "B")
+	r.commit("F", 600, "D")
+
+	tests := []struct {
+		Opts        MergeBaseOptions
+		Independent bool
+		Commits     []string
+		Want        string
+	}{
+		{MergeBaseOptions{}, false, []string{"F", "E"}, "C"},
+		{MergeBaseOptions{All: true}, false, []string{"F", "E"}, "C B"},
+		{MergeBaseOptions{All: true}, false, []string{"D", "B"}, "B"},
+		{MergeBaseOptions{All: true}, false, []string{"B", "C"}, "A"},
+		{MergeBaseOptions{All: true, Octopus: true}, false, []string{"D", "E", "B"}, "B"},
+		{MergeBaseOptions{}, true, []string{"B", "F", "C", "E", "F"}, "F E"},
+	}
+	for i, tc := range tests {
+		var cmts []Commitish
+		for _, name := range tc.Commits {
+			cmts = append(cmts, r.commits[name])
+		}
+		var bases []CommitID
+		var err error
+		if tc.Independent {
+			bases, err = MergeBaseIndependent(r.Client, cmts)
+		} else {
+			bases, err = MergeBase(r.Client, tc.Opts, cmts)
+		}
+		if err != nil {
+			t.Errorf("tc %d: %v", i, err)
+			continue
+		}
+		if got := r.nameList(bases); got != tc.Want {
+			t.Errorf("tc %d: got %v want %v", i, got, tc.Want)
+		}
+	}
+}
@@ -0,0 +1,538 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Options for naming commits relative to refs with "git name-rev".
+type NameRevOptions struct {
+	// Only name commits with tags.
+	Tags bool
+
+	// Only name commits with refs which match one of the Refs patterns
+	// (if any) and none of the Exclude patterns. A pattern may match
+	// the full ref name or any of its trailing components, in which
+	// case the name is shortened as much as possible.
+	Refs, Exclude []string
+
+	// Name every commit which is reachable from a ref, rather than the
+	// revisions given.
+	All bool
+
+	// Return an error for revisions which can't be named, instead of
+	// naming them "undefined".
+	NoUndefined bool
+
+	// Use the abbreviated object name for revisions which can't be
+	// named.
+	Always bool
+
+	// Name the commit that a tag points to, rather than the tag.
+	PeelTag bool
+
+	// With Tags, use the shortest unambiguous name for tags.
+	NameOnly bool
+}
+
+// A revision named by NameRev.
+type RevName struct {
+	// The revision as it was given to NameRev, or the object id
+	// with the All option.
+	Rev string
+
+	Id   Sha1
+	Name string
+}
+
+// Merges are walked as if they were this many generations away, so that
+// names which only follow first parents are preferred.
+const mergeTraversalWeight = 65535
+
+// Commits which are older than the oldest commit being named by more
+// than this many seconds aren't walked, in case of clock skew.
+const cutoffDateSlop = 86400
+
+// The name of a commit, relative to the tip that it was reached from.
+type revName struct {
+	tipName    string
+	taggerDate int64
+	generation int
+	distance   int
+	fromTag    bool
+}
+
+// Returns the name of the commit described by n.
+func (n *revName) String() string {
+	if n.generation == 0 {
+		return n.tipName
+	}
+	return fmt.Sprintf("%s~%d", strings.TrimSuffix(n.tipName, "^0"), n.generation)
+}
+
+// Returns the distance used to compare names. Names with a generation
+// (such as "tip~2") are ranked as far as names which go through a merge,
+// like git does.
+func effectiveDistance(distance, generation int) int {
+	if generation > 0 {
+		return distance + mergeTraversalWeight
+	}
+	return distance
+}
+
+// Returns true if a name reached from a tip with the given properties
+// is better than n.
+func (n *revName) worseThan(taggerDate int64, generation, distance int, fromTag bool) bool {
+	nameDistance := effectiveDistance(n.distance, n.generation)
+	newDistance := effectiveDistance(distance, generation)
+
+	// Names based on older tags are preferred, even if they're farther
+	// away.
+	if fromTag && n.fromTag {
+		return n.taggerDate > taggerDate || (n.taggerDate == taggerDate && nameDistance > newDistance)
+	}
+	// Tags are preferred over anything else.
+	if n.fromTag != fromTag {
+		return fromTag
+	}
+	if nameDistance != newDistance {
+		return nameDistance > newDistance
+	}
+	return n.taggerDate > taggerDate
+}
+
+// A ref that's used to name commits.
+type nameTip struct {
+	Id   Sha1
+	Name string
+
+	// The commit that the ref points to after peeling tags, if it
+	// points to a commit.
+	Commit    CommitID
+	HasCommit bool
+
+	// The date of the innermost tag, or the commit date if the ref
+	// isn't a tag.
+	TaggerDate int64
+
+	FromTag bool
+	Deref   bool
+}
+
+// A revNamer names commits relative to refs.
+type revNamer struct {
+	w      *revWalker
+	tips   []nameTip
+	names  map[CommitID]*revName
+	cutoff int64
+
+	// The commits that are loaded while reading the refs, including
+	// refs which aren't used as tips. These are the commits that refs
+	// and tags point to directly, and the parents of the commits that
+	// refs point to. git lists them with --all even if they can't be
+	// named.
+	refCommits []CommitID
+}
+
+// Returns the index of the trailing component of path that matches
+// pattern, or -1 if no part of it matches.
+func subpathMatches(path, pattern string) int {
+	for i := 0; i < len(path); {
+		if matchesWildcard(pattern, path[i:]) {
+			return i
+		}
+		slash := strings.IndexByte(path[i:], '/')
+		if slash < 0 {
+			break
+		}
+		i += slash + 1
+	}
+	return -1
+}
+
+// Returns the date of the tag with the given headers, or 0 if it
+// doesn't have a tagger.
+func tagDate(headers []objectHeader) int64 {
+	tagger, err := parsePerson(getObjectHeader(headers, "tagger"))
+	if err != nil || tagger.Time == nil {
+		return 0
+	}
+	return tagger.Time.Unix()
+}
+
+// Creates a revNamer with the refs that match opts as tips.
+func newRevNamer(c *Client, opts NameRevOptions) (*revNamer, error) {
+	n := &revNamer{
+		w:      newRevWalker(c),
+		names:  make(map[CommitID]*revName),
+		cutoff: math.MaxInt64,
+	}
+	refs, err := c.GetRefs("refs/")
+	if err != nil {
+		return nil, err
+	}
+refs:
+	for _, ref := range refs {
+		if err := n.loadRef(ref.Value); err != nil {
+			return nil, err
+		}
+		path := ref.Name.String()
+		abbreviate := opts.Tags && opts.NameOnly
+		if opts.Tags && !strings.HasPrefix(path, "refs/tags/") {
+			continue
+		}
+		for _, pattern := range opts.Exclude {
+			if subpathMatches(path, pattern) >= 0 {
+				continue refs
+			}
+		}
+		if len(opts.Refs) > 0 {
+			matched := false
+			for _, pattern := range opts.Refs {
+				switch subpathMatches(path, pattern) {
+				case -1:
+				case 0:
+					matched = true
+				default:
+					matched = true
+					abbreviate = true
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		tip := nameTip{Id: ref.Value, TaggerDate: math.MaxInt64}
+		id := ref.Value
+		for id.Type(c) == "tag" {
+			obj, err := c.GetObject(id)
+			if err != nil {
+				return nil, err
+			}
+			headers, _ := parseObjectHeaders(obj.GetContent())
+			if id, err = Sha1FromString(getObjectHeader(headers, "object")); err != nil {
+				return nil, err
+			}
+			tip.Deref = true
+			tip.TaggerDate = tagDate(headers)
+		}
+		if id.Type(c) == "commit" {
+			cmt, err := n.w.parse(CommitID(id))
+			if err != nil {
+				return nil, err
+			}
+			tip.Commit, tip.HasCommit = cmt.Id, true
+			tip.FromTag = strings.HasPrefix(path, "refs/tags/")
+			if tip.TaggerDate == math.MaxInt64 {
+				tip.TaggerDate = cmt.Date
+			}
+		}
+
+		switch {
+		case abbreviate:
+			tip.Name = c.ShortenRef(ref.Name)
+		case strings.HasPrefix(path, "refs/heads/"):
+			tip.Name = strings.TrimPrefix(path, "refs/heads/")
+		default:
+			tip.Name = strings.TrimPrefix(path, "refs/")
+		}
+		n.tips = append(n.tips, tip)
+	}
+	return n, nil
+}
+
+// Adds the commits which are loaded when reading the object that a ref
+// points to to refCommits.
+func (n *revNamer) loadRef(id Sha1) error {
+	switch id.Type(n.w.c) {
+	case "commit":
+		cmt, err := n.w.parse(CommitID(id))
+		if err != nil {
+			return err
+		}
+		n.refCommits = append(n.refCommits, cmt.Id)
+		n.refCommits = append(n.refCommits, cmt.Parents...)
+	case "tag":
+		obj, err := n.w.c.GetObject(id)
+		if err != nil {
+			return err
+		}
+		headers, _ := parseObjectHeaders(obj.GetContent())
+		if getObjectHeader(headers, "type") == "commit" {
+			target, err := CommitIDFromString(getObjectHeader(headers, "object"))
+			if err != nil {
+				return err
+			}
+			n.refCommits = append(n.refCommits, target)
+		}
+	}
+	return nil
+}
+
+// Names the commits reachable from the tips. Tags are named first, from
+// oldest to newest, so that worse names spread less.
+func (n *revNamer) nameTips() error {
+	sort.SliceStable(n.tips, func(i, j int) bool {
+		a, b := n.tips[i], n.tips[j]
+		if a.FromTag != b.FromTag {
+			return a.FromTag
+		}
+		return a.TaggerDate < b.TaggerDate
+	})
+	for _, tip := range n.tips {
+		if !tip.HasCommit {
+			continue
+		}
+		if err := n.nameRev(tip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sets the name of cmt, unless it already has a better one. It returns
+// nil if the name wasn't changed.
+func (n *revNamer) update(cmt *walkCommit, taggerDate int64, generation, distance int, fromTag bool) *revName {
+	name, ok := n.names[cmt.Id]
+	if ok && !name.worseThan(taggerDate, generation, distance, fromTag) {
+		return nil
+	}
+	if !ok {
+		name = &revName{}
+		n.names[cmt.Id] = name
+	}
+	name.taggerDate = taggerDate
+	name.generation = generation
+	name.distance = distance
+	name.fromTag = fromTag
+	return name
+}
+
+// Names the commits reachable from tip, walking depth first so that
+// first parents are named before other parents.
+func (n *revNamer) nameRev(tip nameTip) error {
+	start, err := n.w.parse(tip.Commit)
+	if err != nil {
+		return err
+	}
+	if start.Date < n.cutoff {
+		return nil
+	}
+	name := n.update(start, tip.TaggerDate, 0, 0, tip.FromTag)
+	if name == nil {
+		return nil
+	}
+	name.tipName = tip.Name
+	if tip.Deref {
+		name.tipName += "^0"
+	}
+
+	stack := []*walkCommit{start}
+	for len(stack) > 0 {
+		cmt := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		name := n.names[cmt.Id]
+
+		var queue []*walkCommit
+		for i, pid := range cmt.Parents {
+			p, err := n.w.parse(pid)
+			if err != nil {
+				return err
+			}
+			if p.Date < n.cutoff {
+				continue
+			}
+			generation, distance := name.generation+1, name.distance+1
+			if i > 0 {
+				generation, distance = 0, name.distance+mergeTraversalWeight
+			}
+			pname := n.update(p, tip.TaggerDate, generation, distance, tip.FromTag)
+			if pname == nil {
+				continue
+			}
+			switch {
+			case i == 0:
+				pname.tipName = name.tipName
+			case name.generation > 0:
+				pname.tipName = fmt.Sprintf("%s~%d^%d", strings.TrimSuffix(name.tipName, "^0"), name.generation, i+1)
+			default:
+				pname.tipName = fmt.Sprintf("%s^%d", strings.TrimSuffix(name.tipName, "^0"), i+1)
+			}
+			queue = append(queue, p)
+		}
+		// The first parent needs to be on the top of the stack.
+		for i := len(queue) - 1; i >= 0; i-- {
+			stack = append(stack, queue[i])
+		}
+	}
+	return nil
+}
+
+// Returns the name of the object id. Commits are named relative to the
+// tips, while other objects are only named if a ref points to them.
+func (n *revNamer) name(id Sha1) (string, bool) {
+	if name, ok := n.names[CommitID(id)]; ok {
+		return name.String(), true
+	}
+	if id.Type(n.w.c) == "commit" {
+		return "", false
+	}
+	for _, tip := range n.tips {
+		if tip.Id == id {
+			return tip.Name, true
+		}
+	}
+	return "", false
+}
+
+// Returns the name of id for the output, following opts if there's no
+// name for it.
+func (n *revNamer) nameOrFallback(opts NameRevOptions, id Sha1) (string, error) {
+	if name, ok := n.name(id); ok {
+		return name, nil
+	}
+	switch {
+	case !opts.NoUndefined:
+		return "undefined", nil
+	case opts.Always:
+		return id.Abbrev(n.w.c, 0), nil
+	default:
+		return "", fmt.Errorf("cannot describe '%s'", id)
+	}
+}
+
+// Implements "git name-rev". Each of the revisions is named relative to
+// the nearest ref that it can be reached from, such as "tags/v1.0~2" or
+// "master^2~3". Revisions which can't be parsed are skipped with a
+// message on stderr.
+func NameRev(c *Client, opts NameRevOptions, revs []string) ([]RevName, error) {
+	n, err := newRevNamer(c, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.All {
+		n.cutoff = 0
+	}
+
+	var named []RevName
+	for _, rev := range revs {
+		id, err := RevParseObject(c, &RevParseOptions{}, rev)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not get sha1 for %s. Skipping.\n", rev)
+			continue
+		}
+		commit, err := peelObject(c, id, "")
+		isCommit := err == nil && commit.Type(c) == "commit"
+		if isCommit {
+			cmt, err := n.w.parse(CommitID(commit))
+			if err != nil {
+				return nil, err
+			}
+			if cmt.Date < n.cutoff {
+				n.cutoff = cmt.Date
+			}
+		}
+		if opts.PeelTag {
+			if !isCommit {
+				fmt.Fprintf(os.Stderr, "Could not get commit for %s. Skipping.\n", rev)
+				continue
+			}
+			id = commit
+		}
+		named = append(named, RevName{Rev: rev, Id: id})
+	}
+	if n.cutoff > math.MinInt64+cutoffDateSlop {
+		n.cutoff -= cutoffDateSlop
+	} else {
+		n.cutoff = math.MinInt64
+	}
+	if err := n.nameTips(); err != nil {
+		return nil, err
+	}
+
+	if opts.All {
+		named = named[:0]
+		all := make(map[CommitID]bool)
+		for id := range n.names {
+			all[id] = true
+		}
+		for _, id := range n.refCommits {
+			all[id] = true
+		}
+		for id := range all {
+			named = append(named, RevName{Rev: id.String(), Id: Sha1(id)})
+		}
+		sort.Slice(named, func(i, j int) bool { return named[i].Rev < named[j].Rev })
+	}
+	for i := range named {
+		if named[i].Name, err = n.nameOrFallback(opts, named[i].Id); err != nil {
+			return named[:i], err
+		}
+	}
+	return named, nil
+}
+
+// Implements "git name-rev --stdin". Every full object id in r which can
+// be named is annotated with its name, and the result is written to w.
+// With NameOnly, the object ids are replaced by their names instead.
+func NameRevAnnotate(c *Client, opts NameRevOptions, r io.Reader, w io.Writer) error {
+	n, err := newRevNamer(c, opts)
+	if err != nil {
+		return err
+	}
+	n.cutoff = 0
+	if err := n.nameTips(); err != nil {
+		return err
+	}
+
+	ishex := func(b byte) bool {
+		return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f')
+	}
+	reader := bufio.NewReader(r)
+	for {
+		line, rerr := reader.ReadString('\n')
+		if rerr != nil && rerr != io.EOF {
+			return rerr
+		}
+		if line == "" {
+			return nil
+		}
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n"
+		}
+		counter := 0
+		start := 0
+		for i := 0; i < len(line); i++ {
+			if !ishex(line[i]) {
+				counter = 0
+				continue
+			}
+			counter++
+			if counter != 40 || (i+1 < len(line) && ishex(line[i+1])) {
+				continue
+			}
+			counter = 0
+			id, err := Sha1FromString(line[i-39 : i+1])
+			if err != nil {
+				continue
+			}
+			name, ok := n.name(id)
+			if !ok {
+				continue
+			}
+			if opts.NameOnly {
+				fmt.Fprintf(w, "%s%s", line[start:i-39], name)
+			} else {
+				fmt.Fprintf(w, "%s (%s)", line[start:i+1], name)
+			}
+			start = i + 1
+		}
+		fmt.Fprint(w, line[start:])
+	}
+}
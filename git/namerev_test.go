@@ -0,0 +1,55 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestRevNameString(t *testing.T) {
+	tests := []struct {
+		Name revName
+		Want string
+	}{
+		{revName{tipName: "master"}, "master"},
+		{revName{tipName: "master", generation: 3, distance: 3}, "master~3"},
+		{revName{tipName: "tags/v1^0"}, "tags/v1^0"},
+		{revName{tipName: "tags/v1^0", generation: 2, distance: 2}, "tags/v1~2"},
+		{revName{tipName: "master~2^2", generation: 1, distance: 65538}, "master~2^2~1"},
+	}
+	for i, tc := range tests {
+		if got := tc.Name.String(); got != tc.Want {
+			t.Errorf("tc %d: got %v want %v", i, got, tc.Want)
+		}
+	}
+}
+
+func TestRevNameWorseThan(t *testing.T) {
+	tests := []struct {
+		Name       revName
+		TaggerDate int64
+		Generation int
+		Distance   int
+		FromTag    bool
+		Want       bool
+	}{
+		// Tags are better than branches, even if they're farther away.
+		{revName{tipName: "master", distance: 1, generation: 1}, 10, 5, 5, true, true},
+		{revName{tipName: "v1", fromTag: true}, 10, 0, 0, false, false},
+		// Older tags are better, even if they're farther away.
+		{revName{tipName: "v2", taggerDate: 20, fromTag: true}, 10, 5, 5, true, true},
+		{revName{tipName: "v1", taggerDate: 10, fromTag: true}, 20, 0, 0, true, false},
+		// Otherwise, shorter names are better.
+		{revName{tipName: "master", generation: 3, distance: 3}, 10, 2, 2, false, true},
+		{revName{tipName: "master", generation: 2, distance: 2}, 10, 3, 3, false, false},
+		// A name which goes through a merge is as far as one which
+		// goes back generations from the tip.
+		{revName{tipName: "b^2", distance: mergeTraversalWeight + 1}, 10, 2, 2, false, false},
+		// Ties are broken by the date.
+		{revName{tipName: "b", taggerDate: 20}, 10, 0, 0, false, true},
+		{revName{tipName: "b", taggerDate: 10}, 10, 0, 0, false, false},
+	}
+	for i, tc := range tests {
+		if got := tc.Name.worseThan(tc.TaggerDate, tc.Generation, tc.Distance, tc.FromTag); got != tc.Want {
+			t.Errorf("tc %d: got %v want %v", i, got, tc.Want)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package git
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Returns true if s could be an abbreviated (or full) hex object name.
+func isHexPrefix(s string) bool {
+	if len(s) < 4 || len(s) > 40 {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// Reads the sha1 table from a version 2 pack index.
+func readPackIndexSha1s(r io.Reader) ([]Sha1, error) {
+	var idx PackfileIndexV2
+	if err := binary.Read(r, binary.BigEndian, &idx.magic); err != nil {
+		return nil, err
+	}
+	if idx.magic != [4]byte{0377, 't', 'O', 'c'} {
+		return nil, fmt.Errorf("Unsupported pack index version")
+	}
+	if err := binary.Read(r, binary.BigEndian, &idx.Version); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.BigEndian, &idx.Fanout); err != nil {
+		return nil, err
+	}
+	idx.Sha1Table = make([]Sha1, idx.Fanout[255])
+	if err := binary.Read(r, binary.BigEndian, idx.Sha1Table); err != nil {
+		return nil, err
+	}
+	return idx.Sha1Table, nil
+}
+
+// Returns every object in c's object database whose hex name starts
+// with prefix, sorted and without duplicates. prefix must be at least
+// 2 characters long.
+func (c *Client) findObjectsByPrefix(prefix string) ([]Sha1, error) {
+	prefix = strings.ToLower(prefix)
+	found := make(map[Sha1]bool)
+
+	// Loose objects are stored in a directory named after the first
+	// byte.
+	dir := c.GitDir.File(File("objects/" + prefix[:2])).String()
+	if files, err := ioutil.ReadDir(dir); err == nil {
+		for _, fi := range files {
+			name := prefix[:2] + fi.Name()
+			if len(name) != 40 || !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			if id, err := Sha1FromString(name); err == nil {
+				found[id] = true
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	indexes, err := filepath.Glob(c.GitDir.File("objects/pack/*.idx").String())
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range indexes {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		sha1s, err := readPackIndexSha1s(bufio.NewReader(f))
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		// The table is sorted, so binary search for the start of
+		// the prefix.
+		i := sort.Search(len(sha1s), func(i int) bool {
+			return hex.EncodeToString(sha1s[i][:]) >= prefix
+		})
+		for ; i < len(sha1s) && strings.HasPrefix(sha1s[i].String(), prefix); i++ {
+			found[sha1s[i]] = true
+		}
+	}
+
+	var objects []Sha1
+	for id := range found {
+		objects = append(objects, id)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].String() < objects[j].String()
+	})
+	return objects, nil
+}
+
+// Returns true if the object id satisfies the disambiguation hint, which
+// may be "commit", "committish", "treeish", "tree" or "blob". An empty
+// hint accepts any object.
+func (c *Client) matchesHint(id Sha1, hint string) bool {
+	t := id.Type(c)
+	switch hint {
+	case "":
+		return true
+	case "commit", "tree", "blob":
+		return t == hint
+	case "committish":
+		peeled, err := id.Peel(c)
+		return err == nil && peeled.Type(c) == "commit"
+	case "treeish":
+		peeled, err := id.Peel(c)
+		if err != nil {
+			return false
+		}
+		pt := peeled.Type(c)
+		return pt == "commit" || pt == "tree"
+	}
+	return false
+}
+
+// Returns the line describing the object id in the candidate list of an
+// ambiguous object name.
+func (c *Client) describeCandidate(id Sha1) string {
+	abbrev := id.Abbrev(c, 0)
+	switch t := id.Type(c); t {
+	case "commit":
+		cmt := CommitID(id)
+		committer, err := cmt.GetCommitter(c)
+		msg, err2 := cmt.GetCommitMessage(c)
+		if err != nil || err2 != nil || committer.Time == nil {
+			return abbrev + " commit"
+		}
+		subject, _ := splitSubject(msg)
+		return fmt.Sprintf("%s commit %s - %s", abbrev, committer.Time.Format("2006-01-02"), subject)
+	case "tag":
+		obj, err := c.GetObject(id)
+		if err != nil {
+			return abbrev + " tag"
+		}
+		headers, _ := parseObjectHeaders(obj.GetContent())
+		tagger, err := parsePerson(getObjectHeader(headers, "tagger"))
+		if err != nil || tagger.Time == nil {
+			return fmt.Sprintf("%s tag %s", abbrev, getObjectHeader(headers, "tag"))
+		}
+		return fmt.Sprintf("%s tag %s - %s", abbrev, tagger.Time.Format("2006-01-02"), getObjectHeader(headers, "tag"))
+	default:
+		return abbrev + " " + t
+	}
+}
+
+// Returns the sort order of object types in the list of candidates for an
+// ambiguous object name. Like git, tags come first and blobs last.
+func candidateOrder(t string) int {
+	switch t {
+	case "tag":
+		return 0
+	case "commit":
+		return 1
+	case "tree":
+		return 2
+	default:
+		return 3
+	}
+}
+
+// Resolves the abbreviated object name prefix to the only object that it
+// matches. If more than one object matches, only the objects that
+// satisfy hint (or core.disambiguate if hint is empty) are considered.
+func (c *Client) resolveAbbrev(prefix, hint string) (Sha1, error) {
+	candidates, err := c.findObjectsByPrefix(prefix)
+	if err != nil {
+		return Sha1{}, err
+	}
+	if hint == "" {
+		hint = c.GetConfig("core.disambiguate")
+	}
+	if len(candidates) > 1 && hint != "" {
+		var matched []Sha1
+		for _, id := range candidates {
+			if c.matchesHint(id, hint) {
+				matched = append(matched, id)
+			}
+		}
+		if len(matched) == 1 {
+			return matched[0], nil
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return Sha1{}, fmt.Errorf("Object %s not found", prefix)
+	case 1:
+		return candidates[0], nil
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidateOrder(candidates[i].Type(c)) < candidateOrder(candidates[j].Type(c))
+	})
+	msg := fmt.Sprintf("short object ID %s is ambiguous\nThe candidates are:", prefix)
+	for _, id := range candidates {
+		msg += "\n  " + c.describeCandidate(id)
+	}
+	return Sha1{}, fmt.Errorf("%s", msg)
+}
+
+// Returns the minimum length of abbreviated object names, from the
+// core.abbrev config variable. It defaults to 7.
+func (c *Client) abbrevLength() int {
+	switch v := c.GetConfig("core.abbrev"); v {
+	case "", "auto":
+		return 7
+	case "no":
+		return 40
+	default:
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 4 {
+			return 7
+		}
+		if n > 40 {
+			return 40
+		}
+		return n
+	}
+}
+
+// Returns the shortest prefix of id which is at least min characters long
+// and doesn't match any other object in c. If min is 0, core.abbrev is
+// used as the minimum.
+func (id Sha1) Abbrev(c *Client, min int) string {
+	name := id.String()
+	if min <= 0 {
+		min = c.abbrevLength()
+	}
+	if min < 4 {
+		min = 4
+	}
+	if min >= 40 {
+		return name
+	}
+	candidates, err := c.findObjectsByPrefix(name[:min])
+	if err != nil {
+		return name[:min]
+	}
+	length := min
+	for _, other := range candidates {
+		if other == id {
+			continue
+		}
+		// The abbreviation needs to be one longer than the prefix
+		// shared with any other object.
+		o := other.String()
+		n := min
+		for n < 40 && o[n] == name[n] {
+			n++
+		}
+		if n+1 > length {
+			length = n + 1
+		}
+	}
+	if length > 40 {
+		length = 40
+	}
+	return name[:length]
+}
+
+// Returns every object whose name starts with prefix, as used by "git
+// rev-parse --disambiguate". Like git, nothing matches a prefix that's
+// shorter than 4 characters or isn't hexadecimal.
+func Disambiguate(c *Client, prefix string) ([]Sha1, error) {
+	if !isHexPrefix(prefix) {
+		return nil, nil
+	}
+	return c.findObjectsByPrefix(prefix)
+}
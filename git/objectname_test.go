@@ -0,0 +1,58 @@
+package git
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAbbrev(t *testing.T) {
+	r := newTestRepo(t)
+	defer r.Close()
+	c := r.Client
+
+	// 515 and 5301 hash to blobs whose names share the prefix 3cda32.
+	a, err := c.WriteObject("blob", []byte("515\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.WriteObject("blob", []byte("5301\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := c.WriteObject("blob", []byte("test\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Id   Sha1
+		Min  int
+		Want string
+	}{
+		{a, 0, "3cda32f"},
+		{a, 5, "3cda32f"},
+		{b, 4, "3cda32b"},
+		{a, 10, "3cda32fc27"},
+		{other, 0, "9daeafb"},
+		{other, 4, "9dae"},
+		{other, 40, "9daeafb9864cf43055ae93beb0afd6c7d144bfa4"},
+	}
+	for i, tc := range tests {
+		if got := tc.Id.Abbrev(c, tc.Min); got != tc.Want {
+			t.Errorf("tc %d: got %v want %v", i, got, tc.Want)
+		}
+	}
+
+	if id, err := c.resolveAbbrev("3cda32b", ""); err != nil || id != b {
+		t.Errorf("Unexpected resolution of 3cda32b: %v (%v)", id, err)
+	}
+	if _, err := c.resolveAbbrev("3cda", ""); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("Expected ambiguous error for 3cda, got %v", err)
+	}
+	if _, err := c.resolveAbbrev("3cda", "commit"); err == nil {
+		t.Error("Expected error resolving 3cda as a commit")
+	}
+	if _, err := c.resolveAbbrev("0000", ""); err == nil {
+		t.Error("Expected error resolving 0000")
+	}
+}
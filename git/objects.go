@@ -122,6 +122,99 @@ func (t GitTreeObject) String() string {
 	return ret
 }
 
+type GitTagObject struct {
+	size    int
+	content []byte
+}
+
+func (t GitTagObject) GetContent() []byte {
+	return t.content
+}
+
+func (t GitTagObject) GetType() string {
+	return "tag"
+}
+func (t GitTagObject) GetSize() int {
+	return t.size
+}
+func (t GitTagObject) String() string {
+	return string(t.content)
+}
+
+// Returns the object that the tag points to.
+func (t GitTagObject) GetObject() (Sha1, error) {
+	if !bytes.HasPrefix(t.content, []byte("object ")) || len(t.content) < 47 {
+		return Sha1{}, fmt.Errorf("Invalid tag object")
+	}
+	return Sha1FromString(string(t.content[7:47]))
+}
+
+// An objectHeader is a header line from a commit or tag object, such as
+// "tree" or "author".
+type objectHeader struct {
+	Name, Value string
+}
+
+// Splits the content of a commit or tag object into its headers and its
+// message. Continuation lines of multi-line headers (such as gpgsig) are
+// joined to the header that they continue with a newline.
+func parseObjectHeaders(content []byte) (headers []objectHeader, message string) {
+	for len(content) > 0 {
+		eol := bytes.IndexByte(content, '\n')
+		if eol < 0 {
+			eol = len(content)
+		}
+		line := string(content[:eol])
+		if eol < len(content) {
+			content = content[eol+1:]
+		} else {
+			content = nil
+		}
+		if line == "" {
+			// A blank line separates the headers from the message.
+			return headers, string(content)
+		}
+		if line[0] == ' ' && len(headers) > 0 {
+			headers[len(headers)-1].Value += "\n" + line[1:]
+			continue
+		}
+		if sp := strings.IndexByte(line, ' '); sp >= 0 {
+			headers = append(headers, objectHeader{line[:sp], line[sp+1:]})
+		} else {
+			headers = append(headers, objectHeader{line, ""})
+		}
+	}
+	return headers, ""
+}
+
+// Returns the value of the first header named name, or the empty string.
+func getObjectHeader(headers []objectHeader, name string) string {
+	for _, h := range headers {
+		if h.Name == name {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// Peels id until it finds something that isn't a tag, and returns it. If id
+// is not a tag, it is returned unmodified.
+func (id Sha1) Peel(c *Client) (Sha1, error) {
+	for {
+		obj, err := c.GetObject(id)
+		if err != nil {
+			return Sha1{}, err
+		}
+		tag, ok := obj.(GitTagObject)
+		if !ok {
+			return id, nil
+		}
+		if id, err = tag.GetObject(); err != nil {
+			return Sha1{}, err
+		}
+	}
+}
+
 // Returns the byte array of a packed object from packfile, after
 // resolving any deltas. (packfile should be the base name with no
 // extension.)
@@ -211,6 +304,19 @@ func (c *Client) GetObject(sha1 Sha1) (GitObject, error) {
 			}
 		}
 		return GitTreeObject{size, content}, nil
+	} else if strings.HasPrefix(string(b), "tag ") {
+		var size int
+		var content []byte
+		for idx, val := range b {
+			if val == 0 {
+				content = b[idx+1:]
+				if size, err = strconv.Atoi(string(b[4:idx])); err != nil {
+					fmt.Printf("Error converting % x to int at idx: %d", b[4:idx], idx)
+				}
+				break
+			}
+		}
+		return GitTagObject{size, content}, nil
 	} else {
 		fmt.Printf("Content: %s\n", string(b))
 	}
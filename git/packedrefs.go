@@ -0,0 +1,127 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// A packedRef is a reference stored in the .git/packed-refs file.
+type packedRef struct {
+	Name  RefSpec
+	Value Sha1
+
+	// The object that Value peels to if it's an annotated tag, and
+	// the packed-refs file recorded it. The zero value if not known.
+	Peeled Sha1
+}
+
+// packedRefs represents the contents of a .git/packed-refs file.
+type packedRefs struct {
+	// The "# pack-refs with:" line, including the comment marker, if
+	// the file had one.
+	Header string
+
+	Refs []packedRef
+}
+
+// Parses the contents of a packed-refs file. The format is one ref per
+// line of the form "sha1 refname", optionally followed by a line of the
+// form "^sha1" with the object that the previous ref peels to.
+func parsePackedRefs(r io.Reader) (packedRefs, error) {
+	var p packedRefs
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			continue
+		case line[0] == '#':
+			if strings.HasPrefix(line, "# pack-refs with:") {
+				p.Header = line
+			}
+		case line[0] == '^':
+			if len(p.Refs) == 0 {
+				return packedRefs{}, fmt.Errorf("Peeled value without a reference in packed-refs")
+			}
+			sha, err := Sha1FromString(line[1:])
+			if err != nil {
+				return packedRefs{}, fmt.Errorf("Invalid peeled value in packed-refs: %v", err)
+			}
+			p.Refs[len(p.Refs)-1].Peeled = sha
+		default:
+			sp := strings.IndexByte(line, ' ')
+			if sp < 0 {
+				return packedRefs{}, fmt.Errorf("Invalid line in packed-refs: %s", line)
+			}
+			sha, err := Sha1FromString(line[:sp])
+			if err != nil {
+				return packedRefs{}, fmt.Errorf("Invalid line in packed-refs: %s", line)
+			}
+			p.Refs = append(p.Refs, packedRef{Name: RefSpec(line[sp+1:]), Value: sha})
+		}
+	}
+	return p, scanner.Err()
+}
+
+// Writes p in the packed-refs file format.
+func (p packedRefs) WritePackedRefs(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if p.Header != "" {
+		fmt.Fprintf(bw, "%s\n", p.Header)
+	}
+	for _, ref := range p.Refs {
+		fmt.Fprintf(bw, "%s %s\n", ref.Value, ref.Name)
+		if ref.Peeled != (Sha1{}) {
+			fmt.Fprintf(bw, "^%s\n", ref.Peeled)
+		}
+	}
+	return bw.Flush()
+}
+
+// Returns the packed ref named name, if it exists.
+func (p packedRefs) Lookup(name RefSpec) (packedRef, bool) {
+	for _, ref := range p.Refs {
+		if ref.Name == name {
+			return ref, true
+		}
+	}
+	return packedRef{}, false
+}
+
+// Reads the packed-refs file from c's GitDir. If there is no packed-refs
+// file, it returns an empty packedRefs, not an error.
+func (c *Client) readPackedRefs() (packedRefs, error) {
+	f, err := c.GitDir.Open("packed-refs")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return packedRefs{}, nil
+		}
+		return packedRefs{}, err
+	}
+	defer f.Close()
+	return parsePackedRefs(f)
+}
+
+// Replaces the packed-refs file with packed without releasing the lock on
+// it, by writing to a temporary file and renaming it into place. The
+// caller must hold the packed-refs lock.
+func (c *Client) replacePackedRefs(packed packedRefs) error {
+	tmp := c.GitDir.File("packed-refs.new").String()
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := packed.WritePackedRefs(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, c.GitDir.File("packed-refs").String())
+}
@@ -0,0 +1,65 @@
+package git
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParsePackedRefs(t *testing.T) {
+	const packed = `# pack-refs with: peeled fully-peeled sorted 
+1f8e5b4cfe8f0d8f9e9bd0b2c8d3c3b4d5e6f708 refs/heads/master
+2a8e5b4cfe8f0d8f9e9bd0b2c8d3c3b4d5e6f709 refs/tags/v1
+^3b8e5b4cfe8f0d8f9e9bd0b2c8d3c3b4d5e6f70a
+4c8e5b4cfe8f0d8f9e9bd0b2c8d3c3b4d5e6f70b refs/tags/v2
+`
+	p, err := parsePackedRefs(strings.NewReader(packed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Header != "# pack-refs with: peeled fully-peeled sorted " {
+		t.Errorf("Unexpected header %q", p.Header)
+	}
+
+	tests := []struct {
+		Name   RefSpec
+		Value  string
+		Peeled string
+	}{
+		{"refs/heads/master", "1f8e5b4cfe8f0d8f9e9bd0b2c8d3c3b4d5e6f708", "0000000000000000000000000000000000000000"},
+		{"refs/tags/v1", "2a8e5b4cfe8f0d8f9e9bd0b2c8d3c3b4d5e6f709", "3b8e5b4cfe8f0d8f9e9bd0b2c8d3c3b4d5e6f70a"},
+		{"refs/tags/v2", "4c8e5b4cfe8f0d8f9e9bd0b2c8d3c3b4d5e6f70b", "0000000000000000000000000000000000000000"},
+	}
+	if len(p.Refs) != len(tests) {
+		t.Fatalf("Unexpected number of refs: got %v want %v", len(p.Refs), len(tests))
+	}
+	for i, tc := range tests {
+		ref, ok := p.Lookup(tc.Name)
+		if !ok {
+			t.Errorf("tc %d: %s not found", i, tc.Name)
+			continue
+		}
+		if ref.Value.String() != tc.Value {
+			t.Errorf("tc %d: got value %v want %v", i, ref.Value, tc.Value)
+		}
+		if ref.Peeled.String() != tc.Peeled {
+			t.Errorf("tc %d: got peeled %v want %v", i, ref.Peeled, tc.Peeled)
+		}
+	}
+	if _, ok := p.Lookup("refs/heads/foo"); ok {
+		t.Error("Found non-existent ref refs/heads/foo")
+	}
+
+	// Writing it back out should give back the original file.
+	var buf bytes.Buffer
+	if err := p.WritePackedRefs(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != packed {
+		t.Errorf("Unexpected output: got %q want %q", got, packed)
+	}
+
+	if _, err := parsePackedRefs(strings.NewReader("^1f8e5b4cfe8f0d8f9e9bd0b2c8d3c3b4d5e6f708\n")); err == nil {
+		t.Error("Expected error for peeled line without a ref")
+	}
+}
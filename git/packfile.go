@@ -1,12 +1,13 @@
 package git
 
 import (
+	"bufio"
 	"bytes"
+	"compress/zlib"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
-
-	"github.com/driusan/dgit/zlib"
 )
 
 var debug bool = false
@@ -80,7 +81,6 @@ func (p PackfileHeader) ReadHeaderSize(r io.Reader) (PackEntryType, PackEntrySiz
 			case OBJ_TREE:
 			case OBJ_BLOB:
 			case OBJ_TAG:
-				fmt.Printf("Tag!\n")
 			case OBJ_OFS_DELTA:
 			case OBJ_REF_DELTA:
 			}
@@ -124,54 +124,78 @@ func (p PackfileHeader) ReadHeaderSize(r io.Reader) (PackEntryType, PackEntrySiz
 	return entrytype, size, Sha1{}, 0, dataread
 }
 
+// A packReader wraps a reader that a packfile is being read from, and keeps
+// track of how many bytes have been consumed from it. Since it implements
+// io.ByteReader, compress/zlib will never read past the end of a compressed
+// object, so the offset is always exactly at the end of the last thing that
+// was read.
+//
+// Anything consumed is also written to the optional Sum, CRC, and Tee writers,
+// in order to calculate the pack trailer, object checksums, and copy the
+// pack while it's being read.
+type packReader struct {
+	r *bufio.Reader
+	n int64
+
+	Sum hash.Hash
+	CRC hash.Hash32
+	Tee io.Writer
+
+	buf [1]byte
+}
+
+func newPackReader(r io.Reader) *packReader {
+	return &packReader{r: bufio.NewReader(r)}
+}
+
+func (p *packReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.consumed(b[:n])
+	return n, err
+}
+
+func (p *packReader) ReadByte() (byte, error) {
+	b, err := p.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	p.buf[0] = b
+	p.consumed(p.buf[:])
+	return b, nil
+}
+
+func (p *packReader) consumed(b []byte) {
+	p.n += int64(len(b))
+	if p.Sum != nil {
+		p.Sum.Write(b)
+	}
+	if p.CRC != nil {
+		p.CRC.Write(b)
+	}
+	if p.Tee != nil {
+		p.Tee.Write(b)
+	}
+}
+
 func (p PackfileHeader) ReadEntryDataStream(r io.ReadSeeker) (uncompressed []byte, compressed []byte) {
 	b := new(bytes.Buffer)
-	bookmark, _ := r.Seek(0, 1)
-	zr, err := zlib.NewReader(r)
+	bookmark, _ := r.Seek(0, io.SeekCurrent)
+
+	// The packReader ensures zlib doesn't read more than it needs to,
+	// so after decompressing we know exactly how big the compressed data
+	// was, and can go back and get it.
+	pr := newPackReader(r)
+	zr, err := zlib.NewReader(pr)
 	if err != nil {
 		panic(err)
 	}
 	defer zr.Close()
 	io.Copy(b, zr)
 
-	// Go's zlib implementation is greedy, so we need some hacks to
-	// get r back to the right place in the file.
-	// We use a modified version of compress/zlib which exposes the
-	// digest. Before reading, we take a bookmark of the address
-	// that we're starting at, then after reading we go back there.
-	// Starting from there, look through the reader until we find the
-	// compressed object's zlib digest.
-	// This is stupid, but necessary because git's packfile format
-	// is *very* stupid.
-	digest := zr.Digest.Sum32()
-	r.Seek(bookmark, 0)
-	address := make([]byte, 4)
-	var i int64
-	var finalAddress int64
-	for {
-		n, err := r.Read(address)
-		// This probably means we reached the end of the io.Reader.
-		// It might be the last read, so break out of the loop instead
-		// of getting caught in an infinite loop.
-		if n < 4 || err != nil {
-			break
-		}
-		var intAddress uint32 = (uint32(address[3]) | uint32(address[2])<<8 | uint32(address[1])<<16 | uint32(address[0])<<24)
-		if intAddress == digest {
-			finalAddress = bookmark + i + 4
-			break
-		}
-		// Advance a byte
-		i += 1
-		r.Seek(bookmark+i, 0)
-
-	}
-	r.Seek(bookmark, 0)
-	compressed = make([]byte, finalAddress-bookmark)
-	r.Read(compressed)
-	r.Seek(finalAddress, 0)
+	r.Seek(bookmark, io.SeekStart)
+	compressed = make([]byte, pr.n)
+	io.ReadFull(r, compressed)
 	return b.Bytes(), compressed
-
 }
 
 type VariableLengthInt uint64
@@ -0,0 +1,126 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// PackRefsOptions represents the options that may be passed to
+// "git pack-refs"
+type PackRefsOptions struct {
+	// Pack all refs, instead of only tags and refs which are already
+	// packed.
+	All bool
+
+	// Do not remove the loose refs after they've been packed.
+	NoPrune bool
+}
+
+// PackRefs implements "git pack-refs". It moves loose refs into the
+// packed-refs file, recording the object that annotated tags peel to, and
+// then removes the loose refs that were packed unless opts.NoPrune is set.
+func PackRefs(c *Client, opts PackRefsOptions) error {
+	lock, err := c.GitDir.File("packed-refs").Lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+
+	packed, err := c.readPackedRefs()
+	if err != nil {
+		return err
+	}
+	refs := make(map[RefSpec]Sha1)
+	for _, ref := range packed.Refs {
+		refs[ref.Name] = ref.Value
+	}
+
+	loose, err := c.looseRefs()
+	if err != nil {
+		return err
+	}
+	var pruneable []looseRef
+	for _, ref := range loose {
+		if ref.Target != "" {
+			// Symbolic refs can't be packed.
+			continue
+		}
+		// Without --all, only tags and refs that are already packed
+		// get packed.
+		if _, ok := refs[ref.Name]; !ok && !opts.All && !ref.Name.HasPrefix("refs/tags/") {
+			continue
+		}
+		if have, _, err := c.HaveObject(ref.Value); err != nil || !have {
+			// Don't pack (or remove) broken refs.
+			continue
+		}
+		refs[ref.Name] = ref.Value
+		pruneable = append(pruneable, ref)
+	}
+
+	newpacked := packedRefs{Header: "# pack-refs with: peeled fully-peeled sorted "}
+	for name, val := range refs {
+		ref := packedRef{Name: name, Value: val}
+		peeled, err := val.Peel(c)
+		if err != nil {
+			// Still pack it, but without the peeled value,
+			// rather than losing every other ref.
+			fmt.Fprintf(os.Stderr, "warning: unable to peel %s: %v\n", name, err)
+		} else if peeled != val {
+			ref.Peeled = peeled
+		}
+		newpacked.Refs = append(newpacked.Refs, ref)
+	}
+	sort.Slice(newpacked.Refs, func(i, j int) bool {
+		return newpacked.Refs[i].Name < newpacked.Refs[j].Name
+	})
+	if err := newpacked.WritePackedRefs(lock); err != nil {
+		return err
+	}
+	if err := lock.Commit(); err != nil {
+		return err
+	}
+
+	if opts.NoPrune {
+		return nil
+	}
+	for _, ref := range pruneable {
+		if err := pruneLooseRef(c, ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Removes the loose ref if it still has the value that was packed. The
+// ref is locked while it's checked so that a concurrent update-ref can't
+// change it between checking it and removing it.
+func pruneLooseRef(c *Client, ref looseRef) error {
+	f := ref.Name.File(c)
+	lock, err := f.Lock()
+	if err != nil {
+		// Something else is updating the ref, so leave it alone.
+		// The loose value will take precedence over the packed one.
+		return nil
+	}
+	defer lock.Rollback()
+
+	val, err := f.ReadFirstLine()
+	if err != nil {
+		return nil
+	}
+	if cur, err := Sha1FromString(val); err != nil || cur != ref.Value {
+		// It was updated since it was packed.
+		return nil
+	}
+	if err := f.Remove(); err != nil {
+		return err
+	}
+	lock.Rollback()
+
+	// Clean up any directories that are now empty, but leave the
+	// top level directories such as refs/heads alone.
+	c.removeEmptyRefDirs(ref.Name.String())
+	return nil
+}
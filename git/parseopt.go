@@ -0,0 +1,514 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Returned by RevParseParseOpt when the arguments couldn't be parsed, or
+// when help was requested. Either way, git exits with status 129.
+type ParseOptError struct {
+	// The reason that parsing failed, or nil if help was requested.
+	Err error
+
+	// The usage message to show, if any.
+	Usage string
+
+	// Help is true if the usage was asked for, in which case it's meant
+	// for stdout (to be evaluated by the shell) rather than stderr.
+	Help bool
+}
+
+func (e ParseOptError) Error() string {
+	if e.Err == nil {
+		return "usage requested"
+	}
+	return e.Err.Error()
+}
+
+// An option from a --parseopt specification.
+type parseOptSpec struct {
+	Short byte
+	Long  string
+
+	// The name of the argument in the help, or "" for "...".
+	ArgHelp string
+	Help    string
+
+	// Group headers only have a Help, which is the header.
+	Group bool
+
+	NoArg  bool // The option doesn't take an argument.
+	OptArg bool // The argument is optional.
+	NoNeg  bool // The option can't be negated with --no-
+	Hidden bool // Only show the option in --help-all
+}
+
+// Reads a --parseopt specification. The usage lines come first, up to a
+// line with only "--", followed by one option per line in the format
+//
+//	<short>|<long>|<short>,<long> [*=?!]* [arghint] <space> <help>
+//
+// Lines without any help text are group headers.
+func parseOptSpecs(spec io.Reader) (usage []string, opts []parseOptSpec, err error) {
+	scanner := bufio.NewScanner(spec)
+	for {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, nil, err
+			}
+			return nil, nil, fmt.Errorf("premature end of input")
+		}
+		if line := scanner.Text(); line != "--" {
+			usage = append(usage, line)
+			continue
+		}
+		if len(usage) == 0 {
+			return nil, nil, fmt.Errorf("no usage string given before the `--' separator")
+		}
+		break
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		space := strings.IndexAny(line, " \t\n\v\f\r")
+		if space <= 0 {
+			opts = append(opts, parseOptSpec{
+				Group: true,
+				Help:  strings.TrimLeft(line, " \t\n\v\f\r"),
+			})
+			continue
+		}
+		o := parseOptSpec{
+			Help:  strings.TrimLeft(line[space+1:], " \t\n\v\f\r"),
+			NoArg: true,
+		}
+
+		spec := line[:space]
+		flags := strings.IndexAny(spec, "*=?!")
+		if flags < 0 {
+			flags = len(spec)
+		}
+		switch {
+		case flags == 0:
+			return nil, nil, fmt.Errorf("missing opt-spec before option flags")
+		case flags == 1:
+			o.Short = spec[0]
+		case spec[1] != ',':
+			o.Long = spec[:flags]
+		default:
+			o.Short = spec[0]
+			o.Long = spec[2:flags]
+		}
+
+		i := flags
+	flagchars:
+		for ; i < len(spec); i++ {
+			switch spec[i] {
+			case '=':
+				o.NoArg = false
+			case '?':
+				o.NoArg = false
+				o.OptArg = true
+			case '!':
+				o.NoNeg = true
+			case '*':
+				o.Hidden = true
+			default:
+				break flagchars
+			}
+		}
+		o.ArgHelp = spec[i:]
+		opts = append(opts, o)
+	}
+	return usage, opts, scanner.Err()
+}
+
+// Returns the help for the options in the same format as git's usage
+// messages. Hidden options are only included if all is set.
+func parseOptUsage(usage []string, opts []parseOptSpec, all bool) string {
+	const optsWidth = 24
+	const gap = 2
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "usage: %s\n", usage[0])
+	usage = usage[1:]
+	for ; len(usage) > 0 && usage[0] != ""; usage = usage[1:] {
+		fmt.Fprintf(&b, "   or: %s\n", usage[0])
+	}
+	for _, line := range usage {
+		if line == "" {
+			b.WriteString("\n")
+		} else {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+	}
+	if len(opts) == 0 || !opts[0].Group {
+		b.WriteString("\n")
+	}
+
+	for _, o := range opts {
+		if o.Group {
+			fmt.Fprintf(&b, "\n%s\n", o.Help)
+			continue
+		}
+		if o.Hidden && !all {
+			continue
+		}
+		line := "    "
+		if o.Short != 0 {
+			line += "-" + string(o.Short)
+			if o.Long != "" {
+				line += ", "
+			}
+		}
+		if o.Long != "" {
+			line += "--" + o.Long
+		}
+		if !o.NoArg {
+			argh := o.ArgHelp
+			literal := argh == "" || strings.ContainsAny(argh, "()<>[]|")
+			if argh == "" {
+				argh = "..."
+			}
+			if !literal {
+				argh = "<" + argh + ">"
+			}
+			switch {
+			case o.OptArg && o.Long != "":
+				line += "[=" + argh + "]"
+			case o.OptArg:
+				line += "[" + argh + "]"
+			default:
+				line += " " + argh
+			}
+		}
+
+		pad := optsWidth - len(line)
+		switch {
+		case len(line) == optsWidth+1:
+			pad = -1
+		case len(line) > optsWidth:
+			line += "\n"
+			pad = optsWidth
+		}
+		fmt.Fprintf(&b, "%s%s%s\n", line, strings.Repeat(" ", pad+gap), o.Help)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// Quotes s so that it can be safely passed to sh as a single word.
+func sqQuote(s string) string {
+	s = strings.Replace(s, "'", `'\''`, -1)
+	s = strings.Replace(s, "!", `'\!'`, -1)
+	return "'" + s + "'"
+}
+
+// Implements "git rev-parse --sq-quote". Each argument is quoted for sh
+// and preceded by a space.
+func SQQuote(args []string) string {
+	var b strings.Builder
+	for _, arg := range args {
+		b.WriteString(" ")
+		b.WriteString(sqQuote(arg))
+	}
+	return b.String()
+}
+
+// The state of parsing arguments for RevParseParseOpt.
+type parseOptParser struct {
+	opts []parseOptSpec
+	args []string
+
+	// The rest of the current argument, after the option that's being
+	// parsed. hasValue distinguishes "--opt=" from "--opt".
+	value    string
+	hasValue bool
+
+	stuckLong bool
+	parsed    []string
+}
+
+// Returns the name of o for error messages.
+func (p *parseOptParser) optName(o *parseOptSpec, short, unset bool) string {
+	switch {
+	case short:
+		return fmt.Sprintf("switch `%c'", o.Short)
+	case unset:
+		return fmt.Sprintf("option `no-%s'", o.Long)
+	default:
+		return fmt.Sprintf("option `%s'", o.Long)
+	}
+}
+
+// Gets the value of o, and adds it to the parsed options.
+func (p *parseOptParser) getValue(o *parseOptSpec, short, unset bool) error {
+	if unset && p.hasValue {
+		return fmt.Errorf("%s takes no value", p.optName(o, short, unset))
+	}
+	if unset && o.NoNeg {
+		return fmt.Errorf("%s isn't available", p.optName(o, short, unset))
+	}
+	if !short && p.hasValue && o.NoArg {
+		return fmt.Errorf("%s takes no value", p.optName(o, short, unset))
+	}
+
+	var arg string
+	hasArg := false
+	switch {
+	case unset, o.NoArg:
+	case o.OptArg && !p.hasValue:
+	case p.hasValue:
+		arg, hasArg = p.value, true
+		p.value, p.hasValue = "", false
+	case len(p.args) > 1:
+		p.args = p.args[1:]
+		arg, hasArg = p.args[0], true
+	default:
+		return fmt.Errorf("%s requires a value", p.optName(o, short, unset))
+	}
+
+	var opt string
+	switch {
+	case unset:
+		opt = "--no-" + o.Long
+	case o.Short != 0 && (o.Long == "" || !p.stuckLong):
+		opt = "-" + string(o.Short)
+	default:
+		opt = "--" + o.Long
+	}
+	if hasArg {
+		switch {
+		case !p.stuckLong:
+			opt += " "
+		case o.Long != "":
+			opt += "="
+		}
+		opt += sqQuote(arg)
+	}
+	p.parsed = append(p.parsed, opt)
+	return nil
+}
+
+// Parses the short option at the start of p.value. It returns false if
+// it isn't a known option.
+func (p *parseOptParser) parseShort() (bool, error) {
+	for i := range p.opts {
+		o := &p.opts[i]
+		if o.Group || o.Short != p.value[0] {
+			continue
+		}
+		p.value = p.value[1:]
+		p.hasValue = p.value != ""
+		return true, p.getValue(o, true, false)
+	}
+	return false, nil
+}
+
+// Parses the long option arg, which doesn't include the leading "--".
+// Unambiguous abbreviations of options are accepted, and options may be
+// negated with "no-" unless the specification forbids it. It returns
+// help if the usage should be shown because the option is ambiguous.
+func (p *parseOptParser) parseLong(arg string) (known, help bool, err error) {
+	argEnd := strings.IndexByte(arg, '=')
+	if argEnd < 0 {
+		argEnd = len(arg)
+	}
+	var abbrev, ambiguous *parseOptSpec
+	var abbrevUnset, ambiguousUnset bool
+options:
+	for i := range p.opts {
+		o := &p.opts[i]
+		if o.Group || o.Long == "" {
+			continue
+		}
+		long := o.Long
+		unset, optUnset := false, false
+		for {
+			if strings.HasPrefix(arg, long) {
+				rest := arg[len(long):]
+				if rest == "" {
+					p.value, p.hasValue = "", false
+				} else if rest[0] == '=' {
+					p.value, p.hasValue = rest[1:], true
+				} else {
+					continue options
+				}
+				return true, false, p.getValue(o, false, unset != optUnset)
+			}
+
+			isAbbrev := strings.HasPrefix(long, arg[:argEnd])
+			if !isAbbrev && !o.NoNeg {
+				switch {
+				case strings.HasPrefix("no-", arg):
+					// Negated and abbreviated very much.
+					unset = true
+					isAbbrev = true
+				case !strings.HasPrefix(arg, "no-"):
+					if strings.HasPrefix(long, "no-") {
+						// The option is given without the
+						// "no-" of its name, which negates it.
+						long = long[3:]
+						optUnset = true
+						continue
+					}
+				default:
+					unset = true
+					if strings.HasPrefix(arg[3:], long) {
+						rest := arg[3+len(long):]
+						if rest == "" {
+							p.value, p.hasValue = "", false
+						} else if rest[0] == '=' {
+							p.value, p.hasValue = rest[1:], true
+						} else {
+							continue options
+						}
+						return true, false, p.getValue(o, false, unset != optUnset)
+					}
+					isAbbrev = strings.HasPrefix(long, arg[3:])
+				}
+			}
+			if isAbbrev {
+				if abbrev != nil {
+					ambiguous, ambiguousUnset = abbrev, abbrevUnset
+				}
+				abbrev, abbrevUnset = o, unset != optUnset
+			}
+			break
+		}
+	}
+	if ambiguous != nil {
+		no := func(unset bool) string {
+			if unset {
+				return "no-"
+			}
+			return ""
+		}
+		return false, true, fmt.Errorf(
+			"ambiguous option: %s (could be --%s%s or --%s%s)",
+			arg,
+			no(ambiguousUnset), ambiguous.Long,
+			no(abbrevUnset), abbrev.Long,
+		)
+	}
+	if abbrev != nil {
+		p.value, p.hasValue = "", false
+		if argEnd < len(arg) {
+			p.value, p.hasValue = arg[argEnd+1:], true
+		}
+		return true, false, p.getValue(abbrev, false, abbrevUnset)
+	}
+	return false, false, nil
+}
+
+// Returns an error if arg, a short option without its leading "-", looks
+// like a long option that was given with a single dash.
+func (p *parseOptParser) checkTypos(arg string) error {
+	if len(arg) < 3 {
+		return nil
+	}
+	typo := strings.HasPrefix(arg, "no-")
+	for _, o := range p.opts {
+		if !o.Group && o.Long != "" && strings.HasPrefix(o.Long, arg) {
+			typo = true
+		}
+	}
+	if typo {
+		return fmt.Errorf("did you mean `--%s` (with two dashes)?", arg)
+	}
+	return nil
+}
+
+// Implements "git rev-parse --parseopt". The option specification is read
+// from spec, and args are parsed according to it. The options are returned
+// in a normalized form as a "set --" command for sh to evaluate, followed
+// by "--" and the remaining arguments. The KeepDashDash, StopAtNonOption
+// and StuckLong options change how args are parsed.
+//
+// If the arguments are invalid, or help is requested, the error is a
+// ParseOptError.
+func RevParseParseOpt(opt RevParseOptions, spec io.Reader, args []string) (string, error) {
+	usage, opts, err := parseOptSpecs(spec)
+	if err != nil {
+		return "", err
+	}
+	showUsage := func(err error, help, all bool) error {
+		return ParseOptError{
+			Err:   err,
+			Usage: parseOptUsage(usage, opts, all),
+			Help:  help,
+		}
+	}
+
+	p := parseOptParser{opts: opts, args: args, stuckLong: opt.StuckLong}
+	var nonopts []string
+parse:
+	for ; len(p.args) > 0; p.args = p.args[1:] {
+		arg := p.args[0]
+		switch {
+		case arg == "" || arg[0] != '-' || arg == "-":
+			if opt.StopAtNonOption {
+				break parse
+			}
+			nonopts = append(nonopts, arg)
+		case arg == "-h" && len(args) == 1:
+			return "", showUsage(nil, true, false)
+		case arg == "--":
+			if !opt.KeepDashDash {
+				p.args = p.args[1:]
+			}
+			break parse
+		case arg == "--help-all":
+			return "", showUsage(nil, true, true)
+		case arg == "--help":
+			return "", showUsage(nil, true, false)
+		case strings.HasPrefix(arg, "--"):
+			known, help, err := p.parseLong(arg[2:])
+			if err != nil {
+				if help {
+					return "", showUsage(err, true, false)
+				}
+				return "", ParseOptError{Err: err}
+			}
+			if !known {
+				return "", showUsage(fmt.Errorf("unknown option `%s'", arg[2:]), false, false)
+			}
+		default:
+			p.value = arg[1:]
+			for first := true; p.value != ""; first = false {
+				known, err := p.parseShort()
+				if err != nil {
+					return "", ParseOptError{Err: err}
+				}
+				if first && (!known || p.value != "") {
+					if err := p.checkTypos(arg[1:]); err != nil {
+						return "", ParseOptError{Err: err}
+					}
+				}
+				if !known {
+					if p.value[0] == 'h' {
+						return "", showUsage(nil, true, false)
+					}
+					if !first && p.value[0] == '-' {
+						// git reports the rest of the
+						// argument as a long option.
+						return "", showUsage(fmt.Errorf("unknown option `%s'", p.value[1:]), false, false)
+					}
+					return "", showUsage(fmt.Errorf("unknown switch `%c'", p.value[0]), false, false)
+				}
+			}
+		}
+	}
+
+	out := "set --"
+	if len(p.parsed) > 0 {
+		out += " " + strings.Join(p.parsed, " ")
+	}
+	return out + " --" + SQQuote(append(nonopts, p.args...)), nil
+}
@@ -0,0 +1,957 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// A PrettyFormat is a format for showing commits, as given to the --pretty
+// or --format options of log, show and rev-list.
+type PrettyFormat struct {
+	// The name of the built-in format, such as "medium" or "oneline",
+	// or "format" for a format string.
+	Name string
+
+	// The format string, for "format" and the built-in formats which
+	// are defined by one.
+	Template string
+
+	// True if each commit is followed by a newline, instead of being
+	// separated from the next one by a newline.
+	Terminator bool
+}
+
+// The built-in formats, in the order that git looks them up. The format
+// strings are only set for the formats which are defined by one.
+var builtinFormats = []PrettyFormat{
+	{Name: "raw"},
+	{Name: "medium"},
+	{Name: "short"},
+	{Name: "email"},
+	{Name: "fuller"},
+	{Name: "full"},
+	{Name: "oneline", Terminator: true},
+	{Name: "reference", Template: "%C(auto)%h (%s, %ad)", Terminator: true},
+}
+
+// ParsePrettyFormat parses the argument to --pretty or --format. It may be
+// the name of a built-in format (or a unique prefix of one), the name of a
+// format defined by a pretty.<name> config variable, or a format string.
+// Format strings prefixed with "format:" separate commits with a newline,
+// while ones prefixed with "tformat:" (or containing a "%" without any
+// prefix) terminate each commit with one. Like git, the empty string is an
+// empty format string, which doesn't show anything.
+func ParsePrettyFormat(c *Client, arg string) (PrettyFormat, error) {
+	return parsePrettyFormat(c, arg, arg, 0)
+}
+
+func parsePrettyFormat(c *Client, arg, orig string, depth int) (PrettyFormat, error) {
+	switch {
+	case arg == "":
+		return PrettyFormat{Name: "format", Terminator: true}, nil
+	case strings.HasPrefix(arg, "format:"):
+		return PrettyFormat{Name: "format", Template: arg[len("format:"):]}, nil
+	case strings.HasPrefix(arg, "tformat:"):
+		return PrettyFormat{Name: "format", Template: arg[len("tformat:"):], Terminator: true}, nil
+	case strings.Contains(arg, "%"):
+		return PrettyFormat{Name: "format", Template: arg, Terminator: true}, nil
+	}
+	if depth > 10 {
+		return PrettyFormat{}, fmt.Errorf("invalid --pretty format: %s", orig)
+	}
+	if alias := c.GetConfig("pretty." + arg); alias != "" {
+		return parsePrettyFormat(c, alias, orig, depth+1)
+	}
+	// Like git, the shortest format that arg is a prefix of is used.
+	var found *PrettyFormat
+	for i, f := range builtinFormats {
+		if !strings.HasPrefix(f.Name, strings.ToLower(arg)) {
+			continue
+		}
+		if found == nil || len(f.Name) < len(found.Name) {
+			found = &builtinFormats[i]
+		}
+	}
+	if found == nil {
+		return PrettyFormat{}, fmt.Errorf("invalid --pretty format: %s", orig)
+	}
+	return *found, nil
+}
+
+// IsUserFormat returns true if the commits are formatted by a format
+// string, rather than by one of the built-in formats with a header.
+func (f PrettyFormat) IsUserFormat() bool {
+	return f.Name == "format" || f.Template != ""
+}
+
+// PrettyOptions represents the options which control how a
+// CommitFormatter formats commits.
+type PrettyOptions struct {
+	Format PrettyFormat
+
+	// The mode for dates, as accepted by FormatDate.
+	Date string
+
+	// Expand tabs in messages to spaces in the medium, full and fuller
+	// formats, like log does.
+	ExpandTabs bool
+
+	// The decorations for %d and %D, as returned by Decorations. They're
+	// loaded when needed if nil.
+	Decorations map[Sha1][]string
+
+	// Map the authors and committers shown by the built-in formats
+	// other than raw with the mailmap, like log's --use-mailmap.
+	Mailmap bool
+}
+
+// A CommitFormatter formats commits for showing them to the user, in the
+// same formats as git's --pretty option.
+type CommitFormatter struct {
+	c    *Client
+	opts PrettyOptions
+
+	// The mailmap for %aN and the other placeholders which use it,
+	// which is read when it's first needed.
+	mailmap *Mailmap
+}
+
+// NewCommitFormatter returns a formatter for commits with the given
+// options, or an error if the options are invalid.
+func NewCommitFormatter(c *Client, opts PrettyOptions) (*CommitFormatter, error) {
+	if opts.Date == "" && opts.Format.Name == "reference" {
+		opts.Date = "short"
+	}
+	if _, err := FormatDate(time.Unix(0, 0), opts.Date); err != nil {
+		return nil, err
+	}
+	return &CommitFormatter{c: c, opts: opts}, nil
+}
+
+// Format returns the commit formatted according to the options. It
+// doesn't include the "commit" line that log and rev-list show before most
+// formats. parents are the parents to show, which may have been rewritten
+// by a history walk. For the built-in formats other than oneline, the
+// result ends with a newline.
+func (f *CommitFormatter) Format(cmt CommitID, parents []CommitID) (string, error) {
+	info, err := f.newCommitInfo(cmt, parents)
+	if err != nil {
+		return "", err
+	}
+	format := f.opts.Format
+	if format.IsUserFormat() {
+		return f.expand(info, format.Template)
+	}
+
+	var b strings.Builder
+	switch format.Name {
+	case "oneline":
+		return info.subject(), nil
+	case "raw":
+		fmt.Fprintf(&b, "tree %s\n", getObjectHeader(info.headers, "tree"))
+		for _, p := range parents {
+			fmt.Fprintf(&b, "parent %s\n", p)
+		}
+		for _, h := range info.headers {
+			if h.Name != "tree" && h.Name != "parent" {
+				fmt.Fprintf(&b, "%s %s\n", h.Name, strings.Replace(h.Value, "\n", "\n ", -1))
+			}
+		}
+	case "email":
+		return f.email(info)
+	default:
+		if len(parents) > 1 {
+			b.WriteString("Merge:")
+			for _, p := range parents {
+				fmt.Fprintf(&b, " %s", Sha1(p).Abbrev(f.c, 0))
+			}
+			b.WriteString("\n")
+		}
+		author, err := f.person(info, "author")
+		if err != nil {
+			return "", err
+		}
+		committer, err := f.person(info, "committer")
+		if err != nil {
+			return "", err
+		}
+		switch format.Name {
+		case "short":
+			fmt.Fprintf(&b, "Author: %s <%s>\n", author.Name, author.Email)
+		case "medium":
+			fmt.Fprintf(&b, "Author: %s <%s>\n", author.Name, author.Email)
+			fmt.Fprintf(&b, "Date:   %s\n", f.date(author))
+		case "full":
+			fmt.Fprintf(&b, "Author: %s <%s>\n", author.Name, author.Email)
+			fmt.Fprintf(&b, "Commit: %s <%s>\n", committer.Name, committer.Email)
+		case "fuller":
+			fmt.Fprintf(&b, "Author:     %s <%s>\n", author.Name, author.Email)
+			fmt.Fprintf(&b, "AuthorDate: %s\n", f.date(author))
+			fmt.Fprintf(&b, "Commit:     %s <%s>\n", committer.Name, committer.Email)
+			fmt.Fprintf(&b, "CommitDate: %s\n", f.date(committer))
+		}
+	}
+	b.WriteString("\n")
+
+	// The message is indented, without any leading blank lines or
+	// trailing whitespace. The short format only has the title.
+	expand := f.opts.ExpandTabs && format.Name != "short" && format.Name != "raw"
+	for _, line := range messageLines(info.message) {
+		if line == "" && format.Name == "short" {
+			break
+		}
+		if expand {
+			line = expandTabs(line)
+		}
+		fmt.Fprintf(&b, "    %s\n", line)
+	}
+	return strings.TrimRight(b.String(), " \n") + "\n", nil
+}
+
+// Returns the email format of the commit, as used by format-patch.
+func (f *CommitFormatter) email(info *commitInfo) (string, error) {
+	var b strings.Builder
+	author, err := f.person(info, "author")
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(&b, "From %s Mon Sep 17 00:00:00 2001\n", info.id)
+	fmt.Fprintf(&b, "From: %s <%s>\n", emailName(author.Name), author.Email)
+	if author.Time != nil {
+		date, _ := FormatDate(*author.Time, "rfc")
+		fmt.Fprintf(&b, "Date: %s\n", date)
+	}
+	b.WriteString("Subject: [PATCH]")
+	switch subject := info.subject(); {
+	case !isASCII(subject):
+		b.WriteString(" " + rfc2047Encode(subject, false))
+	case len("Subject: [PATCH] ")+len(subject) <= 78:
+		b.WriteString(" " + subject)
+	default:
+		b.WriteString(wrapText(subject, len("Subject: [PATCH]"), 78))
+	}
+	b.WriteString("\n")
+	if !isASCII(info.message) {
+		b.WriteString("MIME-Version: 1.0\nContent-Type: text/plain; charset=UTF-8\nContent-Transfer-Encoding: 8bit\n")
+	}
+	b.WriteString("\n")
+
+	var body strings.Builder
+	for _, line := range messageLines(info.body()) {
+		fmt.Fprintf(&body, "%s\n", line)
+	}
+	if s := strings.TrimRight(body.String(), "\n"); s != "" {
+		b.WriteString(s + "\n")
+	}
+	return b.String(), nil
+}
+
+// FormatTag returns the annotated tag formatted the way that show prints
+// it, which is the tag's name and tagger in the style of the format,
+// followed by the raw message. It also returns the object that the tag
+// points to.
+func (f *CommitFormatter) FormatTag(tag Sha1) (string, Sha1, error) {
+	obj, err := f.c.GetObject(tag)
+	if err != nil {
+		return "", Sha1{}, err
+	}
+	t, ok := obj.(GitTagObject)
+	if !ok {
+		return "", Sha1{}, fmt.Errorf("%s is not a tag", tag)
+	}
+	target, err := t.GetObject()
+	if err != nil {
+		return "", Sha1{}, err
+	}
+	content := t.GetContent()
+	headers, _ := parseObjectHeaders(content)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "tag %s\n", getObjectHeader(headers, "tag"))
+	if h := getObjectHeader(headers, "tagger"); h != "" {
+		tagger, _ := parsePerson(h)
+		switch f.opts.Format.Name {
+		case "oneline":
+		case "email":
+			fmt.Fprintf(&b, "From: %s <%s>\n", emailName(tagger.Name), tagger.Email)
+			if tagger.Time != nil {
+				date, _ := FormatDate(*tagger.Time, "rfc")
+				fmt.Fprintf(&b, "Date: %s\n", date)
+			}
+		case "medium":
+			fmt.Fprintf(&b, "Tagger: %s <%s>\n", tagger.Name, tagger.Email)
+			fmt.Fprintf(&b, "Date:   %s\n", f.date(tagger))
+		case "fuller":
+			fmt.Fprintf(&b, "Tagger:     %s <%s>\n", tagger.Name, tagger.Email)
+			fmt.Fprintf(&b, "TaggerDate: %s\n", f.date(tagger))
+		default:
+			fmt.Fprintf(&b, "Tagger: %s <%s>\n", tagger.Name, tagger.Email)
+		}
+	}
+	// Unlike commits, the message is shown as it is, starting with the
+	// blank line after the headers.
+	if blank := bytes.Index(content, []byte("\n\n")); blank >= 0 {
+		b.Write(content[blank+1:])
+	}
+	return b.String(), target, nil
+}
+
+// Returns the date of p formatted with the date mode of the options.
+func (f *CommitFormatter) date(p Person) string {
+	if p.Time == nil {
+		return ""
+	}
+	// The mode was checked by NewCommitFormatter.
+	date, _ := FormatDate(*p.Time, f.opts.Date)
+	return date
+}
+
+// Returns the lines of msg with any leading blank lines removed, and the
+// trailing whitespace removed from each line.
+func messageLines(msg string) []string {
+	var lines []string
+	for _, line := range strings.Split(msg, "\n") {
+		line = strings.TrimRight(line, " \t\r\n\v\f")
+		if line == "" && len(lines) == 0 {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Expands the tabs in line to spaces, with tab stops every 8 columns.
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var expanded strings.Builder
+	col := 0
+	for _, r := range line {
+		if r == '\t' {
+			n := 8 - col%8
+			expanded.WriteString(strings.Repeat(" ", n))
+			col += n
+			continue
+		}
+		expanded.WriteRune(r)
+		col++
+	}
+	return expanded.String()
+}
+
+// Returns true if s only contains ASCII characters.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the name of a person as it's shown in an email header, which is
+// encoded if it isn't ASCII and quoted if it contains special characters.
+func emailName(name string) string {
+	if !isASCII(name) || strings.Contains(name, "=?") {
+		return rfc2047Encode(name, true)
+	}
+	if !strings.ContainsAny(name, "()<>@,;:\\\".[]") {
+		return name
+	}
+	name = strings.Replace(name, "\\", "\\\\", -1)
+	return `"` + strings.Replace(name, `"`, `\"`, -1) + `"`
+}
+
+// Encodes s as an RFC 2047 encoded word, using the "Q" encoding. Addresses
+// allow fewer characters to be left unencoded than subjects do.
+func rfc2047Encode(s string, address bool) string {
+	var b strings.Builder
+	b.WriteString("=?UTF-8?q?")
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		special := ch >= utf8.RuneSelf || ch <= ' ' || ch == 0x7f || ch == '=' || ch == '?' || ch == '_'
+		if address && !special {
+			special = !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || strings.IndexByte("!*+-/", ch) >= 0)
+		}
+		if special {
+			fmt.Fprintf(&b, "=%02X", ch)
+		} else {
+			b.WriteByte(ch)
+		}
+	}
+	b.WriteString("?=")
+	return b.String()
+}
+
+// Wraps the words of text so that no line is longer than width, where the
+// first line starts at column start. Each word is preceded by a space, and
+// lines after the first are indented by one space.
+func wrapText(text string, start, width int) string {
+	var b strings.Builder
+	col := start
+	for _, word := range strings.Fields(text) {
+		n := utf8.RuneCountInString(word)
+		if col > 1 && col+1+n > width {
+			b.WriteString("\n")
+			col = 0
+		}
+		b.WriteString(" " + word)
+		col += 1 + n
+	}
+	return b.String()
+}
+
+// commitInfo holds the parsed commit while it's being formatted.
+type commitInfo struct {
+	id      CommitID
+	parents []CommitID
+	headers []objectHeader
+	message string
+}
+
+func (f *CommitFormatter) newCommitInfo(cmt CommitID, parents []CommitID) (*commitInfo, error) {
+	headers, msg, err := cmt.getHeaders(f.c)
+	if err != nil {
+		return nil, err
+	}
+	return &commitInfo{id: cmt, parents: parents, headers: headers, message: msg}, nil
+}
+
+// Returns the author or committer of the commit.
+func (ci *commitInfo) person(field string) Person {
+	p, _ := parsePerson(getObjectHeader(ci.headers, field))
+	return p
+}
+
+// Returns the lines of the title of the commit, which is the first
+// paragraph of the message.
+func (ci *commitInfo) title() []string {
+	var title []string
+	for _, line := range messageLines(ci.message) {
+		if line == "" {
+			break
+		}
+		title = append(title, line)
+	}
+	return title
+}
+
+// Returns the title of the commit joined into a single line.
+func (ci *commitInfo) subject() string {
+	return strings.Join(ci.title(), " ")
+}
+
+// Returns the message after the title and the blank lines after it.
+func (ci *commitInfo) body() string {
+	msg := ci.message
+	// Skip the leading blank lines, the title, and then the blank lines
+	// after it.
+	for _, title := range []bool{false, true, false} {
+		for msg != "" {
+			eol := strings.IndexByte(msg, '\n') + 1
+			if eol == 0 {
+				eol = len(msg)
+			}
+			if (strings.TrimSpace(msg[:eol]) != "") != title {
+				break
+			}
+			msg = msg[eol:]
+		}
+	}
+	return msg
+}
+
+// Returns the title of the commit in the form used for file names by
+// format-patch, as shown by %f.
+func (ci *commitInfo) sanitizedSubject() string {
+	line := strings.TrimLeft(ci.message, "\n")
+	if eol := strings.IndexByte(line, '\n'); eol >= 0 {
+		line = line[:eol]
+	}
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '.' || ch == '_') {
+			space = b.Len() > 0
+			continue
+		}
+		if space {
+			b.WriteByte('-')
+			space = false
+		}
+		b.WriteByte(ch)
+		// Consecutive dots are squashed into one.
+		for ch == '.' && i+1 < len(line) && line[i+1] == '.' {
+			i++
+		}
+	}
+	return strings.TrimRight(b.String(), ".-")
+}
+
+// The ways that a placeholder can be padded to a width with %<, %> and %><.
+type padding struct {
+	// How the placeholder is aligned within the width: '<' for left,
+	// '>' for right or 'c' for centre. 0 means there's no padding.
+	align byte
+
+	// The width, or the column to pad to if column is set.
+	width  int
+	column bool
+
+	// How to truncate values which are too wide: "trunc", "ltrunc",
+	// "mtrunc", or the empty string to leave them as they are.
+	trunc string
+}
+
+// Parses a padding placeholder at the start of format, which is after the
+// "%". It returns the padding and the length of the placeholder, or 0 if
+// format doesn't start with a valid one.
+func parsePadding(format string) (padding, int) {
+	var p padding
+	n := 0
+	switch {
+	case strings.HasPrefix(format, "><"):
+		p.align, n = 'c', 2
+	case strings.HasPrefix(format, ">>"):
+		// git can steal the spaces to the left for this, but it
+		// isn't supported and it's treated the same as %>.
+		p.align, n = '>', 2
+	case strings.HasPrefix(format, ">"), strings.HasPrefix(format, "<"):
+		p.align, n = format[0], 1
+	default:
+		return padding{}, 0
+	}
+	if strings.HasPrefix(format[n:], "|") {
+		p.column = true
+		n++
+	}
+	if !strings.HasPrefix(format[n:], "(") {
+		return padding{}, 0
+	}
+	end := strings.IndexByte(format[n:], ')')
+	if end < 0 {
+		return padding{}, 0
+	}
+	args := strings.SplitN(format[n+1:n+end], ",", 2)
+	width, err := strconv.Atoi(strings.TrimSpace(args[0]))
+	if err != nil || width < 0 {
+		return padding{}, 0
+	}
+	p.width = width
+	if len(args) == 2 {
+		switch t := strings.TrimSpace(args[1]); t {
+		case "trunc", "ltrunc", "mtrunc":
+			p.trunc = t
+		default:
+			return padding{}, 0
+		}
+	}
+	return p, n + end + 1
+}
+
+// Returns the number of columns that s takes up, ignoring colours and
+// control characters.
+func displayWidth(s string) int {
+	width := 0
+	for i := 0; i < len(s); {
+		if s[i] == '\033' {
+			if end := strings.IndexByte(s[i:], 'm'); end >= 0 {
+				i += end + 1
+				continue
+			}
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r >= ' ' && r != 0x7f {
+			width++
+		}
+		i += size
+	}
+	return width
+}
+
+// Returns the first n runes of s, and the rest of it.
+func splitRunes(s string, n int) (string, string) {
+	for i := range s {
+		if n == 0 {
+			return s[:i], s[i:]
+		}
+		n--
+	}
+	return s, ""
+}
+
+// Pads or truncates s according to p. col is the column that s starts at.
+func (p padding) apply(s string, col int) string {
+	width := p.width
+	if p.column {
+		width -= col
+	}
+	occupied := displayWidth(s)
+	if occupied > width && p.trunc != "" && width >= 2 {
+		runes := utf8.RuneCountInString(s)
+		switch p.trunc {
+		case "trunc":
+			s, _ = splitRunes(s, width-2)
+			s += ".."
+		case "ltrunc":
+			_, right := splitRunes(s, runes-width+2)
+			s = ".." + right
+		case "mtrunc":
+			left, rest := splitRunes(s, width/2-1)
+			_, right := splitRunes(rest, occupied-width+2)
+			s = left + ".." + right
+		}
+		return s
+	}
+	if occupied >= width {
+		return s
+	}
+	spaces := width - occupied
+	switch p.align {
+	case '<':
+		return s + strings.Repeat(" ", spaces)
+	case '>':
+		return strings.Repeat(" ", spaces) + s
+	}
+	return strings.Repeat(" ", spaces/2) + s + strings.Repeat(" ", spaces-spaces/2)
+}
+
+// The ANSI codes for the colours and attributes accepted by %C.
+var (
+	colorNames = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+	colorAttrs = map[string]int{
+		"bold": 1, "dim": 2, "italic": 3, "ul": 4, "blink": 5, "reverse": 7, "strike": 9,
+		"nobold": 22, "nodim": 22, "noitalic": 23, "noul": 24, "noblink": 25, "noreverse": 27, "nostrike": 29,
+	}
+)
+
+// Parses a git colour specification such as "bold red blue" into an ANSI
+// escape sequence.
+func parseColor(spec string) (string, error) {
+	var attrs, colors []string
+	for _, word := range strings.Fields(spec) {
+		word = strings.ToLower(word)
+		if word == "reset" {
+			attrs = append(attrs, "")
+			continue
+		}
+		if a, ok := colorAttrs[strings.Replace(word, "no-", "no", 1)]; ok {
+			attrs = append(attrs, strconv.Itoa(a))
+			continue
+		}
+		if len(colors) == 2 {
+			return "", fmt.Errorf("invalid color value: %s", spec)
+		}
+		// The foreground colour comes first, then the background.
+		base := 30 + 10*len(colors)
+		code := ""
+		switch {
+		case word == "normal":
+		case word == "default":
+			code = strconv.Itoa(base + 9)
+		case strings.HasPrefix(word, "#") && len(word) == 7:
+			rgb, err := strconv.ParseUint(word[1:], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("invalid color value: %s", spec)
+			}
+			code = fmt.Sprintf("%d;2;%d;%d;%d", base+8, rgb>>16, rgb>>8&0xff, rgb&0xff)
+		default:
+			if n, err := strconv.Atoi(word); err == nil && n >= -1 && n < 256 {
+				switch {
+				case n < 0:
+				case n < 8:
+					code = strconv.Itoa(base + n)
+				default:
+					code = fmt.Sprintf("%d;5;%d", base+8, n)
+				}
+				break
+			}
+			bright := strings.HasPrefix(word, "bright")
+			found := false
+			for i, name := range colorNames {
+				if strings.TrimPrefix(word, "bright") == name {
+					if bright {
+						code = strconv.Itoa(base + 60 + i)
+					} else {
+						code = strconv.Itoa(base + i)
+					}
+					found = true
+				}
+			}
+			if !found {
+				return "", fmt.Errorf("invalid color value: %s", spec)
+			}
+		}
+		colors = append(colors, code)
+	}
+	var codes []string
+	for _, a := range attrs {
+		if a != "" {
+			codes = append(codes, a)
+		}
+	}
+	for _, c := range colors {
+		if c != "" {
+			codes = append(codes, c)
+		}
+	}
+	return "\033[" + strings.Join(codes, ";") + "m", nil
+}
+
+// Expands the placeholders in the format string for the commit.
+func (f *CommitFormatter) expand(info *commitInfo, format string) (string, error) {
+	var out strings.Builder
+	var pad padding
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			out.WriteByte(format[i])
+			continue
+		}
+		i++
+
+		// A "+", "-" or " " after the "%" adds a newline or a space
+		// before the placeholder if it isn't empty, or removes the
+		// newlines before it if it is.
+		modifier := byte(0)
+		if strings.IndexByte("+- ", format[i]) >= 0 && i+1 < len(format) {
+			modifier = format[i]
+			i++
+		}
+		if p, n := parsePadding(format[i:]); n > 0 {
+			pad = p
+			i += n - 1
+			continue
+		}
+		val, n, err := f.placeholder(info, format[i:])
+		if err != nil {
+			return "", err
+		}
+		if n == 0 {
+			// Unknown placeholders are left as they are.
+			out.WriteByte('%')
+			if modifier != 0 {
+				out.WriteByte(modifier)
+			}
+			i--
+			continue
+		}
+		i += n - 1
+		if pad.align != 0 {
+			line := out.String()
+			line = line[strings.LastIndexByte(line, '\n')+1:]
+			val = pad.apply(val, displayWidth(line))
+			pad = padding{}
+		}
+		switch {
+		case modifier == '+' && val != "":
+			out.WriteString("\n")
+		case modifier == ' ' && val != "":
+			out.WriteString(" ")
+		case modifier == '-' && val == "":
+			s := strings.TrimRight(out.String(), "\n")
+			out.Reset()
+			out.WriteString(s)
+		}
+		out.WriteString(val)
+	}
+	return out.String(), nil
+}
+
+// Returns the value of the placeholder at the start of format, which is
+// after the "%", and its length. The length is 0 if it isn't a known
+// placeholder.
+func (f *CommitFormatter) placeholder(info *commitInfo, format string) (string, int, error) {
+	switch format[0] {
+	case 'H':
+		return info.id.String(), 1, nil
+	case 'h':
+		return Sha1(info.id).Abbrev(f.c, 0), 1, nil
+	case 'T':
+		return getObjectHeader(info.headers, "tree"), 1, nil
+	case 't':
+		tree, err := Sha1FromString(getObjectHeader(info.headers, "tree"))
+		if err != nil {
+			return "", 0, err
+		}
+		return tree.Abbrev(f.c, 0), 1, nil
+	case 'P', 'p':
+		var parents []string
+		for _, p := range info.parents {
+			if format[0] == 'P' {
+				parents = append(parents, p.String())
+			} else {
+				parents = append(parents, Sha1(p).Abbrev(f.c, 0))
+			}
+		}
+		return strings.Join(parents, " "), 1, nil
+	case 'a', 'c':
+		if len(format) < 2 {
+			return "", 0, nil
+		}
+		field := "author"
+		if format[0] == 'c' {
+			field = "committer"
+		}
+		p, spec := info.person(field), format[1]
+		if spec == 'N' || spec == 'E' || spec == 'L' {
+			// The upper case versions of %an, %ae and %al use
+			// the mailmap.
+			mailmap, err := f.getMailmap()
+			if err != nil {
+				return "", 0, err
+			}
+			p, spec = mailmap.Map(p), spec-'A'+'a'
+		}
+		val, ok := f.personPlaceholder(p, spec)
+		if !ok {
+			return "", 0, nil
+		}
+		return val, 2, nil
+	case 'd', 'D':
+		decorations, err := f.decorations()
+		if err != nil {
+			return "", 0, err
+		}
+		names := decorations[Sha1(info.id)]
+		switch {
+		case len(names) == 0:
+			return "", 1, nil
+		case format[0] == 'd':
+			return " (" + strings.Join(names, ", ") + ")", 1, nil
+		}
+		return strings.Join(names, ", "), 1, nil
+	case 'e':
+		return getObjectHeader(info.headers, "encoding"), 1, nil
+	case 's':
+		return info.subject(), 1, nil
+	case 'f':
+		return info.sanitizedSubject(), 1, nil
+	case 'b':
+		return info.body(), 1, nil
+	case 'B':
+		return info.message, 1, nil
+	case 'n':
+		return "\n", 1, nil
+	case '%':
+		return "%", 1, nil
+	case 'x':
+		if len(format) >= 3 {
+			if b, err := strconv.ParseUint(format[1:3], 16, 8); err == nil {
+				return string([]byte{byte(b)}), 3, nil
+			}
+		}
+	case 'C':
+		return f.color(format)
+	}
+	return "", 0, nil
+}
+
+// Returns the mailmap, reading it if it hasn't been read yet.
+func (f *CommitFormatter) getMailmap() (*Mailmap, error) {
+	if f.mailmap == nil {
+		mailmap, err := ReadMailmap(f.c)
+		if err != nil {
+			return nil, err
+		}
+		f.mailmap = mailmap
+	}
+	return f.mailmap, nil
+}
+
+// Returns the author or committer of the commit as shown by the built-in
+// formats, which are mapped with the mailmap if the Mailmap option is set.
+func (f *CommitFormatter) person(info *commitInfo, field string) (Person, error) {
+	p := info.person(field)
+	if !f.opts.Mailmap {
+		return p, nil
+	}
+	mailmap, err := f.getMailmap()
+	if err != nil {
+		return Person{}, err
+	}
+	return mailmap.Map(p), nil
+}
+
+// Returns the value of a placeholder for the author or committer, where
+// c is the character after the "a" or "c".
+func (f *CommitFormatter) personPlaceholder(p Person, c byte) (string, bool) {
+	mode := ""
+	switch c {
+	case 'n':
+		return p.Name, true
+	case 'e':
+		return p.Email, true
+	case 'l':
+		if at := strings.IndexByte(p.Email, '@'); at >= 0 {
+			return p.Email[:at], true
+		}
+		return p.Email, true
+	case 'd':
+		return f.date(p), true
+	case 'D':
+		mode = "rfc"
+	case 'r':
+		mode = "relative"
+	case 't':
+		mode = "unix"
+	case 'i':
+		mode = "iso"
+	case 'I':
+		mode = "iso-strict"
+	case 's':
+		mode = "short"
+	default:
+		return "", false
+	}
+	if p.Time == nil {
+		return "", true
+	}
+	date, _ := FormatDate(*p.Time, mode)
+	return date, true
+}
+
+// Returns the colour for a %C placeholder at the start of format, and
+// its length. Colours are only shown if they're prefixed with "always,",
+// since colour output isn't otherwise supported.
+func (f *CommitFormatter) color(format string) (string, int, error) {
+	for _, name := range []string{"red", "green", "blue", "reset"} {
+		if strings.HasPrefix(format[1:], name) {
+			return "", len(name) + 1, nil
+		}
+	}
+	if !strings.HasPrefix(format, "C(") {
+		return "", 0, nil
+	}
+	end := strings.IndexByte(format, ')')
+	if end < 0 {
+		return "", 0, nil
+	}
+	spec := format[2:end]
+	if !strings.HasPrefix(spec, "always,") {
+		return "", end + 1, nil
+	}
+	color, err := parseColor(spec[len("always,"):])
+	return color, end + 1, err
+}
+
+// Returns the decorations for %d and %D, loading them if they weren't
+// passed in the options.
+func (f *CommitFormatter) decorations() (map[Sha1][]string, error) {
+	if f.opts.Decorations == nil {
+		decorations, err := Decorations(f.c, false)
+		if err != nil {
+			return nil, err
+		}
+		f.opts.Decorations = decorations
+	}
+	return f.opts.Decorations, nil
+}
@@ -0,0 +1,86 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestPaddingApply(t *testing.T) {
+	tests := []struct {
+		Format string
+		Value  string
+		Column int
+		Want   string
+	}{
+		{"<(6)", "abc", 0, "abc   "},
+		{">(6)", "abc", 0, "   abc"},
+		{"><(6)", "abc", 0, " abc  "},
+		{"<(2)", "abc", 0, "abc"},
+		{"<(6,trunc)", "abcdefgh", 0, "abcd.."},
+		{"<(6,ltrunc)", "abcdefgh", 0, "..efgh"},
+		{"<(6,mtrunc)", "abcdefgh", 0, "ab..gh"},
+		{"<|(6)", "abc", 2, "abc "},
+		{">|(6)", "abc", 4, "abc"},
+	}
+	for i, tc := range tests {
+		p, n := parsePadding(tc.Format)
+		if n != len(tc.Format) {
+			t.Errorf("tc %d: got length %v want %v", i, n, len(tc.Format))
+			continue
+		}
+		if got := p.apply(tc.Value, tc.Column); got != tc.Want {
+			t.Errorf("tc %d: got %q want %q", i, got, tc.Want)
+		}
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		Spec    string
+		Want    string
+		WantErr bool
+	}{
+		{"red", "\033[31m", false},
+		{"bold red blue", "\033[1;31;44m", false},
+		{"reset", "\033[m", false},
+		{"#ff0000", "\033[38;2;255;0;0m", false},
+		{"123 ul", "\033[4;38;5;123m", false},
+		{"brightred nobold", "\033[22;91m", false},
+		{"red green blue", "", true},
+		{"bogus", "", true},
+	}
+	for i, tc := range tests {
+		got, err := parseColor(tc.Spec)
+		if (err != nil) != tc.WantErr {
+			t.Errorf("tc %d: got error %v", i, err)
+			continue
+		}
+		if got != tc.Want {
+			t.Errorf("tc %d: got %q want %q", i, got, tc.Want)
+		}
+	}
+}
+
+func TestCommitInfoMessage(t *testing.T) {
+	tests := []struct {
+		Message   string
+		Subject   string
+		Body      string
+		Sanitized string
+	}{
+		{"Subject\n", "Subject", "", "Subject"},
+		{"\n\nTwo line  \nsubject\n\n\nBody\n\nmore\n", "Two line subject", "Body\n\nmore\n", "Two-line"},
+		{"Fix: the [thing]... again.\n", "Fix: the [thing]... again.", "", "Fix-the-thing-.-again"},
+	}
+	for i, tc := range tests {
+		info := &commitInfo{message: tc.Message}
+		if got := info.subject(); got != tc.Subject {
+			t.Errorf("tc %d: got subject %q want %q", i, got, tc.Subject)
+		}
+		if got := info.body(); got != tc.Body {
+			t.Errorf("tc %d: got body %q want %q", i, got, tc.Body)
+		}
+		if got := info.sanitizedSubject(); got != tc.Sanitized {
+			t.Errorf("tc %d: got sanitized subject %q want %q", i, got, tc.Sanitized)
+		}
+	}
+}
@@ -0,0 +1,496 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A ReflogEntry is a single line of a ref's reflog, recording an update
+// to the ref.
+type ReflogEntry struct {
+	Old, New  Sha1
+	Committer Person
+	Message   string
+}
+
+func (e ReflogEntry) String() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s %s %s\n", e.Old, e.New, e.Committer)
+	}
+	return fmt.Sprintf("%s %s %s\t%s\n", e.Old, e.New, e.Committer, e.Message)
+}
+
+// Parses a line from a reflog file.
+func parseReflogEntry(line string) (ReflogEntry, error) {
+	if len(line) < 83 || line[40] != ' ' || line[81] != ' ' {
+		return ReflogEntry{}, fmt.Errorf("Invalid reflog entry: %s", line)
+	}
+	old, err := Sha1FromString(line[:40])
+	if err != nil {
+		return ReflogEntry{}, err
+	}
+	new, err := Sha1FromString(line[41:81])
+	if err != nil {
+		return ReflogEntry{}, err
+	}
+	ident, msg := line[82:], ""
+	if tab := strings.IndexByte(ident, '\t'); tab >= 0 {
+		ident, msg = ident[:tab], ident[tab+1:]
+	}
+	committer, err := parsePerson(ident)
+	if err != nil {
+		return ReflogEntry{}, err
+	}
+	return ReflogEntry{old, new, committer, msg}, nil
+}
+
+// Returns the file that the reflog for ref is stored in.
+func (c *Client) reflogFile(ref RefSpec) File {
+	return c.GitDir.File(File("logs/" + ref.String()))
+}
+
+// Returns true if ref has a reflog.
+func ReflogExists(c *Client, ref RefSpec) bool {
+	return c.reflogFile(ref).Exists()
+}
+
+// Reads the reflog for ref, with the oldest entry first. Lines which
+// can't be parsed are skipped.
+func (c *Client) ReadReflog(ref RefSpec) ([]ReflogEntry, error) {
+	f, err := c.reflogFile(ref).Open()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("Reflog for %s does not exist", ref)
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []ReflogEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		// Like git, skip malformed entries rather than giving up on
+		// the whole log.
+		e, err := parseReflogEntry(scanner.Text())
+		if err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Replaces the reflog for ref with entries.
+func (c *Client) writeReflog(ref RefSpec, entries []ReflogEntry) error {
+	f := c.reflogFile(ref)
+	if err := os.MkdirAll(filepath.Dir(f.String()), 0755); err != nil {
+		return err
+	}
+	lock, err := f.Lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+	w := bufio.NewWriter(lock)
+	for _, e := range entries {
+		if _, err := w.WriteString(e.String()); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return lock.Commit()
+}
+
+// Returns true if a reflog should be created for ref when it's updated,
+// based on the core.logAllRefUpdates config.
+func (c *Client) shouldLogRef(ref RefSpec) bool {
+	switch c.GetConfig("core.logAllRefUpdates") {
+	case "always":
+		return true
+	case "false":
+		return false
+	case "":
+		// The default is to log updates in repositories with a
+		// working tree.
+		if c.GetConfig("core.bare") == "true" {
+			return false
+		}
+	}
+	name := ref.String()
+	return name == "HEAD" ||
+		strings.HasPrefix(name, "refs/heads/") ||
+		strings.HasPrefix(name, "refs/remotes/") ||
+		strings.HasPrefix(name, "refs/notes/")
+}
+
+// Returns the names of all refs which have reflogs, sorted.
+func (c *Client) reflogRefs() ([]RefSpec, error) {
+	var refs []RefSpec
+	dir := c.GitDir.File("logs").String()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, RefSpec(filepath.ToSlash(rel)))
+		return nil
+	})
+	sort.Slice(refs, func(i, j int) bool { return refs[i] < refs[j] })
+	return refs, err
+}
+
+// DwimReflog converts name, as given on the command line, to the ref whose reflog it
+// refers to. The rules are the same as for finding refs, except that only
+// refs with a reflog are considered.
+func (c *Client) DwimReflog(name string) (RefSpec, error) {
+	for _, candidate := range refRevParseRules(name) {
+		if ReflogExists(c, candidate) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("Reflog for %s does not exist", name)
+}
+
+// Returns the ref that the current branch reflog (ie. "@{n}" without a
+// ref name) refers to. This is the branch that HEAD points to, or HEAD
+// itself when it's detached.
+func (c *Client) currentBranchRef() RefSpec {
+	if r, err := SymbolicRefGet(c, SymbolicRefOptions{}, "HEAD"); err == nil {
+		return RefSpec(strings.TrimSpace(r.String()))
+	}
+	return "HEAD"
+}
+
+// Resolves the reflog selector sel (the part inside of "@{}") for the ref
+// named name. sel may either be a number of updates ago, or a date.
+func (c *Client) resolveReflogSelector(name string, sel string) (Sha1, error) {
+	var ref RefSpec
+	if name == "" {
+		ref = c.currentBranchRef()
+	} else {
+		r, err := c.DwimReflog(name)
+		if err != nil {
+			return Sha1{}, err
+		}
+		ref = r
+	}
+	entries, err := c.ReadReflog(ref)
+	if err != nil {
+		return Sha1{}, err
+	}
+	if len(entries) == 0 {
+		// There haven't been any updates, but the ref still has a
+		// current value.
+		if sel == "0" {
+			cmt, err := ref.CommitID(c)
+			return Sha1(cmt), err
+		}
+		return Sha1{}, fmt.Errorf("Log for '%s' is empty", name)
+	}
+
+	if n, err := strconv.Atoi(sel); err == nil && n >= 0 {
+		if n == 0 {
+			return entries[len(entries)-1].New, nil
+		}
+		// Like git, the value n updates ago is the old value of the
+		// nth newest entry, not the new value of the entry before
+		// it, which isn't the same if the log has a gap. If the ref
+		// was created by that entry, the old value of the next
+		// older entry that has one is used.
+		for i := len(entries) - n; i >= 0; i-- {
+			if entries[i].Old != (Sha1{}) {
+				return entries[i].Old, nil
+			}
+		}
+		return Sha1{}, fmt.Errorf("Log for '%s' only has %d entries", name, len(entries))
+	}
+
+	t, err := ParseDate(sel, time.Now())
+	if err != nil {
+		return Sha1{}, err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if e := entries[i]; e.Committer.Time != nil && !e.Committer.Time.After(t) {
+			return e.New, nil
+		}
+	}
+	// The date is before the log starts, so use the oldest value that
+	// we know about.
+	if entries[0].Old != (Sha1{}) {
+		return entries[0].Old, nil
+	}
+	return entries[0].New, nil
+}
+
+// Returns the name of the nth branch that was checked out before the
+// current one, as used by the "@{-n}" syntax. If HEAD was detached at
+// the time, the name is the commit ID.
+func (c *Client) previousBranch(n int) (string, error) {
+	if n <= 0 {
+		return "", fmt.Errorf("Invalid previous branch @{-%d}", n)
+	}
+	entries, err := c.ReadReflog("HEAD")
+	if err != nil {
+		return "", err
+	}
+	remaining := n
+	for i := len(entries) - 1; i >= 0; i-- {
+		msg := entries[i].Message
+		if !strings.HasPrefix(msg, "checkout: moving from ") {
+			continue
+		}
+		remaining--
+		if remaining > 0 {
+			continue
+		}
+		msg = strings.TrimPrefix(msg, "checkout: moving from ")
+		to := strings.Index(msg, " to ")
+		if to < 0 {
+			return "", fmt.Errorf("Invalid checkout entry in reflog: %s", entries[i].Message)
+		}
+		return msg[:to], nil
+	}
+	return "", fmt.Errorf("Not enough checkouts in reflog for @{-%d}", n)
+}
+
+// ReflogExpireOptions are the options that can be passed to "git reflog
+// expire".
+type ReflogExpireOptions struct {
+	// Entries older than Expire are removed. The zero value means that
+	// entries never expire.
+	Expire time.Time
+
+	// Entries older than ExpireUnreachable which are not reachable from
+	// the current tip of the ref are removed. The zero value means that
+	// entries never expire.
+	ExpireUnreachable time.Time
+
+	// Expire the reflogs of all refs.
+	All bool
+
+	// Don't actually remove anything.
+	DryRun bool
+
+	// Update the old value of each entry to the new value of the
+	// preceding one, if the preceding one was removed.
+	Rewrite bool
+
+	// Update the ref to the new value of the newest entry left
+	// in the reflog.
+	UpdateRef bool
+
+	// Print the entries that are removed.
+	Verbose bool
+}
+
+// Parses an expiry time for reflog expire, as given to --expire or in the
+// gc.reflogExpire config. "never" and "false" return the zero time, while
+// "all" and "now" expire everything.
+func ParseExpiry(s string, now time.Time) (time.Time, error) {
+	switch s {
+	case "never", "false":
+		return time.Time{}, nil
+	case "all", "now":
+		// Make sure that things that happened in the same second as
+		// now are also expired.
+		return now.Add(time.Second), nil
+	}
+	return ParseDate(s, now)
+}
+
+// Returns the default ReflogExpireOptions for c, based on the gc.reflogExpire
+// and gc.reflogExpireUnreachable configs.
+func (c *Client) DefaultReflogExpireOptions() (ReflogExpireOptions, error) {
+	now := time.Now()
+	var opts ReflogExpireOptions
+	var err error
+	expire := c.GetConfig("gc.reflogExpire")
+	if expire == "" {
+		expire = "90 days ago"
+	}
+	if opts.Expire, err = ParseExpiry(expire, now); err != nil {
+		return opts, err
+	}
+	unreachable := c.GetConfig("gc.reflogExpireUnreachable")
+	if unreachable == "" {
+		unreachable = "30 days ago"
+	}
+	opts.ExpireUnreachable, err = ParseExpiry(unreachable, now)
+	return opts, err
+}
+
+// Implements "git reflog expire". Expires old entries from the reflogs
+// of refs (or of all refs with opts.All.)
+func ReflogExpire(c *Client, opts ReflogExpireOptions, refs []RefSpec) error {
+	if opts.All {
+		all, err := c.reflogRefs()
+		if err != nil {
+			return err
+		}
+		refs = all
+	}
+	for _, ref := range refs {
+		if err := reflogExpireRef(c, opts, ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func reflogExpireRef(c *Client, opts ReflogExpireOptions, ref RefSpec) error {
+	entries, err := c.ReadReflog(ref)
+	if err != nil {
+		return err
+	}
+
+	// Lazily build the set of commits reachable from the ref, since
+	// it's only needed if there are old entries.
+	var reachable map[Sha1]bool
+	isReachable := func(id Sha1) bool {
+		if reachable == nil {
+			reachable = make(map[Sha1]bool)
+			if tip, err := ref.CommitID(c); err == nil {
+				reachable[Sha1(tip)] = true
+				for _, a := range tip.Ancestors(c) {
+					reachable[Sha1(a)] = true
+				}
+			}
+		}
+		return reachable[id]
+	}
+
+	keep := make([]bool, len(entries))
+	for i, e := range entries {
+		keep[i] = true
+		if e.Committer.Time == nil {
+			continue
+		}
+		when := *e.Committer.Time
+		switch {
+		case !opts.Expire.IsZero() && when.Before(opts.Expire):
+			keep[i] = false
+		case !opts.ExpireUnreachable.IsZero() && when.Before(opts.ExpireUnreachable) && !isReachable(e.New):
+			keep[i] = false
+		}
+	}
+	return rewriteReflog(c, ref, entries, keep, opts.DryRun, opts.Rewrite, opts.UpdateRef, opts.Verbose)
+}
+
+// Removes the entries from the reflog for ref where keep is false.
+func rewriteReflog(c *Client, ref RefSpec, entries []ReflogEntry, keep []bool, dryRun, rewrite, updateRef, verbose bool) error {
+	var kept []ReflogEntry
+	for i, e := range entries {
+		if !keep[i] {
+			if verbose && dryRun {
+				fmt.Printf("would prune %s\n", e.Message)
+			} else if verbose {
+				fmt.Printf("prune %s\n", e.Message)
+			}
+			continue
+		}
+		if verbose {
+			fmt.Printf("keep %s\n", e.Message)
+		}
+		if rewrite && len(kept) > 0 && (i == 0 || !keep[i-1]) {
+			e.Old = kept[len(kept)-1].New
+		}
+		kept = append(kept, e)
+	}
+	if dryRun || len(kept) == len(entries) {
+		return nil
+	}
+	if err := c.writeReflog(ref, kept); err != nil {
+		return err
+	}
+	if updateRef && len(kept) > 0 {
+		last := kept[len(kept)-1].New
+		if cur, err := ref.CommitID(c); err == nil && Sha1(cur) == last {
+			return nil
+		}
+		t := NewRefTransaction(c)
+		if err := t.Update(ref.String(), last, nil, true, ""); err != nil {
+			return err
+		}
+		// Updating the ref would add an entry to the log we just
+		// rewrote, so prepare and commit it without logging.
+		t.noLog = true
+		return t.Commit()
+	}
+	return nil
+}
+
+// ReflogDeleteOptions are the options that can be passed to "git reflog
+// delete".
+type ReflogDeleteOptions struct {
+	DryRun, Rewrite, UpdateRef, Verbose bool
+}
+
+// Implements "git reflog delete". Each selector must be of the form
+// ref@{n}, and the nth entry of ref's reflog is removed.
+func ReflogDelete(c *Client, opts ReflogDeleteOptions, selectors []string) error {
+	// Group the entries to delete by ref, so that the numbers refer to
+	// the log before anything was deleted.
+	toDelete := make(map[RefSpec][]int)
+	var order []RefSpec
+	for _, sel := range selectors {
+		at := strings.LastIndex(sel, "@{")
+		if at < 0 || !strings.HasSuffix(sel, "}") {
+			return fmt.Errorf("Not a reflog: %s", sel)
+		}
+		n, err := strconv.Atoi(sel[at+2 : len(sel)-1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("Invalid reflog: %s", sel)
+		}
+		var ref RefSpec
+		if name := sel[:at]; name == "" {
+			ref = c.currentBranchRef()
+		} else if ref, err = c.DwimReflog(name); err != nil {
+			return err
+		}
+		if _, ok := toDelete[ref]; !ok {
+			order = append(order, ref)
+		}
+		toDelete[ref] = append(toDelete[ref], n)
+	}
+
+	for _, ref := range order {
+		entries, err := c.ReadReflog(ref)
+		if err != nil {
+			return err
+		}
+		keep := make([]bool, len(entries))
+		for i := range keep {
+			keep[i] = true
+		}
+		for _, n := range toDelete[ref] {
+			if n >= len(entries) {
+				return fmt.Errorf("Log for '%s' only has %d entries", ref, len(entries))
+			}
+			keep[len(entries)-1-n] = false
+		}
+		if err := rewriteReflog(c, ref, entries, keep, opts.DryRun, opts.Rewrite, opts.UpdateRef, opts.Verbose); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package git
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseReflogEntry(t *testing.T) {
+	const line = "0000000000000000000000000000000000000000 1f8e5b4cfe8f0d8f9e9bd0b2c8d3c3b4d5e6f708 Some One <one@example.com> 1577880000 -0500\tcommit (initial): first"
+	e, err := parseReflogEntry(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Old != (Sha1{}) {
+		t.Errorf("Unexpected old value %v", e.Old)
+	}
+	if e.New.String() != "1f8e5b4cfe8f0d8f9e9bd0b2c8d3c3b4d5e6f708" {
+		t.Errorf("Unexpected new value %v", e.New)
+	}
+	if e.Committer.Name != "Some One" || e.Committer.Email != "one@example.com" {
+		t.Errorf("Unexpected committer %v", e.Committer)
+	}
+	if e.Committer.Time == nil || e.Committer.Time.Unix() != 1577880000 {
+		t.Errorf("Unexpected time %v", e.Committer.Time)
+	}
+	if e.Message != "commit (initial): first" {
+		t.Errorf("Unexpected message %q", e.Message)
+	}
+	if got := e.String(); got != line+"\n" {
+		t.Errorf("Unexpected String(): got %q want %q", got, line+"\n")
+	}
+
+	if _, err := parseReflogEntry("not a reflog entry"); err == nil {
+		t.Error("Expected error for invalid entry")
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2020, 3, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		Input string
+		Want  time.Time
+	}{
+		{"now", now},
+		{"yesterday", now.AddDate(0, 0, -1)},
+		{"2 days ago", now.Add(-48 * time.Hour)},
+		{"3.hours.ago", now.Add(-3 * time.Hour)},
+		{"1 week 2 days ago", now.Add(-9 * 24 * time.Hour)},
+		{"1.month.ago", time.Date(2020, 2, 15, 12, 0, 0, 0, time.UTC)},
+		{"@1577880000", time.Unix(1577880000, 0)},
+		{"2020-01-01 12:00:00 +0000", time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)},
+	}
+	for i, tc := range tests {
+		got, err := ParseDate(tc.Input, now)
+		if err != nil {
+			t.Errorf("tc %d: %v", i, err)
+			continue
+		}
+		if !got.Equal(tc.Want) {
+			t.Errorf("tc %d: got %v want %v", i, got, tc.Want)
+		}
+	}
+
+	if _, err := ParseDate("sometime", now); err == nil {
+		t.Error("Expected error for invalid date")
+	}
+}
+
+func TestResolveReflogSelector(t *testing.T) {
+	r := newTestRepo(t)
+	defer r.Close()
+	r.commit("A", 100)
+	r.commit("B", 200, "A")
+	r.commit("C", 300, "B")
+	r.commit("D", 400, "C")
+
+	entry := func(old, new string, date int64, msg string) string {
+		oldid := "0000000000000000000000000000000000000000"
+		if old != "" {
+			oldid = r.commits[old].String()
+		}
+		return fmt.Sprintf("%s %s T <t@x> %d +0000\t%s\n", oldid, r.commits[new], date, msg)
+	}
+	r.writeFile("HEAD", "ref: refs/heads/master\n")
+	r.setRef("refs/heads/master", "D")
+	r.setRef("refs/heads/topic", "C")
+	// The master reflog has a gap, where something updated it from B
+	// to C without logging it, and a malformed entry which should be
+	// ignored.
+	r.writeFile("logs/refs/heads/master",
+		entry("", "A", 1577880000, "commit (initial): A")+
+			entry("A", "B", 1577966400, "commit: B")+
+			"not a reflog entry\n"+
+			entry("C", "D", 1578052800, "commit: D"))
+	r.writeFile("logs/refs/heads/topic", "")
+	r.writeFile("logs/HEAD",
+		entry("", "A", 1577880000, "commit (initial): A")+
+			entry("A", "C", 1577880100, "checkout: moving from master to topic")+
+			entry("C", "D", 1577880200, "checkout: moving from topic to master"))
+
+	tests := []struct {
+		Rev  string
+		Want string
+	}{
+		{"master@{0}", "D"},
+		{"master@{1}", "C"},
+		{"master@{2}", "A"},
+		{"@{1}", "C"},
+		{"topic@{0}", "C"},
+		{"master@{2020-01-02 18:00:00 +0000}", "B"},
+		{"master@{2020-01-03 12:00:00 +0000}", "D"},
+		{"master@{2019-12-01 00:00:00 +0000}", "A"},
+		{"@{-1}", "C"},
+		{"@{-2}", "D"},
+		{"HEAD@{1}", "C"},
+	}
+	for i, tc := range tests {
+		id, err := RevParseObject(r.Client, &RevParseOptions{}, tc.Rev)
+		if err != nil {
+			t.Errorf("tc %d: %s: %v", i, tc.Rev, err)
+			continue
+		}
+		if got := r.names[CommitID(id)]; got != tc.Want {
+			t.Errorf("tc %d: %s: got %v want %v", i, tc.Rev, got, tc.Want)
+		}
+	}
+
+	for _, rev := range []string{"master@{3}", "topic@{1}", "@{-3}"} {
+		if _, err := RevParseObject(r.Client, &RevParseOptions{}, rev); err == nil {
+			t.Errorf("Expected error for %s", rev)
+		}
+	}
+}
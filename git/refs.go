@@ -0,0 +1,314 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A Ref is a reference and the object that it points to.
+type Ref struct {
+	Name  RefSpec
+	Value Sha1
+
+	// The value that Value peels to, if it was recorded in the
+	// packed-refs file.
+	peeled Sha1
+}
+
+// Returns the object that the ref points to after peeling any tags.
+func (r Ref) Peeled(c *Client) (Sha1, error) {
+	if r.peeled != (Sha1{}) {
+		return r.peeled, nil
+	}
+	return r.Value.Peel(c)
+}
+
+// A looseRef is a ref stored in its own file under .git/refs.
+type looseRef struct {
+	Name  RefSpec
+	Value Sha1
+
+	// The ref that this ref points to if it's a symbolic ref, in
+	// which case Value is the zero value.
+	Target RefSpec
+}
+
+// Returns all the loose refs under c's refs/ directory. Refs that can't be
+// parsed are skipped.
+func (c *Client) looseRefs() ([]looseRef, error) {
+	var refs []looseRef
+	root := c.GitDir.File("refs").String()
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name := RefSpec("refs/" + filepath.ToSlash(rel))
+		val, err := File(path).ReadFirstLine()
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(val, "ref: ") {
+			refs = append(refs, looseRef{Name: name, Target: RefSpec(strings.TrimSpace(val[5:]))})
+			return nil
+		}
+		if len(strings.TrimSpace(val)) != 40 {
+			return nil
+		}
+		sha, err := Sha1FromString(val)
+		if err != nil {
+			return nil
+		}
+		refs = append(refs, looseRef{Name: name, Value: sha})
+		return nil
+	})
+	return refs, err
+}
+
+// GetRefs returns every ref in c whose name starts with prefix (for
+// instance, "refs/" for all refs, or "refs/tags/" for tags), sorted by
+// name. Both loose refs and refs in the packed-refs file are included,
+// with loose refs taking precedence. Symbolic refs are resolved to the
+// value of the ref that they point to.
+func (c *Client) GetRefs(prefix string) ([]Ref, error) {
+	refs := make(map[RefSpec]Ref)
+	packed, err := c.readPackedRefs()
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range packed.Refs {
+		if ref.Name.HasPrefix(prefix) {
+			refs[ref.Name] = Ref{ref.Name, ref.Value, ref.Peeled}
+		}
+	}
+
+	loose, err := c.looseRefs()
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range loose {
+		if !ref.Name.HasPrefix(prefix) {
+			continue
+		}
+		if ref.Target == "" {
+			refs[ref.Name] = Ref{Name: ref.Name, Value: ref.Value}
+			continue
+		}
+		val, err := ref.Target.Value(c)
+		if err != nil {
+			// Dangling symbolic ref.
+			continue
+		}
+		sha, err := Sha1FromString(val)
+		if err != nil {
+			continue
+		}
+		refs[ref.Name] = Ref{Name: ref.Name, Value: sha}
+	}
+
+	sorted := make([]Ref, 0, len(refs))
+	for _, ref := range refs {
+		sorted = append(sorted, ref)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted, nil
+}
+
+// Returns true if the ref name matches the pattern. Patterns without
+// wildcards match refs that are equal to them or that are under them
+// when treated as a directory (so "refs/heads" matches
+// "refs/heads/master".) Otherwise, shell wildcards are used, where "*"
+// doesn't match a "/".
+func refMatchesPattern(name RefSpec, pattern string) bool {
+	s := name.String()
+	if s == pattern || strings.HasPrefix(s, strings.TrimSuffix(pattern, "/")+"/") {
+		return true
+	}
+	match, _ := path.Match(pattern, s)
+	return match
+}
+
+// Returns the shortest name for ref that's still unambiguous in the
+// common case, ie. without the refs/heads/, refs/tags/ or refs/remotes/
+// prefix.
+func (r RefSpec) ShortName() string {
+	s := r.String()
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/"} {
+		if strings.HasPrefix(s, prefix) {
+			return strings.TrimPrefix(s, prefix)
+		}
+	}
+	return strings.TrimPrefix(s, "refs/")
+}
+
+// Returns an error if creating the ref name would conflict with an existing
+// ref, because one of them would need to be a directory in order for the
+// other to exist (ie. "refs/heads/a" and "refs/heads/a/b".) Refs in ignore
+// are not considered, because they're about to be deleted.
+func (c *Client) checkRefConflict(name RefSpec, ignore map[RefSpec]bool) error {
+	refs, err := c.GetRefs("refs/")
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if ignore[ref.Name] {
+			continue
+		}
+		if ref.Name.HasPrefix(name.String()+"/") || name.HasPrefix(ref.Name.String()+"/") {
+			return fmt.Errorf("'%s' exists; cannot create '%s'", ref.Name, name)
+		}
+	}
+	return nil
+}
+
+// Removes the directories containing the file name (relative to the
+// GitDir) that are empty, stopping at top level namespaces such as
+// refs/heads or logs/refs/heads. This is used to clean up after a ref or
+// reflog in a hierarchical namespace is deleted.
+func (c *Client) removeEmptyRefDirs(name string) {
+	dir := filepath.Dir(name)
+	for strings.Count(strings.TrimPrefix(dir, "logs/"), "/") > 1 {
+		if err := os.Remove(c.GitDir.File(File(dir)).String()); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// Removes dir if it only contains empty directories, so that a ref can
+// be created in its place.
+func removeEmptyDirs(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			return fmt.Errorf("%s is not empty", dir)
+		}
+		if err := removeEmptyDirs(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return os.Remove(dir)
+}
+
+// Moves (or copies) the ref oldref, which points to id, to newref along
+// with its reflog. reason is appended to the new ref's reflog.
+func (c *Client) moveRef(oldref, newref RefSpec, id CommitID, reason string, copy bool) error {
+	// Save the old reflog, since deleting the old ref deletes it.
+	var log []ReflogEntry
+	if ReflogExists(c, oldref) {
+		var err error
+		if log, err = c.ReadReflog(oldref); err != nil {
+			return err
+		}
+	}
+
+	t := NewRefTransaction(c)
+	// The reflog is written below, so that it can include the old
+	// ref's history.
+	t.noLog = true
+	old := Sha1(id)
+	if !copy {
+		if err := t.Delete(oldref.String(), &old, true, ""); err != nil {
+			return err
+		}
+	}
+	if err := t.Update(newref.String(), old, nil, true, ""); err != nil {
+		return err
+	}
+	if err := t.Commit(); err != nil {
+		return err
+	}
+
+	if log == nil && !c.shouldLogRef(newref) {
+		return nil
+	}
+	if err := c.writeReflog(newref, log); err != nil {
+		return err
+	}
+	return updateReflog(c, true, c.reflogFile(newref), id, id, reason)
+}
+
+// Returns the refs that the abbreviated ref name could refer to, in order
+// of precedence. name itself is only a candidate if it looks like a ref,
+// so that files such as "config" in the git directory aren't mistaken for
+// refs.
+func refRevParseRules(name string) []RefSpec {
+	var rules []RefSpec
+	if strings.HasPrefix(name, "refs/") || isPseudoRef(name) {
+		rules = append(rules, RefSpec(name))
+	}
+	return append(rules,
+		RefSpec("refs/"+name),
+		RefSpec("refs/tags/"+name),
+		RefSpec("refs/heads/"+name),
+		RefSpec("refs/remotes/"+name),
+		RefSpec("refs/remotes/"+name+"/HEAD"),
+	)
+}
+
+// Returns true if name is a ref that lives at the top of the git
+// directory, such as HEAD or ORIG_HEAD.
+func isPseudoRef(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// DwimRef converts name, as given on the command line, to the full name of
+// the ref that it refers to using git's precedence rules. For instance,
+// "master" is usually refs/heads/master, unless there's a tag with the
+// same name.
+func (c *Client) DwimRef(name string) (RefSpec, error) {
+	for _, candidate := range refRevParseRules(name) {
+		if candidate.Exists(c) {
+			return candidate, nil
+		}
+	}
+	return "", InvalidRef
+}
+
+// ShortenRef returns the shortest name for the ref that DwimRef would
+// resolve back to the same ref. For instance, refs/heads/master is
+// usually shortened to "master", but it's shortened to "heads/master" if
+// there is also a tag named master.
+func (c *Client) ShortenRef(ref RefSpec) string {
+	rules := []string{"refs/", "refs/tags/", "refs/heads/", "refs/remotes/"}
+	name := ref.String()
+	for i := len(rules) - 1; i >= 0; i-- {
+		if !strings.HasPrefix(name, rules[i]) {
+			continue
+		}
+		short := strings.TrimPrefix(name, rules[i])
+		ambiguous := strings.HasPrefix(short, "refs/") || isPseudoRef(short)
+		for j := 0; j < i && !ambiguous; j++ {
+			ambiguous = RefSpec(rules[j] + short).Exists(c)
+		}
+		if !ambiguous {
+			return short
+		}
+	}
+	return name
+}
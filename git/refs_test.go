@@ -0,0 +1,203 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHierarchicalRefs(t *testing.T) {
+	r := newTestRepo(t)
+	defer r.Close()
+	c := r.Client
+
+	id, _ := Sha1FromString("1f8e5b4cfe8f0d8f9e9bd0b2c8d3c3b4d5e6f708")
+	create := func(ref string) error {
+		tx := NewRefTransaction(c)
+		if err := tx.Create(ref, id, false, ""); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+	remove := func(ref string) error {
+		tx := NewRefTransaction(c)
+		if err := tx.Delete(ref, nil, false, ""); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	tests := []struct {
+		Op      func(string) error
+		Ref     string
+		Success bool
+	}{
+		{create, "refs/heads/a/b", true},
+		{create, "refs/heads/a/c/d", true},
+		{create, "refs/heads/a", false},
+		{create, "refs/heads/a/b/c", false},
+		{remove, "refs/heads/a/b", true},
+		{create, "refs/heads/a", false},
+		{remove, "refs/heads/a/c/d", true},
+		// Everything under a was deleted, so now it can be a ref.
+		{create, "refs/heads/a", true},
+	}
+	for i, tc := range tests {
+		if err := tc.Op(tc.Ref); (err == nil) != tc.Success {
+			t.Errorf("tc %d: %s: got %v want success=%v", i, tc.Ref, err, tc.Success)
+		}
+	}
+
+	refs, err := c.GetRefs("refs/heads/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 1 || refs[0].Name != "refs/heads/a" {
+		t.Errorf("Unexpected refs after updates: %v", refs)
+	}
+}
+
+func TestRefTransactionAtomic(t *testing.T) {
+	r := newTestRepo(t)
+	defer r.Close()
+	c := r.Client
+
+	id, _ := Sha1FromString("1f8e5b4cfe8f0d8f9e9bd0b2c8d3c3b4d5e6f708")
+	tx := NewRefTransaction(c)
+	if err := tx.Create("refs/heads/old", id, false, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The deletion can't lock packed-refs, so neither update may be
+	// applied.
+	lock, err := c.GitDir.File("packed-refs").Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Rollback()
+	tx = NewRefTransaction(c)
+	if err := tx.Create("refs/heads/new", id, false, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Delete("refs/heads/old", nil, false, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err == nil {
+		t.Error("Commit succeeded with packed-refs locked")
+	}
+	if RefSpec("refs/heads/new").File(c).Exists() {
+		t.Error("refs/heads/new was created")
+	}
+	if !RefSpec("refs/heads/old").File(c).Exists() {
+		t.Error("refs/heads/old was deleted")
+	}
+}
+
+func TestPackRefs(t *testing.T) {
+	r := newTestRepo(t)
+	defer r.Close()
+	c := r.Client
+	r.mergeHistory()
+
+	tag, err := c.WriteObject("tag", []byte(fmt.Sprintf("object %s\ntype commit\ntag v1\ntagger T <t@x> 300 +0000\n\nv1\n", r.commits["C"])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.writeFile("HEAD", "ref: refs/heads/master\n")
+	r.setRef("refs/heads/master", "F")
+	r.setRef("refs/heads/topic/x", "C")
+	r.setRef("refs/tags/light", "A")
+	r.writeFile("refs/tags/v1", tag.String()+"\n")
+	r.writeFile("refs/tags/broken", "1f8e5b4cfe8f0d8f9e9bd0b2c8d3c3b4d5e6f708\n")
+	// topic/x is already packed, with an older value, so it's repacked
+	// even without All.
+	r.writeFile("packed-refs", fmt.Sprintf("# pack-refs with: peeled fully-peeled sorted \n%s refs/heads/topic/x\n", r.commits["B"]))
+
+	loose := func(name string) bool {
+		_, err := os.Stat(filepath.Join(c.GitDir.String(), name))
+		return err == nil
+	}
+	check := func(step string, want string, looseRefs, packedRefs []string) {
+		t.Helper()
+		got, err := ioutil.ReadFile(filepath.Join(c.GitDir.String(), "packed-refs"))
+		if err != nil {
+			t.Fatalf("%s: %v", step, err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: got packed-refs %q want %q", step, got, want)
+		}
+		for _, name := range looseRefs {
+			if !loose(name) {
+				t.Errorf("%s: loose ref %s was removed", step, name)
+			}
+		}
+		for _, name := range packedRefs {
+			if loose(name) {
+				t.Errorf("%s: loose ref %s was not pruned", step, name)
+			}
+		}
+	}
+
+	const header = "# pack-refs with: peeled fully-peeled sorted \n"
+	packedTags := fmt.Sprintf("%s refs/heads/topic/x\n%s refs/tags/light\n%s refs/tags/v1\n^%s\n",
+		r.commits["C"], r.commits["A"], tag, r.commits["C"])
+
+	// Hold the lock on packed-refs, so that nothing can be packed.
+	r.writeFile("packed-refs.lock", "")
+	if err := PackRefs(c, PackRefsOptions{All: true}); err == nil {
+		t.Error("Packed refs while packed-refs.lock was held")
+	}
+	check("locked", header+fmt.Sprintf("%s refs/heads/topic/x\n", r.commits["B"]),
+		[]string{"refs/heads/master", "refs/heads/topic/x", "refs/tags/light", "refs/tags/v1"}, nil)
+	if err := os.Remove(filepath.Join(c.GitDir.String(), "packed-refs.lock")); err != nil {
+		t.Fatal(err)
+	}
+
+	// By default, only tags and refs which are already packed are packed.
+	if err := PackRefs(c, PackRefsOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	check("default", header+packedTags,
+		[]string{"HEAD", "refs/heads/master", "refs/tags/broken"},
+		[]string{"refs/heads/topic", "refs/tags/light", "refs/tags/v1"})
+	if !loose("refs/tags") {
+		t.Error("Removed refs/tags when its refs were pruned")
+	}
+
+	// Packing doesn't change what the refs resolve to.
+	for _, tc := range []struct {
+		Rev  string
+		Want string
+	}{
+		{"topic/x", "C"},
+		{"light", "A"},
+		{"v1^{}", "C"},
+		{"HEAD", "F"},
+	} {
+		if got, err := RevParseObject(c, &RevParseOptions{}, tc.Rev); err != nil || got != Sha1(r.commits[tc.Want]) {
+			t.Errorf("%s: got %v (%v) want %v", tc.Rev, got, err, r.commits[tc.Want])
+		}
+	}
+
+	// NoPrune packs the branch, but leaves the loose ref behind.
+	if err := PackRefs(c, PackRefsOptions{All: true, NoPrune: true}); err != nil {
+		t.Fatal(err)
+	}
+	withMaster := header + fmt.Sprintf("%s refs/heads/master\n", r.commits["F"]) + packedTags
+	check("no prune", withMaster, []string{"refs/heads/master"}, nil)
+
+	// All packs and prunes the branch, but still leaves HEAD and the
+	// broken ref alone.
+	if err := PackRefs(c, PackRefsOptions{All: true}); err != nil {
+		t.Fatal(err)
+	}
+	check("all", withMaster, []string{"HEAD", "refs/tags/broken"}, []string{"refs/heads/master"})
+	if head, err := SymbolicRef("HEAD").CommitID(c); err != nil || head != r.commits["F"] {
+		t.Errorf("HEAD: got %v (%v) want %v", head, err, r.commits["F"])
+	}
+}
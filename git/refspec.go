@@ -1,6 +1,7 @@
 package git
 
 import (
+	"os"
 	"strings"
 )
 
@@ -26,12 +27,33 @@ func (r RefSpec) File(c *Client) File {
 	return c.GitDir.File(File(r.String()))
 }
 
-// Returns the value of RefSpec in Client's GitDir, or the empty string
-// if it doesn't exist.
+// Returns the value of RefSpec in Client's GitDir. Loose refs take
+// precedence over refs in the packed-refs file. If it doesn't exist in
+// either, InvalidRef is returned.
 func (r RefSpec) Value(c *Client) (string, error) {
 	f := r.File(c)
-	val, err := f.ReadAll()
-	return strings.TrimSpace(val), err
+	if fi, err := f.Stat(); err == nil && !fi.IsDir() {
+		val, err := f.ReadAll()
+		return strings.TrimSpace(val), err
+	} else if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	packed, err := c.readPackedRefs()
+	if err != nil {
+		return "", err
+	}
+	if ref, ok := packed.Lookup(RefSpec(r.String())); ok {
+		return ref.Value.String(), nil
+	}
+	return "", InvalidRef
+}
+
+// Returns true if the ref exists in c, either as a loose ref or in the
+// packed-refs file.
+func (r RefSpec) Exists(c *Client) bool {
+	_, err := r.Value(c)
+	return err == nil
 }
 
 func (r RefSpec) CommitID(c *Client) (CommitID, error) {
@@ -39,6 +61,11 @@ func (r RefSpec) CommitID(c *Client) (CommitID, error) {
 	if err != nil {
 		return CommitID{}, err
 	}
+	if strings.HasPrefix(v, "ref: ") {
+		// It's a symbolic ref such as refs/remotes/origin/HEAD, so
+		// resolve it through the ref that it points to.
+		return RefSpec(strings.TrimPrefix(v, "ref: ")).CommitID(c)
+	}
 	return CommitIDFromString(v)
 }
 
@@ -66,17 +93,12 @@ func GetBranch(c *Client, branchname string) (Branch, error) {
 
 // Returns true if the branch exists under c's GitDir
 func (b Branch) Exists(c *Client) bool {
-	return c.GitDir.File(File(b)).Exists()
+	return RefSpec(b).Exists(c)
 }
 
 // Implements Commitish interface on Branch.
 func (b Branch) CommitID(c *Client) (CommitID, error) {
-	val, err := RefSpec(b).Value(c)
-	if err != nil {
-		return CommitID{}, err
-	}
-	sha, err := Sha1FromString(val)
-	return CommitID(sha), err
+	return RefSpec(b).CommitID(c)
 }
 
 // Implements Treeish on Branch.
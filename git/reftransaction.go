@@ -0,0 +1,386 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A refUpdate is a single change queued in a RefTransaction.
+type refUpdate struct {
+	// The ref as it was passed to the transaction, which may be a
+	// symbolic ref such as HEAD.
+	Ref     string
+	NoDeref bool
+	Reason  string
+
+	// The new value of the ref. If HaveNew is false, the ref is only
+	// verified and not changed. If NewValue is the zero value, the ref
+	// is deleted.
+	NewValue Sha1
+	HaveNew  bool
+
+	// The value that the ref must currently have. If OldValue is the
+	// zero value, the ref must not exist.
+	OldValue Sha1
+	HaveOld  bool
+
+	// The following are set when the transaction is prepared.
+
+	// The ref that's actually modified, after dereferencing Ref.
+	target RefSpec
+	// The value of target before the update, if it existed.
+	current Sha1
+	lock    *LockFile
+}
+
+// A RefTransaction is a set of ref updates which are either all applied
+// or not applied at all. Each ref is locked by creating a "<ref>.lock"
+// file when the transaction is prepared, and the locks are held until
+// it's committed or aborted.
+type RefTransaction struct {
+	c *Client
+
+	// Create reflogs for refs which don't have one.
+	CreateReflog bool
+
+	// Don't log the updates in the reflog at all. This is used when
+	// the reflog itself is being rewritten.
+	noLog bool
+
+	updates  []*refUpdate
+	prepared bool
+	closed   bool
+
+	// When refs are being deleted, the packed-refs file is locked
+	// when the transaction is prepared, since they need to be removed
+	// from it too.
+	packlock *LockFile
+	packed   packedRefs
+}
+
+// Creates a new, empty ref transaction.
+func NewRefTransaction(c *Client) *RefTransaction {
+	return &RefTransaction{c: c}
+}
+
+func (t *RefTransaction) queue(u *refUpdate) error {
+	if t.closed {
+		return fmt.Errorf("Transaction is already closed")
+	}
+	if t.prepared {
+		return fmt.Errorf("Can not add updates to a prepared transaction")
+	}
+	if u.Ref == "" {
+		return fmt.Errorf("Missing ref name")
+	}
+	if err := ValidateRefName(u.Ref, CheckRefFormatOptions{AllowOnelevel: true}); err != nil {
+		return err
+	}
+	t.updates = append(t.updates, u)
+	return nil
+}
+
+// Update queues an update of ref to newvalue. If oldvalue is not nil, the
+// ref must have that value when the transaction is prepared (with the
+// zero value meaning that it must not exist.) Setting newvalue to the
+// zero value deletes the ref. Symbolic refs are updated through the ref
+// they point to unless noDeref is set.
+func (t *RefTransaction) Update(ref string, newvalue Sha1, oldvalue *Sha1, noDeref bool, reason string) error {
+	u := &refUpdate{Ref: ref, NoDeref: noDeref, Reason: reason, NewValue: newvalue, HaveNew: true}
+	if oldvalue != nil {
+		u.OldValue, u.HaveOld = *oldvalue, true
+	}
+	return t.queue(u)
+}
+
+// Create queues the creation of ref with the value newvalue. The ref must
+// not already exist.
+func (t *RefTransaction) Create(ref string, newvalue Sha1, noDeref bool, reason string) error {
+	if newvalue == (Sha1{}) {
+		return fmt.Errorf("create %s: zero value given as new value", ref)
+	}
+	return t.Update(ref, newvalue, &Sha1{}, noDeref, reason)
+}
+
+// Delete queues the deletion of ref. If oldvalue is not nil, ref must have
+// that value.
+func (t *RefTransaction) Delete(ref string, oldvalue *Sha1, noDeref bool, reason string) error {
+	if oldvalue != nil && *oldvalue == (Sha1{}) {
+		return fmt.Errorf("delete %s: zero value given as old value", ref)
+	}
+	return t.Update(ref, Sha1{}, oldvalue, noDeref, reason)
+}
+
+// Verify queues a check that ref has the value oldvalue, without
+// modifying it. A nil or zero oldvalue verifies that ref doesn't exist.
+func (t *RefTransaction) Verify(ref string, oldvalue *Sha1, noDeref bool) error {
+	if oldvalue == nil {
+		oldvalue = &Sha1{}
+	}
+	return t.queue(&refUpdate{Ref: ref, NoDeref: noDeref, OldValue: *oldvalue, HaveOld: true})
+}
+
+// Returns the ref that u modifies, after following a symbolic ref.
+func (u *refUpdate) resolveTarget(c *Client) RefSpec {
+	if !u.NoDeref {
+		f := c.GitDir.File(File(u.Ref))
+		if val, err := f.ReadFirstLine(); err == nil && strings.HasPrefix(val, "ref: ") {
+			return RefSpec(strings.TrimSpace(strings.TrimPrefix(val, "ref: ")))
+		}
+	}
+	return RefSpec(u.Ref)
+}
+
+// Prepare locks every ref in the transaction, verifies their old values
+// and writes the new values to the locks, so that committing it only
+// needs to move them into place. If anything fails, every lock is
+// released and the transaction is closed.
+func (t *RefTransaction) Prepare() error {
+	if t.closed {
+		return fmt.Errorf("Transaction is already closed")
+	}
+	if t.prepared {
+		return nil
+	}
+	if err := t.prepare(); err != nil {
+		t.Abort()
+		return err
+	}
+	t.prepared = true
+	return nil
+}
+
+func (t *RefTransaction) prepare() error {
+	seen := make(map[RefSpec]bool)
+	deleted := make(map[RefSpec]bool)
+	for _, u := range t.updates {
+		u.target = u.resolveTarget(t.c)
+		if seen[u.target] {
+			return fmt.Errorf("Multiple updates for ref '%s' not allowed", u.target)
+		}
+		seen[u.target] = true
+		if u.HaveNew && u.NewValue == (Sha1{}) {
+			deleted[u.target] = true
+		}
+	}
+
+	for i, u := range t.updates {
+		f := t.c.GitDir.File(File(u.target))
+		if u.HaveNew && u.NewValue != (Sha1{}) {
+			// Refs are files, so a ref can't be created if
+			// another ref needs it to be a directory, or vice
+			// versa. This includes other refs being created in
+			// the same transaction.
+			if err := t.c.checkRefConflict(u.target, deleted); err != nil {
+				return fmt.Errorf("Cannot lock ref '%s': %v", u.Ref, err)
+			}
+			for _, other := range t.updates[:i] {
+				if other.HaveNew && other.NewValue != (Sha1{}) && (other.target.HasPrefix(u.target.String()+"/") || u.target.HasPrefix(other.target.String()+"/")) {
+					return fmt.Errorf("Cannot lock ref '%s': cannot process '%s' and '%s' at the same time", u.Ref, other.target, u.target)
+				}
+			}
+
+			// There might be a leftover empty directory from
+			// refs that used to be inside of it. If it's not
+			// empty, it's because of a ref being deleted in this
+			// transaction, so Commit will remove it after the
+			// deletion.
+			if fi, err := f.Stat(); err == nil && fi.IsDir() {
+				removeEmptyDirs(f.String())
+			}
+		}
+		// The directory for the lock might not exist, even when
+		// deleting, if the ref is only in the packed-refs file.
+		if err := os.MkdirAll(filepath.Dir(f.String()), 0755); err != nil {
+			return fmt.Errorf("Cannot lock ref '%s': %v", u.Ref, err)
+		}
+		lock, err := f.Lock()
+		if err != nil {
+			return fmt.Errorf("Cannot lock ref '%s': %v", u.Ref, err)
+		}
+		u.lock = lock
+
+		// Now that it's locked, nothing else can change it, so
+		// check the current value.
+		var exists bool
+		val, err := u.target.Value(t.c)
+		if err == nil && strings.HasPrefix(val, "ref: ") {
+			// It's a symbolic ref that isn't being
+			// dereferenced, so compare against the value
+			// that it points to.
+			val, err = RefSpec(strings.TrimPrefix(val, "ref: ")).Value(t.c)
+		}
+		if err == nil {
+			cur, err := Sha1FromString(val)
+			if err != nil {
+				return fmt.Errorf("Cannot lock ref '%s': invalid value %s", u.Ref, val)
+			}
+			u.current, exists = cur, true
+		}
+		if !u.HaveOld {
+			continue
+		}
+		switch {
+		case u.OldValue == (Sha1{}) && exists:
+			return fmt.Errorf("Cannot lock ref '%s': reference already exists", u.Ref)
+		case u.OldValue != (Sha1{}) && !exists:
+			return fmt.Errorf("Cannot lock ref '%s': unable to resolve reference '%s'", u.Ref, u.target)
+		case u.OldValue != (Sha1{}) && u.current != u.OldValue:
+			return fmt.Errorf("Cannot lock ref '%s': is at %s but expected %s", u.Ref, u.current, u.OldValue)
+		}
+	}
+
+	for _, u := range t.updates {
+		if u.HaveNew && u.NewValue != (Sha1{}) {
+			if _, err := fmt.Fprintf(u.lock, "%s\n", u.NewValue); err != nil {
+				return fmt.Errorf("Cannot update ref '%s': %v", u.Ref, err)
+			}
+		}
+	}
+
+	if len(deleted) > 0 {
+		lock, err := t.c.GitDir.File("packed-refs").Lock()
+		if err != nil {
+			return err
+		}
+		t.packlock = lock
+		// Read it after acquiring the lock, so that nothing else
+		// changes it before it's written.
+		packed, err := t.c.readPackedRefs()
+		if err != nil {
+			return err
+		}
+		t.packed = packed
+	}
+	return nil
+}
+
+// Commit applies every update in the transaction, preparing it first if
+// it hasn't already been prepared.
+func (t *RefTransaction) Commit() error {
+	if err := t.Prepare(); err != nil {
+		return err
+	}
+	defer t.Abort()
+
+	// Every ref is locked and verified and its new value is written, so
+	// nothing below should fail unless something is wrong with the
+	// filesystem.
+
+	// Remove the deleted refs from packed-refs first, so that their
+	// packed values don't become visible when the loose refs are
+	// removed. packed-refs stays locked until the loose refs are gone,
+	// so that pack-refs can't pack them again in between.
+	if t.packlock != nil {
+		deleted := make(map[RefSpec]bool)
+		for _, u := range t.updates {
+			if u.HaveNew && u.NewValue == (Sha1{}) {
+				deleted[u.target] = true
+			}
+		}
+		var refs []packedRef
+		for _, ref := range t.packed.Refs {
+			if !deleted[ref.Name] {
+				refs = append(refs, ref)
+			}
+		}
+		if len(refs) != len(t.packed.Refs) {
+			t.packed.Refs = refs
+			if err := t.c.replacePackedRefs(t.packed); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Do the deletions first, so that any directories that they leave
+	// behind are cleaned up before refs are created in their place.
+	for _, u := range t.updates {
+		if u.HaveNew && u.NewValue == (Sha1{}) {
+			if err := t.deleteRef(u); err != nil {
+				return err
+			}
+		}
+	}
+	for _, u := range t.updates {
+		if !u.HaveNew || u.NewValue == (Sha1{}) {
+			continue
+		}
+		if fi, err := u.target.File(t.c).Stat(); err == nil && fi.IsDir() {
+			if err := removeEmptyDirs(u.target.File(t.c).String()); err != nil {
+				return err
+			}
+		}
+		if err := t.logUpdate(u); err != nil {
+			return err
+		}
+		if err := u.lock.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Abort releases all the locks held by the transaction without applying
+// any of the updates that haven't been committed.
+func (t *RefTransaction) Abort() error {
+	for _, u := range t.updates {
+		if u.lock != nil {
+			u.lock.Rollback()
+		}
+	}
+	if t.packlock != nil {
+		t.packlock.Rollback()
+	}
+	t.closed = true
+	return nil
+}
+
+// Deletes the loose ref that u locked, along with its reflog. Its
+// packed-refs entry must already have been removed.
+func (t *RefTransaction) deleteRef(u *refUpdate) error {
+	if f := u.target.File(t.c); f.Exists() {
+		if err := f.Remove(); err != nil {
+			return err
+		}
+	}
+	if log := t.c.reflogFile(u.target); log.Exists() {
+		if err := log.Remove(); err != nil {
+			return err
+		}
+	}
+	if err := u.lock.Rollback(); err != nil {
+		return err
+	}
+
+	// Now that the lock is gone, clean up any directories that were
+	// only there for this ref.
+	t.c.removeEmptyRefDirs(u.target.String())
+	t.c.removeEmptyRefDirs("logs/" + u.target.String())
+	return nil
+}
+
+// Appends the update to the reflog of the ref that was updated, and the
+// symbolic ref that it was updated through if applicable.
+func (t *RefTransaction) logUpdate(u *refUpdate) error {
+	if t.noLog {
+		return nil
+	}
+	logs := []RefSpec{u.target}
+	if u.target != RefSpec(u.Ref) {
+		logs = append(logs, RefSpec(u.Ref))
+	}
+	for _, name := range logs {
+		file := t.c.reflogFile(name)
+		// Refs only get a new reflog if it was requested or
+		// core.logAllRefUpdates says that they should have one.
+		if !t.CreateReflog && !file.Exists() && !t.c.shouldLogRef(name) {
+			continue
+		}
+		if err := updateReflog(t.c, true, file, CommitID(u.current), CommitID(u.NewValue), u.Reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
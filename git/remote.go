@@ -0,0 +1,617 @@
+package git
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A fetchRefspec is a refspec from a remote.<name>.fetch config variable,
+// such as "+refs/heads/*:refs/remotes/origin/*", which maps refs on the
+// remote (Src) to remote-tracking refs (Dst).
+type fetchRefspec struct {
+	Force    bool
+	Src, Dst string
+}
+
+func parseFetchRefspec(s string) fetchRefspec {
+	var r fetchRefspec
+	if strings.HasPrefix(s, "+") {
+		r.Force = true
+		s = s[1:]
+	}
+	if colon := strings.IndexByte(s, ':'); colon >= 0 {
+		r.Src, r.Dst = s[:colon], s[colon+1:]
+	} else {
+		r.Src = s
+	}
+	return r
+}
+
+func (r fetchRefspec) String() string {
+	s := r.Src + ":" + r.Dst
+	if r.Force {
+		return "+" + s
+	}
+	return s
+}
+
+// Maps name from the pattern from to the pattern to. If from has a "*",
+// the part of name that it matches replaces the "*" in to. It returns false
+// if name doesn't match from.
+func mapRefPattern(from, to string, name RefSpec) (RefSpec, bool) {
+	n := name.String()
+	star := strings.IndexByte(from, '*')
+	if star < 0 {
+		if n != from {
+			return "", false
+		}
+		return RefSpec(to), true
+	}
+	prefix, suffix := from[:star], from[star+1:]
+	if len(n) < len(prefix)+len(suffix) || !strings.HasPrefix(n, prefix) || !strings.HasSuffix(n, suffix) {
+		return "", false
+	}
+	return RefSpec(strings.Replace(to, "*", n[len(prefix):len(n)-len(suffix)], 1)), true
+}
+
+// Returns the remote-tracking ref that the ref name on the remote is
+// stored in.
+func (r fetchRefspec) toLocal(name RefSpec) (RefSpec, bool) {
+	if r.Dst == "" {
+		return "", false
+	}
+	return mapRefPattern(r.Src, r.Dst, name)
+}
+
+// Returns the ref on the remote that the remote-tracking ref name is
+// fetched from.
+func (r fetchRefspec) toRemote(name RefSpec) (RefSpec, bool) {
+	if r.Dst == "" {
+		return "", false
+	}
+	return mapRefPattern(r.Dst, r.Src, name)
+}
+
+// Returns the names of the remotes configured in c, in the order that
+// they appear in the config.
+func RemoteList(c *Client) []string {
+	return c.readConfig().Subsections("remote")
+}
+
+// Returns true if name is a remote configured in c.
+func (c *Client) remoteExists(name string) bool {
+	for _, r := range RemoteList(c) {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the fetch refspecs configured for the remote name.
+func (c *Client) remoteFetchRefspecs(name string) []fetchRefspec {
+	var specs []fetchRefspec
+	for _, s := range c.GetConfigAll("remote." + name + ".fetch") {
+		specs = append(specs, parseFetchRefspec(s))
+	}
+	return specs
+}
+
+// Returns the local remote-tracking refs for the remote name, according to
+// its fetch refspecs. Symbolic refs (such as refs/remotes/origin/HEAD) are
+// not included.
+func (c *Client) remoteTrackingRefs(name string) ([]Ref, error) {
+	all, err := c.GetRefs("refs/")
+	if err != nil {
+		return nil, err
+	}
+	var refs []Ref
+	for _, ref := range all {
+		for _, spec := range c.remoteFetchRefspecs(name) {
+			if _, ok := spec.toRemote(ref.Name); ok {
+				if !isSymbolicRef(c, ref.Name) {
+					refs = append(refs, ref)
+				}
+				break
+			}
+		}
+	}
+	return refs, nil
+}
+
+// Returns true if ref is a symbolic ref in c.
+func isSymbolicRef(c *Client, ref RefSpec) bool {
+	_, err := SymbolicRefGet(c, SymbolicRefOptions{}, SymbolicRef(ref))
+	return err == nil
+}
+
+// Returns an error if name can't be used as the name of a remote.
+func validateRemoteName(name string) error {
+	if name == "" || ValidateRefName("refs/remotes/"+name+"/test", CheckRefFormatOptions{}) != nil {
+		return fmt.Errorf("'%s' is not a valid remote name", name)
+	}
+	return nil
+}
+
+// RemoteAddOptions represents the options that may be passed to
+// "git remote add".
+type RemoteAddOptions struct {
+	// Only track these branches, instead of every branch on the
+	// remote.
+	Track []string
+
+	// Set up refs/remotes/<name>/HEAD to point at this branch.
+	Master string
+}
+
+// Implements "git remote add". It configures a new remote named name with
+// the given url, and a default fetch refspec which stores the branches on
+// the remote under refs/remotes/<name>/.
+func RemoteAdd(c *Client, opts RemoteAddOptions, name, url string) error {
+	if err := validateRemoteName(name); err != nil {
+		return err
+	}
+	if c.remoteExists(name) {
+		return fmt.Errorf("remote %s already exists.", name)
+	}
+	err := c.updateConfig(func(config *GitConfig) error {
+		if err := config.AddConfig("remote."+name+".url", url); err != nil {
+			return err
+		}
+		if len(opts.Track) == 0 {
+			return config.AddConfig("remote."+name+".fetch", "+refs/heads/*:refs/remotes/"+name+"/*")
+		}
+		for _, b := range opts.Track {
+			if err := config.AddConfig("remote."+name+".fetch", "+refs/heads/"+b+":refs/remotes/"+name+"/"+b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil || opts.Master == "" {
+		return err
+	}
+	return SymbolicRefUpdate(c, SymbolicRefOptions{}, SymbolicRef("refs/remotes/"+name+"/HEAD"), RefSpec("refs/remotes/"+name+"/"+opts.Master), "")
+}
+
+// Implements "git remote remove". It removes the remote name, all of its
+// remote-tracking refs, and the upstream configuration of any branches
+// which track it.
+func RemoteRemove(c *Client, name string) error {
+	if !c.remoteExists(name) {
+		return fmt.Errorf("No such remote: '%s'", name)
+	}
+	refs, err := c.remoteTrackingRefs(name)
+	if err != nil {
+		return err
+	}
+
+	err = c.updateConfig(func(config *GitConfig) error {
+		for _, b := range config.Subsections("branch") {
+			if config.GetConfig("branch."+b+".remote") == name {
+				config.UnsetConfig("branch." + b + ".remote")
+				config.UnsetConfig("branch." + b + ".merge")
+			}
+			if config.GetConfig("branch."+b+".pushRemote") == name {
+				config.UnsetConfig("branch." + b + ".pushRemote")
+			}
+			config.removeEmptySection("branch", b)
+		}
+		if config.GetConfig("remote.pushDefault") == name {
+			config.UnsetConfig("remote.pushDefault")
+		}
+		config.RemoveSection("remote", name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if head := SymbolicRef("refs/remotes/" + name + "/HEAD"); isSymbolicRef(c, RefSpec(head)) {
+		if err := SymbolicRefDelete(c, SymbolicRefOptions{}, head); err != nil {
+			return err
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+	t := NewRefTransaction(c)
+	for _, ref := range refs {
+		old := ref.Value
+		if err := t.Delete(ref.Name.String(), &old, true, ""); err != nil {
+			return err
+		}
+	}
+	return t.Commit()
+}
+
+// Implements "git remote rename". It renames the remote oldname to
+// newname, along with its remote-tracking refs and any branch
+// configuration that refers to it.
+func RemoteRename(c *Client, oldname, newname string) error {
+	if !c.remoteExists(oldname) {
+		return fmt.Errorf("No such remote: '%s'", oldname)
+	}
+	if err := validateRemoteName(newname); err != nil {
+		return err
+	}
+	if c.remoteExists(newname) {
+		return fmt.Errorf("remote %s already exists.", newname)
+	}
+	refs, err := c.remoteTrackingRefs(oldname)
+	if err != nil {
+		return err
+	}
+
+	oldprefix, newprefix := "refs/remotes/"+oldname+"/", "refs/remotes/"+newname+"/"
+	err = c.updateConfig(func(config *GitConfig) error {
+		config.RenameSection("remote", oldname, newname)
+		// Only the default refspecs are updated, since any
+		// others were customized on purpose.
+		fetch := config.GetConfigAll("remote." + newname + ".fetch")
+		changed := false
+		for i, s := range fetch {
+			spec := parseFetchRefspec(s)
+			if strings.HasPrefix(spec.Dst, oldprefix) {
+				spec.Dst = newprefix + strings.TrimPrefix(spec.Dst, oldprefix)
+				fetch[i] = spec.String()
+				changed = true
+			}
+		}
+		if changed {
+			config.UnsetConfig("remote." + newname + ".fetch")
+			for _, s := range fetch {
+				if err := config.AddConfig("remote."+newname+".fetch", s); err != nil {
+					return err
+				}
+			}
+		}
+		for _, b := range config.Subsections("branch") {
+			for _, key := range []string{".remote", ".pushRemote"} {
+				if config.GetConfig("branch."+b+key) == oldname {
+					if err := config.SetConfig("branch."+b+key, newname); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if config.GetConfig("remote.pushDefault") == oldname {
+			return config.SetConfig("remote.pushDefault", newname)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		if !ref.Name.HasPrefix(oldprefix) {
+			continue
+		}
+		newref := RefSpec(newprefix + strings.TrimPrefix(ref.Name.String(), oldprefix))
+		reason := fmt.Sprintf("remote: renamed %s to %s", ref.Name, newref)
+		if err := c.moveRef(ref.Name, newref, CommitID(ref.Value), reason, false); err != nil {
+			return err
+		}
+	}
+
+	// Symbolic refs need to point to the renamed refs.
+	oldhead := SymbolicRef(oldprefix + "HEAD")
+	if target, err := SymbolicRefGet(c, SymbolicRefOptions{}, oldhead); err == nil {
+		if target.HasPrefix(oldprefix) {
+			target = RefSpec(newprefix + strings.TrimPrefix(target.String(), oldprefix))
+		}
+		var log []ReflogEntry
+		if ReflogExists(c, RefSpec(oldhead)) {
+			if log, err = c.ReadReflog(RefSpec(oldhead)); err != nil {
+				return err
+			}
+		}
+		if err := SymbolicRefDelete(c, SymbolicRefOptions{}, oldhead); err != nil {
+			return err
+		}
+		newhead := SymbolicRef(newprefix + "HEAD")
+		if log != nil {
+			if err := c.writeReflog(RefSpec(newhead), log); err != nil {
+				return err
+			}
+		}
+		reason := fmt.Sprintf("remote: renamed %s to %s", oldhead, newhead)
+		return SymbolicRefUpdate(c, SymbolicRefOptions{}, newhead, target, reason)
+	}
+	return nil
+}
+
+// RemoteURLOptions represents the options that may be passed to
+// "git remote get-url" or "git remote set-url".
+type RemoteURLOptions struct {
+	// Operate on the push URLs instead of the fetch URLs.
+	Push bool
+
+	// For get-url, return all of the URLs instead of only the first.
+	// For set-url, add a URL instead of replacing it.
+	All, Add bool
+
+	// For set-url, delete all URLs matching the given pattern.
+	Delete bool
+}
+
+// Implements "git remote get-url". It returns the URL of the remote name,
+// or every URL if opts.All is set. If opts.Push is set, the push URLs are
+// returned, which default to the fetch URLs.
+func RemoteGetURL(c *Client, opts RemoteURLOptions, name string) ([]string, error) {
+	if !c.remoteExists(name) {
+		return nil, fmt.Errorf("No such remote '%s'", name)
+	}
+	urls := c.GetConfigAll("remote." + name + ".url")
+	if opts.Push {
+		if push := c.GetConfigAll("remote." + name + ".pushurl"); len(push) > 0 {
+			urls = push
+		}
+	}
+	if !opts.All && len(urls) > 1 {
+		urls = urls[:1]
+	}
+	return urls, nil
+}
+
+// Implements "git remote set-url". It sets the URL of the remote name to
+// newurl. If oldurl is not empty, only URLs matching it are replaced.
+//
+// If opts.Add is set, newurl is added instead of replacing anything, and if
+// opts.Delete is set, every URL matching newurl is deleted.
+func RemoteSetURL(c *Client, opts RemoteURLOptions, name, newurl, oldurl string) error {
+	if !c.remoteExists(name) {
+		return fmt.Errorf("No such remote '%s'", name)
+	}
+	key := "remote." + name + ".url"
+	if opts.Push {
+		key = "remote." + name + ".pushurl"
+	}
+	return c.updateConfig(func(config *GitConfig) error {
+		if opts.Add {
+			return config.AddConfig(key, newurl)
+		}
+		urls := config.GetConfigAll(key)
+		var keep []string
+		matched := false
+		for _, u := range urls {
+			switch {
+			case opts.Delete && strings.Contains(u, newurl):
+				matched = true
+			case !opts.Delete && oldurl != "" && strings.Contains(u, oldurl):
+				if !matched {
+					keep = append(keep, newurl)
+				}
+				matched = true
+			default:
+				keep = append(keep, u)
+			}
+		}
+		switch {
+		case opts.Delete && !matched:
+			return fmt.Errorf("No such URL found: %s", newurl)
+		case opts.Delete && len(keep) == 0 && !opts.Push:
+			return fmt.Errorf("Will not delete all non-push URLs")
+		case !opts.Delete && oldurl != "" && !matched:
+			return fmt.Errorf("No such URL found: %s", oldurl)
+		case !opts.Delete && oldurl == "":
+			// Replace the (first) URL.
+			if len(keep) == 0 {
+				keep = []string{newurl}
+			} else {
+				keep[0] = newurl
+			}
+		}
+		config.UnsetConfig(key)
+		for _, u := range keep {
+			if err := config.AddConfig(key, u); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// A RemoteBranch is a branch on a remote, as reported by "git remote
+// show".
+type RemoteBranch struct {
+	// The name of the branch on the remote, or the full name of the
+	// local ref for stale branches.
+	Name string
+
+	// One of "tracked", "new", "stale", or "" if the remote wasn't
+	// queried.
+	Status string
+}
+
+// A RemotePull is a local branch which merges with a branch on the remote
+// when pulling.
+type RemotePull struct {
+	Local, Merge string
+}
+
+// A RemotePush is a local branch which is pushed to the remote.
+type RemotePush struct {
+	Local, Remote string
+
+	// One of "up to date", "fast-forwardable" or "local out of date".
+	Status string
+}
+
+// RemoteInfo is the information shown by "git remote show" about a
+// remote.
+type RemoteInfo struct {
+	Name     string
+	FetchURL string
+	PushURLs []string
+
+	// Set if the remote was queried for its branches. Otherwise,
+	// Branches only come from local remote-tracking refs and the
+	// status of each is unknown.
+	Queried bool
+
+	// The branch that HEAD points to on the remote.
+	HEADBranch string
+
+	Branches []RemoteBranch
+	Pulls    []RemotePull
+	Pushes   []RemotePush
+}
+
+// Implements "git remote show". Unless noQuery is set, the remote is
+// contacted to compare its branches against the local remote-tracking
+// branches.
+func RemoteShow(c *Client, name string, noQuery bool) (RemoteInfo, error) {
+	info := RemoteInfo{Name: name}
+	if !c.remoteExists(name) {
+		return info, fmt.Errorf("'%s' does not appear to be a git repository", name)
+	}
+	if urls, err := RemoteGetURL(c, RemoteURLOptions{}, name); err == nil && len(urls) > 0 {
+		info.FetchURL = urls[0]
+	}
+	info.PushURLs, _ = RemoteGetURL(c, RemoteURLOptions{Push: true, All: true}, name)
+
+	config := c.readConfig()
+	for _, b := range config.Subsections("branch") {
+		if config.GetConfig("branch."+b+".remote") != name {
+			continue
+		}
+		if merge := config.GetConfig("branch." + b + ".merge"); merge != "" {
+			info.Pulls = append(info.Pulls, RemotePull{b, strings.TrimPrefix(merge, "refs/heads/")})
+		}
+	}
+	sort.Slice(info.Pulls, func(i, j int) bool { return info.Pulls[i].Local < info.Pulls[j].Local })
+
+	tracking, err := c.remoteTrackingRefs(name)
+	if err != nil {
+		return info, err
+	}
+	specs := c.remoteFetchRefspecs(name)
+	if noQuery {
+		for _, ref := range tracking {
+			info.Branches = append(info.Branches, RemoteBranch{Name: strings.TrimPrefix(ref.Name.String(), "refs/remotes/"+name+"/")})
+		}
+		return info, nil
+	}
+
+	remoteRefs, err := LsRemote(c, LsRemoteOptions{Symref: true}, name, nil)
+	if err != nil {
+		return info, err
+	}
+	info.Queried = true
+
+	// Branches on the remote, and whether they have a remote-tracking
+	// ref yet.
+	remoteHeads := make(map[string]Sha1)
+	fetched := make(map[RefSpec]bool)
+	for _, ref := range remoteRefs {
+		if ref.Refname == "HEAD" {
+			info.HEADBranch = strings.TrimPrefix(ref.Symref.String(), "refs/heads/")
+			continue
+		}
+		if !ref.Refname.HasPrefix("refs/heads/") {
+			continue
+		}
+		branch := strings.TrimPrefix(ref.Refname.String(), "refs/heads/")
+		if sha, err := Sha1FromString(ref.Sha1); err == nil {
+			remoteHeads[branch] = sha
+		}
+		status := "new"
+		for _, spec := range specs {
+			if local, ok := spec.toLocal(ref.Refname); ok {
+				fetched[local] = true
+				if local.Exists(c) {
+					status = "tracked"
+				}
+			}
+		}
+		info.Branches = append(info.Branches, RemoteBranch{branch, status})
+	}
+	for _, ref := range tracking {
+		if !fetched[ref.Name] {
+			info.Branches = append(info.Branches, RemoteBranch{ref.Name.String(), "stale"})
+		}
+	}
+	sort.Slice(info.Branches, func(i, j int) bool { return info.Branches[i].Name < info.Branches[j].Name })
+
+	// Without push refspecs, local branches are pushed to the branches
+	// of the same name on the remote.
+	locals, err := c.GetBranches()
+	if err != nil {
+		return info, err
+	}
+	for _, b := range locals {
+		remote, ok := remoteHeads[b.BranchName()]
+		if !ok {
+			continue
+		}
+		push := RemotePush{Local: b.BranchName(), Remote: b.BranchName()}
+		local, err := b.CommitID(c)
+		if err != nil {
+			return info, err
+		}
+		switch {
+		case Sha1(local) == remote:
+			push.Status = "up to date"
+		case remote.Type(c) == "commit" && CommitID(remote).IsAncestor(c, local):
+			push.Status = "fast-forwardable"
+		default:
+			push.Status = "local out of date"
+		}
+		info.Pushes = append(info.Pushes, push)
+	}
+	return info, nil
+}
+
+// RemotePruneOptions represents the options that may be passed to
+// "git remote prune".
+type RemotePruneOptions struct {
+	// Report what would be pruned without deleting anything.
+	DryRun bool
+}
+
+// Implements "git remote prune". It deletes the remote-tracking refs of
+// the remote name whose branches no longer exist on the remote, and
+// returns the refs which were (or, with opts.DryRun, would be) deleted.
+func RemotePrune(c *Client, opts RemotePruneOptions, name string) ([]RefSpec, error) {
+	if !c.remoteExists(name) {
+		return nil, fmt.Errorf("No such remote: '%s'", name)
+	}
+	remoteRefs, err := LsRemote(c, LsRemoteOptions{}, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	tracking, err := c.remoteTrackingRefs(name)
+	if err != nil {
+		return nil, err
+	}
+
+	fetched := make(map[RefSpec]bool)
+	for _, ref := range remoteRefs {
+		for _, spec := range c.remoteFetchRefspecs(name) {
+			if local, ok := spec.toLocal(ref.Refname); ok {
+				fetched[local] = true
+			}
+		}
+	}
+
+	var stale []RefSpec
+	t := NewRefTransaction(c)
+	for _, ref := range tracking {
+		if fetched[ref.Name] {
+			continue
+		}
+		stale = append(stale, ref.Name)
+		old := ref.Value
+		if err := t.Delete(ref.Name.String(), &old, true, ""); err != nil {
+			return nil, err
+		}
+	}
+	if opts.DryRun || len(stale) == 0 {
+		t.Abort()
+		return stale, nil
+	}
+	return stale, t.Commit()
+}
@@ -0,0 +1,39 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestFetchRefspec(t *testing.T) {
+	tests := []struct {
+		Spec   string
+		Remote RefSpec
+		Local  RefSpec
+		Match  bool
+	}{
+		{"+refs/heads/*:refs/remotes/origin/*", "refs/heads/master", "refs/remotes/origin/master", true},
+		{"+refs/heads/*:refs/remotes/origin/*", "refs/heads/feature/x", "refs/remotes/origin/feature/x", true},
+		{"+refs/heads/*:refs/remotes/origin/*", "refs/tags/v1", "", false},
+		{"refs/heads/master:refs/remotes/origin/master", "refs/heads/master", "refs/remotes/origin/master", true},
+		{"refs/heads/master:refs/remotes/origin/master", "refs/heads/main", "", false},
+		{"+refs/heads/*/x:refs/remotes/origin/*", "refs/heads/a/b/x", "refs/remotes/origin/a/b", true},
+		{"refs/heads/master", "refs/heads/master", "", false},
+	}
+	for i, tc := range tests {
+		spec := parseFetchRefspec(tc.Spec)
+		local, ok := spec.toLocal(tc.Remote)
+		if ok != tc.Match || local != tc.Local {
+			t.Errorf("tc %d: got %v (%v) want %v (%v)", i, local, ok, tc.Local, tc.Match)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if remote, ok := spec.toRemote(local); !ok || remote != tc.Remote {
+			t.Errorf("tc %d: got %v (%v) want %v", i, remote, ok, tc.Remote)
+		}
+		if got := spec.String(); got != tc.Spec {
+			t.Errorf("tc %d: got %v want %v", i, got, tc.Spec)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package git
+
+import (
+	"bytes"
+	"path"
+	"sort"
+)
+
+// The similarity score of identical files. Scores are scaled the same way
+// as git's, so that the percentages match.
+const maxSimilarity = 60000
+
+// Files which are at least 50% similar are considered to be renames.
+const minRenameSimilarity = maxSimilarity / 2
+
+// A FileChange is a change to a single file between two trees, after
+// renames have been detected.
+type FileChange struct {
+	HashDiff
+
+	// The name of the file in the source tree if it was renamed, or
+	// the empty string otherwise. HashDiff.Name is always the name in
+	// the destination tree.
+	OldName IndexPath
+
+	// How similar a renamed file is to the original, as a percentage.
+	Similarity int
+}
+
+// Returns the status letter for the change, as used by --name-status.
+func (f FileChange) Status() string {
+	switch {
+	case f.OldName != "":
+		return "R"
+	case f.Src.Sha1 == (Sha1{}) && f.Src.FileMode == 0:
+		return "A"
+	case f.Dst.Sha1 == (Sha1{}) && f.Dst.FileMode == 0:
+		return "D"
+	case f.Src.FileMode.fileType() != f.Dst.FileMode.fileType():
+		return "T"
+	}
+	return "M"
+}
+
+// Returns the type bits of a mode, which distinguish regular files,
+// symlinks and submodules.
+func (e EntryMode) fileType() EntryMode {
+	return e &^ 0777
+}
+
+// Returns true if the mode is for a regular file, executable or not.
+func (e EntryMode) isRegular() bool {
+	return e.fileType() == ModeBlob.fileType()
+}
+
+// Returns true if data looks like binary data, the same way as git does,
+// by checking for a NUL byte near the start.
+func IsBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// Returns the number of bytes in each span of data which hashes to the
+// same value, where spans end at a newline or after 64 bytes. This is the
+// same fingerprint that git's diffcore-delta uses to estimate similarity.
+func spanHashes(data []byte) map[uint32]int {
+	const hashBase = 107927
+	text := !IsBinary(data)
+	hashes := make(map[uint32]int)
+	var accum1, accum2 uint32
+	n := 0
+	for i := 0; i < len(data); i++ {
+		ch := uint32(data[i])
+		old1 := accum1
+		// CRs in CRLF line endings are ignored in text.
+		if text && ch == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+			continue
+		}
+		accum1 = (accum1 << 7) ^ (accum2 >> 25)
+		accum2 = (accum2 << 7) ^ (old1 >> 25)
+		accum1 += ch
+		n++
+		if n < 64 && ch != '\n' {
+			continue
+		}
+		hashes[(accum1+accum2*0x61)%hashBase] += n
+		n, accum1, accum2 = 0, 0, 0
+	}
+	if n > 0 {
+		hashes[(accum1+accum2*0x61)%hashBase] += n
+	}
+	return hashes
+}
+
+// Returns the similarity score of src and dst, which is 0 if they're
+// too different in size to be at least minScore similar.
+func similarity(src, dst []byte, minScore int) int {
+	maxSize, baseSize := len(src), len(dst)
+	if maxSize < baseSize {
+		maxSize, baseSize = baseSize, maxSize
+	}
+	if len(dst) == 0 || maxSize*(maxSimilarity-minScore) < (maxSize-baseSize)*maxSimilarity {
+		return 0
+	}
+	srcHashes, dstHashes := spanHashes(src), spanHashes(dst)
+	copied := 0
+	for h, n := range srcHashes {
+		if d := dstHashes[h]; d < n {
+			copied += d
+		} else {
+			copied += n
+		}
+	}
+	return int(int64(copied) * maxSimilarity / int64(maxSize))
+}
+
+// DetectRenames pairs up the files which were deleted in diffs with the
+// ones which were added, if they're similar enough to be renames. Other
+// changes are returned unchanged. Changes to trees are ignored, so diffs
+// should come from a recursive diff. The result is sorted by the name in
+// the destination.
+func DetectRenames(c *Client, diffs []HashDiff) ([]FileChange, error) {
+	var srcs, dsts []int
+	for i, d := range diffs {
+		if d.Src.FileMode == ModeTree || d.Dst.FileMode == ModeTree {
+			continue
+		}
+		switch {
+		case d.Src.Sha1 == (Sha1{}) && d.Src.FileMode == 0:
+			dsts = append(dsts, i)
+		case d.Dst.Sha1 == (Sha1{}) && d.Dst.FileMode == 0:
+			srcs = append(srcs, i)
+		}
+	}
+
+	// The index of the source that each destination was renamed from.
+	renamed := make(map[int]int)
+	scores := make(map[int]int)
+	used := make(map[int]bool)
+	sameBase := func(src, dst int) int {
+		if path.Base(string(diffs[src].Name)) == path.Base(string(diffs[dst].Name)) {
+			return 1
+		}
+		return 0
+	}
+
+	// Exact renames are found first, preferring the sources with the
+	// same base name.
+	for _, dst := range dsts {
+		best, bestScore := -1, -1
+		for _, src := range srcs {
+			s, d := diffs[src].Src, diffs[dst].Dst
+			if used[src] || s.Sha1 != d.Sha1 {
+				continue
+			}
+			if (!s.FileMode.isRegular() || !d.FileMode.isRegular()) && s.FileMode != d.FileMode {
+				continue
+			}
+			if score := sameBase(src, dst); score > bestScore {
+				best, bestScore = src, score
+			}
+		}
+		if best >= 0 {
+			renamed[dst], scores[dst] = best, maxSimilarity
+			used[best] = true
+		}
+	}
+
+	// Then the remaining regular files are compared to each other.
+	type candidate struct {
+		src, dst, score, nameScore int
+	}
+	var candidates []candidate
+	contents := make(map[Sha1][]byte)
+	content := func(id Sha1) ([]byte, error) {
+		if data, ok := contents[id]; ok {
+			return data, nil
+		}
+		obj, err := c.GetObject(id)
+		if err != nil {
+			return nil, err
+		}
+		contents[id] = obj.GetContent()
+		return contents[id], nil
+	}
+	for _, dst := range dsts {
+		if _, ok := renamed[dst]; ok || !diffs[dst].Dst.FileMode.isRegular() {
+			continue
+		}
+		dstData, err := content(diffs[dst].Dst.Sha1)
+		if err != nil {
+			return nil, err
+		}
+		for _, src := range srcs {
+			if used[src] || !diffs[src].Src.FileMode.isRegular() {
+				continue
+			}
+			srcData, err := content(diffs[src].Src.Sha1)
+			if err != nil {
+				return nil, err
+			}
+			if score := similarity(srcData, dstData, minRenameSimilarity); score >= minRenameSimilarity {
+				candidates = append(candidates, candidate{src, dst, score, sameBase(src, dst)})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].nameScore > candidates[j].nameScore
+	})
+	for _, cand := range candidates {
+		if _, ok := renamed[cand.dst]; ok || used[cand.src] {
+			continue
+		}
+		renamed[cand.dst], scores[cand.dst] = cand.src, cand.score
+		used[cand.src] = true
+	}
+
+	var changes []FileChange
+	for i, d := range diffs {
+		if d.Src.FileMode == ModeTree || d.Dst.FileMode == ModeTree || used[i] {
+			continue
+		}
+		change := FileChange{HashDiff: d}
+		if src, ok := renamed[i]; ok {
+			change.OldName = diffs[src].Name
+			change.Src = diffs[src].Src
+			change.Similarity = scores[i] * 100 / maxSimilarity
+		}
+		changes = append(changes, change)
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes, nil
+}
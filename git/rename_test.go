@@ -0,0 +1,46 @@
+package git
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		Src, Dst string
+		Want     int
+	}{
+		{"a\nb\nc\nd\n", "a\nb\nc\nd\n", maxSimilarity},
+		{"a\nb\nc\nd\n", "a\nb\nc\ne\n", maxSimilarity * 3 / 4},
+		// CRs in CRLF line endings don't count as a change.
+		{"a\nb\n", "a\r\nb\r\n", maxSimilarity * 4 / 6},
+		// Files which are too different in size aren't compared.
+		{"a\n", strings.Repeat("a\n", 10), 0},
+		{"a\n", "", 0},
+	}
+	for i, tc := range tests {
+		if got := similarity([]byte(tc.Src), []byte(tc.Dst), minRenameSimilarity); got != tc.Want {
+			t.Errorf("tc %d: got %v want %v", i, got, tc.Want)
+		}
+	}
+}
+
+func TestFileChangeStatus(t *testing.T) {
+	blob := TreeEntry{Sha1: Sha1{1}, FileMode: ModeBlob}
+	tests := []struct {
+		Change FileChange
+		Want   string
+	}{
+		{FileChange{HashDiff: HashDiff{Src: blob, Dst: TreeEntry{Sha1: Sha1{2}, FileMode: ModeBlob}}}, "M"},
+		{FileChange{HashDiff: HashDiff{Src: blob, Dst: TreeEntry{Sha1: Sha1{1}, FileMode: ModeExec}}}, "M"},
+		{FileChange{HashDiff: HashDiff{Src: blob, Dst: TreeEntry{Sha1: Sha1{1}, FileMode: ModeSymlink}}}, "T"},
+		{FileChange{HashDiff: HashDiff{Dst: blob}}, "A"},
+		{FileChange{HashDiff: HashDiff{Src: blob}}, "D"},
+		{FileChange{HashDiff: HashDiff{Src: blob, Dst: blob}, OldName: "old"}, "R"},
+	}
+	for i, tc := range tests {
+		if got := tc.Change.Status(); got != tc.Want {
+			t.Errorf("tc %d: got %v want %v", i, got, tc.Want)
+		}
+	}
+}
@@ -32,6 +32,10 @@ var NoNewCommits error = errors.New("No new commits")
 type Reference struct {
 	Sha1    string
 	Refname RefSpec
+
+	// The ref that Refname points to, if it's a symbolic ref on the
+	// remote and it was requested.
+	Symref RefSpec
 }
 
 type UpdateReference struct {
@@ -0,0 +1,591 @@
+package git
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// RevListOptions represents the options that may be passed to
+// "git rev-list".
+type RevListOptions struct {
+	WalkOptions
+
+	// Include the trees and blobs referenced by the listed commits.
+	Objects bool
+
+	// Include the excluded commits which are parents of listed commits.
+	Boundary bool
+
+	// Mark which side of a symmetric difference each commit is on.
+	LeftRight bool
+
+	// Mark commits which have an equivalent patch on the other side of
+	// a symmetric difference.
+	CherryMark bool
+
+	// Include the children of each listed commit in its entry.
+	Children bool
+}
+
+// A tag, tree or blob given in the revisions to rev-list, which is listed
+// with the Objects option.
+type pendingObject struct {
+	Id   Sha1
+	Path IndexPath
+}
+
+// A RevListEntry is a commit or other object listed by RevList.
+type RevListEntry struct {
+	Id Sha1
+
+	// The entry is a tree or blob included because of the Objects
+	// option, rather than a commit.
+	Object bool
+
+	// The path of a tree or blob listed because of the Objects option,
+	// relative to the root of the commit's tree. It's empty for commits
+	// and root trees.
+	Path IndexPath
+
+	// The commit is a boundary commit, which was excluded by the
+	// revisions but is the parent of a listed commit.
+	Boundary bool
+
+	// The commit is only reachable from the left side of a symmetric
+	// difference.
+	Left bool
+
+	// The commit has an equivalent patch on the other side of a
+	// symmetric difference. Only set with the CherryMark option.
+	Equivalent bool
+
+	// The parents of a listed commit. With the RewriteParents option,
+	// they're rewritten to the nearest ancestors which are listed.
+	Parents []CommitID
+
+	// The listed commits that are children of the commit. Only set
+	// with the Children option.
+	Children []CommitID
+}
+
+// Parses the revisions given to rev-list into the tips to walk from.
+// Excluded tips have the uninteresting flag set in w, and any tags, trees
+// or blobs are added to w's pending or excluded objects. It returns true
+// if there was a symmetric difference.
+func (w *revWalker) addRevisions(revs []string) (tips []CommitID, symmetric bool, err error) {
+	c := w.c
+	not := false
+	add := func(name string, exclude bool, f walkFlags) error {
+		id, err := RevParseObject(c, &RevParseOptions{}, name)
+		if err != nil {
+			return err
+		}
+		id, err = peelObject(c, id, "commit")
+		if err != nil {
+			return err
+		}
+		if exclude {
+			f |= uninteresting | bottom
+		}
+		w.flags[CommitID(id)] |= f
+		tips = append(tips, CommitID(id))
+		return nil
+	}
+	// Adds the object id to the walk. Tags are followed to the object
+	// that they point to, and are kept along with any trees or blobs to
+	// be listed with the Objects option. path is the path of a tree or
+	// blob that was given with the "rev:path" syntax.
+	addObject := func(id Sha1, path IndexPath, exclude bool) error {
+		for id.Type(c) == "tag" {
+			obj, err := c.GetObject(id)
+			if err != nil {
+				return err
+			}
+			headers, _ := parseObjectHeaders(obj.GetContent())
+			if exclude {
+				w.excluded = append(w.excluded, id)
+			} else {
+				w.pending = append(w.pending, pendingObject{id, IndexPath(getObjectHeader(headers, "tag"))})
+			}
+			if id, err = Sha1FromString(getObjectHeader(headers, "object")); err != nil {
+				return err
+			}
+		}
+		switch t := id.Type(c); t {
+		case "commit":
+			if exclude {
+				w.flags[CommitID(id)] |= uninteresting | bottom
+			}
+			tips = append(tips, CommitID(id))
+		case "tree", "blob":
+			if exclude {
+				w.excluded = append(w.excluded, id)
+			} else {
+				w.pending = append(w.pending, pendingObject{id, path})
+			}
+		default:
+			return fmt.Errorf("Object %s not found", id)
+		}
+		return nil
+	}
+	addRev := func(name string, exclude bool) error {
+		id, err := RevParseObject(c, &RevParseOptions{}, name)
+		if err != nil {
+			return err
+		}
+		var path IndexPath
+		if sep := revPathSeparator(name); sep >= 0 {
+			path = IndexPath(name[sep+1:])
+		}
+		return addObject(id, path, exclude)
+	}
+	addRefs := func(prefix, pattern string, exclude bool) error {
+		if pattern != "" && !strings.ContainsAny(pattern, "*?[") {
+			pattern += "/*"
+		}
+		refs, err := c.GetRefs(prefix)
+		if err != nil {
+			return err
+		}
+		for _, ref := range refs {
+			if pattern != "" && !matchesWildcard(prefix+pattern, ref.Name.String()) {
+				continue
+			}
+			if err := addObject(ref.Value, "", exclude); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, rev := range revs {
+		switch {
+		case rev == "--not":
+			not = !not
+			continue
+		case rev == "--all":
+			if head, err := SymbolicRef("HEAD").CommitID(c); err == nil {
+				if err := addObject(Sha1(head), "", not); err != nil {
+					return nil, false, err
+				}
+			}
+			err = addRefs("refs/", "", not)
+		case rev == "--branches" || strings.HasPrefix(rev, "--branches="):
+			err = addRefs("refs/heads/", strings.TrimPrefix(strings.TrimPrefix(rev, "--branches"), "="), not)
+		case rev == "--tags" || strings.HasPrefix(rev, "--tags="):
+			err = addRefs("refs/tags/", strings.TrimPrefix(strings.TrimPrefix(rev, "--tags"), "="), not)
+		case rev == "--remotes" || strings.HasPrefix(rev, "--remotes="):
+			err = addRefs("refs/remotes/", strings.TrimPrefix(strings.TrimPrefix(rev, "--remotes"), "="), not)
+		case strings.HasPrefix(rev, "-") && rev != "-":
+			return nil, false, fmt.Errorf("Unknown option %s", rev)
+		case strings.Contains(rev, "..."):
+			dots := strings.Index(rev, "...")
+			left, right := rev[:dots], rev[dots+3:]
+			if left == "" {
+				left = "HEAD"
+			}
+			if right == "" {
+				right = "HEAD"
+			}
+			if err := add(left, not, symmetricLeft); err != nil {
+				return nil, false, err
+			}
+			if err := add(right, not, symmetricRight); err != nil {
+				return nil, false, err
+			}
+			symmetric = true
+		case strings.Contains(rev, ".."):
+			dots := strings.Index(rev, "..")
+			left, right := rev[:dots], rev[dots+2:]
+			if left == "" {
+				left = "HEAD"
+			}
+			if right == "" {
+				right = "HEAD"
+			}
+			if err := add(left, !not, 0); err != nil {
+				return nil, false, err
+			}
+			err = add(right, not, 0)
+		case strings.HasPrefix(rev, "^"):
+			err = addRev(rev[1:], !not)
+		default:
+			err = addRev(rev, not)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return tips, symmetric, nil
+}
+
+// Returns an identifier for the changes introduced by the commit, which
+// is the same for commits that make the same change on top of different
+// parents. Like "git patch-id", it ignores whitespace and line numbers.
+// Merge commits don't have a patch ID.
+func (w *revWalker) patchID(cmt *walkCommit) (Sha1, bool, error) {
+	if len(cmt.Parents) > 1 {
+		return Sha1{}, false, nil
+	}
+	c := w.c
+	var diffs []HashDiff
+	var err error
+	if len(cmt.Parents) == 0 {
+		objects, err := cmt.Tree.GetAllObjects(c, "", true, true)
+		if err != nil {
+			return Sha1{}, false, err
+		}
+		for name, entry := range objects {
+			if entry.FileMode != ModeTree {
+				diffs = append(diffs, HashDiff{name, TreeEntry{}, entry})
+			}
+		}
+		sort.Sort(ByName(diffs))
+	} else {
+		diffs, err = DiffTree(c, &DiffTreeOptions{Recurse: true}, cmt.Parents[0], cmt.Id, nil)
+		if err != nil {
+			return Sha1{}, false, err
+		}
+	}
+
+	h := sha1.New()
+	for _, d := range diffs {
+		if d.Src.FileMode == ModeTree || d.Dst.FileMode == ModeTree {
+			continue
+		}
+		fmt.Fprintf(h, "%s\n", d.Name)
+		patch, err := d.ExternalDiff(c, d.Src, d.Dst, File(d.Name), DiffCommonOptions{})
+		if err != nil {
+			return Sha1{}, false, err
+		}
+		for _, line := range strings.Split(patch, "\n") {
+			if strings.HasPrefix(line, "+++") || strings.HasPrefix(line, "---") {
+				continue
+			}
+			if !strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "-") {
+				continue
+			}
+			h.Write([]byte(strings.Map(func(r rune) rune {
+				if unicode.IsSpace(r) {
+					return -1
+				}
+				return r
+			}, line)))
+			h.Write([]byte{'\n'})
+		}
+	}
+	var id Sha1
+	copy(id[:], h.Sum(nil))
+	return id, true, nil
+}
+
+// Returns the commits from commits which have an equivalent patch on the
+// other side of the symmetric difference.
+func (w *revWalker) cherryEquivalents(commits []*walkCommit) (map[CommitID]bool, error) {
+	ids := make(map[CommitID]Sha1)
+	sides := make(map[Sha1][2]bool)
+	for _, cmt := range commits {
+		id, ok, err := w.patchID(cmt)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		ids[cmt.Id] = id
+		s := sides[id]
+		if w.flags[cmt.Id]&symmetricLeft != 0 {
+			s[0] = true
+		} else {
+			s[1] = true
+		}
+		sides[id] = s
+	}
+	equivalent := make(map[CommitID]bool)
+	for cmt, id := range ids {
+		if s := sides[id]; s[0] && s[1] {
+			equivalent[cmt] = true
+		}
+	}
+	return equivalent, nil
+}
+
+// Returns true if the tree entry a sorts before b in a git tree object.
+// Trees are sorted as if their names had a trailing slash.
+func treeEntryLess(a, b IndexPath, amode, bmode EntryMode) bool {
+	as, bs := string(a), string(b)
+	if amode == ModeTree {
+		as += "/"
+	}
+	if bmode == ModeTree {
+		bs += "/"
+	}
+	return as < bs
+}
+
+// Returns true if the tree entry at path should be included by a walk
+// limited to paths. Trees which are leading directories of one of the
+// paths are included, so that they can be descended into.
+func pathIncluded(path IndexPath, isTree bool, paths []IndexPath) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, p := range paths {
+		if path == p || strings.HasPrefix(string(path), string(p)+"/") {
+			return true
+		}
+		if isTree && strings.HasPrefix(string(p), string(path)+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Appends the objects in tree (including tree itself) which aren't in
+// excluded to objects, in the order that git lists them. Only the objects
+// included by paths are listed, if there are any.
+func revListTree(c *Client, tree TreeID, path IndexPath, paths []IndexPath, excluded map[Sha1]bool, objects []RevListEntry) ([]RevListEntry, error) {
+	if excluded[Sha1(tree)] {
+		return objects, nil
+	}
+	excluded[Sha1(tree)] = true
+	objects = append(objects, RevListEntry{Id: Sha1(tree), Object: true, Path: path})
+
+	entries, err := tree.GetAllObjects(c, "", false, false)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]IndexPath, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return treeEntryLess(names[i], names[j], entries[names[i]].FileMode, entries[names[j]].FileMode)
+	})
+	for _, name := range names {
+		entry := entries[name]
+		child := name
+		if path != "" {
+			child = path + "/" + name
+		}
+		if !pathIncluded(child, entry.FileMode == ModeTree, paths) {
+			continue
+		}
+		if entry.FileMode == ModeTree {
+			if objects, err = revListTree(c, TreeID(entry.Sha1), child, paths, excluded, objects); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if excluded[entry.Sha1] {
+			continue
+		}
+		excluded[entry.Sha1] = true
+		objects = append(objects, RevListEntry{Id: entry.Sha1, Object: true, Path: child})
+	}
+	return objects, nil
+}
+
+// Marks every object in tree as excluded.
+func excludeTree(c *Client, tree TreeID, excluded map[Sha1]bool) error {
+	if excluded[Sha1(tree)] {
+		return nil
+	}
+	excluded[Sha1(tree)] = true
+	objects, err := tree.GetAllObjects(c, "", true, false)
+	if err != nil {
+		return err
+	}
+	for _, entry := range objects {
+		excluded[entry.Sha1] = true
+	}
+	return nil
+}
+
+// Implements "git rev-list". revs are the revisions given on the command
+// line, which may include ranges such as "A..B" and "A...B", exclusions
+// such as "^A", and the pseudo-options "--not", "--all", and
+// "--branches", "--tags" or "--remotes" with an optional "=pattern".
+//
+// Commits are returned from newest to oldest unless the WalkOptions
+// change the order, followed by boundary commits and then the other
+// objects if opts.Objects is set.
+func RevList(c *Client, opts RevListOptions, revs []string) ([]RevListEntry, error) {
+	return newRevWalker(c).revList(opts, revs)
+}
+
+// Implements RevList using w, so that the caller can inspect the flags
+// that were set on the commits afterwards.
+func (w *revWalker) revList(opts RevListOptions, revs []string) ([]RevListEntry, error) {
+	c := w.c
+	filter, err := newCommitFilter(opts.WalkOptions)
+	if err != nil {
+		return nil, err
+	}
+	w.firstParent = opts.FirstParent
+	w.paths = opts.Paths
+	if !opts.Since.IsZero() {
+		w.maxAge = opts.Since.Unix()
+	}
+	tips, symmetric, err := w.addRevisions(revs)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := w.limit(tips)
+	if err != nil {
+		return nil, err
+	}
+	if opts.TopoOrder || opts.DateOrder {
+		commits = w.topoSort(commits, opts.DateOrder)
+	}
+
+	var children map[CommitID][]CommitID
+	if opts.Children {
+		// Like git, children are listed in the reverse of the order
+		// that they're walked.
+		children = make(map[CommitID][]CommitID)
+		for _, cmt := range commits {
+			for _, p := range cmt.Parents {
+				children[p] = append([]CommitID{cmt.Id}, children[p]...)
+			}
+		}
+	}
+
+	var equivalent map[CommitID]bool
+	if opts.CherryMark && symmetric {
+		if equivalent, err = w.cherryEquivalents(commits); err != nil {
+			return nil, err
+		}
+	}
+
+	var included []*walkCommit
+	skip := opts.Skip
+	for _, cmt := range commits {
+		if opts.MaxCount < 0 || (opts.MaxCount > 0 && len(included) >= opts.MaxCount) {
+			break
+		}
+		ok, err := w.include(cmt, filter)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		included = append(included, cmt)
+	}
+	if opts.Reverse {
+		for i, j := 0, len(included)-1; i < j; i, j = i+1, j-1 {
+			included[i], included[j] = included[j], included[i]
+		}
+	}
+
+	var entries []RevListEntry
+	for _, cmt := range included {
+		w.flags[cmt.Id] |= shown
+		parents := cmt.Parents
+		if opts.RewriteParents && len(w.paths) > 0 {
+			if parents, err = w.rewriteParents(cmt); err != nil {
+				return nil, err
+			}
+		}
+		for _, p := range parents {
+			w.flags[p] |= childShown
+		}
+		entries = append(entries, RevListEntry{
+			Id:         Sha1(cmt.Id),
+			Left:       w.flags[cmt.Id]&symmetricLeft != 0,
+			Equivalent: equivalent[cmt.Id],
+			Parents:    parents,
+			Children:   children[cmt.Id],
+		})
+	}
+
+	if opts.Boundary {
+		var boundary []*walkCommit
+		added := make(map[CommitID]bool)
+		for _, e := range entries {
+			for _, pid := range e.Parents {
+				if w.flags[pid]&shown != 0 || added[pid] {
+					continue
+				}
+				added[pid] = true
+				// Like git, the parents of boundary commits which
+				// weren't reached by the walk are unknown.
+				p, ok := w.commits[pid]
+				if !ok {
+					p = &walkCommit{Id: pid}
+				}
+				boundary = append(boundary, p)
+			}
+		}
+		// Like git, the boundary commits are in reverse order of
+		// discovery, sorted topologically.
+		for i, j := 0, len(boundary)-1; i < j; i, j = i+1, j-1 {
+			boundary[i], boundary[j] = boundary[j], boundary[i]
+		}
+		for _, cmt := range w.topoSort(boundary, false) {
+			entries = append(entries, RevListEntry{
+				Id:       Sha1(cmt.Id),
+				Boundary: true,
+				Left:     w.flags[cmt.Id]&symmetricLeft != 0,
+				Parents:  cmt.Parents,
+				Children: children[cmt.Id],
+			})
+		}
+	}
+
+	if opts.Objects {
+		// Like git, only exclude the objects reachable from the
+		// excluded commits at the edge of the range.
+		excluded := make(map[Sha1]bool)
+		for _, id := range w.excluded {
+			if id.Type(c) == "tree" {
+				if err := excludeTree(c, TreeID(id), excluded); err != nil {
+					return nil, err
+				}
+			}
+			excluded[id] = true
+		}
+		for _, cmt := range included {
+			for _, pid := range cmt.Parents {
+				if w.flags[pid]&uninteresting == 0 {
+					continue
+				}
+				p, err := w.parse(pid)
+				if err != nil {
+					return nil, err
+				}
+				if err := excludeTree(c, p.Tree, excluded); err != nil {
+					return nil, err
+				}
+			}
+		}
+		// The objects that were given in the revisions come before
+		// the trees of the commits.
+		for _, obj := range w.pending {
+			if obj.Id.Type(c) == "tree" {
+				if entries, err = revListTree(c, TreeID(obj.Id), obj.Path, w.paths, excluded, entries); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if !excluded[obj.Id] {
+				excluded[obj.Id] = true
+				entries = append(entries, RevListEntry{Id: obj.Id, Object: true, Path: obj.Path})
+			}
+		}
+		for _, cmt := range included {
+			if entries, err = revListTree(c, cmt.Tree, "", w.paths, excluded, entries); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,61 @@
+package git
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRevList(t *testing.T) {
+	r := newTestRepo(t)
+	defer r.Close()
+	r.mergeHistory()
+	commits := r.commits
+
+	tests := []struct {
+		Opts RevListOptions
+		Revs []string
+		Want string
+	}{
+		{RevListOptions{}, []string{commits["F"].String()}, "F E C D B A"},
+		{RevListOptions{}, []string{commits["C"].String() + ".." + commits["F"].String()}, "F E D"},
+		{RevListOptions{}, []string{commits["F"].String(), "^" + commits["D"].String()}, "F E C B"},
+		{RevListOptions{}, []string{commits["F"].String(), "--not", commits["C"].String(), commits["D"].String()}, "F E"},
+		{RevListOptions{Boundary: true}, []string{commits["E"].String(), "^" + commits["D"].String()}, "E C B -D -A"},
+		{RevListOptions{LeftRight: true}, []string{commits["C"].String() + "..." + commits["D"].String()}, "<C >D <B"},
+		{RevListOptions{LeftRight: true}, []string{commits["C"].String() + "..." + commits["F"].String()}, ">F >E >D"},
+		{RevListOptions{}, []string{commits["C"].String() + "..." + commits["C"].String()}, ""},
+		{RevListOptions{WalkOptions: WalkOptions{MaxCount: 2, Skip: 1}}, []string{commits["F"].String()}, "E C"},
+		{RevListOptions{WalkOptions: WalkOptions{MaxCount: 3, Reverse: true}}, []string{commits["F"].String()}, "C E F"},
+		{RevListOptions{WalkOptions: WalkOptions{MaxCount: -1}}, []string{commits["F"].String()}, ""},
+		{RevListOptions{WalkOptions: WalkOptions{FirstParent: true}}, []string{commits["F"].String()}, "F E D A"},
+		{RevListOptions{WalkOptions: WalkOptions{Merges: true}}, []string{commits["F"].String()}, "E"},
+		{RevListOptions{WalkOptions: WalkOptions{NoMerges: true, TopoOrder: true}}, []string{commits["F"].String()}, "F C B D A"},
+		{RevListOptions{WalkOptions: WalkOptions{Grep: []string{"^[BC]$"}}}, []string{commits["F"].String()}, "C B"},
+		{RevListOptions{WalkOptions: WalkOptions{Since: time.Unix(250, 0)}}, []string{commits["F"].String()}, "F E C D"},
+	}
+	for i, tc := range tests {
+		entries, err := RevList(r.Client, tc.Opts, tc.Revs)
+		if err != nil {
+			t.Errorf("tc %d: %v", i, err)
+			continue
+		}
+		var got string
+		for j, e := range entries {
+			if j > 0 {
+				got += " "
+			}
+			switch {
+			case e.Boundary:
+				got += "-"
+			case tc.Opts.LeftRight && e.Left:
+				got += "<"
+			case tc.Opts.LeftRight:
+				got += ">"
+			}
+			got += r.names[CommitID(e.Id)]
+		}
+		if got != tc.Want {
+			t.Errorf("tc %d: got %v want %v", i, got, tc.Want)
+		}
+	}
+}
@@ -1,37 +1,49 @@
 package git
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// Returned by RevParse with the Verify option if it wasn't given exactly
+// one valid revision.
+var NeedSingleRevision error = errors.New("Needed a single revision")
+
 type Pattern string
 
 type ParsedRevision struct {
 	Id       Sha1
 	Excluded bool
+
+	// The name of the revision, if one of the Symbolic,
+	// SymbolicFullName or AbbrefRev options was set.
+	Name string
 }
 
 func (pr ParsedRevision) CommitID(c *Client) (CommitID, error) {
-	if pr.Id.Type(c) != "commit" {
+	id, err := peelObject(c, pr.Id, "commit")
+	if err != nil {
 		return CommitID{}, fmt.Errorf("Invalid revision commit")
 	}
-	return CommitID(pr.Id), nil
+	return CommitID(id), nil
 }
 
 func (pr ParsedRevision) TreeID(c *Client) (TreeID, error) {
-	if pr.Id.Type(c) != "commit" {
-		return TreeID{}, fmt.Errorf("Invalid revision commit")
+	id, err := peelObject(c, pr.Id, "tree")
+	if err != nil {
+		return TreeID{}, fmt.Errorf("Invalid revision tree")
 	}
-	return CommitID(pr.Id).TreeID(c)
+	return TreeID(id), nil
 }
 
 func (pr ParsedRevision) IsAncestor(c *Client, parent Commitish) bool {
-	if pr.Id.Type(c) != "commit" {
-		return false
-	}
 	com, err := pr.CommitID(c)
 	if err != nil {
 		return false
@@ -48,54 +60,64 @@ func (pr ParsedRevision) Ancestors(c *Client) []CommitID {
 }
 
 // Options that may be passed to RevParse on the command line.
-// BUG(driusan): None of the RevParse options are implemented
+// BUG(driusan): The filtering options are not implemented.
 type RevParseOptions struct {
-	// Operation modes
+	// Operation modes. These are handled by RevParseParseOpt and
+	// SQQuote rather than RevParse.
 	ParseOpt, SQQuote bool
 
 	// Options for --parseopt
-	KeepDashDash    bool
-	StopAtNonOption bool
-	StuckLong       bool
+	KeepDashDash    bool // Keep the "--" in the remaining arguments.
+	StopAtNonOption bool // Stop parsing at the first non-option.
+	StuckLong       bool // Output options in their --long=value form.
 
 	// Options for Filtering
 	RevsOnly       bool
 	NoRevs         bool
 	Flags, NoFlags bool
 
-	// Options for output. These should probably not be here but be handled
-	// in the cmd package instead.
-	Default                    string
-	Prefix                     string
-	Verify                     bool
-	Quiet                      bool
-	SQ                         bool
-	Not                        bool
-	AbbrefRev                  string //strict|loose
-	Short                      uint   // The number of characters to abbreviate to. Default should be "4"
+	// Options for output.
+	Default string // The revision to use if no revisions are given.
+	Prefix  string
+	Verify  bool // Require exactly one valid revision.
+
+	// With Verify, the caller shouldn't print an error if the revision
+	// isn't valid. RevParse still returns one.
+	Quiet bool
+
+	SQ        bool
+	Not       bool   // Toggle whether revisions are excluded.
+	AbbrefRev string // strict|loose. Set the Name of revisions to the short name of the ref.
+	Short     uint   // The minimum number of characters to abbreviate to. 0 means core.abbrev
+
+	// Set the Name of each ParsedRevision to the revision as it was
+	// given, or to the full name of the ref that it refers to.
 	Symbolic, SymbolicFullName bool
 
-	// Options for Objects
+	// Options for Objects. Patterns for Branches, Tags and Remotes
+	// match the refs under refs/heads/, refs/tags/ and refs/remotes/
+	// respectively, and Glob patterns match refs under refs/. A pattern
+	// without a wildcard is treated as a prefix, and "*" lists all refs.
+	// Exclude removes the refs whose listed name matches it.
 	All                     bool
 	Branches, Tags, Remotes Pattern
 	Glob                    Pattern
 	Exclude                 Pattern
-	Disambiguate            string // Prefix
-
-	// Options for Files
-	// BUG(driusan): These should be handled as part of "args", not in RevParseOptions.
-	// They're included here so that I don't forget about them.
-	GitDir           GitDir
-	GitCommonDir     GitDir
-	IsInsideGitDir   bool
-	IsInsideWorkTree bool
-	IsBareRepository bool
-	ResolveGitDir    File // path
-	GitPath          GitDir
-	ShowCDup         bool
-	ShowPrefix       bool
-	ShowToplevel     bool
-	SharedIndexPath  bool
+	Disambiguate            string // Prefix of the objects to list
+
+	// Options for Files. These are handled by RevParseFiles rather than
+	// RevParse.
+	GitDir, AbsoluteGitDir bool
+	GitCommonDir           bool
+	IsInsideGitDir         bool
+	IsInsideWorkTree       bool
+	IsBareRepository       bool
+	ResolveGitDir          File // The path to check.
+	GitPath                File // The path to resolve inside of the git directory.
+	ShowCDup               bool
+	ShowPrefix             bool
+	ShowToplevel           bool
+	SharedIndexPath        bool
 
 	// Other options
 	After, Before time.Time
@@ -103,53 +125,466 @@ type RevParseOptions struct {
 
 // RevParseTreeish will parse a single revision into a Treeish structure.
 func RevParseTreeish(c *Client, opt *RevParseOptions, arg string) (Treeish, error) {
-	if len(arg) == 40 {
-		comm, err := Sha1FromString(arg)
-		if err != nil {
-			return nil, err
-		}
-		switch comm.Type(c) {
-		case "tree":
-			return TreeID(comm), nil
-		case "commit":
-			return CommitID(comm), nil
-		default:
-			return nil, fmt.Errorf("%s is not a tree-ish", arg)
-		}
-	}
-
 	// Check if it's a symbolic ref
-	var b Branch
 	r, err := SymbolicRefGet(c, SymbolicRefOptions{}, SymbolicRef(arg))
 	if err == nil {
 		// It was a symbolic ref, convert it to a branch.
-		b = Branch(r)
+		return Branch(r), nil
+	}
+	if b, ok := revParseBranch(c, arg); ok {
 		return b, nil
 	}
 
-	// arg was not a Sha or a symbolic ref, it might still be a branch.
-	// (This will return an error if arg is an invalid branch.)
-	return GetBranch(c, arg)
+	id, err := revParseObject(c, opt, arg, "treeish")
+	if err != nil {
+		return nil, err
+	}
+	if id, err = id.Peel(c); err != nil {
+		return nil, err
+	}
+	switch id.Type(c) {
+	case "tree":
+		return TreeID(id), nil
+	case "commit":
+		return CommitID(id), nil
+	default:
+		return nil, fmt.Errorf("%s is not a tree-ish", arg)
+	}
+}
+
+// Returns the branch that arg refers to if it names a local or
+// remote-tracking branch, so that commands such as checkout can tell
+// that they were given a branch and not just a commit.
+func revParseBranch(c *Client, arg string) (Branch, bool) {
+	ref, err := c.DwimRef(arg)
+	if err != nil {
+		return "", false
+	}
+	if !ref.HasPrefix("refs/heads/") && !ref.HasPrefix("refs/remotes/") {
+		return "", false
+	}
+	if _, err := ref.CommitID(c); err != nil {
+		return "", false
+	}
+	return Branch(ref), true
+}
+
+// Parses a reflog revision of the form name@{sel}.
+func revParseReflog(c *Client, opt *RevParseOptions, name, sel string) (Commitish, error) {
+	if name == "" && strings.HasPrefix(sel, "-") {
+		// @{-n} is the nth branch checked out before the current one.
+		n, err := strconv.Atoi(sel[1:])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid previous branch: @{%s}", sel)
+		}
+		prev, err := c.previousBranch(n)
+		if err != nil {
+			return nil, err
+		}
+		return RevParseCommitish(c, opt, prev)
+	}
+	switch strings.ToLower(sel) {
+	case "u", "upstream":
+		// name@{upstream} is the branch that name is tracking.
+		b := c.GetHeadBranch()
+		if name != "" && name != "HEAD" {
+			b = Branch("refs/heads/" + name)
+		}
+		if b == "" {
+			return nil, DetachedHead
+		}
+		upstream := b.Upstream(c)
+		if upstream == "" {
+			return nil, fmt.Errorf("no upstream configured for branch '%s'", b.BranchName())
+		}
+		if !upstream.Exists(c) {
+			return nil, fmt.Errorf("upstream branch '%s' not stored as a remote-tracking branch", upstream)
+		}
+		return Branch(upstream), nil
+	}
+	id, err := c.resolveReflogSelector(name, sel)
+	if err != nil {
+		return nil, err
+	}
+	return CommitID(id), nil
 }
 
 // RevParse will parse a single revision into a Commitish object.
 func RevParseCommitish(c *Client, opt *RevParseOptions, arg string) (Commitish, error) {
-	if len(arg) == 40 {
-		sha1, err := Sha1FromString(arg)
-		return CommitID(sha1), err
+	// @{-n} refers to a branch, not only its commit.
+	if strings.HasPrefix(arg, "@{-") && strings.HasSuffix(arg, "}") {
+		return revParseReflog(c, opt, "", arg[2:len(arg)-1])
 	}
 
 	// Check if it's a symbolic ref
-	var b Branch
 	r, err := SymbolicRefGet(c, SymbolicRefOptions{}, SymbolicRef(arg))
 	if err == nil {
 		// It was a symbolic ref, convert the refspec to a branch.
-		if b = Branch(r); b.Exists(c) {
+		if b := Branch(r); b.Exists(c) {
 			return b, nil
 		}
 	}
-	// arg was not a Sha or a valid symbolic ref, it might still be a branch
-	return GetBranch(c, arg)
+	if b, ok := revParseBranch(c, arg); ok {
+		return b, nil
+	}
+
+	id, err := revParseObject(c, opt, arg, "committish")
+	if err != nil {
+		return nil, err
+	}
+	id, err = peelObject(c, id, "commit")
+	if err != nil {
+		return nil, err
+	}
+	return CommitID(id), nil
+}
+
+// RevParseObject parses a single revision, as described in
+// gitrevisions(7), into the object that it names. Unlike
+// RevParseCommitish, the object may be of any type. For instance,
+// "v1.0" names the tag object itself, "HEAD^{tree}" names a tree and
+// "HEAD:README" names a blob.
+func RevParseObject(c *Client, opt *RevParseOptions, arg string) (Sha1, error) {
+	return revParseObject(c, opt, arg, "")
+}
+
+// Implements RevParseObject. If arg contains an ambiguous abbreviated
+// object name, objects which don't satisfy hint are ignored. (See
+// resolveAbbrev.)
+func revParseObject(c *Client, opt *RevParseOptions, arg, hint string) (Sha1, error) {
+	if arg == "" {
+		return Sha1{}, fmt.Errorf("Invalid empty revision")
+	}
+	if strings.HasPrefix(arg, ":/") {
+		// :/regex is the youngest commit reachable from any ref whose
+		// message matches.
+		starts, err := revParseAllRefs(c)
+		if err != nil {
+			return Sha1{}, err
+		}
+		cmt, err := searchCommitMessage(c, starts, arg[2:])
+		return Sha1(cmt), err
+	}
+	if arg[0] == ':' {
+		return revParseIndexPath(c, arg[1:])
+	}
+	if colon := revPathSeparator(arg); colon >= 0 {
+		return revParseTreePath(c, opt, arg[:colon], arg[colon+1:])
+	}
+	return revParseSuffixes(c, opt, arg, hint)
+}
+
+// Returns the index of the colon separating a revision from a path in
+// arg, or -1 if there isn't one. Colons inside of braces, such as in
+// "HEAD@{10:00}" or "HEAD^{/fix: typo}", don't count.
+func revPathSeparator(arg string) int {
+	depth := 0
+	for i, c := range arg {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			if depth > 0 {
+				depth--
+			}
+		case ':':
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Parses the suffixes such as "~n", "^n" and "^{type}" at the end of name,
+// from right to left, and applies them to the object that the rest of
+// name refers to. The suffixes imply a type that abbreviated object names
+// must have, so hint is only used if there aren't any.
+func revParseSuffixes(c *Client, opt *RevParseOptions, name, hint string) (Sha1, error) {
+	if strings.HasSuffix(name, "}") {
+		if p := strings.LastIndex(name, "^{"); p >= 0 && strings.LastIndex(name, "@{") < p {
+			typ := name[p+2 : len(name)-1]
+			var basehint string
+			switch {
+			case typ == "commit" || strings.HasPrefix(typ, "/"):
+				basehint = "committish"
+			case typ == "tree":
+				basehint = "treeish"
+			case typ == "blob":
+				basehint = "blob"
+			}
+			base, err := revParseSuffixes(c, opt, name[:p], basehint)
+			if err != nil {
+				return Sha1{}, err
+			}
+			if strings.HasPrefix(typ, "/") {
+				// rev^{/regex} is the youngest commit reachable from
+				// rev whose message matches.
+				cmt, err := peelObject(c, base, "commit")
+				if err != nil {
+					return Sha1{}, err
+				}
+				found, err := searchCommitMessage(c, []CommitID{CommitID(cmt)}, typ[1:])
+				return Sha1(found), err
+			}
+			return peelObject(c, base, typ)
+		}
+	}
+
+	i := len(name)
+	for i > 0 && name[i-1] >= '0' && name[i-1] <= '9' {
+		i--
+	}
+	if i == 0 || (name[i-1] != '~' && name[i-1] != '^') {
+		return revParseBase(c, opt, name, hint)
+	}
+	op := name[i-1]
+	n := 1
+	if i < len(name) {
+		var err error
+		if n, err = strconv.Atoi(name[i:]); err != nil {
+			return Sha1{}, fmt.Errorf("Invalid revision: %s", name)
+		}
+	}
+	base, err := revParseSuffixes(c, opt, name[:i-1], "committish")
+	if err != nil {
+		return Sha1{}, err
+	}
+	id, err := peelObject(c, base, "commit")
+	if err != nil {
+		return Sha1{}, err
+	}
+	cmt := CommitID(id)
+
+	if op == '~' {
+		// rev~n is the nth generation ancestor, following only first
+		// parents.
+		for ; n > 0; n-- {
+			parents, err := cmt.Parents(c)
+			if err != nil {
+				return Sha1{}, err
+			}
+			if len(parents) == 0 {
+				return Sha1{}, fmt.Errorf("Invalid revision: %s", name)
+			}
+			cmt = parents[0]
+		}
+		return Sha1(cmt), nil
+	}
+
+	// rev^n is the nth parent, and rev^0 is the commit itself.
+	if n == 0 {
+		return Sha1(cmt), nil
+	}
+	parents, err := cmt.Parents(c)
+	if err != nil {
+		return Sha1{}, err
+	}
+	if n > len(parents) {
+		return Sha1{}, fmt.Errorf("Invalid revision: %s", name)
+	}
+	return Sha1(parents[n-1]), nil
+}
+
+// Resolves a revision name with no suffixes, such as a ref, an
+// abbreviated object name or a reflog entry.
+func revParseBase(c *Client, opt *RevParseOptions, name, hint string) (Sha1, error) {
+	if name == "@" {
+		name = "HEAD"
+	}
+	if at := strings.Index(name, "@{"); at >= 0 && strings.HasSuffix(name, "}") {
+		cmt, err := revParseReflog(c, opt, name[:at], name[at+2:len(name)-1])
+		if err != nil {
+			return Sha1{}, err
+		}
+		id, err := cmt.CommitID(c)
+		return Sha1(id), err
+	}
+	if len(name) == 40 {
+		if id, err := Sha1FromString(name); err == nil {
+			return id, nil
+		}
+	}
+	if ref, err := c.DwimRef(name); err == nil {
+		id, err := ref.CommitID(c)
+		return Sha1(id), err
+	}
+	if isHexPrefix(name) {
+		return c.resolveAbbrev(name, hint)
+	}
+	return Sha1{}, fmt.Errorf("Invalid revision: %s", name)
+}
+
+// Peels the object id until it's of type typ, following tags and from
+// commits to their trees. typ may also be "" to peel tags until a non-tag
+// is found, or "object" to only verify that id exists.
+func peelObject(c *Client, id Sha1, typ string) (Sha1, error) {
+	for {
+		t := id.Type(c)
+		switch {
+		case t == "":
+			return Sha1{}, fmt.Errorf("Object %s not found", id)
+		case typ == "object", t == typ:
+			return id, nil
+		case typ == "" && t != "tag":
+			return id, nil
+		case t == "tag":
+			obj, err := c.GetObject(id)
+			if err != nil {
+				return Sha1{}, err
+			}
+			if id, err = obj.(GitTagObject).GetObject(); err != nil {
+				return Sha1{}, err
+			}
+		case t == "commit" && typ == "tree":
+			tree, err := CommitID(id).TreeID(c)
+			return Sha1(tree), err
+		default:
+			switch typ {
+			case "commit", "tree", "blob", "tag":
+				return Sha1{}, fmt.Errorf("%s is a %s, not a %s", id, t, typ)
+			}
+			return Sha1{}, fmt.Errorf("Invalid object type: %s", typ)
+		}
+	}
+}
+
+// Returns the commits that every ref in c (and HEAD) point to, for
+// searching with ":/regex".
+func revParseAllRefs(c *Client) ([]CommitID, error) {
+	refs, err := c.GetRefs("refs/")
+	if err != nil {
+		return nil, err
+	}
+	var starts []CommitID
+	if head, err := SymbolicRef("HEAD").CommitID(c); err == nil {
+		starts = append(starts, head)
+	}
+	for _, ref := range refs {
+		id, err := ref.Peeled(c)
+		if err != nil || id.Type(c) != "commit" {
+			continue
+		}
+		starts = append(starts, CommitID(id))
+	}
+	return starts, nil
+}
+
+// Returns the youngest commit reachable from starts whose commit message
+// matches the regular expression pattern. A pattern starting with "!-"
+// matches commits that do not match the rest of the pattern, and "!!"
+// matches a literal "!".
+func searchCommitMessage(c *Client, starts []CommitID, pattern string) (CommitID, error) {
+	negate := false
+	if strings.HasPrefix(pattern, "!-") {
+		negate = true
+		pattern = pattern[2:]
+	} else if strings.HasPrefix(pattern, "!!") {
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, "!") {
+		return CommitID{}, fmt.Errorf("Invalid search pattern: %s", pattern)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return CommitID{}, err
+	}
+
+	// Like git, walk the history from newest to oldest by commit date
+	// and stop at the first match, which is the youngest one.
+	walker := NewCommitWalker(c)
+	for _, start := range starts {
+		if err := walker.Push(start); err != nil {
+			return CommitID{}, err
+		}
+	}
+	for walker.Next() {
+		msg, err := walker.Commit().GetCommitMessage(c)
+		if err != nil {
+			return CommitID{}, err
+		}
+		if re.MatchString(msg) != negate {
+			return walker.Commit(), nil
+		}
+	}
+	if err := walker.Err(); err != nil {
+		return CommitID{}, err
+	}
+	return CommitID{}, fmt.Errorf("No commit message matches %s", pattern)
+}
+
+// Converts a path given as part of a revision into a path relative to the
+// top of the work tree. Paths starting with "./" or "../" are relative
+// to the current directory, and any other paths are already relative to
+// the top of the tree.
+func revParsePath(c *Client, path string) (IndexPath, error) {
+	if path == "." || path == ".." || strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../") {
+		p, err := File(path).IndexPath(c)
+		if err != nil {
+			return "", err
+		}
+		if p == IndexPath(c.WorkDir) {
+			return "", nil
+		}
+		return p, nil
+	}
+	return IndexPath(strings.TrimSuffix(path, "/")), nil
+}
+
+// Resolves ":path" or ":n:path" to the blob at path in stage n of the
+// index.
+func revParseIndexPath(c *Client, arg string) (Sha1, error) {
+	stage := Stage0
+	if len(arg) >= 2 && arg[1] == ':' && arg[0] >= '0' && arg[0] <= '3' {
+		stage = Stage(arg[0] - '0')
+		arg = arg[2:]
+	}
+	path, err := revParsePath(c, arg)
+	if err != nil {
+		return Sha1{}, err
+	}
+	idx, err := c.GitDir.ReadIndex()
+	if err != nil {
+		return Sha1{}, err
+	}
+	entry, ok := idx.GetStageMap()[IndexStageEntry{path, stage}]
+	if !ok {
+		return Sha1{}, fmt.Errorf("path '%s' does not exist in the index at stage %d", path, stage)
+	}
+	return entry.Sha1, nil
+}
+
+// Resolves "rev:path" to the object at path in the tree of rev.
+func revParseTreePath(c *Client, opt *RevParseOptions, rev, arg string) (Sha1, error) {
+	base, err := revParseObject(c, opt, rev, "treeish")
+	if err != nil {
+		return Sha1{}, err
+	}
+	id, err := peelObject(c, base, "tree")
+	if err != nil {
+		return Sha1{}, err
+	}
+	path, err := revParsePath(c, arg)
+	if err != nil {
+		return Sha1{}, err
+	}
+	if path == "" {
+		return id, nil
+	}
+	for _, name := range strings.Split(string(path), "/") {
+		if id.Type(c) != "tree" {
+			return Sha1{}, fmt.Errorf("path '%s' does not exist in '%s'", path, rev)
+		}
+		entries, err := TreeID(id).GetAllObjects(c, "", false, false)
+		if err != nil {
+			return Sha1{}, err
+		}
+		entry, ok := entries[IndexPath(name)]
+		if !ok {
+			return Sha1{}, fmt.Errorf("path '%s' does not exist in '%s'", path, rev)
+		}
+		id = entry.Sha1
+	}
+	return id, nil
 }
 
 // RevParse will parse a single revision into a Commit object.
@@ -164,37 +599,363 @@ func RevParseCommit(c *Client, opt *RevParseOptions, arg string) (CommitID, erro
 // Implements "git rev-parse". This should be refactored in terms of RevParseCommit and cleaned up.
 // (clean up a lot.)
 func RevParse(c *Client, opt RevParseOptions, args []string) (commits []ParsedRevision, err2 error) {
+	if opt.Disambiguate != "" {
+		objects, err := Disambiguate(c, opt.Disambiguate)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range objects {
+			commits = append(commits, ParsedRevision{Id: id})
+		}
+	}
+
+	refs, err := revParseRefs(c, opt)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		name := ref.symbolic
+		if opt.SymbolicFullName || opt.AbbrefRev != "" {
+			name = ref.Name.String()
+			// Symbolic refs are shown as the ref they point to.
+			if target, err := SymbolicRefGet(c, SymbolicRefOptions{}, SymbolicRef(ref.Name)); err == nil {
+				name = target.String()
+			}
+			if opt.AbbrefRev != "" {
+				name = c.ShortenRef(RefSpec(name))
+			}
+		}
+		commits = append(commits, ParsedRevision{Id: ref.Value, Excluded: opt.Not, Name: name})
+	}
+
+	if len(args) == 0 && opt.Default != "" {
+		args = []string{opt.Default}
+	}
+	if opt.Verify && len(args) != 1 {
+		return nil, NeedSingleRevision
+	}
 	for _, arg := range args {
-		switch arg {
-		case "--git-dir":
-			wd, err := os.Getwd()
-			if err == nil {
-				fmt.Printf("%s\n", strings.TrimPrefix(c.GitDir.String(), wd+"/"))
-			} else {
-				fmt.Printf("%s\n", c.GitDir)
+		if arg == "" || (arg[0] == '-' && arg != "-") {
+			return nil, fmt.Errorf("Invalid revision: %s", arg)
+		}
+		name := arg
+		exclude := false
+		if arg[0] == '^' && !opt.Verify {
+			name = arg[1:]
+			exclude = true
+		}
+		id, err := RevParseObject(c, &opt, name)
+		if err != nil {
+			if opt.Verify {
+				return nil, NeedSingleRevision
 			}
-		default:
-			if len(arg) > 0 && arg[0] == '-' {
-				fmt.Printf("%s\n", arg)
-			} else {
-				var sha string
-				var exclude bool
-				var err error
-				if arg[0] == '^' {
-					sha = arg[1:]
-					exclude = true
-				} else {
-					sha = arg
-					exclude = false
-				}
-				cmt, err := RevParseCommit(c, &opt, sha)
-				if err != nil {
-					err2 = err
-				} else {
-					commits = append(commits, ParsedRevision{Sha1(cmt), exclude})
-				}
+			err2 = err
+			continue
+		}
+		rev := ParsedRevision{Id: id, Excluded: exclude != opt.Not}
+		switch {
+		case opt.SymbolicFullName, opt.AbbrefRev != "":
+			ref, ok := revParseRefName(c, &opt, name)
+			if !ok {
+				// Revisions which aren't refs don't have a
+				// canonical name, so they aren't included.
+				continue
 			}
+			rev.Name = ref.String()
+			if opt.AbbrefRev != "" {
+				rev.Name = c.ShortenRef(ref)
+			}
+		case opt.Symbolic:
+			rev.Name = name
 		}
+		commits = append(commits, rev)
 	}
 	return
 }
+
+// A ref listed by rev-parse, along with the name that --symbolic shows
+// for it.
+type revParseRef struct {
+	Ref
+	symbolic string
+}
+
+// Returns the refs listed by the All, Branches, Tags, Remotes and Glob
+// options.
+func revParseRefs(c *Client, opt RevParseOptions) ([]revParseRef, error) {
+	var refs []revParseRef
+	add := func(prefix string, pattern Pattern) error {
+		p := string(pattern)
+		if p != "" && !strings.ContainsAny(p, "*?[") {
+			p = strings.TrimSuffix(p, "/") + "/*"
+		}
+		all, err := c.GetRefs(prefix)
+		if err != nil {
+			return err
+		}
+		for _, ref := range all {
+			if p == "" || matchesWildcard(prefix+p, ref.Name.String()) {
+				// --branches, --tags and --remotes show the
+				// name relative to their namespace.
+				name := strings.TrimPrefix(ref.Name.String(), prefix)
+				if prefix == "refs/" {
+					name = ref.Name.String()
+				}
+				refs = append(refs, revParseRef{ref, name})
+			}
+		}
+		return nil
+	}
+	if opt.All {
+		if err := add("refs/", ""); err != nil {
+			return nil, err
+		}
+	}
+	for _, opt := range []struct {
+		prefix  string
+		pattern Pattern
+	}{
+		{"refs/heads/", opt.Branches},
+		{"refs/tags/", opt.Tags},
+		{"refs/remotes/", opt.Remotes},
+		{"", opt.Glob},
+	} {
+		if opt.pattern == "" {
+			continue
+		}
+		prefix, pattern := opt.prefix, opt.pattern
+		if prefix == "" {
+			prefix = "refs/"
+			pattern = Pattern(strings.TrimPrefix(string(pattern), "refs/"))
+		}
+		if err := add(prefix, pattern); err != nil {
+			return nil, err
+		}
+	}
+	if opt.Exclude != "" {
+		var included []revParseRef
+		for _, ref := range refs {
+			// The pattern is matched against the name that's
+			// shown, so it's relative to the namespace for
+			// --branches, --tags and --remotes.
+			if !matchesWildcard(string(opt.Exclude), ref.symbolic) {
+				included = append(included, ref)
+			}
+		}
+		refs = included
+	}
+	return refs, nil
+}
+
+// Returns the full name of the ref that arg refers to, following
+// symbolic refs such as HEAD. It returns false if arg isn't a ref, such
+// as for "HEAD~1".
+func revParseRefName(c *Client, opt *RevParseOptions, arg string) (RefSpec, bool) {
+	if arg == "@" {
+		arg = "HEAD"
+	}
+	if at := strings.Index(arg, "@{"); at >= 0 && strings.HasSuffix(arg, "}") {
+		// Only @{-n} and @{upstream} refer to refs.
+		cmt, err := revParseReflog(c, opt, arg[:at], arg[at+2:len(arg)-1])
+		if b, ok := cmt.(Branch); ok && err == nil {
+			return RefSpec(b), true
+		}
+		return "", false
+	}
+	ref, err := c.DwimRef(arg)
+	if err != nil {
+		return "", false
+	}
+	if target, err := SymbolicRefGet(c, SymbolicRefOptions{}, SymbolicRef(ref)); err == nil {
+		return target, true
+	}
+	return ref, true
+}
+
+// Returns true if dir looks like a git directory.
+func isGitDir(dir string) bool {
+	for _, f := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the paths in the git directory that are shared between all of
+// the working trees of a repository, and are stored in the common
+// directory.
+func isCommonPath(path string) bool {
+	switch path {
+	case "logs/HEAD", "info/sparse-checkout":
+		return false
+	}
+	for _, dir := range []string{"branches", "hooks", "info", "logs", "lost-found", "objects", "refs", "remotes", "rr-cache", "svn", "worktrees"} {
+		if path == dir || strings.HasPrefix(path, dir+"/") {
+			return true
+		}
+	}
+	switch path {
+	case "config", "packed-refs", "shallow", "description", "common":
+		return true
+	}
+	return false
+}
+
+// Returns the common directory of the repository, which is different
+// from the git directory for linked working trees.
+func (c *Client) commonDir() (string, error) {
+	gitdir, err := filepath.Abs(c.GitDir.String())
+	if err != nil {
+		return "", err
+	}
+	common, err := ioutil.ReadFile(filepath.Join(gitdir, "commondir"))
+	if err != nil {
+		return gitdir, nil
+	}
+	dir := strings.TrimSpace(string(common))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(gitdir, dir)
+	}
+	return filepath.Clean(dir), nil
+}
+
+// Returns true if path is dir or inside of it.
+func pathInside(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// RevParseFiles returns the output of the "Options for Files" that are
+// set in opt, such as GitDir or ShowToplevel. There's a line of output
+// for each option that's set, in the order that they're declared in
+// RevParseOptions, except for ShowCDup outside of a working tree, which
+// doesn't have any output. Paths are relative to the current directory
+// when git would show them that way.
+func RevParseFiles(c *Client, opt RevParseOptions) ([]string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	gitdir, err := filepath.Abs(c.GitDir.String())
+	if err != nil {
+		return nil, err
+	}
+	var workdir string
+	if c.WorkDir != "" {
+		if workdir, err = filepath.Abs(c.WorkDir.String()); err != nil {
+			return nil, err
+		}
+	}
+	insideGitDir := pathInside(cwd, gitdir)
+	insideWorkTree := workdir != "" && pathInside(cwd, workdir) && !insideGitDir
+
+	// Returns path relative to the current directory if it's inside of
+	// the working tree or the current directory is the git directory,
+	// and otherwise the absolute path.
+	relative := func(path string) string {
+		if insideWorkTree || cwd == gitdir {
+			if rel, err := filepath.Rel(cwd, path); err == nil {
+				return rel
+			}
+		}
+		return path
+	}
+
+	var lines []string
+	if opt.GitDir {
+		// The git dir is only shown as a relative path if it's
+		// inside the current directory.
+		if rel, err := filepath.Rel(cwd, gitdir); err == nil && !strings.HasPrefix(rel, "..") {
+			lines = append(lines, rel)
+		} else {
+			lines = append(lines, gitdir)
+		}
+	}
+	if opt.AbsoluteGitDir {
+		lines = append(lines, gitdir)
+	}
+	if opt.GitCommonDir {
+		common, err := c.commonDir()
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, relative(common))
+	}
+	if opt.IsInsideGitDir {
+		lines = append(lines, strconv.FormatBool(insideGitDir))
+	}
+	if opt.IsInsideWorkTree {
+		lines = append(lines, strconv.FormatBool(insideWorkTree))
+	}
+	if opt.IsBareRepository {
+		lines = append(lines, strconv.FormatBool(c.WorkDir == ""))
+	}
+	if opt.ResolveGitDir != "" {
+		dir, err := resolveGitDir(opt.ResolveGitDir)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, dir)
+	}
+	if opt.GitPath != "" {
+		path := filepath.ToSlash(filepath.Clean(opt.GitPath.String()))
+		base := gitdir
+		if isCommonPath(path) {
+			if base, err = c.commonDir(); err != nil {
+				return nil, err
+			}
+		}
+		lines = append(lines, relative(filepath.Join(base, path)))
+	}
+	if opt.ShowCDup && insideWorkTree {
+		rel, err := filepath.Rel(cwd, workdir)
+		if err != nil {
+			return nil, err
+		}
+		if rel == "." {
+			rel = ""
+		} else {
+			rel += "/"
+		}
+		lines = append(lines, rel)
+	}
+	if opt.ShowPrefix {
+		prefix := ""
+		if insideWorkTree {
+			rel, err := filepath.Rel(workdir, cwd)
+			if err != nil {
+				return nil, err
+			}
+			if rel != "." {
+				prefix = rel + "/"
+			}
+		}
+		lines = append(lines, prefix)
+	}
+	if opt.ShowToplevel {
+		if !insideWorkTree {
+			return nil, fmt.Errorf("fatal: this operation must be run in a work tree")
+		}
+		lines = append(lines, workdir)
+	}
+	return lines, nil
+}
+
+// Returns the git directory that path refers to, which may either be a
+// git directory or a ".git" file pointing to one.
+func resolveGitDir(path File) (string, error) {
+	p := path.String()
+	if isGitDir(p) {
+		return p, nil
+	}
+	if content, err := ioutil.ReadFile(p); err == nil && strings.HasPrefix(string(content), "gitdir: ") {
+		dir := strings.TrimSpace(strings.TrimPrefix(string(content), "gitdir: "))
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(p), dir)
+		}
+		if isGitDir(dir) {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("not a gitdir '%s'", path)
+}
@@ -0,0 +1,309 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRevPathSeparator(t *testing.T) {
+	tests := []struct {
+		Arg  string
+		Want int
+	}{
+		{"HEAD", -1},
+		{"HEAD:README", 4},
+		{"HEAD~2:dir/file", 6},
+		{"HEAD@{10:00}", -1},
+		{"master@{10:00}:file", 14},
+		{"HEAD^{/fix: typo}", -1},
+		{"HEAD^{/fix: typo}:a:b", 17},
+		{"HEAD:", 4},
+	}
+	for i, tc := range tests {
+		if got := revPathSeparator(tc.Arg); got != tc.Want {
+			t.Errorf("tc %d: got %v want %v", i, got, tc.Want)
+		}
+	}
+}
+
+func TestRevParseParseOpt(t *testing.T) {
+	const spec = `cmd [options]
+--
+a,all      all
+b=         bee
+keep!      keep it
+o,out?     out
+no-thing   not a thing
+`
+	tests := []struct {
+		Opts RevParseOptions
+		Args []string
+		Want string
+	}{
+		{RevParseOptions{}, []string{"-a", "x"}, "set -- -a -- 'x'"},
+		{RevParseOptions{}, []string{"-ab3", "--out"}, "set -- -a -b '3' -o --"},
+		{RevParseOptions{}, []string{"--al", "-b", "it's"}, `set -- -a -b 'it'\''s' --`},
+		{RevParseOptions{}, []string{"--no-all", "--thing"}, "set -- --no-all --no-no-thing --"},
+		{RevParseOptions{}, []string{"-o", "x", "--", "-a"}, "set -- -o -- 'x' '-a'"},
+		{RevParseOptions{StuckLong: true}, []string{"-b", "x", "-oy", "--out"}, "set -- -b'x' --out='y' --out --"},
+		{RevParseOptions{KeepDashDash: true}, []string{"-a", "--", "x"}, "set -- -a -- '--' 'x'"},
+		{RevParseOptions{StopAtNonOption: true}, []string{"x", "-a"}, "set -- -- 'x' '-a'"},
+	}
+	for i, tc := range tests {
+		got, err := RevParseParseOpt(tc.Opts, strings.NewReader(spec), tc.Args)
+		if err != nil {
+			t.Errorf("tc %d: unexpected error: %v", i, err)
+			continue
+		}
+		if got != tc.Want {
+			t.Errorf("tc %d: got %v want %v", i, got, tc.Want)
+		}
+	}
+
+	errors := []struct {
+		Args []string
+		Want string
+		Help bool
+	}{
+		{[]string{"--no-keep"}, "unknown option `no-keep'", false},
+		{[]string{"-z"}, "unknown switch `z'", false},
+		{[]string{"--all=3"}, "option `all' takes no value", false},
+		{[]string{"-b"}, "switch `b' requires a value", false},
+		{[]string{"--no-"}, "ambiguous option: no- (could be --no-out or --no-thing)", true},
+	}
+	for i, tc := range errors {
+		_, err := RevParseParseOpt(RevParseOptions{}, strings.NewReader(spec), tc.Args)
+		perr, ok := err.(ParseOptError)
+		if !ok {
+			t.Errorf("tc %d: got %v want a ParseOptError", i, err)
+			continue
+		}
+		if perr.Error() != tc.Want || perr.Help != tc.Help {
+			t.Errorf("tc %d: got %v (help %v) want %v (help %v)", i, perr, perr.Help, tc.Want, tc.Help)
+		}
+	}
+}
+
+func TestSQQuote(t *testing.T) {
+	if got, want := SQQuote([]string{"a b", "it's", "!"}), ` 'a b' 'it'\''s' ''\!''`; got != want {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
+
+func TestRevParseObject(t *testing.T) {
+	r := newTestRepo(t)
+	defer r.Close()
+	r.writeFile("HEAD", "ref: refs/heads/master\n")
+	blobs := r.setFiles(map[string]string{"a.txt": "one\n", "dir/b.txt": "two\n", "z.txt": "three\n"})
+	r.mergeHistory()
+	r.setRef("refs/heads/master", "F")
+	tree := r.tree
+	dir, err := RevParseObject(r.Client, &RevParseOptions{}, r.commits["F"].String()+":dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The index is changed after the last commit, so that ":path"
+	// differs from "HEAD:path".
+	staged := r.setFiles(map[string]string{"a.txt": "changed\n", "dir/b.txt": "two\n", "z.txt": "three\n"})
+
+	tag, err := r.WriteObject("tag", []byte(fmt.Sprintf("object %s\ntype commit\ntag v1\ntagger T <t@x> 300 +0000\n\nv1\n", r.commits["C"])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.writeFile("refs/tags/v1", tag.String()+"\n")
+	r.writeFile("logs/refs/heads/master", fmt.Sprintf(
+		"%s %s T <t@x> 100 +0000\tcommit (initial): A\n"+
+			"%s %s T <t@x> 400 +0000\tmerge C\n"+
+			"%s %s T <t@x> 500 +0000\tcommit: F\n",
+		Sha1{}, r.commits["A"], r.commits["A"], r.commits["E"], r.commits["E"], r.commits["F"]))
+
+	commit := func(name string) Sha1 { return Sha1(r.commits[name]) }
+	tests := []struct {
+		Arg  string
+		Want Sha1
+	}{
+		{"HEAD", commit("F")},
+		{"@", commit("F")},
+		{"master~", commit("E")},
+		{"master~2", commit("D")},
+		{"master~3", commit("A")},
+		{"master^", commit("E")},
+		{"master^^2", commit("C")},
+		{"master~1^2~1", commit("B")},
+		{"master^0", commit("F")},
+		{"v1", tag},
+		{"v1^{tag}", tag},
+		{"v1^{}", commit("C")},
+		{"v1^{commit}", commit("C")},
+		{"v1^{tree}", tree},
+		{"v1~2", commit("A")},
+		{"@{1}", commit("E")},
+		{"master@{0}", commit("F")},
+		{"master@{2}", commit("A")},
+		{"master@{1}^2", commit("C")},
+		{"HEAD:a.txt", blobs["a.txt"]},
+		{"v1:dir", dir},
+		{"master@{2}:dir/b.txt", blobs["dir/b.txt"]},
+		{":a.txt", staged["a.txt"]},
+		{":0:dir/b.txt", staged["dir/b.txt"]},
+		{":/^[BD]", commit("D")},
+		{":/!-^[EF]", commit("C")},
+		{"master^{/^[BC]}", commit("C")},
+		{"master~^2^{/^[AD]}", commit("A")},
+	}
+	for i, tc := range tests {
+		got, err := RevParseObject(r.Client, &RevParseOptions{}, tc.Arg)
+		if err != nil {
+			t.Errorf("tc %d: %v: %v", i, tc.Arg, err)
+			continue
+		}
+		if got != tc.Want {
+			t.Errorf("tc %d: %v: got %v want %v", i, tc.Arg, got, tc.Want)
+		}
+	}
+
+	for i, arg := range []string{"master~4", "master~^3", "v1^{blob}", "master@{3}", "HEAD:nofile", ":nofile", ":/nomatch", "master^{/nomatch}", "nobranch", "master^2^{/A}"} {
+		if got, err := RevParseObject(r.Client, &RevParseOptions{}, arg); err == nil {
+			t.Errorf("tc %d: %v: got %v want an error", i, arg, got)
+		}
+	}
+
+	ranges := []struct {
+		Revs []string
+		Want string
+	}{
+		{[]string{"master~2..master"}, "F E C B"},
+		{[]string{"master~^2..master"}, "F E D"},
+		{[]string{"master", "^v1"}, "F E D"},
+		{[]string{"v1...master~2"}, "C D B"},
+		{[]string{"@{2}..@{1}"}, "E C D B"},
+	}
+	for i, tc := range ranges {
+		entries, err := RevList(r.Client, RevListOptions{}, tc.Revs)
+		if err != nil {
+			t.Errorf("range %d: %v", i, err)
+			continue
+		}
+		ids := make([]CommitID, len(entries))
+		for j, e := range entries {
+			ids[j] = CommitID(e.Id)
+		}
+		if got := r.nameList(ids); got != tc.Want {
+			t.Errorf("range %d: %v: got %v want %v", i, tc.Revs, got, tc.Want)
+		}
+	}
+}
+
+func TestRevParseFiles(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gittest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	// The working directory has symlinks resolved, so the expected
+	// paths need to as well.
+	if tmp, err = filepath.EvalSymlinks(tmp); err != nil {
+		t.Fatal(err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+
+	workgit := filepath.Join(tmp, "w", ".git")
+	bare := filepath.Join(tmp, "b.git")
+	for _, dir := range []string{workgit, bare} {
+		for _, sub := range []string{"objects", "refs"} {
+			if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "HEAD"), []byte("ref: refs/heads/master\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(bare, "config"), []byte("[core]\n\tbare = true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(tmp, "w", "sub", "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := RevParseOptions{
+		GitDir:           true,
+		AbsoluteGitDir:   true,
+		GitCommonDir:     true,
+		IsInsideGitDir:   true,
+		IsInsideWorkTree: true,
+		IsBareRepository: true,
+		GitPath:          "objects",
+		ShowCDup:         true,
+		ShowPrefix:       true,
+	}
+	tests := []struct {
+		GitDir   string
+		Dir      string
+		Want     []string
+		Toplevel string
+	}{
+		{
+			workgit, "w",
+			[]string{".git", workgit, ".git", "false", "true", "false", ".git/objects", "", ""},
+			filepath.Join(tmp, "w"),
+		},
+		{
+			workgit, "w/sub/dir",
+			[]string{workgit, workgit, "../../.git", "false", "true", "false", "../../.git/objects", "../../", "sub/dir/"},
+			filepath.Join(tmp, "w"),
+		},
+		{
+			workgit, "w/.git",
+			[]string{".", workgit, ".", "true", "false", "false", "objects", ""},
+			"",
+		},
+		{
+			workgit, "w/.git/refs",
+			[]string{workgit, workgit, workgit, "true", "false", "false", filepath.Join(workgit, "objects"), ""},
+			"",
+		},
+		{
+			bare, "b.git",
+			[]string{".", bare, ".", "true", "false", "true", "objects", ""},
+			"",
+		},
+		{
+			bare, "b.git/refs",
+			[]string{bare, bare, bare, "true", "false", "true", filepath.Join(bare, "objects"), ""},
+			"",
+		},
+	}
+	for i, tc := range tests {
+		c, err := NewClient(tc.GitDir, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chdir(filepath.Join(tmp, tc.Dir)); err != nil {
+			t.Fatal(err)
+		}
+		got, err := RevParseFiles(c, opts)
+		if err != nil {
+			t.Errorf("tc %d: %v: %v", i, tc.Dir, err)
+		} else if strings.Join(got, "\n") != strings.Join(tc.Want, "\n") {
+			t.Errorf("tc %d: %v: got %q want %q", i, tc.Dir, got, tc.Want)
+		}
+
+		top, err := RevParseFiles(c, RevParseOptions{ShowToplevel: true})
+		if tc.Toplevel == "" {
+			if err == nil {
+				t.Errorf("tc %d: %v: got toplevel %v want an error outside of the work tree", i, tc.Dir, top)
+			}
+		} else if err != nil || len(top) != 1 || top[0] != tc.Toplevel {
+			t.Errorf("tc %d: %v: got toplevel %v (%v) want %v", i, tc.Dir, top, err, tc.Toplevel)
+		}
+	}
+}
@@ -0,0 +1,999 @@
+package git
+
+import (
+	"container/heap"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WalkOptions represents the options which limit and order the commits
+// found when walking history. They're shared by the commands which take
+// revision ranges, such as rev-list and log.
+type WalkOptions struct {
+	// If positive, the maximum number of commits to return. If
+	// negative, no commits are returned.
+	MaxCount int
+
+	// The number of commits to skip before returning any.
+	Skip int
+
+	// Only return commits with a commit date after Since or before
+	// Until, if they're not zero.
+	Since, Until time.Time
+
+	// Only return commits where the author or committer identity
+	// ("Name <email>") matches any of the patterns.
+	Author, Committer []string
+
+	// Only return commits where the commit message matches any of the
+	// patterns, or all of them with AllMatch.
+	Grep     []string
+	AllMatch bool
+
+	// Match the Author, Committer and Grep patterns case insensitively.
+	IgnoreCase bool
+
+	// Treat the patterns as extended regular expressions instead of
+	// basic ones.
+	ExtendedRegexp bool
+
+	// Only return merge commits, or only return non-merge commits.
+	Merges, NoMerges bool
+
+	// Only follow the first parent of merge commits.
+	FirstParent bool
+
+	// Never return a commit before all of its children. With DateOrder,
+	// commits are otherwise in commit date order, and with TopoOrder,
+	// lines of history aren't intermixed.
+	TopoOrder, DateOrder bool
+
+	// Return the commits from oldest to newest, after applying
+	// MaxCount and Skip.
+	Reverse bool
+
+	// Only return commits which modify one of the paths, simplifying
+	// the history like git's default mode.
+	Paths []IndexPath
+
+	// Rewrite the parents of commits which are returned so that they
+	// skip over the commits that aren't, as is needed when showing the
+	// parents or children of commits in a path limited walk.
+	RewriteParents bool
+}
+
+// Flags that are set on commits while walking history.
+type walkFlags uint
+
+const (
+	// The commit is reachable from an excluded revision, so it
+	// shouldn't be included in the output.
+	uninteresting walkFlags = 1 << iota
+
+	// The commit was explicitly excluded by the revisions, rather than
+	// being an ancestor of one that was.
+	bottom
+
+	// The commit has been added to the queue.
+	seen
+
+	// The commit is reachable from the left side of a symmetric
+	// difference (A in A...B).
+	symmetricLeft
+
+	// The commit is reachable from the right side of a symmetric
+	// difference (B in A...B).
+	symmetricRight
+
+	// The commit has been included in the output.
+	shown
+
+	// A child of the commit has been included in the output.
+	childShown
+
+	// The commit doesn't modify any of the paths that the walk is
+	// limited to, compared to one of its parents.
+	treesame
+
+	// Flags used while painting history down to the common ancestors
+	// of commits.
+	parent1
+	parent2
+	stale
+	result
+	inQueue
+)
+
+// The information about a commit that's needed to walk history.
+type walkCommit struct {
+	Id      CommitID
+	Tree    TreeID
+	Parents []CommitID
+
+	// The committer time, as seconds since the epoch.
+	Date int64
+}
+
+// A revWalker walks the history of a repository, keeping track of
+// flags for each commit it encounters.
+type revWalker struct {
+	c       *Client
+	commits map[CommitID]*walkCommit
+	flags   map[CommitID]walkFlags
+
+	// Options which change how history is walked, set from the
+	// WalkOptions.
+	firstParent bool
+	maxAge      int64
+	paths       []IndexPath
+
+	// The tags, trees and blobs that were given in the revisions, which
+	// are listed or excluded when listing objects.
+	pending  []pendingObject
+	excluded []Sha1
+
+	// The entries at each of paths in the trees which have been
+	// compared while simplifying history.
+	pathObjects map[TreeID][]TreeEntry
+}
+
+func newRevWalker(c *Client) *revWalker {
+	return &revWalker{
+		c:       c,
+		commits: make(map[CommitID]*walkCommit),
+		flags:   make(map[CommitID]walkFlags),
+	}
+}
+
+// Returns the parsed commit id, reading it from the object database the
+// first time that it's requested.
+func (w *revWalker) parse(id CommitID) (*walkCommit, error) {
+	if cmt, ok := w.commits[id]; ok {
+		return cmt, nil
+	}
+	headers, _, err := id.getHeaders(w.c)
+	if err != nil {
+		return nil, err
+	}
+	cmt := &walkCommit{Id: id}
+	for _, h := range headers {
+		switch h.Name {
+		case "parent":
+			p, err := CommitIDFromString(h.Value)
+			if err != nil {
+				return nil, err
+			}
+			cmt.Parents = append(cmt.Parents, p)
+		case "tree":
+			t, err := Sha1FromString(h.Value)
+			if err != nil {
+				return nil, err
+			}
+			cmt.Tree = TreeID(t)
+		case "committer":
+			if committer, err := parsePerson(h.Value); err == nil && committer.Time != nil {
+				cmt.Date = committer.Time.Unix()
+			}
+		}
+	}
+	w.commits[id] = cmt
+	return cmt, nil
+}
+
+// A commitQueue is a priority queue of commits, ordered from newest to
+// oldest by commit date. Commits with the same date are returned in the
+// order that they were added.
+type commitQueue struct {
+	items []*walkCommit
+	order []uint64
+	next  uint64
+}
+
+func (q *commitQueue) Len() int { return len(q.items) }
+func (q *commitQueue) Less(i, j int) bool {
+	if q.items[i].Date != q.items[j].Date {
+		return q.items[i].Date > q.items[j].Date
+	}
+	return q.order[i] < q.order[j]
+}
+func (q *commitQueue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+	q.order[i], q.order[j] = q.order[j], q.order[i]
+}
+func (q *commitQueue) Push(x interface{}) {
+	q.items = append(q.items, x.(*walkCommit))
+	q.order = append(q.order, q.next)
+	q.next++
+}
+func (q *commitQueue) Pop() interface{} {
+	n := len(q.items) - 1
+	item := q.items[n]
+	q.items, q.order = q.items[:n], q.order[:n]
+	return item
+}
+
+func (q *commitQueue) push(cmt *walkCommit) { heap.Push(q, cmt) }
+func (q *commitQueue) pop() *walkCommit     { return heap.Pop(q).(*walkCommit) }
+func (q *commitQueue) peek() *walkCommit    { return q.items[0] }
+
+// Marks all the ancestors of cmt which have already been encountered as
+// uninteresting.
+func (w *revWalker) markParentsUninteresting(cmt *walkCommit) {
+	stack := append([]CommitID(nil), cmt.Parents...)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if w.flags[id]&uninteresting != 0 {
+			continue
+		}
+		w.flags[id] |= uninteresting
+		// Commits that haven't been parsed yet will be marked when
+		// they're reached by the walk.
+		if p, ok := w.commits[id]; ok {
+			stack = append(stack, p.Parents...)
+		}
+	}
+}
+
+// Adds the parents of cmt to the queue, propagating its flags.
+func (w *revWalker) processParents(cmt *walkCommit, queue *commitQueue) error {
+	if w.flags[cmt.Id]&uninteresting != 0 {
+		for _, pid := range cmt.Parents {
+			w.flags[pid] |= uninteresting
+			p, err := w.parse(pid)
+			if err != nil {
+				return err
+			}
+			w.markParentsUninteresting(p)
+			if w.flags[pid]&seen == 0 {
+				w.flags[pid] |= seen
+				queue.push(p)
+			}
+		}
+		return nil
+	}
+	if err := w.simplify(cmt); err != nil {
+		return err
+	}
+	sides := w.flags[cmt.Id] & (symmetricLeft | symmetricRight)
+	for _, pid := range cmt.Parents {
+		p, err := w.parse(pid)
+		if err != nil {
+			return err
+		}
+		w.flags[pid] |= sides
+		w.markIfCommon(p)
+		if w.flags[pid]&seen == 0 {
+			w.flags[pid] |= seen
+			queue.push(p)
+		}
+		if w.firstParent {
+			break
+		}
+	}
+	return nil
+}
+
+// Marks cmt as uninteresting if it's reachable from both sides of a
+// symmetric difference. A...B excludes the commits that A and B have in
+// common, which are the merge bases of A and B and their ancestors. Like
+// the merge bases, the first commits found in common are kept as bottom
+// commits.
+func (w *revWalker) markIfCommon(cmt *walkCommit) {
+	const both = symmetricLeft | symmetricRight
+	if w.flags[cmt.Id]&(both|uninteresting) != both {
+		return
+	}
+	w.flags[cmt.Id] |= uninteresting | bottom
+	w.markParentsUninteresting(cmt)
+}
+
+// The number of extra commits to walk after every commit in the queue is
+// uninteresting, in case of clock skew.
+const walkSlop = 5
+
+// Returns true if the walk should carry on after reaching the
+// uninteresting commit cmt. Once every commit in the queue is
+// uninteresting, a few more commits are walked in case the commit dates
+// are skewed, and slop keeps track of how many are left.
+func (w *revWalker) stillInteresting(cmt *walkCommit, queue *commitQueue, slop *int) bool {
+	switch {
+	case queue.Len() == 0:
+		*slop = 0
+	case cmt.Date <= queue.peek().Date, w.anyInteresting(queue):
+		*slop = walkSlop
+	default:
+		*slop--
+	}
+	return *slop > 0
+}
+
+// Returns true if there's a commit in the queue that isn't
+// uninteresting.
+func (w *revWalker) anyInteresting(queue *commitQueue) bool {
+	for _, cmt := range queue.items {
+		if w.flags[cmt.Id]&uninteresting == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Walks the history from tips (which must already have their flags set)
+// until only uninteresting commits remain, and returns the interesting
+// commits from newest to oldest.
+func (w *revWalker) limit(tips []CommitID) ([]*walkCommit, error) {
+	queue := &commitQueue{}
+	for _, id := range tips {
+		cmt, err := w.parse(id)
+		if err != nil {
+			return nil, err
+		}
+		w.markIfCommon(cmt)
+		if w.flags[id]&seen != 0 {
+			continue
+		}
+		w.flags[id] |= seen
+		queue.push(cmt)
+	}
+
+	var walked []*walkCommit
+	slop := walkSlop
+	for queue.Len() > 0 {
+		cmt := queue.pop()
+		if w.maxAge != 0 && cmt.Date < w.maxAge {
+			w.flags[cmt.Id] |= uninteresting
+		}
+		if err := w.processParents(cmt, queue); err != nil {
+			return nil, err
+		}
+		if w.flags[cmt.Id]&uninteresting != 0 {
+			w.markParentsUninteresting(cmt)
+			if w.stillInteresting(cmt, queue, &slop) {
+				continue
+			}
+			break
+		}
+		walked = append(walked, cmt)
+	}
+
+	// Commits may have been marked uninteresting after they were
+	// walked, so filter them out now.
+	var commits []*walkCommit
+	for _, cmt := range walked {
+		if w.flags[cmt.Id]&uninteresting == 0 {
+			commits = append(commits, cmt)
+		}
+	}
+	return commits, nil
+}
+
+// A CommitWalker iterates over the history of a repository, from newest
+// to oldest by commit date. Commits are only read from the object database
+// once they're reached, so callers that stop early don't pay for the rest
+// of the history.
+type CommitWalker struct {
+	w     *revWalker
+	queue commitQueue
+	slop  int
+	cur   *walkCommit
+	err   error
+}
+
+// NewCommitWalker returns a CommitWalker which walks the history of the
+// repository that c refers to. Start points are added with Push.
+func NewCommitWalker(c *Client) *CommitWalker {
+	return &CommitWalker{w: newRevWalker(c), slop: walkSlop}
+}
+
+// Adds the commit that cmt refers to as a starting point of the walk.
+func (cw *CommitWalker) Push(cmt Commitish) error {
+	return cw.add(cmt, 0)
+}
+
+// Hides the commit that cmt refers to and all of its ancestors from the
+// walk. The walk finishes shortly after every commit left is hidden, but
+// if commit dates are skewed a commit may be returned before it's known
+// to be reachable from a hidden one.
+func (cw *CommitWalker) Hide(cmt Commitish) error {
+	return cw.add(cmt, uninteresting|bottom)
+}
+
+func (cw *CommitWalker) add(cmt Commitish, f walkFlags) error {
+	id, err := cmt.CommitID(cw.w.c)
+	if err != nil {
+		return err
+	}
+	parsed, err := cw.w.parse(id)
+	if err != nil {
+		return err
+	}
+	cw.w.flags[id] |= f
+	if f&uninteresting != 0 {
+		cw.w.markParentsUninteresting(parsed)
+	}
+	if cw.w.flags[id]&seen == 0 {
+		cw.w.flags[id] |= seen
+		cw.queue.push(parsed)
+	}
+	return nil
+}
+
+// Advances the walk to the next commit, and returns true if there is one.
+// It returns false once the walk is finished or an error was encountered.
+func (cw *CommitWalker) Next() bool {
+	for cw.err == nil && cw.queue.Len() > 0 {
+		cmt := cw.queue.pop()
+		if err := cw.w.processParents(cmt, &cw.queue); err != nil {
+			cw.err = err
+			break
+		}
+		if cw.w.flags[cmt.Id]&uninteresting != 0 {
+			cw.w.markParentsUninteresting(cmt)
+			if !cw.w.stillInteresting(cmt, &cw.queue, &cw.slop) {
+				// Everything left is hidden.
+				cw.queue = commitQueue{}
+			}
+			continue
+		}
+		cw.cur = cmt
+		return true
+	}
+	cw.cur = nil
+	return false
+}
+
+// Returns the commit that the last call to Next advanced to.
+func (cw *CommitWalker) Commit() CommitID {
+	if cw.cur == nil {
+		return CommitID{}
+	}
+	return cw.cur.Id
+}
+
+// Returns the parents of the commit that the last call to Next advanced
+// to.
+func (cw *CommitWalker) Parents() []CommitID {
+	if cw.cur == nil {
+		return nil
+	}
+	return cw.cur.Parents
+}
+
+// Returns the error which stopped the walk, if any.
+func (cw *CommitWalker) Err() error {
+	return cw.err
+}
+
+// Paints the history of one and others down to their common ancestors,
+// the same way that git does when finding merge bases. Commits reachable
+// from one are painted with parent1 and commits reachable from any of
+// others with parent2. Common ancestors are painted stale, along with
+// their ancestors, and the walk finishes when only stale commits are
+// left. It returns the common ancestors which weren't found to be stale,
+// in the order that they were found.
+func (w *revWalker) paintDownToCommon(one CommitID, others []CommitID) ([]CommitID, error) {
+	for _, o := range others {
+		if o == one {
+			return []CommitID{one}, nil
+		}
+	}
+
+	queue := &commitQueue{}
+	// The number of commits in the queue which aren't stale.
+	nonStale := 0
+	var painted []CommitID
+	defer func() {
+		for _, id := range painted {
+			w.flags[id] &^= parent1 | parent2 | stale | result | inQueue
+		}
+	}()
+	paint := func(id CommitID, f walkFlags) error {
+		cmt, err := w.parse(id)
+		if err != nil {
+			return err
+		}
+		old := w.flags[id]
+		if old&(parent1|parent2|stale|result|inQueue) == 0 {
+			painted = append(painted, id)
+		}
+		w.flags[id] |= f
+		switch {
+		case old&inQueue == 0:
+			// The new flags need to be passed on to the
+			// parents, even if the commit was already walked.
+			w.flags[id] |= inQueue
+			queue.push(cmt)
+			if w.flags[id]&stale == 0 {
+				nonStale++
+			}
+		case old&stale == 0 && f&stale != 0:
+			nonStale--
+		}
+		return nil
+	}
+
+	if err := paint(one, parent1); err != nil {
+		return nil, err
+	}
+	for _, o := range others {
+		if err := paint(o, parent2); err != nil {
+			return nil, err
+		}
+	}
+
+	var common []CommitID
+	for nonStale > 0 {
+		cmt := queue.pop()
+		w.flags[cmt.Id] &^= inQueue
+		f := w.flags[cmt.Id] & (parent1 | parent2 | stale)
+		if f&stale == 0 {
+			nonStale--
+		}
+		if f == parent1|parent2 {
+			if w.flags[cmt.Id]&result == 0 {
+				w.flags[cmt.Id] |= result
+				common = append(common, cmt.Id)
+			}
+			f |= stale
+		}
+		for _, pid := range cmt.Parents {
+			if w.flags[pid]&f == f {
+				continue
+			}
+			if err := paint(pid, f); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var found []CommitID
+	for _, cmt := range common {
+		if w.flags[cmt]&stale == 0 {
+			found = append(found, cmt)
+		}
+	}
+	return found, nil
+}
+
+// Returns true if ancestor is reachable from descendant. If it is, it's
+// the only common ancestor of the two which isn't an ancestor of another.
+func (w *revWalker) isAncestor(ancestor, descendant CommitID) (bool, error) {
+	common, err := w.paintDownToCommon(ancestor, []CommitID{descendant})
+	if err != nil {
+		return false, err
+	}
+	for _, cmt := range common {
+		if cmt == ancestor {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Returns the best common ancestors of one and any of others, the same
+// way that git does, from newest to oldest. No commit in the result is an
+// ancestor of another.
+func (w *revWalker) mergeBases(one CommitID, others []CommitID) ([]CommitID, error) {
+	bases, err := w.paintDownToCommon(one, others)
+	if err != nil {
+		return nil, err
+	}
+	if len(bases) <= 1 {
+		return bases, nil
+	}
+	// A common ancestor can be found before it's known to be reachable
+	// from another one.
+	if bases, err = w.removeRedundant(bases); err != nil {
+		return nil, err
+	}
+	// All the bases have been parsed by the walk.
+	sort.SliceStable(bases, func(i, j int) bool {
+		return w.commits[bases[i]].Date > w.commits[bases[j]].Date
+	})
+	return bases, nil
+}
+
+// Removes the commits from commits which are ancestors of other commits
+// in the list.
+func (w *revWalker) removeRedundant(commits []CommitID) ([]CommitID, error) {
+	var independent []CommitID
+	for i, cmt := range commits {
+		redundant := false
+		for j, other := range commits {
+			if i == j || other == cmt {
+				continue
+			}
+			is, err := w.isAncestor(cmt, other)
+			if err != nil {
+				return nil, err
+			}
+			if is {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			independent = append(independent, cmt)
+		}
+	}
+	return independent, nil
+}
+
+// Sorts commits so that no commit comes before any of its children,
+// like git's --topo-order. Otherwise, commits stay in the order that
+// they're given, and the parents of a commit are shown as soon as all of
+// their children are, unless byDate is set, in which case commits are
+// kept in commit date order as much as possible, like --date-order.
+func (w *revWalker) topoSort(commits []*walkCommit, byDate bool) []*walkCommit {
+	indegree := make(map[CommitID]int, len(commits))
+	byId := make(map[CommitID]*walkCommit, len(commits))
+	for _, cmt := range commits {
+		indegree[cmt.Id] = 1
+		byId[cmt.Id] = cmt
+	}
+	for _, cmt := range commits {
+		for _, p := range cmt.Parents {
+			if indegree[p] > 0 {
+				indegree[p]++
+			}
+		}
+	}
+
+	// Commits that are ready to be output. In graph order, this is a
+	// stack, so that lines of history are kept together.
+	var stack []*walkCommit
+	dates := &commitQueue{}
+	put := func(cmt *walkCommit) {
+		if byDate {
+			dates.push(cmt)
+		} else {
+			stack = append(stack, cmt)
+		}
+	}
+	for _, cmt := range commits {
+		if indegree[cmt.Id] == 1 {
+			put(cmt)
+		}
+	}
+	// Reverse the stack, so that the tips come out in the original
+	// order.
+	for i, j := 0, len(stack)-1; i < j; i, j = i+1, j-1 {
+		stack[i], stack[j] = stack[j], stack[i]
+	}
+
+	sorted := make([]*walkCommit, 0, len(commits))
+	for len(stack) > 0 || dates.Len() > 0 {
+		var cmt *walkCommit
+		if byDate {
+			cmt = dates.pop()
+		} else {
+			cmt = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+		}
+		for _, pid := range cmt.Parents {
+			if indegree[pid] == 0 {
+				continue
+			}
+			indegree[pid]--
+			if indegree[pid] == 1 {
+				put(byId[pid])
+			}
+		}
+		indegree[cmt.Id] = 0
+		sorted = append(sorted, cmt)
+	}
+	return sorted
+}
+
+// Returns the entry at path in tree, or the zero TreeEntry if there's
+// nothing there.
+func treeEntryAt(c *Client, tree TreeID, path IndexPath) (TreeEntry, error) {
+	entry := TreeEntry{Sha1(tree), ModeTree}
+	for _, name := range strings.Split(string(path), "/") {
+		if entry.FileMode != ModeTree {
+			return TreeEntry{}, nil
+		}
+		entries, err := TreeID(entry.Sha1).GetAllObjects(c, "", false, false)
+		if err != nil {
+			return TreeEntry{}, err
+		}
+		entry = entries[IndexPath(name)]
+	}
+	return entry, nil
+}
+
+// Returns the entries at each of the paths that the walk is limited to
+// in tree. Paths which don't exist have a zero TreeEntry.
+func (w *revWalker) treePaths(tree TreeID) ([]TreeEntry, error) {
+	if objs, ok := w.pathObjects[tree]; ok {
+		return objs, nil
+	}
+	objs := make([]TreeEntry, len(w.paths))
+	for i, path := range w.paths {
+		entry, err := treeEntryAt(w.c, tree, path)
+		if err != nil {
+			return nil, err
+		}
+		objs[i] = entry
+	}
+	if w.pathObjects == nil {
+		w.pathObjects = make(map[TreeID][]TreeEntry)
+	}
+	w.pathObjects[tree] = objs
+	return objs, nil
+}
+
+// Returns true if the paths that the walk is limited to are the same in
+// both commits.
+func (w *revWalker) sameTrees(a, b *walkCommit) (bool, error) {
+	aobjs, err := w.treePaths(a.Tree)
+	if err != nil {
+		return false, err
+	}
+	bobjs, err := w.treePaths(b.Tree)
+	if err != nil {
+		return false, err
+	}
+	for i := range aobjs {
+		if aobjs[i] != bobjs[i] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Simplifies the history of cmt when the walk is limited to paths, the
+// same way as git's default mode. If cmt is TREESAME to an interesting
+// parent, it's marked as treesame and that parent becomes its only
+// parent, so that the rest of the side branches aren't walked.
+func (w *revWalker) simplify(cmt *walkCommit) error {
+	if len(w.paths) == 0 {
+		return nil
+	}
+	if len(cmt.Parents) == 0 {
+		objs, err := w.treePaths(cmt.Tree)
+		if err != nil {
+			return err
+		}
+		for _, entry := range objs {
+			if entry != (TreeEntry{}) {
+				return nil
+			}
+		}
+		w.flags[cmt.Id] |= treesame
+		return nil
+	}
+
+	changed := false
+	for i, pid := range cmt.Parents {
+		if i > 0 && w.firstParent {
+			break
+		}
+		p, err := w.parse(pid)
+		if err != nil {
+			return err
+		}
+		same, err := w.sameTrees(cmt, p)
+		if err != nil {
+			return err
+		}
+		if !same {
+			changed = true
+			continue
+		}
+		if !w.relevant(pid) {
+			// Even if an uninteresting side branch brought in the
+			// whole change, the other parents are still kept.
+			continue
+		}
+		cmt.Parents = []CommitID{pid}
+		w.flags[cmt.Id] |= treesame
+		return nil
+	}
+	if !changed {
+		w.flags[cmt.Id] |= treesame
+	}
+	return nil
+}
+
+// IsTreeSame returns true if the commit doesn't change any of paths
+// compared to one of its parents, or if it's a root commit which doesn't
+// have any of them. Like git, these commits are left out when history is
+// limited to paths, even when they're named explicitly, such as by show.
+func IsTreeSame(c *Client, cmt CommitID, paths []IndexPath) (bool, error) {
+	w := newRevWalker(c)
+	w.paths = paths
+	wc, err := w.parse(cmt)
+	if err != nil {
+		return false, err
+	}
+	if err := w.simplify(wc); err != nil {
+		return false, err
+	}
+	return w.flags[cmt]&treesame != 0, nil
+}
+
+// Returns true if the commit is relevant when simplifying history,
+// meaning that it's either interesting or one of the excluded revisions.
+func (w *revWalker) relevant(id CommitID) bool {
+	return w.flags[id]&(uninteresting|bottom) != uninteresting
+}
+
+// Returns the number of parents of cmt which are relevant.
+func (w *revWalker) relevantParents(cmt *walkCommit) int {
+	n := 0
+	for _, p := range cmt.Parents {
+		if w.relevant(p) {
+			n++
+		}
+	}
+	return n
+}
+
+// Returns the parents of cmt, rewritten to skip over the commits that
+// were simplified away by a path limited walk. Parents which are
+// rewritten to the same commit are only included once.
+func (w *revWalker) rewriteParents(cmt *walkCommit) ([]CommitID, error) {
+	var parents []CommitID
+	added := make(map[CommitID]bool)
+	for _, pid := range cmt.Parents {
+		for pid != (CommitID{}) && w.flags[pid]&(uninteresting|treesame) == treesame {
+			p, err := w.parse(pid)
+			if err != nil {
+				return nil, err
+			}
+			if len(p.Parents) == 0 {
+				pid = CommitID{}
+				break
+			}
+			// Follow the first relevant parent, if there is one.
+			next := p.Parents[0]
+			if !w.firstParent {
+				for _, pp := range p.Parents {
+					if w.relevant(pp) {
+						next = pp
+						break
+					}
+				}
+			}
+			pid = next
+		}
+		if pid == (CommitID{}) || added[pid] {
+			continue
+		}
+		added[pid] = true
+		parents = append(parents, pid)
+	}
+	return parents, nil
+}
+
+// A commitFilter matches commits against the patterns and other
+// restrictions in a WalkOptions.
+type commitFilter struct {
+	opts                    WalkOptions
+	author, committer, grep []*regexp.Regexp
+}
+
+// Converts a POSIX basic regular expression to the extended syntax used
+// by the regexp package. In a basic regular expression, the characters
+// "?+{|()" only have a special meaning when they're escaped.
+func basicToExtendedRegexp(pattern string) string {
+	var re strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		ch := pattern[i]
+		switch {
+		case ch == '\\' && i+1 < len(pattern):
+			i++
+			if strings.IndexByte("?+{}|()", pattern[i]) >= 0 {
+				re.WriteByte(pattern[i])
+			} else {
+				re.WriteByte('\\')
+				re.WriteByte(pattern[i])
+			}
+		case strings.IndexByte("?+{}|()", ch) >= 0:
+			re.WriteByte('\\')
+			re.WriteByte(ch)
+		default:
+			re.WriteByte(ch)
+		}
+	}
+	return re.String()
+}
+
+func newCommitFilter(opts WalkOptions) (*commitFilter, error) {
+	f := &commitFilter{opts: opts}
+	compile := func(patterns []string) ([]*regexp.Regexp, error) {
+		var res []*regexp.Regexp
+		for _, pattern := range patterns {
+			if !opts.ExtendedRegexp {
+				pattern = basicToExtendedRegexp(pattern)
+			}
+			if opts.IgnoreCase {
+				pattern = "(?i)" + pattern
+			}
+			re, err := regexp.Compile("(?m)" + pattern)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, re)
+		}
+		return res, nil
+	}
+	var err error
+	if f.author, err = compile(opts.Author); err != nil {
+		return nil, err
+	}
+	if f.committer, err = compile(opts.Committer); err != nil {
+		return nil, err
+	}
+	if f.grep, err = compile(opts.Grep); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Returns true if s matches any of the patterns, or all of them if all
+// is set. An empty list of patterns matches everything.
+func matchesPatterns(patterns []*regexp.Regexp, s string, all bool) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, re := range patterns {
+		if re.MatchString(s) != all {
+			return !all
+		}
+	}
+	return all
+}
+
+// Returns true if cmt should be included in the output of a walk.
+func (w *revWalker) include(cmt *walkCommit, f *commitFilter) (bool, error) {
+	opts := f.opts
+	if len(w.paths) > 0 && w.flags[cmt.Id]&treesame != 0 {
+		// Merges which weren't simplified are still needed to show
+		// how history fits together.
+		if !opts.RewriteParents || w.relevantParents(cmt) < 2 {
+			return false, nil
+		}
+	}
+	if !opts.Since.IsZero() && cmt.Date < opts.Since.Unix() {
+		return false, nil
+	}
+	if !opts.Until.IsZero() && cmt.Date > opts.Until.Unix() {
+		return false, nil
+	}
+	if opts.Merges && len(cmt.Parents) < 2 {
+		return false, nil
+	}
+	if opts.NoMerges && len(cmt.Parents) > 1 {
+		return false, nil
+	}
+	if len(f.author) == 0 && len(f.committer) == 0 && len(f.grep) == 0 {
+		return true, nil
+	}
+
+	headers, msg, err := cmt.Id.getHeaders(w.c)
+	if err != nil {
+		return false, err
+	}
+	var author, committer string
+	for _, h := range headers {
+		// Match against the identity without the timestamp.
+		ident := h.Value
+		if gt := strings.LastIndexByte(ident, '>'); gt >= 0 {
+			ident = ident[:gt+1]
+		}
+		switch h.Name {
+		case "author":
+			author = ident
+		case "committer":
+			committer = ident
+		}
+	}
+	return matchesPatterns(f.author, author, false) &&
+		matchesPatterns(f.committer, committer, false) &&
+		matchesPatterns(f.grep, msg, opts.AllMatch), nil
+}
@@ -0,0 +1,131 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestCommitWalker(t *testing.T) {
+	r := newTestRepo(t)
+	defer r.Close()
+	//     B---C
+	//    /     \
+	//   A---D---E---F
+	//        \
+	//         G
+	r.mergeHistory()
+	r.commit("G", 350, "D")
+	commits := r.commits
+
+	tests := []struct {
+		Push, Hide []string
+		Want       string
+	}{
+		{[]string{"F"}, nil, "F E C D B A"},
+		{[]string{"C", "G"}, nil, "G C D B A"},
+		{[]string{"F"}, []string{"D"}, "F E C B"},
+		{[]string{"F"}, []string{"G"}, "F E C B"},
+		{[]string{"G"}, []string{"F"}, "G"},
+		{[]string{"C"}, []string{"F"}, ""},
+	}
+	for i, tc := range tests {
+		walker := NewCommitWalker(r.Client)
+		for _, p := range tc.Push {
+			if err := walker.Push(commits[p]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, h := range tc.Hide {
+			if err := walker.Hide(commits[h]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var got []CommitID
+		for walker.Next() {
+			got = append(got, walker.Commit())
+		}
+		if err := walker.Err(); err != nil {
+			t.Errorf("tc %d: %v", i, err)
+			continue
+		}
+		if r.nameList(got) != tc.Want {
+			t.Errorf("tc %d: got %v want %v", i, r.nameList(got), tc.Want)
+		}
+	}
+
+	ancestors := []struct {
+		Child, Parent string
+		Want          bool
+	}{
+		{"A", "F", true},
+		{"C", "F", true},
+		{"F", "F", true},
+		{"G", "F", false},
+		{"F", "A", false},
+		{"B", "G", false},
+	}
+	for i, tc := range ancestors {
+		if got := commits[tc.Child].IsAncestor(r.Client, commits[tc.Parent]); got != tc.Want {
+			t.Errorf("ancestor tc %d: got %v want %v", i, got, tc.Want)
+		}
+	}
+
+	parents := []struct {
+		A, B string
+		Want string
+	}{
+		{"F", "G", "D"},
+		{"C", "G", "A"},
+		{"E", "C", "C"},
+	}
+	for i, tc := range parents {
+		got, err := NearestCommonParent(r.Client, commits[tc.A], commits[tc.B])
+		if err != nil {
+			t.Errorf("parent tc %d: %v", i, err)
+			continue
+		}
+		if r.names[got] != tc.Want {
+			t.Errorf("parent tc %d: got %v want %v", i, r.names[got], tc.Want)
+		}
+	}
+}
+
+func TestIsTreeSame(t *testing.T) {
+	r := newTestRepo(t)
+	defer r.Close()
+	r.setFiles(map[string]string{"f": "base\n"})
+	r.commit("base", 100)
+	r.setFiles(map[string]string{"f": "base\n", "g": "g\n"})
+	r.commit("g", 200, "base")
+	r.setFiles(map[string]string{"f": "side\n"})
+	r.commit("side", 300, "base")
+	// Takes f from side, so it's the same as one of its parents.
+	r.setFiles(map[string]string{"f": "side\n", "g": "g\n"})
+	r.commit("merge", 400, "g", "side")
+	// Changes f compared to both of its parents.
+	r.setFiles(map[string]string{"f": "evil\n", "g": "g\n"})
+	r.commit("evil", 500, "g", "side")
+
+	tests := []struct {
+		Commit string
+		Paths  []IndexPath
+		Want   bool
+	}{
+		{"base", []IndexPath{"f"}, false},
+		{"base", []IndexPath{"g"}, true},
+		{"g", []IndexPath{"f"}, true},
+		{"g", []IndexPath{"f", "g"}, false},
+		{"merge", []IndexPath{"f"}, true},
+		{"merge", []IndexPath{"g"}, true},
+		{"evil", []IndexPath{"f"}, false},
+	}
+	for i, tc := range tests {
+		got, err := IsTreeSame(r.Client, r.commits[tc.Commit], tc.Paths)
+		if err != nil {
+			t.Errorf("tc %d: %v", i, err)
+			continue
+		}
+		if got != tc.Want {
+			t.Errorf("tc %d: %v %v: got %v want %v", i, tc.Commit, tc.Paths, got, tc.Want)
+		}
+	}
+}
@@ -2,13 +2,13 @@ package git
 
 import (
 	"bytes"
+	"compress/zlib"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"strings"
 
-	"github.com/driusan/dgit/zlib"
 	libgit "github.com/driusan/git"
 )
 
@@ -115,63 +115,109 @@ func (id Sha1) Type(c *Client) string {
 	return obj.GetType()
 }
 
+// Returns true if child is an ancestor of parent, or the same commit.
 func (child CommitID) IsAncestor(c *Client, parent Commitish) bool {
 	p, err := parent.CommitID(c)
 	if err != nil {
 		return false
 	}
-	ancestors := p.Ancestors(c)
-	for _, c := range ancestors {
-		if c == child {
-			return true
-		}
-	}
-	return false
+	is, err := newRevWalker(c).isAncestor(child, p)
+	return err == nil && is
 }
 
+// Returns the commit and all of its ancestors, from newest to oldest by
+// commit date.
 func (s CommitID) Ancestors(c *Client) (commits []CommitID) {
-	// TODO: Replace this with Parent(n) which returns the nth parent,
-	// then improve the efficiency of everywhere that uses this. For now
-	// we still depend on libgit. :(
-	repo, err := libgit.OpenRepository(c.GitDir.String())
-	if err != nil {
+	walker := NewCommitWalker(c)
+	if err := walker.Push(s); err != nil {
 		return nil
 	}
+	for walker.Next() {
+		commits = append(commits, walker.Commit())
+	}
+	return
+}
 
-	lgCommits, err := repo.CommitsBefore(s.String())
+// Returns the parsed headers and message of the commit.
+func (c CommitID) getHeaders(cl *Client) ([]objectHeader, string, error) {
+	obj, err := cl.GetObject(Sha1(c))
 	if err != nil {
-		return nil
+		return nil, "", err
 	}
-	for e := lgCommits.Front(); e != nil; e = e.Next() {
-		c, ok := e.Value.(*libgit.Commit)
-		if ok {
-			sha, err := Sha1FromString(c.Id.String())
-			if err != nil {
-				continue
-			}
-
-			commits = append(commits, CommitID(sha))
+	if obj.GetType() != "commit" {
+		return nil, "", InvalidCommit
+	}
+	headers, msg := parseObjectHeaders(obj.GetContent())
+	return headers, msg, nil
+}
 
+// Returns the parents of the commit, in the order that they're stored.
+func (c CommitID) Parents(cl *Client) ([]CommitID, error) {
+	headers, _, err := c.getHeaders(cl)
+	if err != nil {
+		return nil, err
+	}
+	var parents []CommitID
+	for _, h := range headers {
+		if h.Name != "parent" {
+			continue
 		}
+		p, err := CommitIDFromString(h.Value)
+		if err != nil {
+			return nil, err
+		}
+		parents = append(parents, p)
 	}
-	return
+	return parents, nil
 }
 
+// Returns the author of the commit, including the time that it was
+// authored.
+func (c CommitID) GetAuthor(cl *Client) (Person, error) {
+	headers, _, err := c.getHeaders(cl)
+	if err != nil {
+		return Person{}, err
+	}
+	return parsePerson(getObjectHeader(headers, "author"))
+}
+
+// Returns the committer of the commit, including the time that it was
+// committed.
+func (c CommitID) GetCommitter(cl *Client) (Person, error) {
+	headers, _, err := c.getHeaders(cl)
+	if err != nil {
+		return Person{}, err
+	}
+	return parsePerson(getObjectHeader(headers, "committer"))
+}
+
+// Returns the commit message of the commit.
+func (c CommitID) GetCommitMessage(cl *Client) (string, error) {
+	_, msg, err := c.getHeaders(cl)
+	return msg, err
+}
+
+// Returns the best common ancestor of com and other. If there are multiple
+// best common ancestors, the newest one is returned.
 func NearestCommonParent(c *Client, com, other Commitish) (CommitID, error) {
 	s, err := com.CommitID(c)
 	if err != nil {
 		return CommitID{}, err
 	}
-	ancestors := s.Ancestors(c)
-	for _, commit := range ancestors {
-		// This is a horrible algorithm. TODO: Do something better than O(n^3)
-		if commit.IsAncestor(c, other) {
-			return commit, nil
-		}
+	o, err := other.CommitID(c)
+	if err != nil {
+		return CommitID{}, err
+	}
+	bases, err := newRevWalker(c).mergeBases(s, []CommitID{o})
+	if err != nil {
+		return CommitID{}, err
+	}
+	if len(bases) == 0 {
+		// Nothing in common isn't an error, it just means the
+		// nearest common parent is 0 (the empty commit)
+		return CommitID{}, nil
 	}
-	// Nothing in common isn't an error, it just means the nearest common parent
-	// is 0 (the empty commit)
-	return CommitID{}, nil
+	return bases[0], nil
 }
 
 func (c CommitID) GetAllObjects(cl *Client) ([]Sha1, error) {
@@ -253,6 +299,10 @@ func (t TreeID) GetAllObjects(cl *Client, prefix IndexPath, recurse, excludeself
 				mode = ModeBlob
 			case "100755":
 				mode = ModeExec
+			case "120000":
+				mode = ModeSymlink
+			case "160000":
+				mode = ModeCommit
 			default:
 				panic(fmt.Sprintf("Unsupported mode %v in tree %s", string(perm), t))
 			}
@@ -0,0 +1,246 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ShortlogOptions represents the options for Shortlog and ShortlogFromLog.
+type ShortlogOptions struct {
+	// What commits are grouped by, which may be "author", "committer"
+	// or "trailer:<key>". They're grouped by author if there aren't any.
+	// A commit is only counted once for each person, even if they're
+	// in more than one group.
+	Groups []string
+
+	// Include the email addresses in the idents that commits are
+	// grouped by.
+	Email bool
+
+	// Sort the groups by the number of commits, instead of by ident.
+	Numbered bool
+}
+
+// A ShortlogGroup is the commits by a single person, as found by Shortlog.
+type ShortlogGroup struct {
+	// The person's name, and email if the Email option is set, after
+	// mapping them with the mailmap.
+	Ident string
+
+	// The subjects of the commits, in the reverse of the order that they
+	// were given in, which is oldest first for a log.
+	Subjects []string
+}
+
+// Collects the commits for a shortlog.
+type shortlog struct {
+	opts    ShortlogOptions
+	mailmap *Mailmap
+
+	author, committer bool
+	trailers          []string
+
+	groups map[string]*ShortlogGroup
+}
+
+func newShortlog(c *Client, opts ShortlogOptions) (*shortlog, error) {
+	mailmap, err := ReadMailmap(c)
+	if err != nil {
+		return nil, err
+	}
+	s := &shortlog{opts: opts, mailmap: mailmap, groups: make(map[string]*ShortlogGroup)}
+	for _, group := range opts.Groups {
+		switch {
+		case group == "author":
+			s.author = true
+		case group == "committer":
+			s.committer = true
+		case strings.HasPrefix(group, "trailer:"):
+			s.trailers = append(s.trailers, group[len("trailer:"):])
+		default:
+			return nil, fmt.Errorf("unknown group type: %s", group)
+		}
+	}
+	if len(opts.Groups) == 0 {
+		s.author = true
+	}
+	return s, nil
+}
+
+// Returns the number of different kinds of groups which are used.
+func (s *shortlog) numKinds() int {
+	n := 0
+	for _, set := range []bool{s.author, s.committer, len(s.trailers) > 0} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// Returns the ident to group a commit by p under.
+func (s *shortlog) ident(p Person) string {
+	p = s.mailmap.Map(p)
+	if s.opts.Email {
+		return fmt.Sprintf("%s <%s>", p.Name, p.Email)
+	}
+	return p.Name
+}
+
+// Adds a commit with the given subject to the group for ident.
+func (s *shortlog) add(ident, subject string) {
+	// Like git, the leading "[PATCH]" from patches which were applied
+	// from emails is removed.
+	subject = strings.TrimLeft(subject, " \t\r\n\v\f")
+	if strings.HasPrefix(subject, "[PATCH") {
+		eol := strings.IndexByte(subject, '\n')
+		if eob := strings.IndexByte(subject, ']'); eob >= 0 && (eol < 0 || eob < eol) {
+			subject = subject[eob+1:]
+		}
+	}
+	subject = strings.TrimLeft(subject, " \t\r\v\f")
+	subject = (&commitInfo{message: subject}).subject()
+
+	g := s.groups[ident]
+	if g == nil {
+		g = &ShortlogGroup{Ident: ident}
+		s.groups[ident] = g
+	}
+	g.Subjects = append(g.Subjects, subject)
+}
+
+// Adds a commit to the groups for the people that it's by.
+func (s *shortlog) addCommit(c *Client, cmt CommitID) error {
+	headers, msg, err := cmt.getHeaders(c)
+	if err != nil {
+		return err
+	}
+	info := &commitInfo{id: cmt, headers: headers, message: msg}
+	subject := info.subject()
+	if subject == "" {
+		subject = "<none>"
+	}
+
+	seen := make(map[string]bool)
+	multiple := s.numKinds() > 1
+	for _, field := range []string{"author", "committer"} {
+		if (field == "author" && !s.author) || (field == "committer" && !s.committer) {
+			continue
+		}
+		ident := s.ident(info.person(field))
+		if multiple && seen[ident] {
+			continue
+		}
+		seen[ident] = true
+		s.add(ident, subject)
+	}
+	for _, t := range parseTrailers(msg) {
+		wanted := false
+		for _, key := range s.trailers {
+			wanted = wanted || strings.EqualFold(key, t.key)
+		}
+		if !wanted {
+			continue
+		}
+		// Trailers which aren't identities, such as "Fixes: 123",
+		// are grouped by their value as it is.
+		ident := t.value
+		if p, ok := parseContact(t.value); ok {
+			ident = s.ident(p)
+		}
+		if seen[ident] {
+			continue
+		}
+		seen[ident] = true
+		s.add(ident, subject)
+	}
+	return nil
+}
+
+// Returns the groups sorted by ident, or by the number of commits if the
+// Numbered option is set.
+func (s *shortlog) result() []ShortlogGroup {
+	groups := make([]ShortlogGroup, 0, len(s.groups))
+	for _, g := range s.groups {
+		for i, j := 0, len(g.Subjects)-1; i < j; i, j = i+1, j-1 {
+			g.Subjects[i], g.Subjects[j] = g.Subjects[j], g.Subjects[i]
+		}
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Ident < groups[j].Ident })
+	if s.opts.Numbered {
+		sort.SliceStable(groups, func(i, j int) bool { return len(groups[i].Subjects) > len(groups[j].Subjects) })
+	}
+	return groups
+}
+
+// Shortlog groups commits by the people who wrote or committed them, with
+// their identities mapped by the mailmap, as used for release notes.
+func Shortlog(c *Client, opts ShortlogOptions, commits []CommitID) ([]ShortlogGroup, error) {
+	s, err := newShortlog(c, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, cmt := range commits {
+		if err := s.addCommit(c, cmt); err != nil {
+			return nil, err
+		}
+	}
+	return s.result(), nil
+}
+
+// ShortlogFromLog is like Shortlog, but it reads the commits from the output
+// of log in r. Only the medium, full, fuller and raw formats have the
+// idents that are needed, so only commits in those formats are found.
+// Commits can only be grouped by author or committer.
+func ShortlogFromLog(c *Client, opts ShortlogOptions, r io.Reader) ([]ShortlogGroup, error) {
+	s, err := newShortlog(c, opts)
+	if err != nil {
+		return nil, err
+	}
+	if s.numKinds() > 1 {
+		return nil, fmt.Errorf("using multiple --group options with stdin is not supported")
+	}
+	if len(s.trailers) > 0 {
+		return nil, fmt.Errorf("using --group=trailer with stdin is not supported")
+	}
+	prefixes := []string{"Author: ", "author "}
+	if s.committer {
+		prefixes = []string{"Commit: ", "committer "}
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		var ident string
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(line, prefix) {
+				ident = line[len(prefix):]
+				break
+			}
+		}
+		if ident == "" {
+			continue
+		}
+		// The subject is the first line after the rest of the
+		// headers and the blank lines after them.
+		subject := ""
+		for scanner.Scan() && scanner.Text() != "" {
+		}
+		for scanner.Scan() {
+			if subject = scanner.Text(); subject != "" {
+				break
+			}
+		}
+		if p, ok := parseContact(ident); ok {
+			s.add(s.ident(p), subject)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return s.result(), nil
+}
@@ -0,0 +1,134 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ShowRefOptions represents the options that may be passed to
+// "git show-ref"
+type ShowRefOptions struct {
+	// Include HEAD in the list of refs.
+	IncludeHead bool
+
+	// Limit to branches and/or tags. If neither are set, all refs
+	// are shown.
+	Heads, Tags bool
+
+	// Patterns are full refnames which must exactly match a ref,
+	// rather than being matched against the end of the ref.
+	Verify bool
+
+	// Check that the single pattern passed is a ref that exists,
+	// without printing anything.
+	Exists bool
+}
+
+// Returns true if the pattern matches the ref name in the way that
+// show-ref matches patterns, which is by matching complete path
+// components at the end of the name.
+func showRefMatches(name RefSpec, pattern string) bool {
+	s := name.String()
+	return s == pattern || strings.HasSuffix(s, "/"+pattern)
+}
+
+// ShowRef implements "git show-ref". It returns the refs in c which match
+// any of the patterns (or all refs if there are none.)
+//
+// With opts.Verify, each pattern must be the full name of an existing ref
+// and an error is returned if any of them aren't. With opts.Exists, the
+// single pattern is checked for existence and no refs are returned.
+func ShowRef(c *Client, opts ShowRefOptions, patterns []string) ([]Ref, error) {
+	if opts.Exists {
+		if len(patterns) != 1 {
+			return nil, fmt.Errorf("--exists requires exactly one reference")
+		}
+		if patterns[0] == "HEAD" || strings.HasPrefix(patterns[0], "refs/") {
+			// Symbolic refs exist even if they're dangling, so
+			// check the file before trying to resolve it.
+			f := c.GitDir.File(File(patterns[0]))
+			if fi, err := f.Stat(); err == nil && !fi.IsDir() {
+				return nil, nil
+			}
+			if RefSpec(patterns[0]).Exists(c) {
+				return nil, nil
+			}
+		}
+		return nil, fmt.Errorf("reference does not exist")
+	}
+
+	if opts.Verify {
+		var refs []Ref
+		for _, name := range patterns {
+			ref, err := showRefVerify(c, name)
+			if err != nil {
+				return nil, err
+			}
+			refs = append(refs, ref)
+		}
+		return refs, nil
+	}
+
+	var refs []Ref
+	if opts.IncludeHead {
+		if head, err := c.GetHeadCommit(); err == nil {
+			refs = append(refs, Ref{Name: "HEAD", Value: Sha1(head)})
+		}
+	}
+	all, err := c.GetRefs("refs/")
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range all {
+		if opts.Heads || opts.Tags {
+			if !(opts.Heads && ref.Name.HasPrefix("refs/heads/")) &&
+				!(opts.Tags && ref.Name.HasPrefix("refs/tags/")) {
+				continue
+			}
+		}
+		if len(patterns) > 0 {
+			matched := false
+			for _, p := range patterns {
+				if showRefMatches(ref.Name, p) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// Looks up a ref by its full name for show-ref --verify.
+func showRefVerify(c *Client, name string) (Ref, error) {
+	if name == "HEAD" {
+		head, err := c.GetHeadCommit()
+		if err != nil {
+			return Ref{}, fmt.Errorf("'%s' - not a valid ref", name)
+		}
+		return Ref{Name: "HEAD", Value: Sha1(head)}, nil
+	}
+	if !strings.HasPrefix(name, "refs/") {
+		return Ref{}, fmt.Errorf("'%s' - not a valid ref", name)
+	}
+	val, err := RefSpec(name).Value(c)
+	if err != nil {
+		return Ref{}, fmt.Errorf("'%s' - not a valid ref", name)
+	}
+	if strings.HasPrefix(val, "ref: ") {
+		// It's a symbolic ref, resolve it.
+		val, err = RefSpec(strings.TrimPrefix(val, "ref: ")).Value(c)
+		if err != nil {
+			return Ref{}, fmt.Errorf("'%s' - not a valid ref", name)
+		}
+	}
+	sha, err := Sha1FromString(val)
+	if err != nil {
+		return Ref{}, fmt.Errorf("'%s' - not a valid ref", name)
+	}
+	return Ref{Name: RefSpec(name), Value: sha}, nil
+}
@@ -3,6 +3,8 @@ package git
 import (
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -18,7 +20,9 @@ func (s SymbolicRef) String() string {
 
 func (s SymbolicRef) CommitID(c *Client) (CommitID, error) {
 	rspec, err := SymbolicRefGet(c, SymbolicRefOptions{}, s)
-	if err != nil {
+	if err == DetachedHead {
+		return CommitIDFromString(rspec.String())
+	} else if err != nil {
 		return CommitID{}, err
 	}
 	return rspec.CommitID(c)
@@ -42,6 +46,7 @@ func SymbolicRefGet(c *Client, opts SymbolicRefOptions, symname SymbolicRef) (Re
 	if err != nil {
 		return "", err
 	}
+	value = strings.TrimSpace(value)
 
 	if !strings.HasPrefix(value, "ref: ") {
 		return RefSpec(value), DetachedHead
@@ -57,29 +62,54 @@ func SymbolicRefDelete(c *Client, opts SymbolicRefOptions, symname SymbolicRef)
 	if !file.Exists() {
 		return fmt.Errorf("SymbolicRef %s does not exist.", symname)
 	}
-	return file.Remove()
-
+	if err := file.Remove(); err != nil {
+		return err
+	}
+	c.removeEmptyRefDirs(symname.String())
+	if reflog := c.reflogFile(RefSpec(symname)); reflog.Exists() {
+		if err := reflog.Remove(); err != nil {
+			return err
+		}
+		c.removeEmptyRefDirs("logs/" + symname.String())
+	}
+	return nil
 }
 
 func SymbolicRefUpdate(c *Client, opts SymbolicRefOptions, symname SymbolicRef, refvalue RefSpec, reason string) error {
+	if err := ValidateRefName(symname.String(), CheckRefFormatOptions{AllowOnelevel: true}); err != nil {
+		return err
+	}
 	if !strings.HasPrefix(refvalue.String(), "refs/") {
 		return fmt.Errorf("Refusing to point %s outside of refs/", symname)
 	}
+	if err := ValidateRefName(refvalue.String(), CheckRefFormatOptions{}); err != nil {
+		return err
+	}
 
-	if reason != "" {
-		if reflog := c.GitDir.File(File("logs/" + symname.String())); reflog.Exists() {
-			if err := updateReflog(c, false, reflog, symname, refvalue, reason); err != nil {
+	// There's nothing to log if the new value is an unborn branch.
+	if _, err := refvalue.CommitID(c); reason != "" && err == nil {
+		if reflog := c.reflogFile(RefSpec(symname)); reflog.Exists() || c.shouldLogRef(RefSpec(symname)) {
+			// If it didn't previously point to anything, log
+			// it as being created.
+			var oldvalue Commitish
+			if _, err := symname.CommitID(c); err == nil {
+				oldvalue = symname
+			}
+			if err := updateReflog(c, true, reflog, oldvalue, refvalue, reason); err != nil {
 				return fmt.Errorf("Error updating reflog: %v", err)
 			}
 		}
 	}
 
+	if err := os.MkdirAll(filepath.Dir(c.GitDir.File(File(symname)).String()), 0755); err != nil {
+		return fmt.Errorf("Error creating SymbolicRef: %v", err)
+	}
 	file, err := c.GitDir.Create(File(symname))
 	if err != nil {
 		return fmt.Errorf("Error creating SymbolicRef: %v", err)
 	}
 	defer file.Close()
 
-	fmt.Fprintf(file, "ref: %s", refvalue)
+	fmt.Fprintf(file, "ref: %s\n", refvalue)
 	return nil
 }
@@ -0,0 +1,143 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A testRepo is a temporary repository for tests which need a history to
+// walk. Its commits are named by their message, and have an empty tree
+// unless setFiles has been called.
+type testRepo struct {
+	*Client
+	t    *testing.T
+	tree Sha1
+
+	commits map[string]CommitID
+	names   map[CommitID]string
+}
+
+// Creates an empty repository in a temporary directory. The caller must
+// call Close when it's done with it.
+func newTestRepo(t *testing.T) *testRepo {
+	gitdir, err := ioutil.TempDir("", "gittest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClient(gitdir, "")
+	if err != nil {
+		os.RemoveAll(gitdir)
+		t.Fatal(err)
+	}
+	tree, err := c.WriteObject("tree", nil)
+	if err != nil {
+		os.RemoveAll(gitdir)
+		t.Fatal(err)
+	}
+	return &testRepo{
+		Client:  c,
+		t:       t,
+		tree:    tree,
+		commits: make(map[string]CommitID),
+		names:   make(map[CommitID]string),
+	}
+}
+
+// Removes the repository.
+func (r *testRepo) Close() {
+	os.RemoveAll(r.GitDir.String())
+}
+
+// Creates a commit with the given parents and commit date, named by its
+// message.
+func (r *testRepo) commit(name string, date int, parents ...string) CommitID {
+	content := fmt.Sprintf("tree %s\n", r.tree)
+	for _, p := range parents {
+		content += fmt.Sprintf("parent %s\n", r.commits[p])
+	}
+	content += fmt.Sprintf("author T <t@x> %d +0000\ncommitter T <t@x> %d +0000\n\n%s\n", date, date, name)
+	id, err := r.WriteObject("commit", []byte(content))
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	r.commits[name], r.names[CommitID(id)] = CommitID(id), name
+	return CommitID(id)
+}
+
+// Creates the history
+//
+//	  B---C
+//	 /     \
+//	A---D---E---F
+//
+// where the commit dates increase from left to right, except that D is
+// older than C.
+func (r *testRepo) mergeHistory() {
+	r.commit("A", 100)
+	r.commit("B", 200, "A")
+	r.commit("C", 300, "B")
+	r.commit("D", 250, "A")
+	r.commit("E", 400, "D", "C")
+	r.commit("F", 500, "E")
+}
+
+// Writes a file in the git directory, such as a ref or a reflog, creating
+// any directories that it needs.
+func (r *testRepo) writeFile(name, content string) {
+	path := filepath.Join(r.GitDir.String(), name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		r.t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+// Points the ref name at the commit with the given name, without writing
+// a reflog entry.
+func (r *testRepo) setRef(name, commit string) {
+	r.writeFile(name, r.commits[commit].String()+"\n")
+}
+
+// Writes the files, which are given by their path and content, to the
+// index and makes later commits have a tree containing them. It returns
+// the ids of the blobs by path.
+func (r *testRepo) setFiles(files map[string]string) map[string]Sha1 {
+	idx := NewIndex()
+	blobs := make(map[string]Sha1)
+	for path, content := range files {
+		id, err := r.WriteObject("blob", []byte(content))
+		if err != nil && err != ObjectExists {
+			r.t.Fatal(err)
+		}
+		if err := idx.AddStage(r.Client, IndexPath(path), id, Stage0, 0, 0, uint32(len(content))); err != nil {
+			r.t.Fatal(err)
+		}
+		blobs[path] = id
+	}
+	tree, err := idx.WriteTree(r.Client)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := idx.WriteIndex(&buf); err != nil {
+		r.t.Fatal(err)
+	}
+	r.writeFile("index", buf.String())
+	r.tree = Sha1(tree)
+	return blobs
+}
+
+// Returns the names of the commits, separated by spaces.
+func (r *testRepo) nameList(ids []CommitID) string {
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		names[i] = r.names[id]
+	}
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,111 @@
+package git
+
+import (
+	"strings"
+)
+
+// A trailer is a "Key: value" line at the end of a commit message, such
+// as "Signed-off-by: Name <email>".
+type trailer struct {
+	key, value string
+}
+
+// The prefixes of the trailers that git adds itself. A block of lines
+// with one of them is treated as trailers even if it has other lines.
+var generatedTrailerPrefixes = []string{"Signed-off-by: ", "(cherry picked from commit "}
+
+// Returns the index of the ":" which separates the key of a trailer from
+// its value in line, or -1 if line isn't a trailer. Like git, the key may
+// only have letters, numbers and "-", but may be followed by whitespace.
+func trailerSeparator(line string) int {
+	whitespace := false
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case ch == ':':
+			return i
+		case !whitespace && (ch == '-' || (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')):
+			continue
+		case i > 0 && (ch == ' ' || ch == '\t'):
+			whitespace = true
+			continue
+		}
+		break
+	}
+	return -1
+}
+
+// Returns true if line starts with whitespace, which makes it a
+// continuation of the trailer before it.
+func isContinuation(line string) bool {
+	return line != "" && (line[0] == ' ' || line[0] == '\t')
+}
+
+// Returns the trailers in msg, in the same way as git finds them. They're
+// in the last paragraph, which must either only have trailers, or have
+// one of the trailers that git adds and at least 25% trailers. Lines which
+// start with whitespace continue the trailer before them.
+func parseTrailers(msg string) []trailer {
+	// Like git, the first line is treated as the blank line before the
+	// message, so the title can't be trailers.
+	lines := strings.Split(strings.TrimRight("\n"+msg, " \t\r\n"), "\n")
+
+	start := -1
+	trailers, nonTrailers, continuations := 0, 0, 0
+	recognized := false
+search:
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "#"):
+			nonTrailers += continuations
+			continuations = 0
+			continue
+		case strings.TrimSpace(line) == "":
+			nonTrailers += continuations
+			if (recognized && trailers*3 >= nonTrailers) || (trailers > 0 && nonTrailers == 0) {
+				start = i + 1
+			}
+			break search
+		}
+		for _, prefix := range generatedTrailerPrefixes {
+			if strings.HasPrefix(line, prefix) {
+				trailers++
+				continuations = 0
+				recognized = true
+				continue search
+			}
+		}
+		switch {
+		case trailerSeparator(line) >= 1 && !isContinuation(line):
+			trailers++
+			continuations = 0
+		case isContinuation(line):
+			continuations++
+		default:
+			nonTrailers += 1 + continuations
+			continuations = 0
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+
+	var result []trailer
+	last := -1
+	for _, line := range lines[start:] {
+		if isContinuation(line) && last >= 0 {
+			result[last].value += " " + strings.TrimSpace(line)
+			continue
+		}
+		last = -1
+		if sep := trailerSeparator(line); sep >= 1 {
+			result = append(result, trailer{
+				key:   strings.TrimSpace(line[:sep]),
+				value: strings.TrimSpace(line[sep+1:]),
+			})
+			last = len(result) - 1
+		}
+	}
+	return result
+}
@@ -1,6 +1,7 @@
 package git
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"strings"
@@ -8,14 +9,14 @@ import (
 )
 
 type UpdateRefOptions struct {
-	// Not implemented
 	Delete bool
 
 	NoDeref      bool
 	CreateReflog bool
 	OldValue     Commitish
 
-	// Not implemented
+	// Read a transaction of commands from Stdin, terminated by
+	// NULs instead of newlines if NullTerminate is set.
 	Stdin         io.Reader
 	NullTerminate bool
 }
@@ -31,7 +32,7 @@ func updateReflog(c *Client, create bool, file File, oldvalue, newvalue Commitis
 	}
 
 	now := time.Now()
-	commiter := c.GetAuthor(&now)
+	commiter := c.reflogIdentity(&now)
 
 	var toAppend string
 
@@ -60,93 +61,213 @@ func updateReflog(c *Client, create bool, file File, oldvalue, newvalue Commitis
 // Safely updates ref to point to cmt under the client c, logging reason in the reflog.
 // If opts.OldValue is set, it will return an error if the current value is not OldValue.
 func UpdateRefSpec(c *Client, opts UpdateRefOptions, ref RefSpec, cmt CommitID, reason string) error {
+	opts.NoDeref = true
+	return UpdateRef(c, opts, ref.String(), cmt, reason)
+}
+
+// Handles "git update-ref" command line. If ref is what's passed on the command-line
+// it can be either a symbolic ref, or a refspec. We just use a string, because
+// Go doesn't support sum types.
+//
+// The update is done in a RefTransaction, so the ref is locked while it's
+// being verified and updated.
+func UpdateRef(c *Client, opts UpdateRefOptions, ref string, cmt CommitID, reason string) error {
+	if opts.Stdin != nil {
+		return updateRefStdin(c, opts, reason)
+	}
+
+	var oldval *Sha1
 	if opts.OldValue != nil {
-		curval, err := ref.CommitID(c)
-		if err != nil {
-			return err
-		}
-		oldval, err := opts.OldValue.CommitID(c)
+		old, err := opts.OldValue.CommitID(c)
 		if err != nil {
 			return err
 		}
-		if curval != oldval {
-			return fmt.Errorf("%s is not equal to %s (is %s)", ref, oldval, curval)
-		}
+		oldval = (*Sha1)(&old)
 	}
+
+	t := NewRefTransaction(c)
+	t.CreateReflog = opts.CreateReflog
+	ref = strings.TrimSpace(ref)
+	var err error
 	if opts.Delete {
-		return fmt.Errorf("Delete RefSpec not implemented")
+		err = t.Delete(ref, oldval, opts.NoDeref, reason)
+	} else {
+		err = t.Update(ref, Sha1(cmt), oldval, opts.NoDeref, reason)
 	}
-
-	// The RefSpec Stringer method strips out trailing newlines and junk.
-	filename := File(ref.String())
-	if err := updateReflog(c, opts.CreateReflog, File(c.GitDir)+"/logs/"+filename, opts.OldValue, cmt, reason); err != nil {
+	if err != nil {
 		return err
 	}
+	return t.Commit()
+}
 
-	file, err := c.GitDir.Create(filename)
+// Parses a value passed to update-ref --stdin. The empty string is
+// returned as nil, since it means the value wasn't given.
+func parseUpdateRefValue(c *Client, cmd, name, val string) (*Sha1, error) {
+	if val == "" {
+		return nil, nil
+	}
+	if len(val) == 40 {
+		if sha, err := Sha1FromString(val); err == nil {
+			return &sha, nil
+		}
+	}
+	// Refs can point to any object, so tags aren't peeled.
+	sha, err := RevParseObject(c, &RevParseOptions{}, val)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("%s: invalid <%s>: %s", cmd, name, val)
 	}
-	defer file.Close()
-	fmt.Fprintf(file, "%s\n", cmt)
-	return nil
+	return &sha, nil
 }
 
-// Handles "git update-ref" command line. If ref is what's passed on the command-line
-// it can be either a symbolic ref, or a refspec. We just use a string, because
-// Go doesn't support sum types.
-func UpdateRef(c *Client, opts UpdateRefOptions, ref string, cmt CommitID, reason string) error {
-	if opts.Stdin != nil {
-		return fmt.Errorf("UpdateRef batch mode not implemented")
+// Reads the next command from r for update-ref --stdin. It returns the
+// command name, and the arguments.
+//
+// Without -z, each command is a line with space separated arguments. With
+// -z, the command and the first argument are terminated by a NUL, and
+// the remaining argc arguments are each terminated by a NUL.
+func readUpdateRefCommand(r *bufio.Reader, nullTerminate bool) (string, []string, error) {
+	if !nullTerminate {
+		line, err := r.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", nil, err
+		}
+		fields := strings.Split(strings.TrimSuffix(line, "\n"), " ")
+		return fields[0], fields[1:], nil
 	}
 
-	// It's not a symbolic ref, it's a real ref. Just directly call UpdateRefSpec
-	if strings.HasPrefix(ref, "refs/") {
-		return UpdateRefSpec(c, opts, RefSpec(strings.TrimSpace(ref)), cmt, reason)
+	first, err := r.ReadString(0)
+	if err != nil {
+		if err == io.EOF && first != "" {
+			return "", nil, fmt.Errorf("Unterminated command: %s", first)
+		}
+		return "", nil, err
+	}
+	first = strings.TrimSuffix(first, "\000")
+	var cmd string
+	var args []string
+	if sp := strings.IndexByte(first, ' '); sp >= 0 {
+		cmd, args = first[:sp], []string{first[sp+1:]}
+	} else {
+		cmd = first
 	}
 
-	// It's a symbolic ref. Dereference it, unless --deref
-	if !opts.NoDeref {
-		refspec, err := SymbolicRefGet(c, SymbolicRefOptions{}, SymbolicRef(ref))
+	var argc int
+	switch cmd {
+	case "update":
+		argc = 2
+	case "create", "delete", "verify":
+		argc = 1
+	}
+	for i := 0; i < argc; i++ {
+		arg, err := r.ReadString(0)
 		if err != nil {
+			return "", nil, fmt.Errorf("%s: missing arguments", cmd)
+		}
+		args = append(args, strings.TrimSuffix(arg, "\000"))
+	}
+	return cmd, args, nil
+}
+
+// Implements "git update-ref --stdin". Commands are read from opts.Stdin and
+// queued in a transaction, which is committed when the input ends or when
+// a commit command is read.
+func updateRefStdin(c *Client, opts UpdateRefOptions, reason string) error {
+	r := bufio.NewReader(opts.Stdin)
+	var t *RefTransaction
+	// Whether the transaction was started explicitly with "start", in
+	// which case it needs to be explicitly committed.
+	explicit := false
+	noDeref := opts.NoDeref
+	newTransaction := func() {
+		t = NewRefTransaction(c)
+		t.CreateReflog = opts.CreateReflog
+	}
+	newTransaction()
+
+	for {
+		cmd, args, err := readUpdateRefCommand(r, opts.NullTerminate)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Abort()
 			return err
 		}
-		// This is duplicated from UpdateRefSpec, but we should check
-		// the value before updating the reflog. If we're not doing
-		// anything, we shouldn't update the reflog. (It stays in
-		// UpdateRefSpec because someone else might call it directly.)
-		if opts.OldValue != nil {
-			curval, err := SymbolicRef(ref).CommitID(c)
-			if err != nil {
-				return err
+
+		// Arguments are optional in some commands, so pad them out
+		// to make them easier to handle.
+		for len(args) < 3 {
+			args = append(args, "")
+		}
+		switch cmd {
+		case "update", "create", "delete", "verify":
+			var newval, oldval *Sha1
+			if cmd == "update" || cmd == "create" {
+				if newval, err = parseUpdateRefValue(c, cmd+" "+args[0], "newvalue", args[1]); err == nil && newval == nil {
+					err = fmt.Errorf("%s %s: missing <newvalue>", cmd, args[0])
+				}
+				if err == nil && cmd == "update" {
+					oldval, err = parseUpdateRefValue(c, cmd+" "+args[0], "oldvalue", args[2])
+				}
+			} else {
+				oldval, err = parseUpdateRefValue(c, cmd+" "+args[0], "oldvalue", args[1])
+			}
+			if err == nil {
+				switch cmd {
+				case "update":
+					err = t.Update(args[0], *newval, oldval, noDeref, reason)
+				case "create":
+					err = t.Create(args[0], *newval, noDeref, reason)
+				case "delete":
+					err = t.Delete(args[0], oldval, noDeref, reason)
+				case "verify":
+					err = t.Verify(args[0], oldval, noDeref)
+				}
 			}
-			oldval, err := opts.OldValue.CommitID(c)
-			if err != nil {
-				return err
+			// The no-deref option only applies to the command
+			// following it.
+			noDeref = opts.NoDeref
+		case "option":
+			if args[0] != "no-deref" {
+				err = fmt.Errorf("option unknown: %s", args[0])
 			}
-			if curval != oldval {
-				return fmt.Errorf("%s is not equal to %s (is %s)", ref, oldval, curval)
+			noDeref = true
+		case "start":
+			if explicit || len(t.updates) > 0 {
+				err = fmt.Errorf("start: cannot be called with an open transaction")
+			} else {
+				explicit = true
+				fmt.Println("start: ok")
 			}
+		case "prepare":
+			if err = t.Prepare(); err == nil {
+				fmt.Println("prepare: ok")
+			}
+		case "commit":
+			if err = t.Commit(); err == nil {
+				fmt.Println("commit: ok")
+				explicit = false
+				newTransaction()
+			}
+		case "abort":
+			t.Abort()
+			fmt.Println("abort: ok")
+			explicit = false
+			newTransaction()
+		case "":
+			// Blank lines are allowed, but don't do anything.
+		default:
+			err = fmt.Errorf("unknown command: %s", cmd)
 		}
-
-		// Update the symbolic-ref reflog before doing anything. If it can't
-		// be updated, it's a fatal error and we can't update the refspec.
-		if err := updateReflog(c, true, File(c.GitDir)+"/logs/"+File(ref), opts.OldValue, cmt, reason); err != nil {
+		if err != nil {
+			t.Abort()
 			return err
 		}
-		return UpdateRefSpec(c, opts, refspec, cmt, reason)
-	}
-
-	// NoDeref was specified.
-	if err := updateReflog(c, true, File(c.GitDir)+"/logs/"+File(ref), opts.OldValue, cmt, reason); err != nil {
-		return err
 	}
 
-	f, err := c.GitDir.Create(File(ref))
-	if err != nil {
-		return err
+	if explicit {
+		// A transaction was started but never committed, so don't
+		// apply it.
+		return t.Abort()
 	}
-	defer f.Close()
-	fmt.Fprintf(f, "%s", cmt)
-	return nil
+	return t.Commit()
 }
@@ -0,0 +1,67 @@
+package git
+
+import (
+	"bufio"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadUpdateRefCommand(t *testing.T) {
+	type command struct {
+		Cmd  string
+		Args []string
+	}
+	tests := []struct {
+		Input         string
+		NullTerminate bool
+		Want          []command
+	}{
+		{
+			"start\nupdate refs/heads/a 1234 5678\ncreate refs/heads/b 1234\ndelete refs/heads/c\ncommit\n",
+			false,
+			[]command{
+				{"start", []string{}},
+				{"update", []string{"refs/heads/a", "1234", "5678"}},
+				{"create", []string{"refs/heads/b", "1234"}},
+				{"delete", []string{"refs/heads/c"}},
+				{"commit", []string{}},
+			},
+		},
+		{
+			// The last line doesn't need a terminating newline.
+			"option no-deref\nverify HEAD",
+			false,
+			[]command{
+				{"option", []string{"no-deref"}},
+				{"verify", []string{"HEAD"}},
+			},
+		},
+		{
+			"update refs/heads/a\0001234\000\000delete refs/heads/c\000\000prepare\000",
+			true,
+			[]command{
+				{"update", []string{"refs/heads/a", "1234", ""}},
+				{"delete", []string{"refs/heads/c", ""}},
+				{"prepare", nil},
+			},
+		},
+	}
+	for i, tc := range tests {
+		r := bufio.NewReader(strings.NewReader(tc.Input))
+		var got []command
+		for {
+			cmd, args, err := readUpdateRefCommand(r, tc.NullTerminate)
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("tc %d: %v", i, err)
+			}
+			got = append(got, command{cmd, args})
+		}
+		if !reflect.DeepEqual(got, tc.Want) {
+			t.Errorf("tc %d: got %v want %v", i, got, tc.Want)
+		}
+	}
+}
@@ -11,10 +11,13 @@ import (
 
 var InvalidArgument error = errors.New("Invalid argument to function")
 
-func requiresGitDir(cmd string) bool {
+func requiresGitDir(cmd string, args []string) bool {
 	switch cmd {
-	case "init", "clone":
+	case "init", "clone", "check-ref-format":
 		return false
+	case "rev-parse":
+		// The shell helper modes of rev-parse work anywhere.
+		return len(args) == 0 || (args[0] != "--parseopt" && args[0] != "--sq-quote")
 	default:
 		return true
 	}
@@ -46,11 +49,11 @@ func main() {
 	subcommand = args[0]
 	args = args[1:]
 
-	if err != nil && requiresGitDir(subcommand) {
+	if err != nil && requiresGitDir(subcommand, args) {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(3)
 	}
-	if c != nil && c.GitDir == "" && requiresGitDir(subcommand) {
+	if c != nil && c.GitDir == "" && requiresGitDir(subcommand, args) {
 		fmt.Fprintf(os.Stderr, "Could not find .git directory\n", err)
 		os.Exit(4)
 	}
@@ -59,7 +62,10 @@ func main() {
 	case "init":
 		cmd.Init(c, args)
 	case "branch":
-		cmd.Branch(c, args)
+		if err := cmd.Branch(c, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(4)
+		}
 	case "checkout":
 		if err := cmd.Checkout(c, args); err != nil {
 			fmt.Fprintf(os.Stderr, "%v\n", err)
@@ -99,8 +105,73 @@ func main() {
 			fmt.Fprintf(os.Stderr, "%v\n", err)
 			os.Exit(4)
 		}
+	case "for-each-ref":
+		if err := cmd.ForEachRef(c, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(4)
+		}
+	case "show-ref":
+		switch err := cmd.ShowRef(c, args); err {
+		case nil:
+		case cmd.NoMatchingRefs:
+			os.Exit(1)
+		default:
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+	case "check-ref-format":
+		switch err := cmd.CheckRefFormat(c, args); err {
+		case nil:
+		case cmd.InvalidRefFormat:
+			os.Exit(1)
+		default:
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(4)
+		}
+	case "reflog":
+		switch err := cmd.Reflog(c, args); err {
+		case nil:
+		case cmd.NoReflog:
+			os.Exit(1)
+		default:
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(4)
+		}
+	case "remote":
+		if err := cmd.Remote(c, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(4)
+		}
+	case "ls-remote":
+		if err := cmd.LsRemote(c, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(4)
+		}
+	case "pack-refs":
+		if err := cmd.PackRefs(c, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(4)
+		}
+	case "shortlog":
+		if err := cmd.Shortlog(c, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(4)
+		}
+	case "check-mailmap":
+		if err := cmd.CheckMailmap(c, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(4)
+		}
+	case "show":
+		if err := cmd.Show(c, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(4)
+		}
 	case "log":
-		cmd.Log(c, args)
+		if err := cmd.Log(c, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(4)
+		}
 	case "symbolic-ref":
 		val, err := cmd.SymbolicRef(c, args)
 		if err != nil {
@@ -117,7 +188,10 @@ func main() {
 	case "config":
 		cmd.Config(c, args)
 	case "fetch":
-		cmd.Fetch(c, args)
+		if err := cmd.Fetch(c, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
 	case "reset":
 		cmd.Reset(c, args)
 	case "merge-file":
@@ -131,33 +205,42 @@ func main() {
 			os.Exit(2)
 		}
 	case "merge-base":
-		switch c, err := cmd.MergeBase(c, args); err {
-		case cmd.Ancestor:
+		switch err := cmd.MergeBase(c, args); err {
+		case nil, cmd.Ancestor:
 			os.Exit(0)
-		case cmd.NonAncestor:
+		case cmd.NonAncestor, cmd.NoMergeBase:
 			os.Exit(1)
 		default:
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "%v\n", err)
-				os.Exit(2)
-			}
-			fmt.Printf("%v\n", c)
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
 		}
 	case "rev-parse":
-		commits, err := cmd.RevParse(c, args)
-		if err != nil {
+		switch err := cmd.RevParse(c, args); err {
+		case nil:
+		case cmd.VerifyFailed:
+			os.Exit(1)
+		case cmd.ParseOptFailed:
+			os.Exit(129)
+		default:
 			fmt.Fprintf(os.Stderr, "%v\n", err)
 			os.Exit(4)
 		}
-		for _, sha := range commits {
-			if sha.Excluded {
-				fmt.Print("^")
-			}
-			fmt.Println(sha.Id.String())
-		}
 
 	case "rev-list":
-		cmd.RevList(c, args)
+		if _, err := cmd.RevList(c, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(4)
+		}
+	case "describe":
+		if err := cmd.Describe(c, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(4)
+		}
+	case "name-rev":
+		if err := cmd.NameRev(c, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(4)
+		}
 	case "hash-object":
 		cmd.HashObject(c, args)
 	case "status":